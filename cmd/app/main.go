@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
+	"log"
 	"time"
+	_ "time/tzdata" // user time zones work without zoneinfo on the host
 
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/skaisanlahti/try-go-htmx/internal/client/caldav"
+	"github.com/skaisanlahti/try-go-htmx/internal/client/headless"
 	"github.com/skaisanlahti/try-go-htmx/internal/client/htmx"
 	"github.com/skaisanlahti/try-go-htmx/internal/platform"
 	"github.com/skaisanlahti/try-go-htmx/internal/security"
@@ -37,13 +43,75 @@ func main() {
 		Duration:   time.Duration(settings.Session.SessionDurationMin * float64(time.Minute)),
 	}
 
-	security := security.NewSecurityService(database, passwordOptions, sessionOptions)
-	todo := todo.NewTodoService(database)
+	resetOptions := security.ResetOptions{
+		LinkUrl:  settings.Reset.LinkUrl,
+		Duration: time.Duration(settings.Reset.TokenDurationMin * float64(time.Minute)),
+	}
+
+	encryptionKey, err := base64.StdEncoding.DecodeString(settings.TwoFactor.EncryptionKey)
+	if err != nil {
+		log.Fatalf("Invalid two-factor encryption key: %v", err)
+	}
+
+	twoFactorOptions := security.TwoFactorOptions{
+		Issuer:          settings.TwoFactor.Issuer,
+		EncryptionKey:   encryptionKey,
+		PendingDuration: time.Duration(settings.TwoFactor.PendingDurationMin * float64(time.Minute)),
+	}
+
+	var oidcOptions []security.OidcProviderOptions
+	for _, provider := range settings.Oidc.Providers {
+		oidcOptions = append(oidcOptions, security.OidcProviderOptions{
+			Name:         provider.Name,
+			DisplayName:  provider.DisplayName,
+			Issuer:       provider.Issuer,
+			ClientId:     provider.ClientId,
+			ClientSecret: provider.ClientSecret,
+			RedirectUrl:  provider.RedirectUrl,
+			Scopes:       provider.Scopes,
+		})
+	}
+
+	mailer := platform.NewMailer(platform.MailOptions{
+		Mode:     settings.Mail.Mode,
+		From:     settings.Mail.From,
+		Host:     settings.Mail.Host,
+		Port:     settings.Mail.Port,
+		Username: settings.Mail.Username,
+		Password: settings.Mail.Password,
+		File:     settings.Mail.File,
+	})
+
+	security := security.NewSecurityService(
+		database,
+		passwordOptions,
+		sessionOptions,
+		resetOptions,
+		twoFactorOptions,
+		oidcOptions,
+		settings.Admin.BootstrapUsername,
+		mailer,
+	)
+
+	security.BootstrapAdmin()
+	todoEvents := todo.NewEventHub(database)
+	todo := todo.NewTodoService(database, todoEvents, todo.TodoOptions{
+		MaxSubtaskDepth: settings.Todo.MaxSubtaskDepth,
+		CompleteParents: settings.Todo.CompleteParents,
+		TrashRetention:  time.Duration(settings.Todo.TrashRetentionDays) * 24 * time.Hour,
+	})
 
 	// clients
 	server := platform.NewServer(settings.Address, database)
 	htmx.NewClient(security, todo, server.Router)
+	headless.NewClient(security, todo, server.Router)
+	caldav.NewClient(security, todo, server.Router)
 
-	// start
+	// start, open event streams are ended on shutdown so the server doesn't wait for them
+	purging, stopPurging := context.WithCancel(context.Background())
+	server.RegisterOnShutdown(todoEvents.Close)
+	server.RegisterOnShutdown(stopPurging)
+	go todoEvents.Run()
+	go todo.RunTrashPurge(purging)
 	server.Run()
 }
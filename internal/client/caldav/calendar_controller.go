@@ -0,0 +1,607 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/todo"
+)
+
+// Every user sees their own principal and lists under the same paths, the user is known from the
+// credentials of the request.
+const (
+	rootPath      = "/caldav/"
+	principalPath = "/caldav/principal/"
+	listsPath     = "/caldav/lists/"
+)
+
+// syncTokenPrefix makes the revisions of the lists into URIs, which sync tokens have to be.
+const syncTokenPrefix = "http://try-go-htmx/ns/sync/"
+
+// maxBodySize is the largest request body read, in bytes.
+const maxBodySize = 1 << 20
+
+const calendarContentType = "text/calendar; charset=utf-8"
+
+var (
+	ErrListIdNotNumber  = errors.New("List id not a number.")
+	ErrPreconditionFail = errors.New("The todo has changed since it was read.")
+)
+
+func listPath(listId int) string {
+	return fmt.Sprintf("%s%d/", listsPath, listId)
+}
+
+func todoPath(listId int, resourceName string) string {
+	return listPath(listId) + url.PathEscape(resourceName)
+}
+
+func formatSyncToken(revision int64) string {
+	return syncTokenPrefix + strconv.FormatInt(revision, 10)
+}
+
+// todoEtag changes with every revision of the todo.
+func todoEtag(synced entity.SyncedTodo) string {
+	return `"` + strconv.FormatInt(synced.Revision, 10) + `"`
+}
+
+// calendarController serves the lists of the user as task calendars and their todos as VTODO
+// resources. Every change goes through the todo service, so it's checked like in the app.
+type calendarController struct {
+	todoService *todo.TodoService
+}
+
+func newCalendarController(todo *todo.TodoService) *calendarController {
+	return &calendarController{todo}
+}
+
+// options tells clients what the server supports, without asking for credentials.
+func (this *calendarController) options(response http.ResponseWriter, request *http.Request) {
+	response.Header().Set("DAV", "1, 3, calendar-access")
+	response.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+	response.WriteHeader(http.StatusOK)
+}
+
+// wellKnown points clients looking for the server to the root.
+func (this *calendarController) wellKnown(response http.ResponseWriter, request *http.Request) {
+	http.Redirect(response, request, rootPath, http.StatusMovedPermanently)
+}
+
+// readDavRequest reads the body of a PROPFIND or REPORT request.
+func readDavRequest(response http.ResponseWriter, request *http.Request) (davRequest, bool) {
+	davRequest, err := parseDavRequest(http.MaxBytesReader(response, request.Body, maxBodySize))
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return davRequest, false
+	}
+
+	return davRequest, true
+}
+
+// includesChildren reads the Depth header. Only the resource itself is listed with depth 0,
+// its children too otherwise.
+func includesChildren(request *http.Request) bool {
+	return request.Header.Get("Depth") != "0"
+}
+
+func principalProperties(user entity.User) []davProperty {
+	return []davProperty{
+		hrefProperty(davName("current-user-principal"), principalPath),
+		hrefProperty(davName("principal-URL"), principalPath),
+		hrefProperty(caldavName("calendar-home-set"), listsPath),
+	}
+}
+
+func rootResource(user entity.User) davResource {
+	return davResource{
+		Href: rootPath,
+		Properties: append(principalProperties(user),
+			davProperty{davName("resourcetype"), "<D:collection/>"},
+			textProperty(davName("displayname"), "try-go-htmx"),
+		),
+	}
+}
+
+func principalResource(user entity.User) davResource {
+	return davResource{
+		Href: principalPath,
+		Properties: append(principalProperties(user),
+			davProperty{davName("resourcetype"), "<D:collection/><D:principal/>"},
+			textProperty(davName("displayname"), user.Name),
+		),
+	}
+}
+
+func listsResource(user entity.User) davResource {
+	return davResource{
+		Href: listsPath,
+		Properties: append(principalProperties(user),
+			davProperty{davName("resourcetype"), "<D:collection/>"},
+			textProperty(davName("displayname"), "Todo lists"),
+		),
+	}
+}
+
+// listResource is a list as a calendar of todos. Viewers only get the read privilege.
+func listResource(user entity.User, list todo.SyncList) davResource {
+	privileges := "<D:privilege><D:read/></D:privilege><D:privilege><D:read-current-user-privilege-set/></D:privilege>"
+	if list.CanEdit() {
+		privileges += "<D:privilege><D:write/></D:privilege><D:privilege><D:write-content/></D:privilege>" +
+			"<D:privilege><D:bind/></D:privilege><D:privilege><D:unbind/></D:privilege>"
+	}
+
+	token := formatSyncToken(list.Revision)
+	return davResource{
+		Href: listPath(list.Id),
+		Properties: append(principalProperties(user),
+			davProperty{davName("resourcetype"), "<D:collection/><C:calendar/>"},
+			textProperty(davName("displayname"), list.Name),
+			davProperty{caldavName("supported-calendar-component-set"), `<C:comp name="VTODO"/>`},
+			davProperty{davName("supported-report-set"), "<D:supported-report><D:report><C:calendar-query/></D:report></D:supported-report>" +
+				"<D:supported-report><D:report><C:calendar-multiget/></D:report></D:supported-report>" +
+				"<D:supported-report><D:report><D:sync-collection/></D:report></D:supported-report>"},
+			davProperty{davName("current-user-privilege-set"), privileges},
+			textProperty(davName("sync-token"), token),
+			textProperty(xml.Name{Space: calendarServerNamespace, Local: "getctag"}, token),
+		),
+	}
+}
+
+// todoResource is a todo as an iCalendar file of its own. The calendar data is only sent when
+// it's asked for.
+func todoResource(user entity.User, listId int, synced entity.SyncedTodo) (davResource, error) {
+	var data bytes.Buffer
+	if err := encodeTodo(&data, user, synced); err != nil {
+		return davResource{}, err
+	}
+
+	return davResource{
+		Href: todoPath(listId, synced.ResourceName),
+		Properties: []davProperty{
+			{davName("resourcetype"), ""},
+			textProperty(davName("getetag"), todoEtag(synced)),
+			textProperty(davName("getcontenttype"), calendarContentType+"; component=VTODO"),
+		},
+		Extra: []davProperty{
+			textProperty(caldavName("calendar-data"), data.String()),
+		},
+	}, nil
+}
+
+func encodeTodo(data *bytes.Buffer, user entity.User, synced entity.SyncedTodo) error {
+	return todo.EncodeSyncedTodo(data, synced, user.Location(), time.Now())
+}
+
+func extractListId(request *http.Request) (int, error) {
+	listId, err := strconv.Atoi(request.PathValue("listId"))
+	if err != nil {
+		return 0, ErrListIdNotNumber
+	}
+
+	return listId, nil
+}
+
+func (this *calendarController) propfindRoot(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	davRequest, ok := readDavRequest(response, request)
+	if !ok {
+		return
+	}
+
+	responses := []davResponse{rootResource(user).respond(davRequest)}
+	if includesChildren(request) {
+		responses = append(responses, principalResource(user).respond(davRequest), listsResource(user).respond(davRequest))
+	}
+
+	writeMultistatus(response, responses, "")
+}
+
+func (this *calendarController) propfindPrincipal(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	davRequest, ok := readDavRequest(response, request)
+	if !ok {
+		return
+	}
+
+	writeMultistatus(response, []davResponse{principalResource(user).respond(davRequest)}, "")
+}
+
+// propfindLists lists the lists shared with the user as calendars.
+func (this *calendarController) propfindLists(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	davRequest, ok := readDavRequest(response, request)
+	if !ok {
+		return
+	}
+
+	responses := []davResponse{listsResource(user).respond(davRequest)}
+	if includesChildren(request) {
+		lists, err := this.todoService.FindSyncLists(user)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		for _, list := range lists {
+			responses = append(responses, listResource(user, list).respond(davRequest))
+		}
+	}
+
+	writeMultistatus(response, responses, "")
+}
+
+// propfindList describes a list and with depth 1 its todos.
+func (this *calendarController) propfindList(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	davRequest, ok := readDavRequest(response, request)
+	if !ok {
+		return
+	}
+
+	list, err := this.todoService.FindSyncList(user, listId)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	responses := []davResponse{listResource(user, list).respond(davRequest)}
+	if includesChildren(request) {
+		todos, err := this.todoService.FindSyncedTodos(user, listId)
+		if err != nil {
+			http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+			return
+		}
+
+		for _, synced := range todos {
+			resource, err := todoResource(user, listId, synced)
+			if err != nil {
+				http.Error(response, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			responses = append(responses, resource.respond(davRequest))
+		}
+	}
+
+	writeMultistatus(response, responses, "")
+}
+
+func (this *calendarController) propfindTodo(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	davRequest, ok := readDavRequest(response, request)
+	if !ok {
+		return
+	}
+
+	synced, err := this.todoService.FindSyncedTodo(user, listId, request.PathValue("name"))
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	resource, err := todoResource(user, listId, synced)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeMultistatus(response, []davResponse{resource.respond(davRequest)}, "")
+}
+
+// report answers the calendar queries, multigets and sync reports of a list.
+func (this *calendarController) report(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	davRequest, ok := readDavRequest(response, request)
+	if !ok {
+		return
+	}
+
+	switch davRequest.Kind {
+	case caldavName("calendar-query"):
+		this.calendarQuery(response, user, listId, davRequest)
+	case caldavName("calendar-multiget"):
+		this.calendarMultiget(response, user, listId, davRequest)
+	case davName("sync-collection"):
+		this.syncCollection(response, user, listId, davRequest)
+	default:
+		writeDavError(response, http.StatusForbidden, davName("supported-report"))
+	}
+}
+
+// calendarQuery answers with every todo of the list. The lists only hold todos, so a query for
+// any other component finds nothing; other filters are left for the client to apply.
+func (this *calendarController) calendarQuery(response http.ResponseWriter, user entity.User, listId int, davRequest davRequest) {
+	todos, err := this.todoService.FindSyncedTodos(user, listId)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	for _, component := range davRequest.Components {
+		if component != "VCALENDAR" && component != "VTODO" {
+			todos = nil
+		}
+	}
+
+	responses := []davResponse{}
+	for _, synced := range todos {
+		resource, err := todoResource(user, listId, synced)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responses = append(responses, resource.respond(davRequest))
+	}
+
+	writeMultistatus(response, responses, "")
+}
+
+// calendarMultiget answers with the todos of the hrefs, the ones the list doesn't have as not
+// found.
+func (this *calendarController) calendarMultiget(response http.ResponseWriter, user entity.User, listId int, davRequest davRequest) {
+	responses := []davResponse{}
+	for _, href := range davRequest.Hrefs {
+		name, found := strings.CutPrefix(href, listPath(listId))
+		if found {
+			name, _ = url.PathUnescape(name)
+		}
+
+		synced, err := this.todoService.FindSyncedTodo(user, listId, name)
+		if !found || errors.Is(err, todo.ErrTodoNotFound) {
+			responses = append(responses, davResponse{Href: href, Status: http.StatusNotFound})
+			continue
+		}
+
+		if err != nil {
+			http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+			return
+		}
+
+		resource, err := todoResource(user, listId, synced)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responses = append(responses, resource.respond(davRequest))
+	}
+
+	writeMultistatus(response, responses, "")
+}
+
+// syncCollection answers with the todos changed and removed since the sync token, or with every
+// todo of the list when there's no token yet.
+func (this *calendarController) syncCollection(response http.ResponseWriter, user entity.User, listId int, davRequest davRequest) {
+	var revision int64
+	if davRequest.SyncToken != "" {
+		number, found := strings.CutPrefix(davRequest.SyncToken, syncTokenPrefix)
+		parsed, err := strconv.ParseInt(number, 10, 64)
+		if !found || err != nil {
+			writeDavError(response, http.StatusForbidden, davName("valid-sync-token"))
+			return
+		}
+
+		revision = parsed
+	}
+
+	changed, removed, revision, err := this.todoService.FindSyncChanges(user, listId, revision)
+	if errors.Is(err, todo.ErrSyncTokenInvalid) {
+		writeDavError(response, http.StatusForbidden, davName("valid-sync-token"))
+		return
+	}
+
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	responses := []davResponse{}
+	for _, synced := range changed {
+		resource, err := todoResource(user, listId, synced)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		responses = append(responses, resource.respond(davRequest))
+	}
+
+	// a todo trashed and purged since is listed once
+	slices.Sort(removed)
+	for _, name := range slices.Compact(removed) {
+		responses = append(responses, davResponse{Href: todoPath(listId, name), Status: http.StatusNotFound})
+	}
+
+	writeMultistatus(response, responses, formatSyncToken(revision))
+}
+
+func (this *calendarController) getTodo(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	synced, err := this.todoService.FindSyncedTodo(user, listId, request.PathValue("name"))
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	var data bytes.Buffer
+	if err = encodeTodo(&data, user, synced); err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response.Header().Set("Content-Type", calendarContentType)
+	response.Header().Set("ETag", todoEtag(synced))
+	if _, err = data.WriteTo(response); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// checkPreconditions compares the If-Match and If-None-Match headers to the todo, which doesn't
+// exist yet when found isn't set. Clients use them to not overwrite changes they haven't seen.
+func checkPreconditions(request *http.Request, synced entity.SyncedTodo, found bool) error {
+	ifMatch := request.Header.Get("If-Match")
+	if ifMatch != "" && (!found || (ifMatch != "*" && ifMatch != todoEtag(synced))) {
+		return ErrPreconditionFail
+	}
+
+	ifNoneMatch := request.Header.Get("If-None-Match")
+	if ifNoneMatch != "" && found && (ifNoneMatch == "*" || ifNoneMatch == todoEtag(synced)) {
+		return ErrPreconditionFail
+	}
+
+	return nil
+}
+
+// putTodo adds or replaces a todo. The preconditions are checked while the todo is locked for the
+// save. The todo is stored the way the app keeps todos, so no ETag is sent back and the client
+// reads the todo again.
+func (this *calendarController) putTodo(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	incoming, err := todo.DecodeSyncedTodo(http.MaxBytesReader(response, request.Body, maxBodySize), user.Location())
+	if err != nil {
+		writeDavError(response, http.StatusForbidden, caldavName("valid-calendar-data"))
+		return
+	}
+
+	check := func(existing entity.SyncedTodo, found bool) error {
+		return checkPreconditions(request, existing, found)
+	}
+
+	_, created, err := this.todoService.SaveSyncedTodo(user, listId, request.PathValue("name"), incoming, check)
+	if errors.Is(err, ErrPreconditionFail) {
+		http.Error(response, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	if errors.Is(err, todo.ErrUidConflict) {
+		writeDavError(response, http.StatusForbidden, caldavName("no-uid-conflict"))
+		return
+	}
+
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusBadRequest))
+		return
+	}
+
+	if created {
+		response.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
+
+// deleteTodo moves a todo to the trash with its subtasks.
+func (this *calendarController) deleteTodo(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	name := request.PathValue("name")
+	existing, err := this.todoService.FindSyncedTodo(user, listId, name)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	if err = checkPreconditions(request, existing, true); err != nil {
+		http.Error(response, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+
+	if err = this.todoService.RemoveSyncedTodo(user, listId, name); err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,33 @@
+package caldav
+
+import (
+	"net/http"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/platform"
+	"github.com/skaisanlahti/try-go-htmx/internal/security"
+	"github.com/skaisanlahti/try-go-htmx/internal/todo"
+)
+
+// NewClient registers a CalDAV server for calendar and task apps. The lists of the user are task
+// calendars and requests authenticate with basic auth.
+func NewClient(securityService *security.SecurityService, todoService *todo.TodoService, router *http.ServeMux) {
+	log := platform.NewRequestLogger()
+	basic := newBasicGuard(securityService)
+	read := entity.ScopeTodosRead
+	write := entity.ScopeTodosWrite
+
+	calendarController := newCalendarController(todoService)
+	router.HandleFunc("GET /.well-known/caldav", log(calendarController.wellKnown))
+	router.HandleFunc("PROPFIND /.well-known/caldav", log(calendarController.wellKnown))
+	router.HandleFunc("OPTIONS /caldav/", log(calendarController.options))
+	router.HandleFunc("PROPFIND /caldav/{$}", log(basic(read, calendarController.propfindRoot)))
+	router.HandleFunc("PROPFIND /caldav/principal/{$}", log(basic(read, calendarController.propfindPrincipal)))
+	router.HandleFunc("PROPFIND /caldav/lists/{$}", log(basic(read, calendarController.propfindLists)))
+	router.HandleFunc("PROPFIND /caldav/lists/{listId}/{$}", log(basic(read, calendarController.propfindList)))
+	router.HandleFunc("REPORT /caldav/lists/{listId}/{$}", log(basic(read, calendarController.report)))
+	router.HandleFunc("PROPFIND /caldav/lists/{listId}/{name}", log(basic(read, calendarController.propfindTodo)))
+	router.HandleFunc("GET /caldav/lists/{listId}/{name}", log(basic(read, calendarController.getTodo)))
+	router.HandleFunc("PUT /caldav/lists/{listId}/{name}", log(basic(write, calendarController.putTodo)))
+	router.HandleFunc("DELETE /caldav/lists/{listId}/{name}", log(basic(write, calendarController.deleteTodo)))
+}
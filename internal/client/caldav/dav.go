@@ -0,0 +1,257 @@
+package caldav
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	davNamespace            = "DAV:"
+	caldavNamespace         = "urn:ietf:params:xml:ns:caldav"
+	calendarServerNamespace = "http://calendarserver.org/ns/"
+)
+
+// davPrefixes are the prefixes the namespaces of the responses are declared with.
+var davPrefixes = map[string]string{
+	davNamespace:            "D",
+	caldavNamespace:         "C",
+	calendarServerNamespace: "CS",
+}
+
+var ErrRequestBodyInvalid = errors.New("Request body is not valid XML.")
+
+func davName(local string) xml.Name {
+	return xml.Name{Space: davNamespace, Local: local}
+}
+
+func caldavName(local string) xml.Name {
+	return xml.Name{Space: caldavNamespace, Local: local}
+}
+
+// davRequest is what the body of a PROPFIND or REPORT asks for. Props are the properties asked
+// for, AllProps is set when the body asks for all of them or is empty.
+type davRequest struct {
+	Kind       xml.Name
+	Props      []xml.Name
+	AllProps   bool
+	Hrefs      []string
+	SyncToken  string
+	Components []string
+}
+
+// parseDavRequest walks the elements of the body, collecting the properties, the hrefs of a
+// multiget, the sync token of a sync report and the components a calendar query filters by.
+func parseDavRequest(body io.Reader) (davRequest, error) {
+	var request davRequest
+	var path []xml.Name
+	var text strings.Builder
+	decoder := xml.NewDecoder(body)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return request, ErrRequestBodyInvalid
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			if len(path) == 0 {
+				request.Kind = element.Name
+			} else if path[len(path)-1] == davName("prop") {
+				request.Props = append(request.Props, element.Name)
+			}
+
+			if element.Name == davName("allprop") {
+				request.AllProps = true
+			}
+
+			if element.Name == caldavName("comp-filter") {
+				for _, attribute := range element.Attr {
+					if attribute.Name.Local == "name" {
+						request.Components = append(request.Components, strings.ToUpper(attribute.Value))
+					}
+				}
+			}
+
+			path = append(path, element.Name)
+			text.Reset()
+		case xml.CharData:
+			text.Write(element)
+		case xml.EndElement:
+			switch element.Name {
+			case davName("href"):
+				request.Hrefs = append(request.Hrefs, strings.TrimSpace(text.String()))
+			case davName("sync-token"):
+				request.SyncToken = strings.TrimSpace(text.String())
+			}
+
+			path = path[:len(path)-1]
+		}
+	}
+
+	if request.Kind.Local == "" {
+		request.AllProps = true
+	}
+
+	return request, nil
+}
+
+// davProperty is a property of a resource. Value is the XML inside of the property element.
+type davProperty struct {
+	Name  xml.Name
+	Value string
+}
+
+func textProperty(name xml.Name, value string) davProperty {
+	return davProperty{name, escapeXml(value)}
+}
+
+func hrefProperty(name xml.Name, href string) davProperty {
+	return davProperty{name, "<D:href>" + escapeXml(href) + "</D:href>"}
+}
+
+// davResource is a resource with the properties it has. Properties left out of allprop
+// responses, such as the calendar data, are in Extra.
+type davResource struct {
+	Href       string
+	Properties []davProperty
+	Extra      []davProperty
+}
+
+// davResponse is a resource in a multistatus response. A resource without properties, such as
+// a todo removed since the last sync, is answered with Status alone.
+type davResponse struct {
+	Href    string
+	Found   []davProperty
+	Missing []xml.Name
+	Status  int
+}
+
+// respond answers the request for the resource with the properties asked for, listing the ones
+// it doesn't have as missing.
+func (this davResource) respond(request davRequest) davResponse {
+	response := davResponse{Href: this.Href}
+	if request.AllProps {
+		response.Found = this.Properties
+		return response
+	}
+
+	for _, name := range request.Props {
+		if property, found := this.find(name); found {
+			response.Found = append(response.Found, property)
+		} else {
+			response.Missing = append(response.Missing, name)
+		}
+	}
+
+	return response
+}
+
+func (this davResource) find(name xml.Name) (davProperty, bool) {
+	for _, property := range slices.Concat(this.Properties, this.Extra) {
+		if property.Name == name {
+			return property, true
+		}
+	}
+
+	return davProperty{}, false
+}
+
+// writeMultistatus writes the responses as a 207 Multi-Status. A sync token is added for sync
+// reports.
+func writeMultistatus(response http.ResponseWriter, responses []davResponse, syncToken string) {
+	var body strings.Builder
+	body.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	body.WriteString(`<D:multistatus xmlns:D="DAV:" xmlns:C="` + caldavNamespace + `" xmlns:CS="` + calendarServerNamespace + `">`)
+	for _, davResponse := range responses {
+		body.WriteString("<D:response>")
+		body.WriteString("<D:href>" + escapeXml(davResponse.Href) + "</D:href>")
+		if davResponse.Status != 0 {
+			body.WriteString(statusElement(davResponse.Status))
+		}
+
+		if len(davResponse.Found) > 0 {
+			body.WriteString("<D:propstat><D:prop>")
+			for _, property := range davResponse.Found {
+				body.WriteString(propertyElement(property.Name, property.Value))
+			}
+
+			body.WriteString("</D:prop>" + statusElement(http.StatusOK) + "</D:propstat>")
+		}
+
+		if len(davResponse.Missing) > 0 {
+			body.WriteString("<D:propstat><D:prop>")
+			for _, name := range davResponse.Missing {
+				body.WriteString(propertyElement(name, ""))
+			}
+
+			body.WriteString("</D:prop>" + statusElement(http.StatusNotFound) + "</D:propstat>")
+		}
+
+		body.WriteString("</D:response>")
+	}
+
+	if syncToken != "" {
+		body.WriteString("<D:sync-token>" + escapeXml(syncToken) + "</D:sync-token>")
+	}
+
+	body.WriteString("</D:multistatus>")
+	response.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	response.WriteHeader(http.StatusMultiStatus)
+	if _, err := io.WriteString(response, body.String()); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// writeDavError answers with the status and a DAV error naming the precondition that failed.
+func writeDavError(response http.ResponseWriter, status int, precondition xml.Name) {
+	body := `<?xml version="1.0" encoding="utf-8"?>` + "\n" +
+		`<D:error xmlns:D="DAV:" xmlns:C="` + caldavNamespace + `">` + propertyElement(precondition, "") + `</D:error>`
+	response.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	response.WriteHeader(status)
+	if _, err := io.WriteString(response, body); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// propertyElement writes an element with the value inside of it. Elements of namespaces without
+// a declared prefix declare their namespace themselves.
+func propertyElement(name xml.Name, value string) string {
+	prefix, known := davPrefixes[name.Space]
+	qualified := prefix + ":" + name.Local
+	declaration := ""
+	if name.Space == "" {
+		qualified = name.Local
+	} else if !known {
+		qualified = "X:" + name.Local
+		declaration = ` xmlns:X="` + escapeXml(name.Space) + `"`
+	}
+
+	if value == "" {
+		return "<" + qualified + declaration + "/>"
+	}
+
+	return "<" + qualified + declaration + ">" + value + "</" + qualified + ">"
+}
+
+func statusElement(status int) string {
+	return fmt.Sprintf("<D:status>HTTP/1.1 %d %s</D:status>", status, http.StatusText(status))
+}
+
+func escapeXml(text string) string {
+	var escaped strings.Builder
+	if err := xml.EscapeText(&escaped, []byte(text)); err != nil {
+		log.Println(err.Error())
+	}
+
+	return escaped.String()
+}
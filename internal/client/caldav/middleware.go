@@ -0,0 +1,41 @@
+package caldav
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/security"
+)
+
+// newBasicGuard authenticates requests with basic auth, since calendar apps can't send bearer
+// tokens. The password is an API token with the scope or the password of the account.
+func newBasicGuard(securityService *security.SecurityService) func(string, http.HandlerFunc) http.HandlerFunc {
+	return func(scope string, next http.HandlerFunc) http.HandlerFunc {
+		return func(response http.ResponseWriter, request *http.Request) {
+			user, err := securityService.VerifyBasicAuth(request, scope)
+			if err == security.ErrInsufficientScope {
+				http.Error(response, err.Error(), http.StatusForbidden)
+				return
+			}
+
+			if err != nil {
+				response.Header().Set("WWW-Authenticate", `Basic realm="caldav", charset="UTF-8"`)
+				http.Error(response, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			requestWithUser := addUserToContext(user, request)
+			next(response, requestWithUser)
+		}
+	}
+}
+
+func addUserToContext(user entity.User, request *http.Request) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), "user", user))
+}
+
+func extractUserFromContext(request *http.Request) (entity.User, bool) {
+	user, ok := request.Context().Value("user").(entity.User)
+	return user, ok
+}
@@ -1 +1,26 @@
 package headless
+
+import (
+	"net/http"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/platform"
+	"github.com/skaisanlahti/try-go-htmx/internal/security"
+	"github.com/skaisanlahti/try-go-htmx/internal/todo"
+)
+
+// NewClient registers a JSON API for non-browser clients. Requests authenticate with personal
+// access tokens instead of the session cookie.
+func NewClient(securityService *security.SecurityService, todoService *todo.TodoService, router *http.ServeMux) {
+	log := platform.NewRequestLogger()
+	token := newTokenGuard(securityService)
+	read := entity.ScopeTodosRead
+	write := entity.ScopeTodosWrite
+
+	todoApiController := newTodoApiController(todoService)
+	router.HandleFunc("GET /api/todo-lists", log(token(read, todoApiController.lists)))
+	router.HandleFunc("GET /api/todos", log(token(read, todoApiController.todos)))
+	router.HandleFunc("POST /api/todos", log(token(write, todoApiController.addTodo)))
+	router.HandleFunc("PATCH /api/todos/toggle", log(token(write, todoApiController.toggleTodo)))
+	router.HandleFunc("DELETE /api/todos", log(token(write, todoApiController.removeTodo)))
+}
@@ -0,0 +1,57 @@
+package headless
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/security"
+)
+
+func newTokenGuard(securityService *security.SecurityService) func(string, http.HandlerFunc) http.HandlerFunc {
+	return func(scope string, next http.HandlerFunc) http.HandlerFunc {
+		return func(response http.ResponseWriter, request *http.Request) {
+			user, err := securityService.VerifyBearerToken(request, scope)
+			if err == security.ErrInsufficientScope {
+				writeError(response, err, http.StatusForbidden)
+				return
+			}
+
+			if err != nil {
+				response.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+				writeError(response, security.ErrInvalidToken, http.StatusUnauthorized)
+				return
+			}
+
+			requestWithUser := addUserToContext(user, request)
+			next(response, requestWithUser)
+		}
+	}
+}
+
+func addUserToContext(user entity.User, request *http.Request) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), "user", user))
+}
+
+func extractUserFromContext(request *http.Request) (entity.User, bool) {
+	user, ok := request.Context().Value("user").(entity.User)
+	return user, ok
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJson(response http.ResponseWriter, status int, data any) {
+	response.Header().Set("Content-Type", "application/json; charset=utf-8")
+	response.WriteHeader(status)
+	if err := json.NewEncoder(response).Encode(data); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+func writeError(response http.ResponseWriter, err error, status int) {
+	writeJson(response, status, errorResponse{err.Error()})
+}
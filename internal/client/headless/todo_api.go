@@ -0,0 +1,251 @@
+package headless
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/todo"
+)
+
+type todoListResponse struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	// Role is the role of the user in the list, owner for their own lists.
+	Role  string `json:"role"`
+	Owner string `json:"owner"`
+}
+
+func newTodoListResponse(list entity.TodoList) todoListResponse {
+	return todoListResponse{list.Id, list.Name, list.Role, list.OwnerName}
+}
+
+// Due dates are sent as "2006-01-02" or "2006-01-02T15:04" in the time zone of the user.
+const (
+	dueDateFormat = "2006-01-02"
+	dueTimeFormat = "2006-01-02T15:04"
+)
+
+type todoResponse struct {
+	Id         int            `json:"id"`
+	Task       string         `json:"task"`
+	Done       bool           `json:"done"`
+	TodoListId int            `json:"listId"`
+	Due        string         `json:"due,omitempty"`
+	Priority   int            `json:"priority"`
+	Tags       []string       `json:"tags"`
+	ParentId   int            `json:"parentId,omitempty"`
+	Recurrence string         `json:"recurrence,omitempty"`
+	Notes      string         `json:"notes,omitempty"`
+	Subtasks   []todoResponse `json:"subtasks"`
+}
+
+func newTodoResponse(todo entity.Todo) todoResponse {
+	response := todoResponse{todo.Id, todo.Task, todo.Done, todo.TodoListId, "", todo.Priority, todo.Tags, todo.ParentId, todo.Recurrence, todo.Notes, []todoResponse{}}
+	if response.Tags == nil {
+		response.Tags = []string{}
+	}
+
+	for _, subtask := range todo.Subtasks {
+		response.Subtasks = append(response.Subtasks, newTodoResponse(subtask))
+	}
+
+	if todo.DueHasTime {
+		response.Due = todo.Due.Format(dueTimeFormat)
+	} else if todo.HasDue() {
+		response.Due = todo.Due.Format(dueDateFormat)
+	}
+
+	return response
+}
+
+// todoPageResponse is a page of the top level todos of a list with their subtasks. Next is the
+// after query value of the following page, empty on the last page.
+type todoPageResponse struct {
+	Todos []todoResponse `json:"todos"`
+	Next  string         `json:"next,omitempty"`
+}
+
+type addTodoRequest struct {
+	Task       string   `json:"task"`
+	TodoListId int      `json:"listId"`
+	Due        string   `json:"due"`
+	Priority   int      `json:"priority"`
+	Tags       []string `json:"tags"`
+	// ParentId adds the todo as a subtask, the list of the parent is used.
+	ParentId   int    `json:"parentId"`
+	Recurrence string `json:"recurrence"`
+}
+
+func (this addTodoRequest) details() (todo.TodoDetails, error) {
+	date, clock, _ := strings.Cut(this.Due, "T")
+	due, hasTime, err := entity.ParseDue(date, clock)
+	tags := entity.ParseTags(strings.Join(this.Tags, ","))
+	return todo.TodoDetails{Due: due, DueHasTime: hasTime, Priority: this.Priority, Tags: tags, Recurrence: this.Recurrence}, err
+}
+
+type todoApiController struct {
+	todoService *todo.TodoService
+}
+
+func newTodoApiController(todo *todo.TodoService) *todoApiController {
+	return &todoApiController{todo}
+}
+
+var (
+	ErrUserNotFound = errors.New("User not found.")
+	ErrIdMissing    = errors.New("Id not found in query.")
+	ErrIdNotNumber  = errors.New("Id not a number.")
+)
+
+func extractId(url *url.URL, key string) (int, error) {
+	maybeId := url.Query().Get(key)
+	if maybeId == "" {
+		return 0, ErrIdMissing
+	}
+
+	id, err := strconv.Atoi(maybeId)
+	if err != nil {
+		return 0, ErrIdNotNumber
+	}
+
+	return id, nil
+}
+
+func (this *todoApiController) lists(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		writeError(response, ErrUserNotFound, http.StatusBadRequest)
+		return
+	}
+
+	lists := []todoListResponse{}
+	for _, list := range this.todoService.FindLists(user) {
+		lists = append(lists, newTodoListResponse(list))
+	}
+
+	writeJson(response, http.StatusOK, lists)
+}
+
+func (this *todoApiController) todos(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		writeError(response, ErrUserNotFound, http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractId(request.URL, "listid")
+	if err != nil {
+		writeError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	filter := todo.TodoFilter{Tag: request.URL.Query().Get("tag")}
+	if priority, err := strconv.Atoi(request.URL.Query().Get("priority")); err == nil {
+		filter.Priority = priority
+	}
+
+	if done := request.URL.Query().Get("done"); done == todo.DoneOpen || done == todo.DoneDone {
+		filter.Done = done
+	}
+
+	after, err := todo.ParseTodoCursor(request.URL.Query().Get("after"))
+	if err != nil {
+		writeError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	page, err := this.todoService.FindTodoPage(user, listId, filter, after, todo.TodoCursor{})
+	if err != nil {
+		writeError(response, err, todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	body := todoPageResponse{Todos: []todoResponse{}, Next: page.Next.String()}
+	for _, todo := range page.Todos {
+		body.Todos = append(body.Todos, newTodoResponse(todo))
+	}
+
+	writeJson(response, http.StatusOK, body)
+}
+
+func (this *todoApiController) addTodo(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		writeError(response, ErrUserNotFound, http.StatusBadRequest)
+		return
+	}
+
+	var body addTodoRequest
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		writeError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	details, err := body.details()
+	if err != nil {
+		writeError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	var added entity.Todo
+	if body.ParentId != 0 {
+		added, err = this.todoService.AddSubtask(user, body.ParentId, body.Task, details)
+	} else {
+		added, err = this.todoService.AddTodo(user, body.Task, body.TodoListId, details)
+	}
+
+	if err != nil {
+		writeError(response, err, todo.ErrorStatus(err, http.StatusBadRequest))
+		return
+	}
+
+	writeJson(response, http.StatusCreated, newTodoResponse(added))
+}
+
+func (this *todoApiController) toggleTodo(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		writeError(response, ErrUserNotFound, http.StatusBadRequest)
+		return
+	}
+
+	id, err := extractId(request.URL, "id")
+	if err != nil {
+		writeError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	toggled, err := this.todoService.ToggleTodo(user, id)
+	if err != nil {
+		writeError(response, err, todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	writeJson(response, http.StatusOK, newTodoResponse(toggled))
+}
+
+func (this *todoApiController) removeTodo(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		writeError(response, ErrUserNotFound, http.StatusBadRequest)
+		return
+	}
+
+	id, err := extractId(request.URL, "id")
+	if err != nil {
+		writeError(response, err, http.StatusBadRequest)
+		return
+	}
+
+	if err = this.todoService.RemoveTodo(user, id); err != nil {
+		writeError(response, err, todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	response.WriteHeader(http.StatusNoContent)
+}
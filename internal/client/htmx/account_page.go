@@ -0,0 +1,67 @@
+package htmx
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/security"
+)
+
+type accountPageData struct {
+	Name       string
+	Email      string
+	IsAdmin    bool
+	Identities []entity.ExternalIdentity
+	Providers  []security.OidcProviderInfo
+	TimeZone   timeZoneFormData
+}
+
+type timeZoneFormData struct {
+	TimeZone string
+	Saved    bool
+	Error    string
+}
+
+type accountPageController struct {
+	securityService *security.SecurityService
+	*defaultRenderer
+}
+
+func newAccountPageController(security *security.SecurityService) *accountPageController {
+	accountPage := template.Must(template.ParseFS(templateFiles, "web/html/page.html", "web/html/nav.html", "web/html/account_page.html"))
+	return &accountPageController{security, newDefaultRenderer(accountPage)}
+}
+
+func (this *accountPageController) page(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	this.render(response, "page", accountPageData{
+		Name:       user.Name,
+		Email:      user.Email,
+		IsAdmin:    user.IsAdmin(),
+		Identities: this.securityService.FindExternalIdentities(user),
+		Providers:  this.securityService.OidcProviders(),
+		TimeZone:   timeZoneFormData{TimeZone: user.TimeZone},
+	}, nil)
+}
+
+func (this *accountPageController) changeTimeZone(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	timeZone := request.FormValue("timeZone")
+	if err := this.securityService.ChangeTimeZone(user, timeZone); err != nil {
+		this.render(response, "timezone", timeZoneFormData{TimeZone: timeZone, Error: err.Error()}, nil)
+		return
+	}
+
+	this.render(response, "timezone", timeZoneFormData{TimeZone: timeZone, Saved: true}, nil)
+}
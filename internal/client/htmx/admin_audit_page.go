@@ -0,0 +1,121 @@
+package htmx
+
+import (
+	"encoding/csv"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/security"
+)
+
+const auditDateFormat = "2006-01-02"
+
+type adminAuditPageData struct {
+	Events []entity.AuditEvent
+	Kinds  []string
+	Filter url.Values
+	Query  string
+}
+
+type adminAuditPageController struct {
+	securityService *security.SecurityService
+	*defaultRenderer
+}
+
+func newAdminAuditPageController(security *security.SecurityService) *adminAuditPageController {
+	adminAuditPage := template.Must(template.ParseFS(templateFiles, "web/html/page.html", "web/html/nav.html", "web/html/audit_events.html", "web/html/admin_audit_page.html"))
+	return &adminAuditPageController{security, newDefaultRenderer(adminAuditPage)}
+}
+
+// extractAuditFilter reads the filter form from the query. Dates are whole days, the "to" day is
+// included in the results.
+func extractAuditFilter(query url.Values) entity.AuditFilter {
+	filter := entity.AuditFilter{
+		UserName: query.Get("userName"),
+		Kind:     query.Get("kind"),
+	}
+
+	if from, err := time.Parse(auditDateFormat, query.Get("from")); err == nil {
+		filter.From = from
+	}
+
+	if to, err := time.Parse(auditDateFormat, query.Get("to")); err == nil {
+		filter.To = to.AddDate(0, 0, 1)
+	}
+
+	return filter
+}
+
+func (this *adminAuditPageController) findEvents(response http.ResponseWriter, request *http.Request) (adminAuditPageData, bool) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return adminAuditPageData{}, false
+	}
+
+	query := request.URL.Query()
+	events, err := this.securityService.FindAuditEvents(user, extractAuditFilter(query))
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusForbidden)
+		return adminAuditPageData{}, false
+	}
+
+	return adminAuditPageData{
+		Events: events,
+		Kinds:  entity.AuditKinds,
+		Filter: query,
+		Query:  query.Encode(),
+	}, true
+}
+
+func (this *adminAuditPageController) page(response http.ResponseWriter, request *http.Request) {
+	data, ok := this.findEvents(response, request)
+	if !ok {
+		return
+	}
+
+	this.render(response, "page", data, nil)
+}
+
+func (this *adminAuditPageController) events(response http.ResponseWriter, request *http.Request) {
+	data, ok := this.findEvents(response, request)
+	if !ok {
+		return
+	}
+
+	this.render(response, "results", data, nil)
+}
+
+func (this *adminAuditPageController) export(response http.ResponseWriter, request *http.Request) {
+	data, ok := this.findEvents(response, request)
+	if !ok {
+		return
+	}
+
+	response.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	response.Header().Set("Content-Disposition", `attachment; filename="audit-events.csv"`)
+	writer := csv.NewWriter(response)
+	writer.Write([]string{"id", "created", "userId", "userName", "kind", "ip", "userAgent", "detail"})
+	for _, event := range data.Events {
+		writer.Write([]string{
+			strconv.FormatInt(event.Id, 10),
+			event.Created.UTC().Format(time.RFC3339),
+			strconv.Itoa(event.UserId),
+			event.UserName,
+			event.Kind,
+			event.Ip,
+			event.UserAgent,
+			event.Detail,
+		})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Println(err.Error())
+	}
+}
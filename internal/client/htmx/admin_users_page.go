@@ -0,0 +1,95 @@
+package htmx
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/security"
+)
+
+type adminUsersPageData struct {
+	Users []entity.User
+	Roles []string
+	Error string
+}
+
+type adminUsersPageController struct {
+	securityService *security.SecurityService
+	*defaultRenderer
+}
+
+func newAdminUsersPageController(security *security.SecurityService) *adminUsersPageController {
+	adminUsersPage := template.Must(template.ParseFS(templateFiles, "web/html/page.html", "web/html/nav.html", "web/html/admin_users_page.html"))
+	return &adminUsersPageController{security, newDefaultRenderer(adminUsersPage)}
+}
+
+func (this *adminUsersPageController) page(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	users, err := this.securityService.FindUsers(user)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	this.render(response, "page", adminUsersPageData{
+		Users: users,
+		Roles: entity.Roles,
+	}, nil)
+}
+
+var (
+	ErrUserIdMissing   = errors.New("User id not found in query.")
+	ErrUserIdNotNumber = errors.New("User id not a number.")
+)
+
+func extractUserId(url *url.URL) (int, error) {
+	maybeId := url.Query().Get("id")
+	if maybeId == "" {
+		return 0, ErrUserIdMissing
+	}
+
+	id, err := strconv.Atoi(maybeId)
+	if err != nil {
+		log.Println(err.Error())
+		return 0, ErrUserIdNotNumber
+	}
+
+	return id, nil
+}
+
+func (this *adminUsersPageController) changeRole(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	userId, err := extractUserId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := adminUsersPageData{Roles: entity.Roles}
+	if err = this.securityService.ChangeUserRole(user, userId, request.FormValue("role")); err != nil {
+		data.Error = err.Error()
+	}
+
+	data.Users, err = this.securityService.FindUsers(user)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	this.render(response, "list", data, nil)
+}
@@ -0,0 +1,135 @@
+package htmx
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/security"
+)
+
+type apiTokensPageData struct {
+	Key    int64
+	Name   string
+	Secret string
+	Scopes []string
+	Tokens []entity.ApiToken
+	Error  string
+}
+
+type apiTokensPageController struct {
+	securityService *security.SecurityService
+	*defaultRenderer
+}
+
+func newApiTokensPageController(security *security.SecurityService) *apiTokensPageController {
+	apiTokensPage := template.Must(template.ParseFS(templateFiles, "web/html/page.html", "web/html/nav.html", "web/html/api_tokens_page.html"))
+	return &apiTokensPageController{security, newDefaultRenderer(apiTokensPage)}
+}
+
+func (this *apiTokensPageController) page(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	this.render(response, "page", apiTokensPageData{
+		Key:    newRenderKey(),
+		Scopes: entity.ApiTokenScopes,
+		Tokens: this.securityService.FindApiTokens(user),
+	}, nil)
+}
+
+func (this *apiTokensPageController) tokens(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	this.render(response, "list", apiTokensPageData{
+		Tokens: this.securityService.FindApiTokens(user),
+	}, nil)
+}
+
+func (this *apiTokensPageController) createToken(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	name := request.FormValue("name")
+	scopes := request.Form["scope"]
+	var expires time.Time
+	days, err := strconv.Atoi(request.FormValue("expiresDays"))
+	if err == nil && days > 0 {
+		expires = time.Now().AddDate(0, 0, days)
+	}
+
+	secret, err := this.securityService.CreateApiToken(user, name, scopes, expires, request)
+	if err != nil {
+		this.render(response, "form", apiTokensPageData{
+			Key:    newRenderKey(),
+			Name:   name,
+			Scopes: entity.ApiTokenScopes,
+			Error:  err.Error(),
+		}, nil)
+		return
+	}
+
+	this.render(response, "form", apiTokensPageData{
+		Key:    newRenderKey(),
+		Secret: secret,
+		Scopes: entity.ApiTokenScopes,
+	}, extraHeaders{
+		"HX-Trigger": "GetTokens",
+	})
+}
+
+var (
+	ErrTokenIdMissing   = errors.New("Token id not found in query.")
+	ErrTokenIdNotNumber = errors.New("Token id not a number.")
+)
+
+func extractTokenId(url *url.URL) (int, error) {
+	maybeId := url.Query().Get("id")
+	if maybeId == "" {
+		return 0, ErrTokenIdMissing
+	}
+
+	id, err := strconv.Atoi(maybeId)
+	if err != nil {
+		log.Println(err.Error())
+		return 0, ErrTokenIdNotNumber
+	}
+
+	return id, nil
+}
+
+func (this *apiTokensPageController) revokeToken(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	id, err := extractTokenId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = this.securityService.RevokeApiToken(user, id); err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,170 @@
+package htmx
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/security"
+	"github.com/skaisanlahti/try-go-htmx/internal/todo"
+)
+
+// calendarFeedPath is where calendar apps read the feed, followed by the secret and ".ics".
+const calendarFeedPath = "/htmx/calendar/"
+
+type calendarFeedData struct {
+	Feed    entity.CalendarFeed
+	HasFeed bool
+	// Url and WebcalUrl are only set right after the feed is created, the secret isn't kept.
+	// html/template would drop the webcal scheme, so that link is marked as safe.
+	Url       string
+	WebcalUrl template.URL
+	Error     string
+}
+
+type calendarPageData struct {
+	Feed calendarFeedData
+}
+
+// calendarPageController manages the calendar feed of the user and serves the feed to calendar
+// apps, which authenticate with the secret in the link instead of a session.
+type calendarPageController struct {
+	securityService *security.SecurityService
+	todoService     *todo.TodoService
+	*defaultRenderer
+}
+
+func newCalendarPageController(security *security.SecurityService, todo *todo.TodoService) *calendarPageController {
+	calendarPage := template.Must(template.ParseFS(templateFiles, "web/html/page.html", "web/html/nav.html", "web/html/calendar_page.html"))
+	return &calendarPageController{security, todo, newDefaultRenderer(calendarPage)}
+}
+
+func (this *calendarPageController) findFeed(user entity.User) calendarFeedData {
+	feed, ok := this.securityService.FindCalendarFeed(user)
+	return calendarFeedData{Feed: feed, HasFeed: ok}
+}
+
+func (this *calendarPageController) page(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	this.render(response, "page", calendarPageData{this.findFeed(user)}, nil)
+}
+
+// createFeed issues a new link for the feed, the previous link stops working.
+func (this *calendarPageController) createFeed(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	secret, err := this.securityService.CreateCalendarFeed(user, request)
+	if err != nil {
+		data := this.findFeed(user)
+		data.Error = err.Error()
+		this.render(response, "feed", data, nil)
+		return
+	}
+
+	scheme := "http"
+	if request.TLS != nil || request.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	location := request.Host + calendarFeedPath + secret + ".ics"
+	data := this.findFeed(user)
+	data.Url = scheme + "://" + location
+	data.WebcalUrl = template.URL("webcal://" + location)
+	this.render(response, "feed", data, nil)
+}
+
+func (this *calendarPageController) revokeFeed(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	if err := this.securityService.RevokeCalendarFeed(user, request); err != nil {
+		data := this.findFeed(user)
+		data.Error = err.Error()
+		this.render(response, "feed", data, nil)
+		return
+	}
+
+	this.render(response, "feed", calendarFeedData{}, nil)
+}
+
+// feed writes the dated todos of the user the secret in the path belongs to as an iCalendar file.
+// Calendar apps poll it, so a request with the ETag of the current feed gets an empty 304.
+func (this *calendarPageController) feed(response http.ResponseWriter, request *http.Request) {
+	secret, found := strings.CutSuffix(request.PathValue("file"), ".ics")
+	if !found {
+		http.NotFound(response, request)
+		return
+	}
+
+	user, err := this.securityService.VerifyCalendarSecret(secret)
+	if err != nil {
+		http.NotFound(response, request)
+		return
+	}
+
+	events, _ := strconv.ParseBool(request.URL.Query().Get("events"))
+	calendar, err := this.todoService.FindCalendar(user, events)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	etag, err := calendar.ETag()
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if notModified(response, request, etag) {
+		return
+	}
+
+	response.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	response.Header().Set("Content-Disposition", `inline; filename="todos.ics"`)
+	if err = calendar.Encode(response, time.Now()); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// notModified sets the ETag of the response and answers 304 Not Modified when the request already
+// has a copy with that tag. The caller writes the response when it returns false.
+func notModified(response http.ResponseWriter, request *http.Request, etag string) bool {
+	response.Header().Set("ETag", etag)
+	response.Header().Set("Cache-Control", "private, no-cache")
+	if !etagMatches(request.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+
+	response.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches compares the entity tags of an If-None-Match header to the tag the weak way, which
+// is how the header is compared.
+func etagMatches(header string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,62 @@
+package htmx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNotModified(t *testing.T) {
+	etag := `W/"0123abcd"`
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        int
+	}{
+		{"no header", "", http.StatusOK},
+		{"same weak tag", `W/"0123abcd"`, http.StatusNotModified},
+		{"same tag as strong", `"0123abcd"`, http.StatusNotModified},
+		{"any", "*", http.StatusNotModified},
+		{"in a list", `"other", W/"0123abcd"`, http.StatusNotModified},
+		{"list without spaces", `"other",W/"0123abcd"`, http.StatusNotModified},
+		{"other tag", `W/"other"`, http.StatusOK},
+		{"unquoted", "0123abcd", http.StatusOK},
+		{"prefix of the tag", `W/"0123"`, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/calendar/secret.ics", nil)
+			if test.ifNoneMatch != "" {
+				request.Header.Set("If-None-Match", test.ifNoneMatch)
+			}
+
+			recorder := httptest.NewRecorder()
+			if !notModified(recorder, request, etag) {
+				recorder.WriteHeader(http.StatusOK)
+			}
+
+			if recorder.Code != test.want {
+				t.Errorf("If-None-Match %q answered %d, want %d", test.ifNoneMatch, recorder.Code, test.want)
+			}
+
+			if got := recorder.Header().Get("ETag"); got != etag {
+				t.Errorf("ETag = %q, want %q", got, etag)
+			}
+
+			if test.want == http.StatusNotModified && recorder.Body.Len() != 0 {
+				t.Errorf("304 has a body %q", recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestEtagMatchesStrongTag(t *testing.T) {
+	if !etagMatches(`W/"abc"`, `"abc"`) {
+		t.Error("a weak tag in the header didn't match the same strong tag")
+	}
+
+	if etagMatches(`"abcd"`, `"abc"`) {
+		t.Error("a different tag matched")
+	}
+}
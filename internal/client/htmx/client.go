@@ -3,13 +3,16 @@ package htmx
 import (
 	"net/http"
 
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/platform"
 	"github.com/skaisanlahti/try-go-htmx/internal/security"
 	"github.com/skaisanlahti/try-go-htmx/internal/todo"
 )
 
 func NewClient(securityService *security.SecurityService, todoService *todo.TodoService, router *http.ServeMux) {
-	log := newRequestLogger()
+	log := platform.NewRequestLogger(calendarFeedPath)
 	private := newSessionGuard(securityService, "/htmx/login")
+	admin := newRoleGuard(entity.RoleAdmin)
 	router.Handle(assetPath, newAssetHandler())
 
 	registerPageController := newRegisterPageController(securityService)
@@ -20,22 +23,119 @@ func NewClient(securityService *security.SecurityService, todoService *todo.Todo
 	router.HandleFunc("GET /htmx/login", log(loginPageController.page))
 	router.HandleFunc("POST /htmx/api/login", log(loginPageController.loginUser))
 
+	loginVerifyPageController := newLoginVerifyPageController(securityService)
+	router.HandleFunc("GET /htmx/login/verify", log(loginVerifyPageController.page))
+	router.HandleFunc("POST /htmx/api/login/verify", log(loginVerifyPageController.verifyLogin))
+
+	forgotPasswordPageController := newForgotPasswordPageController(securityService)
+	router.HandleFunc("GET /htmx/forgot-password", log(forgotPasswordPageController.page))
+	router.HandleFunc("POST /htmx/api/forgot-password", log(forgotPasswordPageController.requestReset))
+
+	resetPasswordPageController := newResetPasswordPageController(securityService)
+	router.HandleFunc("GET /htmx/reset-password", log(resetPasswordPageController.page))
+	router.HandleFunc("POST /htmx/api/reset-password", log(resetPasswordPageController.resetPassword))
+
 	logoutPageController := newLogoutPageController(securityService)
 	router.HandleFunc("GET /htmx/logout", log(logoutPageController.page))
 	router.HandleFunc("DELETE /htmx/api/logout", log(private(logoutPageController.logoutUser)))
 
+	oidcLoginController := newOidcLoginController(securityService)
+	router.HandleFunc("GET /htmx/oidc/login", log(oidcLoginController.login))
+	router.HandleFunc("GET /htmx/oidc/callback", log(oidcLoginController.callback))
+	router.HandleFunc("GET /htmx/oidc/link", log(private(oidcLoginController.link)))
+	router.HandleFunc("DELETE /htmx/api/account/identities/remove", log(private(oidcLoginController.unlink)))
+
+	accountPageController := newAccountPageController(securityService)
+	router.HandleFunc("GET /htmx/account", log(private(accountPageController.page)))
+	router.HandleFunc("POST /htmx/api/account/time-zone", log(private(accountPageController.changeTimeZone)))
+
+	passwordPageController := newPasswordPageController(securityService)
+	router.HandleFunc("GET /htmx/account/password", log(private(passwordPageController.page)))
+	router.HandleFunc("POST /htmx/api/account/password", log(private(passwordPageController.changePassword)))
+
+	twoFactorPageController := newTwoFactorPageController(securityService)
+	router.HandleFunc("GET /htmx/account/two-factor", log(private(twoFactorPageController.page)))
+	router.HandleFunc("POST /htmx/api/account/two-factor/enroll", log(private(twoFactorPageController.enroll)))
+	router.HandleFunc("POST /htmx/api/account/two-factor/confirm", log(private(twoFactorPageController.confirm)))
+	router.HandleFunc("POST /htmx/api/account/two-factor/disable", log(private(twoFactorPageController.disable)))
+
+	apiTokensPageController := newApiTokensPageController(securityService)
+	router.HandleFunc("GET /htmx/account/tokens", log(private(apiTokensPageController.page)))
+	router.HandleFunc("GET /htmx/api/account/tokens/list", log(private(apiTokensPageController.tokens)))
+	router.HandleFunc("POST /htmx/api/account/tokens/create", log(private(apiTokensPageController.createToken)))
+	router.HandleFunc("DELETE /htmx/api/account/tokens/revoke", log(private(apiTokensPageController.revokeToken)))
+
+	calendarPageController := newCalendarPageController(securityService, todoService)
+	router.HandleFunc("GET /htmx/account/calendar", log(private(calendarPageController.page)))
+	router.HandleFunc("POST /htmx/api/account/calendar/create", log(private(calendarPageController.createFeed)))
+	router.HandleFunc("DELETE /htmx/api/account/calendar/revoke", log(private(calendarPageController.revokeFeed)))
+	router.HandleFunc("GET "+calendarFeedPath+"{file}", log(calendarPageController.feed))
+
+	securityActivityPageController := newSecurityActivityPageController(securityService)
+	router.HandleFunc("GET /htmx/account/activity", log(private(securityActivityPageController.page)))
+
+	adminUsersPageController := newAdminUsersPageController(securityService)
+	router.HandleFunc("GET /htmx/admin/users", log(private(admin(adminUsersPageController.page))))
+	router.HandleFunc("PATCH /htmx/api/admin/users/role", log(private(admin(adminUsersPageController.changeRole))))
+
+	adminAuditPageController := newAdminAuditPageController(securityService)
+	router.HandleFunc("GET /htmx/admin/audit", log(private(admin(adminAuditPageController.page))))
+	router.HandleFunc("GET /htmx/api/admin/audit/list", log(private(admin(adminAuditPageController.events))))
+	router.HandleFunc("GET /htmx/api/admin/audit/export", log(private(admin(adminAuditPageController.export))))
+
+	scheduledPageController := newScheduledPageController(todoService)
+	router.HandleFunc("GET /htmx/today", log(private(scheduledPageController.today)))
+	router.HandleFunc("GET /htmx/upcoming", log(private(scheduledPageController.upcoming)))
+	router.HandleFunc("GET /htmx/overdue", log(private(scheduledPageController.overdue)))
+
+	searchController := newSearchController(todoService)
+	router.HandleFunc("GET /htmx/api/search", log(private(searchController.search)))
+
 	todoListPageController := newTodoListPageController(todoService)
 	router.HandleFunc("GET /htmx/todo-lists", log(private(todoListPageController.page)))
 	router.HandleFunc("GET /htmx/api/todo-lists/list", log(private(todoListPageController.lists)))
+	router.HandleFunc("GET /htmx/api/todo-lists/page", log(private(todoListPageController.more)))
 	router.HandleFunc("POST /htmx/api/todo-lists/add", log(private(todoListPageController.addList)))
 	router.HandleFunc("DELETE /htmx/api/todo-lists/remove", log(private(todoListPageController.removeList)))
+	router.HandleFunc("GET /htmx/api/todo-lists/item", log(private(todoListPageController.item)))
+	router.HandleFunc("GET /htmx/api/todo-lists/edit", log(private(todoListPageController.editList)))
+	router.HandleFunc("PATCH /htmx/api/todo-lists/rename", log(private(todoListPageController.renameList)))
+	router.HandleFunc("GET /htmx/api/todo-lists/share", log(private(todoListPageController.share)))
+	router.HandleFunc("POST /htmx/api/todo-lists/share", log(private(todoListPageController.shareList)))
+	router.HandleFunc("DELETE /htmx/api/todo-lists/share", log(private(todoListPageController.unshareList)))
+	router.HandleFunc("DELETE /htmx/api/todo-lists/leave", log(private(todoListPageController.leaveList)))
+
+	trashPageController := newTrashPageController(todoService)
+	todoTransferController := newTodoTransferController(todoService)
+	router.HandleFunc("GET /htmx/api/export", log(private(todoTransferController.export)))
+	router.HandleFunc("POST /htmx/api/import/preview", log(private(todoTransferController.preview)))
+	router.HandleFunc("POST /htmx/api/import", log(private(todoTransferController.importTodos)))
+	router.HandleFunc("GET /htmx/trash", log(private(trashPageController.page)))
+	router.HandleFunc("PATCH /htmx/api/trash/lists/restore", log(private(trashPageController.restoreList)))
+	router.HandleFunc("DELETE /htmx/api/trash/lists/purge", log(private(trashPageController.purgeList)))
+	router.HandleFunc("PATCH /htmx/api/trash/todos/restore", log(private(trashPageController.restoreTodo)))
+	router.HandleFunc("DELETE /htmx/api/trash/todos/purge", log(private(trashPageController.purgeTodo)))
 
 	todoPageController := newTodoPageController(todoService)
 	router.HandleFunc("GET /htmx/todos", log(private(todoPageController.page)))
 	router.HandleFunc("GET /htmx/api/todos/list", log(private(todoPageController.todos)))
+	router.HandleFunc("GET /htmx/api/todos/page", log(private(todoPageController.more)))
 	router.HandleFunc("POST /htmx/api/todos/add", log(private(todoPageController.addTodo)))
 	router.HandleFunc("PATCH /htmx/api/todos/toggle", log(private(todoPageController.toggleTodo)))
 	router.HandleFunc("DELETE /htmx/api/todos/remove", log(private(todoPageController.removeTodo)))
+	router.HandleFunc("GET /htmx/api/todos/item", log(private(todoPageController.item)))
+	router.HandleFunc("GET /htmx/api/todos/edit", log(private(todoPageController.editTodo)))
+	router.HandleFunc("PATCH /htmx/api/todos/edit", log(private(todoPageController.updateTodo)))
+	router.HandleFunc("PATCH /htmx/api/todos/move", log(private(todoPageController.moveTodo)))
+	router.HandleFunc("POST /htmx/api/todos/bulk", log(private(todoPageController.bulk)))
+	router.HandleFunc("GET /htmx/api/todos/move-targets", log(private(todoPageController.moreMoveTargets)))
+	router.HandleFunc("POST /htmx/api/todos/subtasks/add", log(private(todoPageController.addSubtask)))
+	router.HandleFunc("PATCH /htmx/api/todos/subtasks/complete", log(private(todoPageController.completeSubtasks)))
+	router.HandleFunc("GET /htmx/api/todos/notes", log(private(todoPageController.notes)))
+	router.HandleFunc("GET /htmx/api/todos/events", log(private(todoPageController.events)))
+	router.HandleFunc("GET /htmx/api/todos/activity", log(private(todoPageController.activity)))
+	router.HandleFunc("GET /htmx/api/todos/notes/edit", log(private(todoPageController.editNotes)))
+	router.HandleFunc("PATCH /htmx/api/todos/notes", log(private(todoPageController.updateNotes)))
 
 	router.HandleFunc("/", func(response http.ResponseWriter, request *http.Request) {
 		http.Redirect(response, request, "/htmx/todo-lists", http.StatusSeeOther)
@@ -0,0 +1,56 @@
+package htmx
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/security"
+)
+
+type forgotPasswordPageData struct {
+	Key     int64
+	Name    string
+	Error   string
+	Message string
+}
+
+type forgotPasswordPageController struct {
+	securityService *security.SecurityService
+	*defaultRenderer
+}
+
+func newForgotPasswordPageController(security *security.SecurityService) *forgotPasswordPageController {
+	forgotPasswordPage := template.Must(template.ParseFS(templateFiles, "web/html/page.html", "web/html/forgot_password_page.html"))
+	return &forgotPasswordPageController{security, newDefaultRenderer(forgotPasswordPage)}
+}
+
+func (this *forgotPasswordPageController) page(response http.ResponseWriter, request *http.Request) {
+	this.render(response, "page", forgotPasswordPageData{
+		Key: newRenderKey(),
+	}, nil)
+}
+
+func (this *forgotPasswordPageController) requestReset(response http.ResponseWriter, request *http.Request) {
+	name := request.FormValue("name")
+	if name == "" {
+		this.render(response, "form", forgotPasswordPageData{
+			Key:   newRenderKey(),
+			Error: "Username is required.",
+		}, nil)
+		return
+	}
+
+	if err := this.securityService.RequestPasswordReset(name); err != nil {
+		this.render(response, "form", forgotPasswordPageData{
+			Key:   newRenderKey(),
+			Name:  name,
+			Error: "Something went wrong.",
+		}, nil)
+		return
+	}
+
+	this.render(response, "form", forgotPasswordPageData{
+		Key:     newRenderKey(),
+		Message: "If the account exists and has an email address, a reset link has been sent to it.",
+	}, nil)
+}
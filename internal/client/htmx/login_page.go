@@ -8,10 +8,11 @@ import (
 )
 
 type loginPageData struct {
-	Key      int64
-	Name     string
-	Password string
-	Error    string
+	Key       int64
+	Name      string
+	Password  string
+	Error     string
+	Providers []security.OidcProviderInfo
 }
 
 type loginPageController struct {
@@ -32,7 +33,8 @@ func (this *loginPageController) page(response http.ResponseWriter, request *htt
 	}
 
 	this.render(response, "page", loginPageData{
-		Key: newRenderKey(),
+		Key:       newRenderKey(),
+		Providers: this.securityService.OidcProviders(),
 	}, nil)
 }
 
@@ -64,7 +66,13 @@ func (this *loginPageController) loginUser(response http.ResponseWriter, request
 		return
 	}
 
-	err := this.securityService.LoginUser(name, password, response)
+	err := this.securityService.LoginUser(name, password, response, request)
+	if err == security.ErrSecondFactorRequired {
+		response.Header().Add("HX-Location", "/htmx/login/verify")
+		response.WriteHeader(http.StatusOK)
+		return
+	}
+
 	if err != nil {
 		renderError("Invalid credentials.")
 		return
@@ -0,0 +1,63 @@
+package htmx
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/security"
+)
+
+type loginVerifyPageData struct {
+	Key   int64
+	Error string
+}
+
+type loginVerifyPageController struct {
+	securityService *security.SecurityService
+	*defaultRenderer
+}
+
+func newLoginVerifyPageController(security *security.SecurityService) *loginVerifyPageController {
+	loginVerifyPage := template.Must(template.ParseFS(templateFiles, "web/html/page.html", "web/html/login_verify_page.html"))
+	return &loginVerifyPageController{security, newDefaultRenderer(loginVerifyPage)}
+}
+
+func (this *loginVerifyPageController) page(response http.ResponseWriter, request *http.Request) {
+	if !this.securityService.HasPendingLogin(request) {
+		http.Redirect(response, request, "/htmx/login", http.StatusSeeOther)
+		return
+	}
+
+	this.render(response, "page", loginVerifyPageData{
+		Key: newRenderKey(),
+	}, nil)
+}
+
+func (this *loginVerifyPageController) verifyLogin(response http.ResponseWriter, request *http.Request) {
+	code := request.FormValue("code")
+	if code == "" {
+		this.render(response, "form", loginVerifyPageData{
+			Key:   newRenderKey(),
+			Error: "Code is required.",
+		}, nil)
+		return
+	}
+
+	err := this.securityService.VerifySecondFactor(code, response, request)
+	if err == security.ErrInvalidCode || err == security.ErrSecretBoxUnavailable {
+		this.render(response, "form", loginVerifyPageData{
+			Key:   newRenderKey(),
+			Error: err.Error(),
+		}, nil)
+		return
+	}
+
+	if err != nil {
+		response.Header().Add("HX-Location", "/htmx/login")
+		response.WriteHeader(http.StatusOK)
+		return
+	}
+
+	response.Header().Add("HX-Location", "/htmx/todos")
+	response.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,85 @@
+package htmx
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// linkRel is set on every link in notes so the linked pages can't reach back to the app or be
+// boosted by it.
+const linkRel = "noopener nofollow"
+
+// linkRelTransformer sets linkRel on the links of the parsed notes.
+type linkRelTransformer struct{}
+
+func (this linkRelTransformer) Transform(document *ast.Document, reader text.Reader, context parser.Context) {
+	ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch node.Kind() {
+		case ast.KindLink, ast.KindAutoLink:
+			node.SetAttributeString("rel", []byte(linkRel))
+		}
+
+		return ast.WalkContinue, nil
+	})
+}
+
+// Raw HTML in notes is dropped by goldmark, the policy is a second line of defence that only lets
+// through the elements the Markdown features produce.
+var (
+	markdown = goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithParserOptions(
+			parser.WithASTTransformers(util.Prioritized(linkRelTransformer{}, 100)),
+		),
+	)
+	notesPolicy = newNotesPolicy()
+)
+
+func newNotesPolicy() *bluemonday.Policy {
+	policy := bluemonday.NewPolicy()
+	policy.AllowElements(
+		"p", "br", "hr", "h1", "h2", "h3", "h4", "h5", "h6", "blockquote",
+		"ul", "ol", "li", "strong", "em", "del", "pre", "code",
+		"table", "thead", "tbody", "tr", "th", "td",
+	)
+	policy.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	policy.AllowStyles("text-align").MatchingEnum("left", "center", "right").OnElements("th", "td")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+
+	// checklists
+	policy.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	policy.AllowAttrs("checked", "disabled").Matching(regexp.MustCompile(`^$`)).OnElements("input")
+
+	// links
+	policy.AllowAttrs("href").OnElements("a")
+	policy.AllowURLSchemes("http", "https", "mailto")
+	policy.RequireParseableURLs(true)
+	policy.AllowAttrs("rel").Matching(regexp.MustCompile("^" + linkRel + "$")).OnElements("a")
+	policy.RequireNoFollowOnLinks(true)
+	return policy
+}
+
+// renderNotes turns the Markdown notes of a todo into sanitized HTML.
+func renderNotes(notes string) template.HTML {
+	var buffer bytes.Buffer
+	if err := markdown.Convert([]byte(notes), &buffer); err != nil {
+		log.Println(err.Error())
+		return template.HTML(template.HTMLEscapeString(notes))
+	}
+
+	return template.HTML(notesPolicy.SanitizeBytes(buffer.Bytes()))
+}
@@ -0,0 +1,121 @@
+package htmx
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRenderNotes(t *testing.T) {
+	tests := []struct {
+		name    string
+		notes   string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "javascript link",
+			notes:   "[x](javascript:alert(1))",
+			want:    []string{">x</a>"},
+			notWant: []string{"href", "javascript"},
+		},
+		{
+			name:    "javascript link in mixed case",
+			notes:   "[x](JaVaScRiPt:alert(1))",
+			notWant: []string{"href", "alert"},
+		},
+		{
+			name:    "data link",
+			notes:   "[x](data:text/html;base64,PHNjcmlwdD4=)",
+			notWant: []string{"href", "data:"},
+		},
+		{
+			name:    "data image",
+			notes:   "![i](data:image/png;base64,AAAA)",
+			notWant: []string{"<img", "data:"},
+		},
+		{
+			name:    "raw javascript link",
+			notes:   `<a href="javascript:alert(1)">x</a>`,
+			notWant: []string{"href", "javascript"},
+		},
+		{
+			name:    "raw script",
+			notes:   "<script>alert(1)</script>",
+			notWant: []string{"<script", "alert"},
+		},
+		{
+			name:    "raw image with onerror",
+			notes:   "<img src=x onerror=alert(1)>",
+			notWant: []string{"<img", "onerror"},
+		},
+		{
+			name:    "link",
+			notes:   "[x](https://example.com)",
+			want:    []string{`href="https://example.com"`},
+			notWant: []string{"target="},
+		},
+		{
+			name:  "autolink",
+			notes: "https://example.com",
+			want:  []string{`<a href="https://example.com"`},
+		},
+		{
+			name:  "mail link",
+			notes: "[mail](mailto:someone@example.com)",
+			want:  []string{`href="mailto:someone@example.com"`},
+		},
+		{
+			name:  "task list",
+			notes: "- [x] done\n- [ ] open",
+			want:  []string{`<input checked="" disabled="" type="checkbox"> done`, `<input disabled="" type="checkbox"> open`},
+		},
+		{
+			name:  "code block language",
+			notes: "```go\nx := 1\n```",
+			want:  []string{`<code class="language-go">`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := string(renderNotes(test.notes))
+			for _, want := range test.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("renderNotes(%q) = %q, want it to contain %q", test.notes, got, want)
+				}
+			}
+
+			for _, notWant := range test.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("renderNotes(%q) = %q, want no %q", test.notes, got, notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderNotesLinkRel(t *testing.T) {
+	notes := "[x](https://example.com) and https://example.org"
+	got := string(renderNotes(notes))
+	if count := strings.Count(got, "<a "); count != 2 {
+		t.Fatalf("renderNotes(%q) = %q, want 2 links", notes, got)
+	}
+
+	for _, link := range strings.Split(got, "<a ")[1:] {
+		start := strings.Index(link, `rel="`)
+		if start < 0 {
+			t.Errorf("link %q has no rel", link)
+			continue
+		}
+
+		rel := link[start+len(`rel="`):]
+		rel = rel[:strings.Index(rel, `"`)]
+		fields := strings.Fields(rel)
+		for _, want := range []string{"nofollow", "noopener"} {
+			if !slices.Contains(fields, want) {
+				t.Errorf("link %q has rel %q, want %s", link, rel, want)
+			}
+		}
+	}
+}
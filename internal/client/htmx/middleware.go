@@ -2,42 +2,12 @@ package htmx
 
 import (
 	"context"
-	"log"
 	"net/http"
-	"time"
 
 	"github.com/skaisanlahti/try-go-htmx/internal/entity"
 	"github.com/skaisanlahti/try-go-htmx/internal/security"
 )
 
-type responseRecorder struct {
-	http.ResponseWriter
-	statusCode int
-}
-
-func (recorder *responseRecorder) WriteHeader(code int) {
-	recorder.statusCode = code
-	recorder.ResponseWriter.WriteHeader(code)
-}
-
-func newRequestLogger() func(http.HandlerFunc) http.HandlerFunc {
-	return func(next http.HandlerFunc) http.HandlerFunc {
-		return func(response http.ResponseWriter, request *http.Request) {
-			start := time.Now()
-			recorder := &responseRecorder{ResponseWriter: response}
-			next(recorder, request)
-			duration := time.Since(start).Milliseconds()
-			log.Printf(
-				"%s %s | status %d | duration %d ms",
-				request.Method,
-				request.URL.Path,
-				recorder.statusCode,
-				duration,
-			)
-		}
-	}
-}
-
 func newSessionGuard(securityService *security.SecurityService, redirectUrl string) func(http.HandlerFunc) http.HandlerFunc {
 	return func(next http.HandlerFunc) http.HandlerFunc {
 		return func(response http.ResponseWriter, request *http.Request) {
@@ -59,6 +29,22 @@ func newSessionGuard(securityService *security.SecurityService, redirectUrl stri
 	}
 }
 
+// newRoleGuard only lets users with the role through. It runs after the session guard, which
+// places the user in the request context.
+func newRoleGuard(role string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(response http.ResponseWriter, request *http.Request) {
+			user, ok := extractUserFromContext(request)
+			if !ok || !user.HasRole(role) {
+				http.Error(response, "Forbidden.", http.StatusForbidden)
+				return
+			}
+
+			next(response, request)
+		}
+	}
+}
+
 func addUserToContext(user entity.User, request *http.Request) *http.Request {
 	return request.WithContext(context.WithValue(request.Context(), "user", user))
 }
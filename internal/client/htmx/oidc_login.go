@@ -0,0 +1,114 @@
+package htmx
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/security"
+)
+
+type oidcCallbackPageData struct {
+	Redirect string
+	Error    string
+}
+
+type oidcLoginController struct {
+	securityService *security.SecurityService
+	*defaultRenderer
+}
+
+func newOidcLoginController(security *security.SecurityService) *oidcLoginController {
+	callbackPage := template.Must(template.ParseFS(templateFiles, "web/html/page.html", "web/html/oidc_callback_page.html"))
+	return &oidcLoginController{security, newDefaultRenderer(callbackPage)}
+}
+
+func (this *oidcLoginController) login(response http.ResponseWriter, request *http.Request) {
+	if this.securityService.IsLoggedIn(request) {
+		http.Redirect(response, request, "/htmx/todos", http.StatusSeeOther)
+		return
+	}
+
+	redirectUrl, err := this.securityService.BeginOidcLogin(request.URL.Query().Get("provider"), 0, response)
+	if err != nil {
+		this.render(response, "page", oidcCallbackPageData{Error: err.Error()}, nil)
+		return
+	}
+
+	http.Redirect(response, request, redirectUrl, http.StatusSeeOther)
+}
+
+func (this *oidcLoginController) link(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	redirectUrl, err := this.securityService.BeginOidcLogin(request.URL.Query().Get("provider"), user.Id, response)
+	if err != nil {
+		this.render(response, "page", oidcCallbackPageData{Error: err.Error()}, nil)
+		return
+	}
+
+	http.Redirect(response, request, redirectUrl, http.StatusSeeOther)
+}
+
+func (this *oidcLoginController) callback(response http.ResponseWriter, request *http.Request) {
+	linked, err := this.securityService.CompleteOidcLogin(response, request)
+	switch {
+	case err == security.ErrSecondFactorRequired:
+		this.render(response, "page", oidcCallbackPageData{Redirect: "/htmx/login/verify"}, nil)
+	case err != nil:
+		log.Println(err.Error())
+		this.render(response, "page", oidcCallbackPageData{Error: err.Error()}, nil)
+	case linked:
+		this.render(response, "page", oidcCallbackPageData{Redirect: "/htmx/account"}, nil)
+	default:
+		this.render(response, "page", oidcCallbackPageData{Redirect: "/htmx/todo-lists"}, nil)
+	}
+}
+
+var (
+	ErrIdentityIdMissing   = errors.New("Identity id not found in query.")
+	ErrIdentityIdNotNumber = errors.New("Identity id not a number.")
+)
+
+func extractIdentityId(url *url.URL) (int, error) {
+	maybeId := url.Query().Get("id")
+	if maybeId == "" {
+		return 0, ErrIdentityIdMissing
+	}
+
+	id, err := strconv.Atoi(maybeId)
+	if err != nil {
+		log.Println(err.Error())
+		return 0, ErrIdentityIdNotNumber
+	}
+
+	return id, nil
+}
+
+func (this *oidcLoginController) unlink(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	id, err := extractIdentityId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = this.securityService.UnlinkExternalIdentity(user, id); err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,84 @@
+package htmx
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/security"
+)
+
+type passwordPageData struct {
+	Key     int64
+	Error   string
+	Message string
+}
+
+type passwordPageController struct {
+	securityService *security.SecurityService
+	*defaultRenderer
+}
+
+func newPasswordPageController(security *security.SecurityService) *passwordPageController {
+	passwordPage := template.Must(template.ParseFS(templateFiles, "web/html/page.html", "web/html/nav.html", "web/html/password_page.html"))
+	return &passwordPageController{security, newDefaultRenderer(passwordPage)}
+}
+
+func (this *passwordPageController) page(response http.ResponseWriter, request *http.Request) {
+	this.render(response, "page", passwordPageData{
+		Key: newRenderKey(),
+	}, nil)
+}
+
+func (this *passwordPageController) changePassword(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	currentPassword := request.FormValue("currentPassword")
+	newPassword := request.FormValue("newPassword")
+	confirmPassword := request.FormValue("confirmPassword")
+	renderError := func(errorMessage string) {
+		this.render(response, "form", passwordPageData{
+			Key:   newRenderKey(),
+			Error: errorMessage,
+		}, nil)
+	}
+
+	if currentPassword == "" {
+		renderError("Current password is required.")
+		return
+	}
+
+	if newPassword == "" {
+		renderError("New password is required.")
+		return
+	}
+
+	if newPassword != confirmPassword {
+		renderError("Passwords don't match.")
+		return
+	}
+
+	err := this.securityService.ChangePassword(user, currentPassword, newPassword, request)
+	if err == security.ErrInvalidCredentials {
+		renderError("Current password is incorrect.")
+		return
+	}
+
+	if err == security.ErrPasswordTooLong {
+		renderError(err.Error())
+		return
+	}
+
+	if err != nil {
+		renderError("Something went wrong.")
+		return
+	}
+
+	this.render(response, "form", passwordPageData{
+		Key:     newRenderKey(),
+		Message: "Password changed. Other sessions have been logged out.",
+	}, nil)
+}
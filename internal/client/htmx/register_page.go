@@ -10,6 +10,7 @@ import (
 type registerPageData struct {
 	Key      int64
 	Name     string
+	Email    string
 	Password string
 	Error    string
 }
@@ -44,11 +45,13 @@ func (this *registerPageController) registerUser(response http.ResponseWriter, r
 	}
 
 	name := request.FormValue("name")
+	email := request.FormValue("email")
 	password := request.FormValue("password")
 	renderError := func(errorMessage string) {
 		this.render(response, "form", registerPageData{
 			Key:      newRenderKey(),
 			Name:     name,
+			Email:    email,
 			Password: password,
 			Error:    errorMessage,
 		}, nil)
@@ -64,8 +67,8 @@ func (this *registerPageController) registerUser(response http.ResponseWriter, r
 		return
 	}
 
-	err := this.securityService.RegisterUser(name, password, response)
-	if err == security.ErrUserAlreadyExists {
+	err := this.securityService.RegisterUser(name, email, password, response, request)
+	if err == security.ErrUserAlreadyExists || err == security.ErrPasswordTooLong {
 		renderError(err.Error())
 		return
 	}
@@ -18,8 +18,8 @@ func newDefaultRenderer(t *template.Template) *defaultRenderer {
 }
 
 func (this *defaultRenderer) render(response http.ResponseWriter, block string, data any, headers extraHeaders) {
-	buffer := &bytes.Buffer{}
-	if err := this.template.ExecuteTemplate(buffer, block, data); err != nil {
+	buffer, err := this.renderBlock(block, data)
+	if err != nil {
 		http.Error(response, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -35,6 +35,13 @@ func (this *defaultRenderer) render(response http.ResponseWriter, block string,
 	return
 }
 
+// renderBlock renders the block without writing a response, for blocks sent as part of a stream.
+func (this *defaultRenderer) renderBlock(block string, data any) (*bytes.Buffer, error) {
+	buffer := &bytes.Buffer{}
+	err := this.template.ExecuteTemplate(buffer, block, data)
+	return buffer, err
+}
+
 func newRenderKey() int64 {
 	return time.Now().UnixMilli()
 }
@@ -0,0 +1,83 @@
+package htmx
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/security"
+)
+
+type resetPasswordPageData struct {
+	Key   int64
+	Token string
+	Done  bool
+	Error string
+}
+
+type resetPasswordPageController struct {
+	securityService *security.SecurityService
+	*defaultRenderer
+}
+
+func newResetPasswordPageController(security *security.SecurityService) *resetPasswordPageController {
+	resetPasswordPage := template.Must(template.ParseFS(templateFiles, "web/html/page.html", "web/html/reset_password_page.html"))
+	return &resetPasswordPageController{security, newDefaultRenderer(resetPasswordPage)}
+}
+
+func (this *resetPasswordPageController) page(response http.ResponseWriter, request *http.Request) {
+	token := request.URL.Query().Get("token")
+	if !this.securityService.IsResetTokenValid(token) {
+		token = ""
+	}
+
+	this.render(response, "page", resetPasswordPageData{
+		Key:   newRenderKey(),
+		Token: token,
+	}, nil)
+}
+
+func (this *resetPasswordPageController) resetPassword(response http.ResponseWriter, request *http.Request) {
+	token := request.FormValue("token")
+	newPassword := request.FormValue("newPassword")
+	confirmPassword := request.FormValue("confirmPassword")
+	renderError := func(errorMessage string) {
+		this.render(response, "form", resetPasswordPageData{
+			Key:   newRenderKey(),
+			Token: token,
+			Error: errorMessage,
+		}, nil)
+	}
+
+	if newPassword == "" {
+		renderError("New password is required.")
+		return
+	}
+
+	if newPassword != confirmPassword {
+		renderError("Passwords don't match.")
+		return
+	}
+
+	err := this.securityService.ResetPassword(token, newPassword, request)
+	if err == security.ErrInvalidResetToken {
+		this.render(response, "form", resetPasswordPageData{
+			Key: newRenderKey(),
+		}, nil)
+		return
+	}
+
+	if err == security.ErrPasswordTooLong {
+		renderError(err.Error())
+		return
+	}
+
+	if err != nil {
+		renderError("Something went wrong.")
+		return
+	}
+
+	this.render(response, "form", resetPasswordPageData{
+		Key:  newRenderKey(),
+		Done: true,
+	}, nil)
+}
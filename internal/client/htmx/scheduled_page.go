@@ -0,0 +1,76 @@
+package htmx
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/todo"
+)
+
+type scheduledItemData struct {
+	entity.ScheduledTodo
+	Now time.Time
+}
+
+type scheduledPageData struct {
+	Title string
+	Empty string
+	Todos []scheduledItemData
+}
+
+// scheduledPageController shows todos from every list of the user by their due dates.
+type scheduledPageController struct {
+	todoService *todo.TodoService
+	*defaultRenderer
+}
+
+func newScheduledPageController(todo *todo.TodoService) *scheduledPageController {
+	scheduledPage := template.Must(template.ParseFS(templateFiles, "web/html/page.html", "web/html/nav.html", "web/html/scheduled_page.html"))
+	return &scheduledPageController{todo, newDefaultRenderer(scheduledPage)}
+}
+
+func (this *scheduledPageController) renderTodos(
+	response http.ResponseWriter,
+	request *http.Request,
+	title string,
+	empty string,
+	find func(user entity.User) ([]entity.ScheduledTodo, error),
+) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	todos, err := find(user)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().In(user.Location())
+	items := make([]scheduledItemData, 0, len(todos))
+	for _, todo := range todos {
+		items = append(items, scheduledItemData{todo, now})
+	}
+
+	this.render(response, "page", scheduledPageData{
+		Title: title,
+		Empty: empty,
+		Todos: items,
+	}, nil)
+}
+
+func (this *scheduledPageController) today(response http.ResponseWriter, request *http.Request) {
+	this.renderTodos(response, request, "Today", "Nothing is due today.", this.todoService.FindTodosDueToday)
+}
+
+func (this *scheduledPageController) upcoming(response http.ResponseWriter, request *http.Request) {
+	this.renderTodos(response, request, "Upcoming", "Nothing is due in the next week.", this.todoService.FindUpcomingTodos)
+}
+
+func (this *scheduledPageController) overdue(response http.ResponseWriter, request *http.Request) {
+	this.renderTodos(response, request, "Overdue", "Nothing is overdue.", this.todoService.FindOverdueTodos)
+}
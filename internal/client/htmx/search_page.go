@@ -0,0 +1,42 @@
+package htmx
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/todo"
+)
+
+type searchResultsData struct {
+	Query   string
+	Results []entity.TodoSearchResult
+}
+
+// searchController finds todos across the lists of the user for the search box in the nav.
+type searchController struct {
+	todoService *todo.TodoService
+	*defaultRenderer
+}
+
+func newSearchController(todo *todo.TodoService) *searchController {
+	searchResults := template.Must(template.ParseFS(templateFiles, "web/html/search_results.html"))
+	return &searchController{todo, newDefaultRenderer(searchResults)}
+}
+
+func (this *searchController) search(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	query := request.URL.Query().Get("q")
+	results, err := this.todoService.SearchTodos(user, query)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	this.render(response, "results", searchResultsData{query, results}, nil)
+}
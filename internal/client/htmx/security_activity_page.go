@@ -0,0 +1,35 @@
+package htmx
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/security"
+)
+
+type securityActivityPageData struct {
+	Events []entity.AuditEvent
+}
+
+type securityActivityPageController struct {
+	securityService *security.SecurityService
+	*defaultRenderer
+}
+
+func newSecurityActivityPageController(security *security.SecurityService) *securityActivityPageController {
+	securityActivityPage := template.Must(template.ParseFS(templateFiles, "web/html/page.html", "web/html/nav.html", "web/html/audit_events.html", "web/html/security_activity_page.html"))
+	return &securityActivityPageController{security, newDefaultRenderer(securityActivityPage)}
+}
+
+func (this *securityActivityPageController) page(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	this.render(response, "page", securityActivityPageData{
+		Events: this.securityService.FindSecurityActivity(user),
+	}, nil)
+}
@@ -0,0 +1,103 @@
+package htmx
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/todo"
+)
+
+var ErrActivityIdNotNumber = errors.New("Activity id not a number.")
+
+// activityEntryData carries an entry of the activity log with its time relative to now and in
+// full in the time zone of the user.
+type activityEntryData struct {
+	entity.TodoActivity
+	Ago string
+	At  string
+}
+
+// activityData is a page of the activity log. MoreBeforeId is the last entry of the page when
+// older entries are left, zero otherwise.
+type activityData struct {
+	TodoListId   int
+	Entries      []activityEntryData
+	MoreBeforeId int64
+}
+
+// relativeTime tells how long before now the time was in the largest whole unit. Times older than
+// a month are shown as dates.
+func relativeTime(now time.Time, then time.Time) string {
+	elapsed := now.Sub(then)
+	switch {
+	case elapsed < time.Minute:
+		return "just now"
+	case elapsed < time.Hour:
+		return unitsAgo(int(elapsed/time.Minute), "minute")
+	case elapsed < 24*time.Hour:
+		return unitsAgo(int(elapsed/time.Hour), "hour")
+	case elapsed < 30*24*time.Hour:
+		return unitsAgo(int(elapsed/(24*time.Hour)), "day")
+	}
+
+	return then.In(now.Location()).Format("Jan 2, 2006")
+}
+
+func unitsAgo(count int, unit string) string {
+	if count == 1 {
+		return fmt.Sprintf("1 %s ago", unit)
+	}
+
+	return fmt.Sprintf("%d %ss ago", count, unit)
+}
+
+// activity renders a page of the activity log of the list. The first page fills the activity tab,
+// the next ones are asked for with the id of the last entry shown in the before parameter.
+func (this *todoPageController) activity(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var beforeId int64
+	if maybeBeforeId := request.URL.Query().Get("before"); maybeBeforeId != "" {
+		beforeId, err = strconv.ParseInt(maybeBeforeId, 10, 64)
+		if err != nil {
+			http.Error(response, ErrActivityIdNotNumber.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, more, err := this.todoService.FindActivity(user, listId, beforeId)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	now := time.Now().In(user.Location())
+	data := activityData{TodoListId: listId}
+	for _, entry := range entries {
+		data.Entries = append(data.Entries, activityEntryData{
+			TodoActivity: entry,
+			Ago:          relativeTime(now, entry.Created),
+			At:           entry.Created.In(user.Location()).Format("Mon 2 Jan 2006 15:04"),
+		})
+	}
+
+	if more {
+		data.MoreBeforeId = entries[len(entries)-1].Id
+	}
+
+	this.render(response, "activity", data, nil)
+}
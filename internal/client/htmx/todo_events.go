@@ -0,0 +1,135 @@
+package htmx
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/todo"
+)
+
+// eventHeartbeat is how often an idle event stream sends a comment, so proxies don't close it and
+// a closed connection is noticed.
+const eventHeartbeat = 15 * time.Second
+
+// writeEvent sends a server-sent event. Each line of the data goes into a data field of its own.
+func writeEvent(response io.Writer, id int, name string, data string) error {
+	var event strings.Builder
+	fmt.Fprintf(&event, "id: %d\nevent: %s\n", id, name)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&event, "data: %s\n", line)
+	}
+
+	event.WriteString("\n")
+	_, err := io.WriteString(response, event.String())
+	return err
+}
+
+// events streams the changes to a list to the page. A todo that changed in place is sent as its
+// rendered item block in an "item-<id>" event, other changes send a "list" event that makes the
+// page load the list again.
+func (this *todoPageController) events(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events, unsubscribe, err := this.todoService.SubscribeToList(user, listId)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	defer unsubscribe()
+
+	// the stream outlives the write timeout of the server
+	controller := http.NewResponseController(response)
+	if err = controller.SetWriteDeadline(time.Time{}); err != nil {
+		log.Println(err.Error())
+	}
+
+	response.Header().Set("Content-Type", "text/event-stream")
+	response.Header().Set("Cache-Control", "no-cache")
+	response.Header().Set("X-Accel-Buffering", "no")
+	response.WriteHeader(http.StatusOK)
+
+	// a browser connecting again may have missed events, so it gets the whole list first
+	eventId := 0
+	if request.Header.Get("Last-Event-ID") != "" {
+		eventId++
+		if err = writeEvent(response, eventId, "list", strconv.Itoa(listId)); err != nil {
+			return
+		}
+	}
+
+	if err = controller.Flush(); err != nil {
+		log.Println(err.Error())
+		return
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case <-heartbeat.C:
+			_, err = io.WriteString(response, ": heartbeat\n\n")
+		case event, open := <-events:
+			if !open {
+				return
+			}
+
+			eventId++
+			err = this.writeTodoEvent(response, user, eventId, event)
+		}
+
+		if err == nil {
+			err = controller.Flush()
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeTodoEvent renders the todo of the event for the user, or asks for the whole list when the
+// event has no todo or the todo can't be shown anymore.
+func (this *todoPageController) writeTodoEvent(response io.Writer, user entity.User, eventId int, event todo.TodoEvent) error {
+	listEvent := strconv.Itoa(event.ListId)
+	if event.TodoId == 0 {
+		return writeEvent(response, eventId, "list", listEvent)
+	}
+
+	list, err := this.todoService.FindListById(user, event.ListId)
+	if err != nil {
+		return err
+	}
+
+	found, err := this.todoService.FindTodoById(user, event.TodoId)
+	if err != nil {
+		return writeEvent(response, eventId, "list", listEvent)
+	}
+
+	items := this.newListItems(user, list, []entity.Todo{found})
+	item, err := this.renderBlock("item", items[0])
+	if err != nil {
+		log.Println(err.Error())
+		return writeEvent(response, eventId, "list", listEvent)
+	}
+
+	return writeEvent(response, eventId, "item-"+strconv.Itoa(found.Id), item.String())
+}
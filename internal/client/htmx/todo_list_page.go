@@ -1,6 +1,7 @@
 package htmx
 
 import (
+	"fmt"
 	"html/template"
 	"net/http"
 
@@ -8,11 +9,42 @@ import (
 	"github.com/skaisanlahti/try-go-htmx/internal/todo"
 )
 
+// todoListPageData holds a page of the lists, the lists the user owns in TodoLists and the lists
+// shared with them in Shared. SharedHeading is set on the page the shared lists start on.
 type todoListPageData struct {
-	Key       int64
-	Name      string
-	TodoLists []entity.TodoList
-	Error     string
+	Key           int64
+	Name          string
+	TodoLists     []entity.TodoList
+	Shared        []entity.TodoList
+	SharedHeading bool
+	Next          todo.ListCursor
+	Last          todo.ListCursor
+	Total         int
+	Error         string
+	Transfer      transferData
+}
+
+// newTodoListPageData splits the page that starts after the cursor into owned and shared lists,
+// the owned ones come first.
+func newTodoListPageData(page todo.ListPage, after todo.ListCursor) todoListPageData {
+	data := todoListPageData{
+		Key:      newRenderKey(),
+		Next:     page.Next,
+		Last:     page.Last,
+		Total:    page.Total,
+		Transfer: newTransferData(0, false),
+	}
+
+	for _, list := range page.Lists {
+		if list.IsOwner() {
+			data.TodoLists = append(data.TodoLists, list)
+		} else {
+			data.Shared = append(data.Shared, list)
+		}
+	}
+
+	data.SharedHeading = len(data.Shared) > 0 && !after.Shared
+	return data
 }
 
 type todoListPageController struct {
@@ -21,7 +53,7 @@ type todoListPageController struct {
 }
 
 func newTodoListPageController(todo *todo.TodoService) *todoListPageController {
-	todoListPage := template.Must(template.ParseFS(templateFiles, "web/html/page.html", "web/html/todo_list_page.html"))
+	todoListPage := template.Must(template.ParseFS(templateFiles, "web/html/page.html", "web/html/nav.html", "web/html/toast.html", "web/html/todo_transfer.html", "web/html/todo_list_page.html"))
 	return &todoListPageController{todo, newDefaultRenderer(todoListPage)}
 }
 
@@ -32,12 +64,17 @@ func (this *todoListPageController) page(response http.ResponseWriter, request *
 		return
 	}
 
-	this.render(response, "page", todoListPageData{
-		Key:       newRenderKey(),
-		TodoLists: this.todoService.FindListsByUserId(user.Id),
-	}, nil)
+	page, err := this.todoService.FindListPage(user, todo.ListCursor{}, todo.ListCursor{})
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	this.render(response, "page", newTodoListPageData(page, todo.ListCursor{}), nil)
 }
 
+// lists renders the lists again through the list in the through parameter, so the pages loaded
+// stay.
 func (this *todoListPageController) lists(response http.ResponseWriter, request *http.Request) {
 	user, ok := extractUserFromContext(request)
 	if !ok {
@@ -45,10 +82,42 @@ func (this *todoListPageController) lists(response http.ResponseWriter, request
 		return
 	}
 
-	this.render(response, "list", todoListPageData{
-		Key:       newRenderKey(),
-		TodoLists: this.todoService.FindListsByUserId(user.Id),
-	}, nil)
+	through, err := todo.ParseListCursor(request.URL.Query().Get("through"))
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := this.todoService.FindListPage(user, todo.ListCursor{}, through)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	this.render(response, "reload", newTodoListPageData(page, todo.ListCursor{}), nil)
+}
+
+// more renders the page of the lists after the cursor in the after parameter.
+func (this *todoListPageController) more(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	after, err := todo.ParseListCursor(request.URL.Query().Get("after"))
+	if err != nil || after.IsZero() {
+		http.Error(response, todo.ErrCursorInvalid.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := this.todoService.FindListPage(user, after, todo.ListCursor{})
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	this.render(response, "more", newTodoListPageData(page, after), nil)
 }
 
 func (this *todoListPageController) addList(response http.ResponseWriter, request *http.Request) {
@@ -59,7 +128,7 @@ func (this *todoListPageController) addList(response http.ResponseWriter, reques
 		return
 	}
 
-	if _, err := this.todoService.AddList(name, user.Id); err != nil {
+	if _, err := this.todoService.AddList(user, name); err != nil {
 		this.render(response, "form", todoListPageData{
 			Key:   newRenderKey(),
 			Name:  name,
@@ -76,14 +145,245 @@ func (this *todoListPageController) addList(response http.ResponseWriter, reques
 }
 
 func (this *todoListPageController) removeList(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
 	listId, err := extractListId(request.URL)
 	if err != nil {
 		http.Error(response, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if err = this.todoService.RemoveList(listId); err != nil {
-		http.Error(response, err.Error(), http.StatusInternalServerError)
+	if err = this.todoService.RemoveList(user, listId); err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	this.render(response, "toast", toastData{
+		Message: "Todo list moved to the trash.",
+		UndoUrl: fmt.Sprintf("/htmx/api/trash/lists/restore?listid=%d", listId),
+	}, nil)
+}
+
+type todoListEditData struct {
+	Id    int
+	Name  string
+	Error string
+}
+
+func (this *todoListPageController) item(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := this.todoService.FindListById(user, listId)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	this.render(response, "item", list, nil)
+}
+
+func (this *todoListPageController) editList(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := this.todoService.FindListById(user, listId)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	this.render(response, "edit", todoListEditData{Id: list.Id, Name: list.Name}, nil)
+}
+
+func (this *todoListPageController) renameList(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := request.FormValue("name")
+	list, err := this.todoService.RenameList(user, listId, name)
+	if err != nil {
+		if status := todo.ErrorStatus(err, http.StatusOK); status != http.StatusOK {
+			http.Error(response, err.Error(), status)
+			return
+		}
+
+		this.render(response, "edit", todoListEditData{Id: listId, Name: name, Error: err.Error()}, nil)
+		return
+	}
+
+	this.render(response, "item", list, nil)
+}
+
+type roleOption struct {
+	Value    string
+	Label    string
+	Selected bool
+}
+
+var roleLabels = map[string]string{
+	entity.ListRoleEditor: "Can edit",
+	entity.ListRoleViewer: "Can view",
+}
+
+func newRoleOptions(selected string) []roleOption {
+	options := make([]roleOption, 0, len(entity.SharedListRoles))
+	for _, role := range entity.SharedListRoles {
+		options = append(options, roleOption{role, roleLabels[role], role == selected})
+	}
+
+	return options
+}
+
+// todoListShareData holds the share dialog of a list with the members it's shared with.
+type todoListShareData struct {
+	Id       int
+	Name     string
+	Members  []entity.TodoListMember
+	UserName string
+	Roles    []roleOption
+	Error    string
+}
+
+// renderShare renders the share dialog of the list, keeping the form values when there's an error
+// to show.
+func (this *todoListPageController) renderShare(response http.ResponseWriter, user entity.User, listId int, userName string, role string, shareErr error) {
+	list, err := this.todoService.FindListById(user, listId)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	members, err := this.todoService.FindListMembers(user, listId)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	data := todoListShareData{Id: list.Id, Name: list.Name, Members: members, Roles: newRoleOptions(entity.ListRoleEditor)}
+	if shareErr != nil {
+		data.UserName = userName
+		data.Roles = newRoleOptions(role)
+		data.Error = shareErr.Error()
+	}
+
+	this.render(response, "share", data, nil)
+}
+
+func (this *todoListPageController) share(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	this.renderShare(response, user, listId, "", "", nil)
+}
+
+func (this *todoListPageController) shareList(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userName := request.FormValue("username")
+	role := request.FormValue("role")
+	err = this.todoService.ShareList(user, listId, userName, role)
+	if status := todo.ErrorStatus(err, http.StatusOK); status != http.StatusOK {
+		http.Error(response, err.Error(), status)
+		return
+	}
+
+	this.renderShare(response, user, listId, userName, role, err)
+}
+
+func (this *todoListPageController) unshareList(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	memberId, err := extractUserId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = this.todoService.UnshareList(user, listId, memberId)
+	if status := todo.ErrorStatus(err, http.StatusOK); status != http.StatusOK {
+		http.Error(response, err.Error(), status)
+		return
+	}
+
+	this.renderShare(response, user, listId, "", "", err)
+}
+
+func (this *todoListPageController) leaveList(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = this.todoService.LeaveList(user, listId); err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusBadRequest))
 		return
 	}
 
@@ -2,23 +2,228 @@ package htmx
 
 import (
 	"errors"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/skaisanlahti/try-go-htmx/internal/entity"
 	"github.com/skaisanlahti/try-go-htmx/internal/todo"
 )
 
+// todoPageData renders the list page. SharedBy is the owner of a list shared with the user and
+// ReadOnly is set for its viewers. Todos are a page of the list, Next is where the next page starts
+// when more are left and Last the last todo loaded.
 type todoPageData struct {
 	Key          int64
 	TodoListId   int
 	TodoListName string
+	SharedBy     string
+	ReadOnly     bool
 	Task         string
-	Todos        []entity.Todo
+	Due          string
+	DueTime      string
+	Priorities   []priorityOption
+	Tags         string
+	Recurrence   string
+	Todos        []todoItemData
+	Next         todo.TodoCursor
+	Last         todo.TodoCursor
+	Total        int
 	Error        string
+	Filter       todoFilterData
+	MoveTargets  moveTargetsData
+	Toast        *toastData
+	Transfer     transferData
+}
+
+type priorityOption struct {
+	Value    int
+	Label    string
+	Selected bool
+}
+
+func newPriorityOptions(selected int) []priorityOption {
+	options := make([]priorityOption, 0, len(entity.Priorities))
+	for _, priority := range entity.Priorities {
+		options = append(options, priorityOption{priority, entity.PriorityLabel(priority), priority == selected})
+	}
+
+	return options
+}
+
+// todoFilterData holds the state of the filter controls. Query is the filter encoded for urls so
+// requests that render the list again keep it.
+type todoFilterData struct {
+	todo.TodoFilter
+	Tags       []entity.Tag
+	Priorities []priorityOption
+	Query      template.URL
+}
+
+func newTodoFilterData(listId int, filter todo.TodoFilter, tags []entity.Tag) todoFilterData {
+	priorities := []priorityOption{{entity.PriorityNone, "Any priority", false}}
+	for _, priority := range entity.Priorities[1:] {
+		priorities = append(priorities, priorityOption{priority, entity.PriorityLabel(priority) + " and up", false})
+	}
+
+	for i := range priorities {
+		priorities[i].Selected = priorities[i].Value == filter.Priority
+	}
+
+	return todoFilterData{filter, tags, priorities, template.URL(encodeTodoFilter(listId, filter))}
+}
+
+// extractTodoFilter reads the filter controls from the query. Unknown values are ignored so a
+// mangled bookmark shows the whole list instead of an error.
+func extractTodoFilter(query url.Values) todo.TodoFilter {
+	filter := todo.TodoFilter{Tag: strings.TrimSpace(query.Get("tag"))}
+	if priority, err := strconv.Atoi(query.Get("priority")); err == nil {
+		filter.Priority = priority
+	}
+
+	if done := query.Get("done"); done == todo.DoneOpen || done == todo.DoneDone {
+		filter.Done = done
+	}
+
+	return filter
+}
+
+func encodeTodoFilter(listId int, filter todo.TodoFilter) string {
+	query := url.Values{}
+	query.Set("listid", strconv.Itoa(listId))
+	if filter.Tag != "" {
+		query.Set("tag", filter.Tag)
+	}
+
+	if filter.Priority > entity.PriorityNone {
+		query.Set("priority", strconv.Itoa(filter.Priority))
+	}
+
+	if filter.Done != todo.DoneAny {
+		query.Set("done", filter.Done)
+	}
+
+	return query.Encode()
+}
+
+// todoItemData carries the current time of the user along with the todo so the item can be shown
+// as overdue. The subtasks are items of their own so the item block can render them.
+type todoItemData struct {
+	entity.Todo
+	Now           time.Time
+	Subtasks      []todoItemData
+	CanAddSubtask bool
+	// OfferCompleteSubtasks is set right after a todo with open subtasks is marked done.
+	OfferCompleteSubtasks bool
+	SubtaskTask           string
+	SubtaskError          string
+	ReadOnly              bool
+}
+
+func (this *todoPageController) newTodoItem(user entity.User, todo entity.Todo) todoItemData {
+	return todoItemData{
+		Todo:          todo,
+		Now:           time.Now().In(user.Location()),
+		Subtasks:      this.newTodoItems(user, todo.Subtasks),
+		CanAddSubtask: this.todoService.CanAddSubtask(todo),
+	}
+}
+
+func (this *todoPageController) newTodoItems(user entity.User, todos []entity.Todo) []todoItemData {
+	items := make([]todoItemData, 0, len(todos))
+	for _, todo := range todos {
+		items = append(items, this.newTodoItem(user, todo))
+	}
+
+	return items
+}
+
+// newListItems renders the todos of the list without the controls that change them when the user
+// can only view the list.
+func (this *todoPageController) newListItems(user entity.User, list entity.TodoList, todos []entity.Todo) []todoItemData {
+	items := this.newTodoItems(user, todos)
+	if !list.CanEdit() {
+		makeReadOnly(items)
+	}
+
+	return items
+}
+
+func makeReadOnly(items []todoItemData) {
+	for i := range items {
+		items[i].ReadOnly = true
+		items[i].CanAddSubtask = false
+		makeReadOnly(items[i].Subtasks)
+	}
+}
+
+// moveTargetsData is a page of the other lists the user can move todos of the list to. Next is the
+// last list read when more are left. Oob is set when the page is added to a picker already shown.
+type moveTargetsData struct {
+	TodoListId int
+	Lists      []entity.TodoList
+	Next       todo.ListCursor
+	Oob        bool
+}
+
+func (this moveTargetsData) IsEmpty() bool {
+	return len(this.Lists) == 0 && this.Next.IsZero()
+}
+
+// findMoveTargets reads the page of the lists of the user after the cursor and keeps the ones todos
+// of the list can be moved to.
+func (this *todoPageController) findMoveTargets(user entity.User, listId int, after todo.ListCursor) (moveTargetsData, error) {
+	page, err := this.todoService.FindListPage(user, after, todo.ListCursor{})
+	if err != nil {
+		return moveTargetsData{}, err
+	}
+
+	data := moveTargetsData{TodoListId: listId, Next: page.Next}
+	for _, list := range page.Lists {
+		if list.CanEdit() && list.Id != listId {
+			data.Lists = append(data.Lists, list)
+		}
+	}
+
+	return data, nil
+}
+
+// sharedBy returns the owner of the list when it's shared with the user.
+func sharedBy(list entity.TodoList) string {
+	if list.IsOwner() {
+		return ""
+	}
+
+	return list.OwnerName
+}
+
+// extractDetails reads the due date, priority and tag inputs of the add and edit forms.
+func extractDetails(request *http.Request) (todo.TodoDetails, error) {
+	due, hasTime, err := entity.ParseDue(request.FormValue("due"), request.FormValue("dueTime"))
+	if err != nil {
+		return todo.TodoDetails{}, err
+	}
+
+	priority := entity.PriorityNone
+	if maybePriority := request.FormValue("priority"); maybePriority != "" {
+		priority, err = strconv.Atoi(maybePriority)
+		if err != nil {
+			return todo.TodoDetails{}, errors.New("Priority is invalid.")
+		}
+	}
+
+	return todo.TodoDetails{
+		Due:        due,
+		DueHasTime: hasTime,
+		Priority:   priority,
+		Tags:       entity.ParseTags(request.FormValue("tags")),
+		Recurrence: request.FormValue("recurrence"),
+	}, nil
 }
 
 type todoPageController struct {
@@ -27,7 +232,7 @@ type todoPageController struct {
 }
 
 func newTodoPageController(todo *todo.TodoService) *todoPageController {
-	todoPageTemplate := template.Must(template.ParseFS(templateFiles, "web/html/page.html", "web/html/todo_page.html"))
+	todoPageTemplate := template.Must(template.ParseFS(templateFiles, "web/html/page.html", "web/html/nav.html", "web/html/toast.html", "web/html/todo_activity.html", "web/html/todo_transfer.html", "web/html/todo_page.html"))
 	return &todoPageController{todo, newDefaultRenderer(todoPageTemplate)}
 }
 
@@ -52,6 +257,12 @@ func extractListId(url *url.URL) (int, error) {
 }
 
 func (this *todoPageController) page(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
 	listId, err := extractListId(request.URL)
 	if err != nil {
 		log.Println(err.Error())
@@ -59,10 +270,22 @@ func (this *todoPageController) page(response http.ResponseWriter, request *http
 		return
 	}
 
-	list, err := this.todoService.FindListById(listId)
+	list, err := this.todoService.FindListById(user, listId)
 	if err != nil {
-		log.Println(err.Error())
-		http.Redirect(response, request, "/htmx/todo-lists", http.StatusSeeOther)
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	filter := extractTodoFilter(request.URL.Query())
+	page, err := this.todoService.FindTodoPage(user, listId, filter, todo.TodoCursor{}, todo.TodoCursor{})
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	targets, err := this.findMoveTargets(user, listId, todo.ListCursor{})
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -70,26 +293,152 @@ func (this *todoPageController) page(response http.ResponseWriter, request *http
 		Key:          newRenderKey(),
 		TodoListId:   listId,
 		TodoListName: list.Name,
-		Todos:        this.todoService.FindTodosByListId(listId),
+		SharedBy:     sharedBy(list),
+		ReadOnly:     !list.CanEdit(),
+		Priorities:   newPriorityOptions(entity.PriorityNone),
+		Todos:        this.newListItems(user, list, page.Todos),
+		Next:         page.Next,
+		Last:         page.Last,
+		Total:        page.Total,
+		Filter:       newTodoFilterData(listId, filter, this.todoService.FindListTags(list)),
+		MoveTargets:  targets,
+		Transfer:     newTransferData(listId, !list.CanEdit()),
 	}, nil)
 
 }
 
 func (this *todoPageController) todos(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
 	listId, err := extractListId(request.URL)
 	if err != nil {
 		http.Error(response, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	this.render(response, "list", todoPageData{
+	list, err := this.todoService.FindListById(user, listId)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	through, err := todo.ParseTodoCursor(request.URL.Query().Get("through"))
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter := extractTodoFilter(request.URL.Query())
+	page, err := this.todoService.FindTodoPage(user, listId, filter, todo.TodoCursor{}, through)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	// changes to the filter controls are pushed into the url so filtered views can be bookmarked
+	filterData := newTodoFilterData(listId, filter, nil)
+	var headers extraHeaders
+	if request.Header.Get("HX-Trigger") == "todo-filters" {
+		headers = extraHeaders{"HX-Push-Url": "/htmx/todos?" + string(filterData.Query)}
+	}
+
+	this.render(response, "reload", todoPageData{
 		TodoListId: listId,
-		Todos:      this.todoService.FindTodosByListId(listId),
-	}, nil)
+		ReadOnly:   !list.CanEdit(),
+		Todos:      this.newListItems(user, list, page.Todos),
+		Next:       page.Next,
+		Last:       page.Last,
+		Total:      page.Total,
+		Filter:     filterData,
+	}, headers)
 
 }
 
+// moreMoveTargets adds the page of the lists after the cursor in the after parameter to the move
+// picker.
+func (this *todoPageController) moreMoveTargets(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	after, err := todo.ParseListCursor(request.URL.Query().Get("after"))
+	if err != nil || after.IsZero() {
+		http.Error(response, todo.ErrCursorInvalid.Error(), http.StatusBadRequest)
+		return
+	}
+
+	targets, err := this.findMoveTargets(user, listId, after)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	targets.Oob = true
+	this.render(response, "move-targets-page", targets, nil)
+}
+
+// more renders the page of the list after the cursor in the after parameter. The last item of each
+// page loads the next one when it's scrolled into view.
+func (this *todoPageController) more(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	after, err := todo.ParseTodoCursor(request.URL.Query().Get("after"))
+	if err != nil || after.IsZero() {
+		http.Error(response, todo.ErrCursorInvalid.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := this.todoService.FindListById(user, listId)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	filter := extractTodoFilter(request.URL.Query())
+	page, err := this.todoService.FindTodoPage(user, listId, filter, after, todo.TodoCursor{})
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	this.render(response, "more", todoPageData{
+		TodoListId: listId,
+		Todos:      this.newListItems(user, list, page.Todos),
+		Next:       page.Next,
+		Last:       page.Last,
+		Filter:     newTodoFilterData(listId, filter, nil),
+	}, nil)
+}
+
 func (this *todoPageController) addTodo(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
 	task := request.FormValue("task")
 	maybeListId := request.FormValue("listId")
 	listId, err := strconv.Atoi(maybeListId)
@@ -98,11 +447,26 @@ func (this *todoPageController) addTodo(response http.ResponseWriter, request *h
 		return
 	}
 
-	if _, err = this.todoService.AddTodo(task, listId); err != nil {
+	details, err := extractDetails(request)
+	if err == nil {
+		_, err = this.todoService.AddTodo(user, task, listId, details)
+	}
+
+	if err != nil {
+		if status := todo.ErrorStatus(err, http.StatusOK); status != http.StatusOK {
+			http.Error(response, err.Error(), status)
+			return
+		}
+
 		this.render(response, "form", todoPageData{
 			Key:        newRenderKey(),
 			TodoListId: listId,
 			Task:       task,
+			Due:        request.FormValue("due"),
+			DueTime:    request.FormValue("dueTime"),
+			Priorities: newPriorityOptions(details.Priority),
+			Tags:       request.FormValue("tags"),
+			Recurrence: request.FormValue("recurrence"),
 			Error:      err.Error(),
 		}, nil)
 		return
@@ -111,6 +475,7 @@ func (this *todoPageController) addTodo(response http.ResponseWriter, request *h
 	this.render(response, "form", todoPageData{
 		Key:        newRenderKey(),
 		TodoListId: listId,
+		Priorities: newPriorityOptions(entity.PriorityNone),
 	}, extraHeaders{
 		"HX-Trigger": "GetTodos",
 	})
@@ -137,32 +502,502 @@ func extractTodoId(url *url.URL) (int, error) {
 }
 
 func (this *todoPageController) toggleTodo(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
 	id, err := extractTodoId(request.URL)
 	if err != nil {
 		http.Error(response, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	todo, err := this.todoService.ToggleTodo(id)
+	target, err := this.todoService.ToggleTodo(user, id)
 	if err != nil {
-		http.Error(response, err.Error(), http.StatusInternalServerError)
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	item := this.newTodoItem(user, target)
+	item.OfferCompleteSubtasks = target.Done && target.HasOpenSubtasks()
+	this.render(response, "item", item, rollUpHeaders(target, item.OfferCompleteSubtasks))
+}
+
+// rollUpHeaders asks for the whole list when a subtask changed, since its parents may have rolled
+// up. The list is left alone while the item has something to show.
+func rollUpHeaders(todo entity.Todo, keepItem bool) extraHeaders {
+	if todo.ParentId == 0 || keepItem {
+		return nil
+	}
+
+	return extraHeaders{"HX-Trigger": "GetTodos"}
+}
+
+func (this *todoPageController) completeSubtasks(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	id, err := extractTodoId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	target, err := this.todoService.CompleteSubtasks(user, id)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	this.render(response, "item", this.newTodoItem(user, target), rollUpHeaders(target, false))
+}
+
+func (this *todoPageController) addSubtask(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	parentId, err := extractTodoId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	task := request.FormValue("task")
+	_, addErr := this.todoService.AddSubtask(user, parentId, task, todo.TodoDetails{})
+	if status := todo.ErrorStatus(addErr, http.StatusOK); status != http.StatusOK {
+		http.Error(response, addErr.Error(), status)
+		return
+	}
+
+	parent, err := this.todoService.FindTodoById(user, parentId)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
 		return
 	}
 
-	this.render(response, "item", todo, nil)
+	item := this.newTodoItem(user, parent)
+	if addErr != nil {
+		item.SubtaskTask = task
+		item.SubtaskError = addErr.Error()
+	}
+
+	this.render(response, "item", item, rollUpHeaders(parent, addErr != nil))
 }
 
 func (this *todoPageController) removeTodo(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
 	id, err := extractTodoId(request.URL)
 	if err != nil {
 		http.Error(response, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if err = this.todoService.RemoveTodo(id); err != nil {
-		http.Error(response, err.Error(), http.StatusInternalServerError)
+	if err = this.todoService.RemoveTodo(user, id); err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	this.render(response, "toast", toastData{
+		Message: "Todo moved to the trash.",
+		UndoUrl: fmt.Sprintf("/htmx/api/trash/todos/restore?id=%d", id),
+	}, nil)
+}
+
+type todoEditData struct {
+	Id         int
+	Task       string
+	Due        string
+	DueTime    string
+	Priorities []priorityOption
+	Tags       string
+	Recurrence string
+	Error      string
+}
+
+func newTodoEditData(todo entity.Todo) todoEditData {
+	data := todoEditData{
+		Id:         todo.Id,
+		Task:       todo.Task,
+		Priorities: newPriorityOptions(todo.Priority),
+		Tags:       strings.Join(todo.Tags, ", "),
+		Recurrence: todo.Recurrence,
+	}
+
+	if todo.HasDue() {
+		data.Due = todo.Due.Format("2006-01-02")
+	}
+
+	if todo.DueHasTime {
+		data.DueTime = todo.Due.Format("15:04")
+	}
+
+	return data
+}
+
+func (this *todoPageController) item(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	id, err := extractTodoId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	target, err := this.todoService.FindTodoById(user, id)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	this.render(response, "item", this.newTodoItem(user, target), nil)
+}
+
+func (this *todoPageController) editTodo(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	id, err := extractTodoId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	target, err := this.todoService.FindTodoById(user, id)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	this.render(response, "edit", newTodoEditData(target), nil)
+}
+
+func (this *todoPageController) updateTodo(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	id, err := extractTodoId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	task := request.FormValue("task")
+	details, err := extractDetails(request)
+	var target entity.Todo
+	if err == nil {
+		target, err = this.todoService.UpdateTodo(user, id, task, details)
+	}
+
+	if err != nil {
+		if status := todo.ErrorStatus(err, http.StatusOK); status != http.StatusOK {
+			http.Error(response, err.Error(), status)
+			return
+		}
+
+		this.render(response, "edit", todoEditData{
+			Id:         id,
+			Task:       task,
+			Due:        request.FormValue("due"),
+			DueTime:    request.FormValue("dueTime"),
+			Priorities: newPriorityOptions(details.Priority),
+			Tags:       request.FormValue("tags"),
+			Recurrence: request.FormValue("recurrence"),
+			Error:      err.Error(),
+		}, nil)
+		return
+	}
+
+	this.render(response, "item", this.newTodoItem(user, target), nil)
+}
+
+// extractOptionalId reads an id from the form, an empty value is returned as zero.
+func extractOptionalId(request *http.Request, key string) (int, error) {
+	maybeId := request.FormValue(key)
+	if maybeId == "" {
+		return 0, nil
+	}
+
+	return strconv.Atoi(maybeId)
+}
+
+func (this *todoPageController) moveTodo(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	id, err := extractTodoId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	beforeId, err := extractOptionalId(request, "before")
+	if err != nil {
+		http.Error(response, ErrTodoIdNotNumber.Error(), http.StatusBadRequest)
+		return
+	}
+
+	afterId, err := extractOptionalId(request, "after")
+	if err != nil {
+		http.Error(response, ErrTodoIdNotNumber.Error(), http.StatusBadRequest)
+		return
+	}
+
+	moved, err := this.todoService.MoveTodo(user, id, beforeId, afterId)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	// the list is rendered again so moves made in other tabs show up too, the filter comes along
+	// in the query of the move url and the pages loaded so far in the form. a mangled cursor renders
+	// the first page, the todo is already moved
+	through, _ := todo.ParseTodoCursor(request.FormValue("through"))
+	filter := extractTodoFilter(request.URL.Query())
+	page, err := this.todoService.FindTodoPage(user, moved.TodoListId, filter, todo.TodoCursor{}, through)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	this.render(response, "reload", todoPageData{
+		TodoListId: moved.TodoListId,
+		Todos:      this.newTodoItems(user, page.Todos),
+		Next:       page.Next,
+		Last:       page.Last,
+		Total:      page.Total,
+		Filter:     newTodoFilterData(moved.TodoListId, filter, nil),
+	}, nil)
+}
+
+// Actions of the bulk form.
+const (
+	bulkDone   = "done"
+	bulkUndone = "undone"
+	bulkRemove = "remove"
+	bulkMove   = "move"
+	bulkClear  = "clear"
+)
+
+var ErrUnknownBulkAction = errors.New("Unknown bulk action.")
+
+// extractSelection reads the ids of the todos checked in the list.
+func extractSelection(form url.Values) ([]int, error) {
+	var todoIds []int
+	for _, maybeId := range form["id"] {
+		id, err := strconv.Atoi(maybeId)
+		if err != nil {
+			return nil, ErrTodoIdNotNumber
+		}
+
+		todoIds = append(todoIds, id)
+	}
+
+	return todoIds, nil
+}
+
+// bulk runs an action of the bulk form on the checked todos and renders the list once for all of
+// them. The filter controls are sent along so the list keeps its filter. Clearing completed todos
+// ignores the selection.
+func (this *todoPageController) bulk(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	if err := request.ParseForm(); err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	listId, err := strconv.Atoi(request.Form.Get("listid"))
+	if err != nil {
+		http.Error(response, ErrListIdNotNumber.Error(), http.StatusBadRequest)
+		return
+	}
+
+	todoIds, err := extractSelection(request.Form)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var toast *toastData
+	switch request.Form.Get("action") {
+	case bulkDone:
+		err = this.todoService.SetTodosDone(user, listId, todoIds, true)
+	case bulkUndone:
+		err = this.todoService.SetTodosDone(user, listId, todoIds, false)
+	case bulkRemove:
+		err = this.todoService.RemoveTodos(user, listId, todoIds)
+		toast = &toastData{Message: "Selected todos moved to the trash."}
+	case bulkMove:
+		// an empty or mangled target is reported as a missing one
+		targetListId, _ := strconv.Atoi(request.Form.Get("targetListId"))
+		err = this.todoService.MoveTodos(user, listId, todoIds, targetListId)
+	case bulkClear:
+		var count int
+		count, err = this.todoService.ClearCompleted(user, listId)
+		toast = &toastData{Message: fmt.Sprintf("%d finished todos moved to the trash.", count)}
+	default:
+		http.Error(response, ErrUnknownBulkAction.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if status := todo.ErrorStatus(err, http.StatusOK); status != http.StatusOK {
+		http.Error(response, err.Error(), status)
+		return
+	}
+
+	list, findErr := this.todoService.FindListById(user, listId)
+	if findErr != nil {
+		http.Error(response, findErr.Error(), todo.ErrorStatus(findErr, http.StatusInternalServerError))
+		return
+	}
+
+	// a mangled cursor renders the first page, the action is already done
+	through, _ := todo.ParseTodoCursor(request.Form.Get("through"))
+	filter := extractTodoFilter(request.Form)
+	page, findErr := this.todoService.FindTodoPage(user, listId, filter, todo.TodoCursor{}, through)
+	if findErr != nil {
+		http.Error(response, findErr.Error(), todo.ErrorStatus(findErr, http.StatusInternalServerError))
+		return
+	}
+
+	data := todoPageData{
+		TodoListId: listId,
+		ReadOnly:   !list.CanEdit(),
+		Todos:      this.newListItems(user, list, page.Todos),
+		Next:       page.Next,
+		Last:       page.Last,
+		Total:      page.Total,
+		Filter:     newTodoFilterData(listId, filter, nil),
+	}
+
+	if err != nil {
+		data.Error = err.Error()
+	} else {
+		data.Toast = toast
+	}
+
+	this.render(response, "bulk", data, nil)
+}
+
+// todoNotesData holds the notes of a todo as written and as rendered from Markdown.
+type todoNotesData struct {
+	Id       int
+	Notes    string
+	Html     template.HTML
+	Error    string
+	ReadOnly bool
+}
+
+func newTodoNotesData(todo entity.Todo) todoNotesData {
+	return todoNotesData{Id: todo.Id, Notes: todo.Notes, Html: renderNotes(todo.Notes)}
+}
+
+func (this *todoPageController) notes(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	id, err := extractTodoId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	target, err := this.todoService.FindTodoById(user, id)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	list, err := this.todoService.FindListById(user, target.TodoListId)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	data := newTodoNotesData(target)
+	data.ReadOnly = !list.CanEdit()
+	this.render(response, "notes", data, nil)
+}
+
+func (this *todoPageController) editNotes(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	id, err := extractTodoId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	target, err := this.todoService.FindTodoById(user, id)
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	this.render(response, "notes-edit", newTodoNotesData(target), nil)
+}
+
+func (this *todoPageController) updateNotes(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	id, err := extractTodoId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	notes := request.FormValue("notes")
+	target, err := this.todoService.UpdateTodoNotes(user, id, notes)
+	if err != nil {
+		if status := todo.ErrorStatus(err, http.StatusOK); status != http.StatusOK {
+			http.Error(response, err.Error(), status)
+			return
+		}
+
+		this.render(response, "notes-edit", todoNotesData{Id: id, Notes: notes, Error: err.Error()}, nil)
 		return
 	}
 
-	response.WriteHeader(http.StatusOK)
+	this.render(response, "notes", newTodoNotesData(target), nil)
 }
@@ -0,0 +1,216 @@
+package htmx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/todo"
+)
+
+// maxImportSize is the largest file that can be imported, in bytes.
+const maxImportSize = 1 << 20
+
+var (
+	ErrImportFileMissing = errors.New("Choose a file to import.")
+	ErrImportTooLarge    = errors.New("The file is too large, import at most 1 MB at a time.")
+)
+
+// transferData offers the export links and the import form of a list, or of every list of the
+// user when ListId is zero. Viewers of a shared list can only export it.
+type transferData struct {
+	ListId   int
+	ReadOnly bool
+	Codecs   []todo.Codec
+}
+
+func newTransferData(listId int, readOnly bool) transferData {
+	return transferData{listId, readOnly, todo.Codecs()}
+}
+
+// importPreviewData shows what an import adds before it's confirmed. Data is the checked import in
+// the JSON format, it's sent back on confirm so the file doesn't have to be uploaded again.
+type importPreviewData struct {
+	ListId  int
+	Lists   []todo.TransferList
+	Count   int
+	Data    string
+	Error   string
+	Message string
+}
+
+type todoTransferController struct {
+	todoService *todo.TodoService
+	*defaultRenderer
+}
+
+func newTodoTransferController(todo *todo.TodoService) *todoTransferController {
+	transferTemplate := template.Must(template.ParseFS(templateFiles, "web/html/todo_transfer.html"))
+	return &todoTransferController{todo, newDefaultRenderer(transferTemplate)}
+}
+
+// extractImportListId reads the list the import goes to, zero when the import adds new lists.
+func extractImportListId(request *http.Request) (int, error) {
+	maybeListId := request.FormValue("listid")
+	if maybeListId == "" {
+		return 0, nil
+	}
+
+	listId, err := strconv.Atoi(maybeListId)
+	if err != nil {
+		return 0, ErrListIdNotNumber
+	}
+
+	return listId, nil
+}
+
+// export downloads a list in the format, or every list of the user when no list is given.
+func (this *todoTransferController) export(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	codec, err := todo.FindCodec(request.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fileName := "todos"
+	var lists []todo.TransferList
+	if request.URL.Query().Has("listid") {
+		listId, err := extractListId(request.URL)
+		if err != nil {
+			http.Error(response, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		lists, err = this.todoService.ExportList(user, listId)
+		if err == nil {
+			fileName = lists[0].Name
+		}
+	} else {
+		lists, err = this.todoService.ExportLists(user)
+	}
+
+	if err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": fileName + "." + codec.Extension()})
+	response.Header().Set("Content-Type", codec.ContentType())
+	response.Header().Set("Content-Disposition", disposition)
+	if err = codec.Encode(response, lists); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// preview reads the uploaded file and shows what importing it would add, or why it can't be
+// imported.
+func (this *todoTransferController) preview(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	request.Body = http.MaxBytesReader(response, request.Body, maxImportSize)
+	file, _, err := request.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			err = ErrImportTooLarge
+		} else {
+			err = ErrImportFileMissing
+		}
+
+		this.render(response, "preview", importPreviewData{Error: err.Error()}, nil)
+		return
+	}
+
+	defer file.Close()
+	listId, err := extractImportListId(request)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := importPreviewData{ListId: listId}
+	lists, err := this.todoService.ParseImport(user, listId, request.FormValue("format"), file)
+	if status := todo.ErrorStatus(err, http.StatusOK); status != http.StatusOK {
+		http.Error(response, err.Error(), status)
+		return
+	}
+
+	if err != nil {
+		data.Error = err.Error()
+		this.render(response, "preview", data, nil)
+		return
+	}
+
+	codec, err := todo.FindCodec(todo.JsonFormat)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var encoded bytes.Buffer
+	if err = codec.Encode(&encoded, lists); err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data.Lists = lists
+	data.Data = encoded.String()
+	for _, list := range lists {
+		data.Count += list.CountTodos()
+	}
+
+	this.render(response, "preview", data, nil)
+}
+
+// importTodos adds the todos of a previewed import and tells the page to load its lists or todos
+// again.
+func (this *todoTransferController) importTodos(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractImportListId(request)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := importPreviewData{ListId: listId}
+	count, err := this.todoService.Import(user, listId, todo.JsonFormat, strings.NewReader(request.FormValue("data")))
+	if status := todo.ErrorStatus(err, http.StatusOK); status != http.StatusOK {
+		http.Error(response, err.Error(), status)
+		return
+	}
+
+	if err != nil {
+		data.Error = err.Error()
+		this.render(response, "preview", data, nil)
+		return
+	}
+
+	trigger := "GetLists"
+	if listId != 0 {
+		trigger = "GetTodos"
+	}
+
+	data.Message = fmt.Sprintf("%d todos imported.", count)
+	this.render(response, "preview", data, extraHeaders{"HX-Trigger": trigger})
+}
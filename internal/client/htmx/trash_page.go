@@ -0,0 +1,169 @@
+package htmx
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/todo"
+)
+
+// toastData is the message shown after a list or todo is moved to the trash. UndoUrl restores it.
+type toastData struct {
+	Message string
+	UndoUrl string
+}
+
+type trashedListData struct {
+	entity.TrashedList
+	DeletedLabel string
+}
+
+type trashedTodoData struct {
+	entity.TrashedTodo
+	DeletedLabel string
+}
+
+type trashPageData struct {
+	Lists         []trashedListData
+	Todos         []trashedTodoData
+	RetentionDays int
+}
+
+// trashPageController shows the lists and todos the user has removed, to restore them or delete
+// them for good.
+type trashPageController struct {
+	todoService *todo.TodoService
+	*defaultRenderer
+}
+
+func newTrashPageController(todo *todo.TodoService) *trashPageController {
+	trashPage := template.Must(template.ParseFS(templateFiles, "web/html/page.html", "web/html/nav.html", "web/html/trash_page.html"))
+	return &trashPageController{todo, newDefaultRenderer(trashPage)}
+}
+
+// deletedLabel shows when an item was removed in the time zone of the user.
+func deletedLabel(user entity.User, deletedAt time.Time) string {
+	return deletedAt.In(user.Location()).Format("Jan 2, 15:04")
+}
+
+func (this *trashPageController) page(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	lists, err := this.todoService.FindTrashedLists(user)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	todos, err := this.todoService.FindTrashedTodos(user)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := trashPageData{RetentionDays: this.todoService.RetentionDays()}
+	for _, list := range lists {
+		data.Lists = append(data.Lists, trashedListData{list, deletedLabel(user, list.DeletedAt)})
+	}
+
+	for _, todo := range todos {
+		data.Todos = append(data.Todos, trashedTodoData{todo, deletedLabel(user, todo.DeletedAt)})
+	}
+
+	this.render(response, "page", data, nil)
+}
+
+// restoreList answers both the trash page and the undo toast, which remove their item on an empty
+// response.
+func (this *trashPageController) restoreList(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = this.todoService.RestoreList(user, listId); err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	response.Header().Set("HX-Trigger", "GetLists")
+	response.WriteHeader(http.StatusOK)
+}
+
+func (this *trashPageController) purgeList(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	listId, err := extractListId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = this.todoService.PurgeList(user, listId); err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+}
+
+// restoreTodo answers both the trash page and the undo toast like restoreList.
+func (this *trashPageController) restoreTodo(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	todoId, err := extractTodoId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = this.todoService.RestoreTodo(user, todoId); err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	response.Header().Set("HX-Trigger", "GetTodos")
+	response.WriteHeader(http.StatusOK)
+}
+
+func (this *trashPageController) purgeTodo(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	todoId, err := extractTodoId(request.URL)
+	if err != nil {
+		http.Error(response, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = this.todoService.PurgeTodo(user, todoId); err != nil {
+		http.Error(response, err.Error(), todo.ErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	response.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,135 @@
+package htmx
+
+import (
+	"encoding/base64"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/security"
+	"github.com/skip2/go-qrcode"
+)
+
+type twoFactorPageData struct {
+	Key            int64
+	Enabled        bool
+	RemainingCodes int
+	QrCode         template.URL
+	Secret         string
+	RecoveryCodes  []string
+	Error          string
+}
+
+type twoFactorPageController struct {
+	securityService *security.SecurityService
+	*defaultRenderer
+}
+
+func newTwoFactorPageController(security *security.SecurityService) *twoFactorPageController {
+	twoFactorPage := template.Must(template.ParseFS(templateFiles, "web/html/page.html", "web/html/nav.html", "web/html/two_factor_page.html"))
+	return &twoFactorPageController{security, newDefaultRenderer(twoFactorPage)}
+}
+
+func (this *twoFactorPageController) status(request *http.Request) (twoFactorPageData, bool) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		return twoFactorPageData{}, false
+	}
+
+	return twoFactorPageData{
+		Key:            newRenderKey(),
+		Enabled:        this.securityService.IsTwoFactorEnabled(user),
+		RemainingCodes: this.securityService.CountRecoveryCodes(user),
+	}, true
+}
+
+func (this *twoFactorPageController) page(response http.ResponseWriter, request *http.Request) {
+	data, ok := this.status(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	this.render(response, "page", data, nil)
+}
+
+// newQrCode renders the otpauth URI as a PNG data URL so the image can be embedded in the page
+// without storing it anywhere.
+func newQrCode(uri string) (template.URL, error) {
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return "", err
+	}
+
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png)), nil
+}
+
+func (this *twoFactorPageController) enroll(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	uri, secret, err := this.securityService.BeginTwoFactorEnrollment(user)
+	if err != nil {
+		data, _ := this.status(request)
+		data.Error = err.Error()
+		this.render(response, "panel", data, nil)
+		return
+	}
+
+	qrCode, err := newQrCode(uri)
+	if err != nil {
+		log.Println(err.Error())
+		http.Error(response, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	this.render(response, "panel", twoFactorPageData{
+		Key:    newRenderKey(),
+		QrCode: qrCode,
+		Secret: secret,
+	}, nil)
+}
+
+func (this *twoFactorPageController) confirm(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	recoveryCodes, err := this.securityService.ConfirmTwoFactorEnrollment(user, request.FormValue("code"))
+	if err != nil {
+		this.render(response, "confirm", twoFactorPageData{
+			Key:   newRenderKey(),
+			Error: err.Error(),
+		}, nil)
+		return
+	}
+
+	this.render(response, "panel", twoFactorPageData{
+		Key:           newRenderKey(),
+		Enabled:       true,
+		RecoveryCodes: recoveryCodes,
+	}, extraHeaders{
+		"HX-Retarget": "#two-factor",
+	})
+}
+
+func (this *twoFactorPageController) disable(response http.ResponseWriter, request *http.Request) {
+	user, ok := extractUserFromContext(request)
+	if !ok {
+		http.Error(response, "User not found.", http.StatusBadRequest)
+		return
+	}
+
+	err := this.securityService.DisableTwoFactor(user, request.FormValue("code"))
+	data, _ := this.status(request)
+	if err != nil {
+		data.Error = err.Error()
+	}
+
+	this.render(response, "panel", data, nil)
+}
@@ -0,0 +1,20 @@
+// A [data-select-all] checkbox checks or clears every checkbox of the form named in its value, so
+// all todos of the list can be picked for a bulk action. Listeners are on the document so lists
+// swapped in by htmx keep working.
+function onChange(event: Event) {
+    const toggle = event.target;
+    if (!(toggle instanceof HTMLInputElement) || !toggle.dataset.selectAll) {
+        return;
+    }
+
+    const boxes = document.querySelectorAll<HTMLInputElement>(
+        `input[type="checkbox"][name="id"][form="${toggle.dataset.selectAll}"]`,
+    );
+    boxes.forEach((box) => {
+        box.checked = toggle.checked;
+    });
+}
+
+export function selectAll() {
+    document.addEventListener("change", onChange);
+}
@@ -0,0 +1,11 @@
+import htmx from "htmx.org";
+
+declare global {
+    interface Window {
+        htmx: typeof htmx;
+    }
+}
+
+// extensions register themselves on window.htmx when imported, so it's set in a module of its own
+// that is imported before them.
+window.htmx = htmx;
@@ -1,11 +1,11 @@
-import htmx from "htmx.org";
+import "./htmx";
+import "htmx.org/dist/ext/sse.js";
+import { selectAll } from "./bulk";
+import { sortable } from "./sortable";
+import { tabs } from "./tabs";
 import { hello } from "./todo_page";
 
-declare global {
-    interface Window {
-        htmx: typeof htmx;
-    }
-}
-
-window.htmx = htmx;
 hello();
+sortable();
+selectAll();
+tabs();
@@ -0,0 +1,95 @@
+import htmx from "htmx.org";
+
+// Lets items with a data-id be dragged inside a [data-sortable] container. On drop the ids of the
+// new neighbours are sent to the data-move-url of the container and the returned list is swapped
+// in. Listeners are on the document so lists swapped in by htmx keep working.
+let dragged: HTMLElement | null = null;
+// the sibling after the dragged item when the drag started, to tell whether the item moved and to
+// put it back when the drag is cancelled
+let originalNext: Element | null = null;
+
+function findItem(target: EventTarget | null): HTMLElement | null {
+    if (!(target instanceof Element)) {
+        return null;
+    }
+
+    return target.closest<HTMLElement>("[data-sortable] [data-id]");
+}
+
+function onDragStart(event: DragEvent) {
+    dragged = findItem(event.target);
+    if (dragged && event.dataTransfer) {
+        event.dataTransfer.effectAllowed = "move";
+        event.dataTransfer.setData("text/plain", dragged.dataset.id ?? "");
+        dragged.classList.add("todo_item--dragging");
+        originalNext = dragged.nextElementSibling;
+    }
+}
+
+function onDragOver(event: DragEvent) {
+    const item = findItem(event.target);
+    if (!dragged || !item || item.parentElement !== dragged.parentElement) {
+        return;
+    }
+
+    // the item under the pointer is a valid drop target too, else dropping it where it now sits
+    // would count as a cancelled drag
+    event.preventDefault();
+    if (item === dragged) {
+        return;
+    }
+
+    const bounds = item.getBoundingClientRect();
+    const isLowerHalf = event.clientY > bounds.top + bounds.height / 2;
+    item.parentElement?.insertBefore(dragged, isLowerHalf ? item.nextElementSibling : item);
+}
+
+function neighbourId(element: Element | null): string {
+    return element instanceof HTMLElement ? element.dataset.id ?? "" : "";
+}
+
+function onDragEnd(event: DragEvent) {
+    if (!dragged) {
+        return;
+    }
+
+    const item = dragged;
+    const next = originalNext;
+    const container = item.closest<HTMLElement>("[data-sortable]");
+    dragged = null;
+    originalNext = null;
+    item.classList.remove("todo_item--dragging");
+    if (!container?.dataset.moveUrl) {
+        return;
+    }
+
+    // escape or a drop outside the list cancels the drag, the item goes back where it was
+    if (event.dataTransfer?.dropEffect === "none") {
+        item.parentElement?.insertBefore(item, next);
+        return;
+    }
+
+    if (item.nextElementSibling === next) {
+        return;
+    }
+
+    // the move url carries the filter of the list in its query, the container as the source brings
+    // along what its hx-include names
+    const url = new URL(container.dataset.moveUrl, window.location.origin);
+    url.searchParams.set("id", item.dataset.id ?? "");
+    htmx.ajax("PATCH", url.pathname + url.search, {
+        source: container,
+        target: container,
+        swap: "outerHTML",
+        values: {
+            before: neighbourId(item.previousElementSibling),
+            after: neighbourId(item.nextElementSibling),
+        },
+    });
+}
+
+export function sortable() {
+    document.addEventListener("dragstart", onDragStart);
+    document.addEventListener("dragover", onDragOver);
+    document.addEventListener("dragend", onDragEnd);
+}
@@ -0,0 +1,27 @@
+// A [role="tab"] button shows the panel named in its aria-controls and hides the panels of the
+// other tabs in its [role="tablist"]. Listeners are on the document so tabs swapped in by htmx keep
+// working.
+function onClick(event: MouseEvent) {
+    if (!(event.target instanceof Element)) {
+        return;
+    }
+
+    const tab = event.target.closest<HTMLElement>('[role="tab"]');
+    const tabList = tab?.closest('[role="tablist"]');
+    if (!tab || !tabList) {
+        return;
+    }
+
+    tabList.querySelectorAll<HTMLElement>('[role="tab"]').forEach((other) => {
+        const selected = other === tab;
+        other.setAttribute("aria-selected", String(selected));
+        const panel = document.getElementById(other.getAttribute("aria-controls") ?? "");
+        if (panel) {
+            panel.hidden = !selected;
+        }
+    });
+}
+
+export function tabs() {
+    document.addEventListener("click", onClick);
+}
@@ -0,0 +1,68 @@
+package entity
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+const (
+	ScopeTodosRead  = "todos:read"
+	ScopeTodosWrite = "todos:write"
+)
+
+var ApiTokenScopes = []string{ScopeTodosRead, ScopeTodosWrite}
+
+type ApiToken struct {
+	Id       int
+	UserId   int
+	Name     string
+	Hash     []byte
+	Scopes   []string
+	Expires  time.Time
+	LastUsed time.Time
+	Created  time.Time
+}
+
+// NewApiToken creates a token for the user. A zero expires time means the token doesn't expire.
+func NewApiToken(userId int, name string, hash []byte, scopes []string, expires time.Time) ApiToken {
+	return ApiToken{
+		UserId:  userId,
+		Name:    name,
+		Hash:    hash,
+		Scopes:  scopes,
+		Expires: expires,
+		Created: time.Now(),
+	}
+}
+
+func (this ApiToken) Validate() error {
+	length := len([]rune(this.Name))
+	if length == 0 {
+		return errors.New("Name is too short.")
+	}
+
+	if length > 100 {
+		return errors.New("Name is too long.")
+	}
+
+	if len(this.Scopes) == 0 {
+		return errors.New("Select at least one scope.")
+	}
+
+	for _, scope := range this.Scopes {
+		if !slices.Contains(ApiTokenScopes, scope) {
+			return errors.New("Unknown scope.")
+		}
+	}
+
+	return nil
+}
+
+func (this ApiToken) HasScope(scope string) bool {
+	return slices.Contains(this.Scopes, scope)
+}
+
+func (this ApiToken) IsExpired() bool {
+	return !this.Expires.IsZero() && this.Expires.Before(time.Now())
+}
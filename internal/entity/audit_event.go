@@ -0,0 +1,73 @@
+package entity
+
+import "time"
+
+const (
+	AuditRegistered         = "registered"
+	AuditLoginSucceeded     = "login_succeeded"
+	AuditLoginFailed        = "login_failed"
+	AuditSecondFactorFailed = "second_factor_failed"
+	AuditLogout             = "logout"
+	AuditSessionExpired     = "session_expired"
+	AuditPasswordRehashed   = "password_rehashed"
+	AuditPasswordChanged    = "password_changed"
+	AuditPasswordReset      = "password_reset"
+	AuditTwoFactorEnabled   = "two_factor_enabled"
+	AuditTwoFactorDisabled  = "two_factor_disabled"
+	AuditTokenCreated       = "token_created"
+	AuditTokenRevoked       = "token_revoked"
+	AuditCalendarCreated    = "calendar_feed_created"
+	AuditCalendarRevoked    = "calendar_feed_revoked"
+	AuditIdentityLinked     = "identity_linked"
+	AuditRoleChanged        = "role_changed"
+)
+
+var AuditKinds = []string{
+	AuditRegistered,
+	AuditLoginSucceeded,
+	AuditLoginFailed,
+	AuditSecondFactorFailed,
+	AuditLogout,
+	AuditSessionExpired,
+	AuditPasswordRehashed,
+	AuditPasswordChanged,
+	AuditPasswordReset,
+	AuditTwoFactorEnabled,
+	AuditTwoFactorDisabled,
+	AuditTokenCreated,
+	AuditTokenRevoked,
+	AuditCalendarCreated,
+	AuditCalendarRevoked,
+	AuditIdentityLinked,
+	AuditRoleChanged,
+}
+
+// AuditEvent is an entry in the security audit log. UserId is zero when the event can't be tied
+// to an account, such as a failed login with an unknown user name.
+type AuditEvent struct {
+	Id        int64
+	UserId    int
+	UserName  string
+	Kind      string
+	Ip        string
+	UserAgent string
+	Detail    string
+	Created   time.Time
+}
+
+func NewAuditEvent(kind string, userId int, userName string) AuditEvent {
+	return AuditEvent{
+		Kind:     kind,
+		UserId:   userId,
+		UserName: userName,
+		Created:  time.Now(),
+	}
+}
+
+type AuditFilter struct {
+	UserName string
+	Kind     string
+	From     time.Time
+	To       time.Time
+	Limit    int
+}
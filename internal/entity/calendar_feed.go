@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+// CalendarFeed lets calendar apps read the dated todos of a user with a secret link instead of
+// a session. Only the hash of the secret is kept.
+type CalendarFeed struct {
+	UserId   int
+	Hash     []byte
+	LastUsed time.Time
+	Created  time.Time
+}
+
+func NewCalendarFeed(userId int, hash []byte) CalendarFeed {
+	return CalendarFeed{
+		UserId:  userId,
+		Hash:    hash,
+		Created: time.Now(),
+	}
+}
@@ -0,0 +1,23 @@
+package entity
+
+import "time"
+
+// ExternalIdentity links an account at an OpenID Connect provider to a local user.
+type ExternalIdentity struct {
+	Id       int
+	UserId   int
+	Provider string
+	Subject  string
+	Email    string
+	Created  time.Time
+}
+
+func NewExternalIdentity(userId int, provider string, subject string, email string) ExternalIdentity {
+	return ExternalIdentity{
+		UserId:   userId,
+		Provider: provider,
+		Subject:  subject,
+		Email:    email,
+		Created:  time.Now(),
+	}
+}
@@ -0,0 +1,16 @@
+package entity
+
+import "time"
+
+type PasswordResetToken struct {
+	Id      int
+	UserId  int
+	Hash    []byte
+	Expires time.Time
+	Used    bool
+}
+
+func NewPasswordResetToken(userId int, hash []byte, duration time.Duration) PasswordResetToken {
+	expires := time.Now().Add(duration)
+	return PasswordResetToken{UserId: userId, Hash: hash, Expires: expires}
+}
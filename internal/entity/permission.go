@@ -0,0 +1,13 @@
+package entity
+
+type Permission string
+
+const (
+	PermissionManageUsers Permission = "users:manage"
+	PermissionViewAudit   Permission = "audit:view"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleUser:  {},
+	RoleAdmin: {PermissionManageUsers, PermissionViewAudit},
+}
@@ -0,0 +1,418 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FrequencyDaily   = "DAILY"
+	FrequencyWeekly  = "WEEKLY"
+	FrequencyMonthly = "MONTHLY"
+)
+
+// maxRecurrenceSteps bounds the search for the next occurrence. Rules such as the 31st of every
+// 12th month starting in February never produce one.
+const maxRecurrenceSteps = 1000
+
+var (
+	ErrRecurrenceInvalid     = errors.New("Recurrence rule is invalid.")
+	ErrRecurrenceUnsupported = errors.New("Recurrence rule uses parts that aren't supported.")
+)
+
+var weekdayCodes = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// Recurrence is the subset of RFC 5545 recurrence rules a todo can repeat with: DAILY, WEEKLY
+// with BYDAY and MONTHLY with BYMONTHDAY, limited by INTERVAL, COUNT or UNTIL. Weeks start on
+// Monday. Until is a wall clock time like the due dates, the zero time when the rule has no end.
+type Recurrence struct {
+	Frequency  string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	Count      int
+	Until      time.Time
+	UntilTime  bool
+}
+
+// ParseRecurrence reads a rule such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE". A leading "RRULE:"
+// is allowed.
+func ParseRecurrence(rule string) (Recurrence, error) {
+	recurrence := Recurrence{Interval: 1}
+	rule = strings.TrimSpace(rule)
+	if len(rule) >= 6 && strings.EqualFold(rule[:6], "RRULE:") {
+		rule = rule[6:]
+	}
+
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(rule, ";") {
+		name, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		value = strings.ToUpper(strings.TrimSpace(value))
+		if !found || name == "" || value == "" || seen[name] {
+			return recurrence, ErrRecurrenceInvalid
+		}
+
+		seen[name] = true
+		var err error
+		switch name {
+		case "FREQ":
+			recurrence.Frequency = value
+			if value != FrequencyDaily && value != FrequencyWeekly && value != FrequencyMonthly {
+				err = ErrRecurrenceUnsupported
+			}
+		case "INTERVAL":
+			recurrence.Interval, err = parsePositive(value)
+		case "COUNT":
+			recurrence.Count, err = parsePositive(value)
+		case "UNTIL":
+			recurrence.Until, recurrence.UntilTime, err = parseUntil(value)
+		case "BYDAY":
+			recurrence.ByDay, err = parseByDay(value)
+		case "BYMONTHDAY":
+			recurrence.ByMonthDay, err = parseByMonthDay(value)
+		case "WKST":
+			if value != "MO" {
+				err = ErrRecurrenceUnsupported
+			}
+		default:
+			err = ErrRecurrenceUnsupported
+		}
+
+		if err != nil {
+			return recurrence, err
+		}
+	}
+
+	switch {
+	case recurrence.Frequency == "":
+		return recurrence, ErrRecurrenceInvalid
+	case recurrence.Count > 0 && !recurrence.Until.IsZero():
+		return recurrence, errors.New("Recurrence rule can't have both COUNT and UNTIL.")
+	case len(recurrence.ByDay) > 0 && recurrence.Frequency != FrequencyWeekly:
+		return recurrence, ErrRecurrenceUnsupported
+	case len(recurrence.ByMonthDay) > 0 && recurrence.Frequency != FrequencyMonthly:
+		return recurrence, ErrRecurrenceUnsupported
+	}
+
+	return recurrence, nil
+}
+
+func parsePositive(value string) (int, error) {
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 {
+		return 0, ErrRecurrenceInvalid
+	}
+
+	return number, nil
+}
+
+// parseUntil reads a date or a date with a time. A time in UTC is read as a wall clock time since
+// todos only know the time zone of their user.
+func parseUntil(value string) (time.Time, bool, error) {
+	if until, err := time.Parse("20060102", value); err == nil {
+		return until, false, nil
+	}
+
+	until, err := time.Parse("20060102T150405", strings.TrimSuffix(value, "Z"))
+	if err != nil {
+		return until, false, ErrRecurrenceInvalid
+	}
+
+	return until, true, nil
+}
+
+func parseByDay(value string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, code := range strings.Split(value, ",") {
+		day, ok := weekdayCodes[strings.TrimSpace(code)]
+		if !ok {
+			// days with a position such as 2MO are only meaningful monthly
+			return nil, ErrRecurrenceUnsupported
+		}
+
+		if !slices.Contains(days, day) {
+			days = append(days, day)
+		}
+	}
+
+	// sorted from Monday to Sunday
+	slices.SortFunc(days, func(a time.Weekday, b time.Weekday) int {
+		return weekdayIndex(a) - weekdayIndex(b)
+	})
+
+	return days, nil
+}
+
+func parseByMonthDay(value string) ([]int, error) {
+	var days []int
+	for _, maybeDay := range strings.Split(value, ",") {
+		day, err := strconv.Atoi(strings.TrimSpace(maybeDay))
+		if err != nil || day == 0 || day < -31 || day > 31 {
+			return nil, ErrRecurrenceInvalid
+		}
+
+		if !slices.Contains(days, day) {
+			days = append(days, day)
+		}
+	}
+
+	return days, nil
+}
+
+// weekdayIndex numbers the days from Monday as zero.
+func weekdayIndex(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
+
+// String formats the rule back into RRULE form with the parts in a fixed order.
+func (this Recurrence) String() string {
+	parts := []string{"FREQ=" + this.Frequency}
+	if this.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(this.Interval))
+	}
+
+	if len(this.ByDay) > 0 {
+		codes := make([]string, 0, len(this.ByDay))
+		for _, day := range this.ByDay {
+			codes = append(codes, strings.ToUpper(day.String()[:2]))
+		}
+
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+
+	if len(this.ByMonthDay) > 0 {
+		days := make([]string, 0, len(this.ByMonthDay))
+		for _, day := range this.ByMonthDay {
+			days = append(days, strconv.Itoa(day))
+		}
+
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+
+	if this.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(this.Count))
+	}
+
+	if this.UntilTime {
+		parts = append(parts, "UNTIL="+this.Until.Format("20060102T150405"))
+	} else if !this.Until.IsZero() {
+		parts = append(parts, "UNTIL="+this.Until.Format("20060102"))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// Summary describes the rule for people, for example "every 2nd Monday" or "every month on the
+// 1st and 15th".
+func (this Recurrence) Summary() string {
+	every := "every "
+	if this.Interval > 1 {
+		every += ordinal(this.Interval) + " "
+	}
+
+	var summary string
+	switch this.Frequency {
+	case FrequencyDaily:
+		summary = every + "day"
+	case FrequencyWeekly:
+		if len(this.ByDay) == 0 {
+			summary = every + "week"
+			break
+		}
+
+		days := make([]string, 0, len(this.ByDay))
+		for _, day := range this.ByDay {
+			days = append(days, day.String())
+		}
+
+		summary = every + joinWords(days)
+	case FrequencyMonthly:
+		summary = every + "month"
+		if len(this.ByMonthDay) > 0 {
+			days := make([]string, 0, len(this.ByMonthDay))
+			for _, day := range this.ByMonthDay {
+				days = append(days, monthDayLabel(day))
+			}
+
+			summary += " on the " + joinWords(days)
+		}
+	}
+
+	if this.Count == 1 {
+		summary += ", once"
+	} else if this.Count > 1 {
+		summary += fmt.Sprintf(", %d times", this.Count)
+	}
+
+	if this.UntilTime {
+		summary += ", until " + this.Until.Format("2 Jan 2006 15:04")
+	} else if !this.Until.IsZero() {
+		summary += ", until " + this.Until.Format("2 Jan 2006")
+	}
+
+	return summary
+}
+
+func ordinal(number int) string {
+	suffix := "th"
+	switch {
+	case number%100 >= 11 && number%100 <= 13:
+	case number%10 == 1:
+		suffix = "st"
+	case number%10 == 2:
+		suffix = "nd"
+	case number%10 == 3:
+		suffix = "rd"
+	}
+
+	return strconv.Itoa(number) + suffix
+}
+
+func monthDayLabel(day int) string {
+	switch {
+	case day > 0:
+		return ordinal(day)
+	case day == -1:
+		return "last day"
+	default:
+		return ordinal(-day) + " to last day"
+	}
+}
+
+// joinWords joins the words with commas and an "and" before the last one.
+func joinWords(words []string) string {
+	if len(words) <= 1 {
+		return strings.Join(words, "")
+	}
+
+	return strings.Join(words[:len(words)-1], ", ") + " and " + words[len(words)-1]
+}
+
+// Next returns the first occurrence after the given one, keeping its clock time. The count is not
+// looked at, the rule of the next occurrence is given by Advance. False is returned when the rule
+// has no more occurrences.
+func (this Recurrence) Next(after time.Time) (time.Time, bool) {
+	interval := this.Interval
+	if interval < 1 {
+		interval = 1
+	}
+
+	var next time.Time
+	found := false
+	switch this.Frequency {
+	case FrequencyDaily:
+		next, found = after.AddDate(0, 0, interval), true
+	case FrequencyWeekly:
+		next, found = this.nextWeekly(after, interval)
+	case FrequencyMonthly:
+		next, found = this.nextMonthly(after, interval)
+	}
+
+	if !found || this.pastUntil(next) {
+		return time.Time{}, false
+	}
+
+	return next, true
+}
+
+// nextWeekly steps through the days after the occurrence, counting weeks from the week of the
+// occurrence so only every interval-th week matches.
+func (this Recurrence) nextWeekly(after time.Time, interval int) (time.Time, bool) {
+	if len(this.ByDay) == 0 {
+		return after.AddDate(0, 0, 7*interval), true
+	}
+
+	weekStart := after.AddDate(0, 0, -weekdayIndex(after.Weekday()))
+	for offset := 1; offset <= 7*interval+7; offset++ {
+		day := after.AddDate(0, 0, offset)
+		week := daysBetween(weekStart, day) / 7
+		if week%interval == 0 && slices.Contains(this.ByDay, day.Weekday()) {
+			return day, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// nextMonthly looks for the earliest matching day after the occurrence in every interval-th
+// month. Days a month doesn't have, like the 31st of April, are skipped.
+func (this Recurrence) nextMonthly(after time.Time, interval int) (time.Time, bool) {
+	monthDays := this.ByMonthDay
+	if len(monthDays) == 0 {
+		monthDays = []int{after.Day()}
+	}
+
+	year, month, _ := after.Date()
+	for step := 0; step < maxRecurrenceSteps; step++ {
+		first := time.Date(year, month+time.Month(step*interval), 1, 0, 0, 0, 0, after.Location())
+		length := first.AddDate(0, 1, -1).Day()
+		var best time.Time
+		for _, monthDay := range monthDays {
+			day := monthDay
+			if day < 0 {
+				day = length + day + 1
+			}
+
+			if day < 1 || day > length {
+				continue
+			}
+
+			candidate := time.Date(first.Year(), first.Month(), day, after.Hour(), after.Minute(), after.Second(), 0, after.Location())
+			if candidate.After(after) && (best.IsZero() || candidate.Before(best)) {
+				best = candidate
+			}
+		}
+
+		if !best.IsZero() {
+			return best, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func daysBetween(start time.Time, end time.Time) int {
+	startDate := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	endDate := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+	return int(endDate.Sub(startDate).Hours() / 24)
+}
+
+// pastUntil compares by date alone when the rule ends on a date.
+func (this Recurrence) pastUntil(occurrence time.Time) bool {
+	if this.Until.IsZero() {
+		return false
+	}
+
+	if this.UntilTime {
+		return occurrence.After(this.Until)
+	}
+
+	return StartOfDay(occurrence).After(this.Until)
+}
+
+// Advance returns the rule for the occurrence after this one. False is returned when this is the
+// last occurrence allowed by the count.
+func (this Recurrence) Advance() (Recurrence, bool) {
+	if this.Count == 1 {
+		return this, false
+	}
+
+	if this.Count > 1 {
+		this.Count--
+	}
+
+	return this, true
+}
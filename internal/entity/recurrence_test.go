@@ -0,0 +1,266 @@
+package entity
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func at(year int, month time.Month, day int, hour int) time.Time {
+	return time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+}
+
+func TestParseRecurrenceErrors(t *testing.T) {
+	tests := []struct {
+		rule string
+		want error
+	}{
+		{"", ErrRecurrenceInvalid},
+		{"FREQ", ErrRecurrenceInvalid},
+		{"FREQ=", ErrRecurrenceInvalid},
+		{"INTERVAL=2", ErrRecurrenceInvalid},
+		{"FREQ=DAILY;FREQ=WEEKLY", ErrRecurrenceInvalid},
+		{"FREQ=DAILY;INTERVAL=0", ErrRecurrenceInvalid},
+		{"FREQ=DAILY;INTERVAL=two", ErrRecurrenceInvalid},
+		{"FREQ=DAILY;COUNT=-1", ErrRecurrenceInvalid},
+		{"FREQ=DAILY;UNTIL=2024-01-31", ErrRecurrenceInvalid},
+		{"FREQ=MONTHLY;BYMONTHDAY=0", ErrRecurrenceInvalid},
+		{"FREQ=MONTHLY;BYMONTHDAY=32", ErrRecurrenceInvalid},
+		{"FREQ=MONTHLY;BYMONTHDAY=-32", ErrRecurrenceInvalid},
+		{"FREQ=YEARLY", ErrRecurrenceUnsupported},
+		{"FREQ=HOURLY", ErrRecurrenceUnsupported},
+		{"FREQ=DAILY;BYHOUR=9", ErrRecurrenceUnsupported},
+		{"FREQ=WEEKLY;WKST=SU", ErrRecurrenceUnsupported},
+		{"FREQ=WEEKLY;BYDAY=XX", ErrRecurrenceUnsupported},
+		{"FREQ=MONTHLY;BYDAY=2MO", ErrRecurrenceUnsupported},
+		{"FREQ=DAILY;BYDAY=MO", ErrRecurrenceUnsupported},
+		{"FREQ=WEEKLY;BYMONTHDAY=1", ErrRecurrenceUnsupported},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rule, func(t *testing.T) {
+			if _, err := ParseRecurrence(test.rule); err != test.want {
+				t.Errorf("ParseRecurrence(%q) error = %v, want %v", test.rule, err, test.want)
+			}
+		})
+	}
+
+	if _, err := ParseRecurrence("FREQ=DAILY;COUNT=3;UNTIL=20240131"); err == nil {
+		t.Error("ParseRecurrence() with COUNT and UNTIL error = nil, want an error")
+	}
+}
+
+func TestParseRecurrence(t *testing.T) {
+	tests := []struct {
+		rule string
+		want Recurrence
+		text string
+	}{
+		{"FREQ=DAILY", Recurrence{Frequency: FrequencyDaily, Interval: 1}, "FREQ=DAILY"},
+		{
+			"RRULE:freq=weekly; interval=2; byday=we,mo,we",
+			Recurrence{Frequency: FrequencyWeekly, Interval: 2, ByDay: []time.Weekday{time.Monday, time.Wednesday}},
+			"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE",
+		},
+		{
+			"FREQ=WEEKLY;BYDAY=SU,MO;WKST=MO",
+			Recurrence{Frequency: FrequencyWeekly, Interval: 1, ByDay: []time.Weekday{time.Monday, time.Sunday}},
+			"FREQ=WEEKLY;BYDAY=MO,SU",
+		},
+		{
+			"FREQ=MONTHLY;BYMONTHDAY=15,-1;COUNT=6",
+			Recurrence{Frequency: FrequencyMonthly, Interval: 1, ByMonthDay: []int{15, -1}, Count: 6},
+			"FREQ=MONTHLY;BYMONTHDAY=15,-1;COUNT=6",
+		},
+		{
+			"FREQ=DAILY;UNTIL=20240131",
+			Recurrence{Frequency: FrequencyDaily, Interval: 1, Until: at(2024, time.January, 31, 0)},
+			"FREQ=DAILY;UNTIL=20240131",
+		},
+		{
+			"FREQ=DAILY;UNTIL=20240131T170000Z",
+			Recurrence{Frequency: FrequencyDaily, Interval: 1, Until: at(2024, time.January, 31, 17), UntilTime: true},
+			"FREQ=DAILY;UNTIL=20240131T170000",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rule, func(t *testing.T) {
+			recurrence, err := ParseRecurrence(test.rule)
+			if err != nil {
+				t.Fatalf("ParseRecurrence(%q) error = %v", test.rule, err)
+			}
+
+			if recurrence.Frequency != test.want.Frequency ||
+				recurrence.Interval != test.want.Interval ||
+				!slices.Equal(recurrence.ByDay, test.want.ByDay) ||
+				!slices.Equal(recurrence.ByMonthDay, test.want.ByMonthDay) ||
+				recurrence.Count != test.want.Count ||
+				!recurrence.Until.Equal(test.want.Until) ||
+				recurrence.UntilTime != test.want.UntilTime {
+				t.Errorf("ParseRecurrence(%q) = %+v, want %+v", test.rule, recurrence, test.want)
+			}
+
+			if text := recurrence.String(); text != test.text {
+				t.Errorf("String() = %q, want %q", text, test.text)
+			}
+		})
+	}
+}
+
+func TestRecurrenceNext(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  string
+		after time.Time
+		want  time.Time
+	}{
+		{"daily", "FREQ=DAILY", at(2024, time.January, 31, 9), at(2024, time.February, 1, 9)},
+		{"daily interval over a leap day", "FREQ=DAILY;INTERVAL=3", at(2024, time.February, 28, 9), at(2024, time.March, 2, 9)},
+		{"weekly", "FREQ=WEEKLY", at(2024, time.January, 1, 9), at(2024, time.January, 8, 9)},
+		{"weekly interval", "FREQ=WEEKLY;INTERVAL=2", at(2024, time.January, 1, 9), at(2024, time.January, 15, 9)},
+		{"weekly by day later in the week", "FREQ=WEEKLY;BYDAY=MO,WE", at(2024, time.January, 1, 9), at(2024, time.January, 3, 9)},
+		{"weekly by day in the next week", "FREQ=WEEKLY;BYDAY=MO,WE", at(2024, time.January, 3, 9), at(2024, time.January, 8, 9)},
+		{"weekly by day on sunday", "FREQ=WEEKLY;BYDAY=SU", at(2024, time.January, 7, 9), at(2024, time.January, 14, 9)},
+		{"weekly by day and interval in the same week", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,FR", at(2024, time.January, 1, 9), at(2024, time.January, 5, 9)},
+		{"weekly by day and interval skips a week", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE", at(2024, time.January, 3, 9), at(2024, time.January, 15, 9)},
+		{"monthly", "FREQ=MONTHLY", at(2024, time.January, 15, 9), at(2024, time.February, 15, 9)},
+		{"monthly interval", "FREQ=MONTHLY;INTERVAL=3", at(2024, time.November, 15, 9), at(2025, time.February, 15, 9)},
+		{"monthly by month days", "FREQ=MONTHLY;BYMONTHDAY=1,15", at(2024, time.January, 1, 9), at(2024, time.January, 15, 9)},
+		{"monthly by month days in the next month", "FREQ=MONTHLY;BYMONTHDAY=15,1", at(2024, time.January, 15, 9), at(2024, time.February, 1, 9)},
+		{"last day in a leap year", "FREQ=MONTHLY;BYMONTHDAY=-1", at(2024, time.January, 31, 9), at(2024, time.February, 29, 9)},
+		{"last day in a common year", "FREQ=MONTHLY;BYMONTHDAY=-1", at(2023, time.January, 31, 9), at(2023, time.February, 28, 9)},
+		{"last day after february", "FREQ=MONTHLY;BYMONTHDAY=-1", at(2024, time.February, 29, 9), at(2024, time.March, 31, 9)},
+		{"second to last day", "FREQ=MONTHLY;BYMONTHDAY=-2", at(2024, time.April, 29, 9), at(2024, time.May, 30, 9)},
+		{"31st skips february", "FREQ=MONTHLY;BYMONTHDAY=31", at(2024, time.January, 31, 9), at(2024, time.March, 31, 9)},
+		{"31st skips april", "FREQ=MONTHLY;BYMONTHDAY=31", at(2024, time.March, 31, 9), at(2024, time.May, 31, 9)},
+		{"day of the occurrence skips short months", "FREQ=MONTHLY", at(2024, time.August, 31, 9), at(2024, time.October, 31, 9)},
+		{"until a date includes the day", "FREQ=DAILY;UNTIL=20240103", at(2024, time.January, 2, 9), at(2024, time.January, 3, 9)},
+		{"until a time includes the time", "FREQ=DAILY;UNTIL=20240103T090000Z", at(2024, time.January, 2, 9), at(2024, time.January, 3, 9)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recurrence, err := ParseRecurrence(test.rule)
+			if err != nil {
+				t.Fatalf("ParseRecurrence(%q) error = %v", test.rule, err)
+			}
+
+			next, ok := recurrence.Next(test.after)
+			if !ok || !next.Equal(test.want) {
+				t.Errorf("Next(%v) = %v, %v, want %v", test.after, next, ok, test.want)
+			}
+		})
+	}
+}
+
+func TestRecurrenceNextEnds(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  string
+		after time.Time
+	}{
+		{"past an until date", "FREQ=DAILY;UNTIL=20240103", at(2024, time.January, 3, 9)},
+		{"past an until date with a weekly rule", "FREQ=WEEKLY;BYDAY=MO;UNTIL=20240107", at(2024, time.January, 1, 9)},
+		{"past an until time", "FREQ=DAILY;UNTIL=20240103T080000Z", at(2024, time.January, 2, 9)},
+		{"month days that never come", "FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=30,31", at(2024, time.February, 1, 9)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recurrence, err := ParseRecurrence(test.rule)
+			if err != nil {
+				t.Fatalf("ParseRecurrence(%q) error = %v", test.rule, err)
+			}
+
+			if next, ok := recurrence.Next(test.after); ok {
+				t.Errorf("Next(%v) = %v, want no more occurrences", test.after, next)
+			}
+		})
+	}
+}
+
+func TestRecurrenceAdvanceConsumesCount(t *testing.T) {
+	recurrence, err := ParseRecurrence("FREQ=WEEKLY;BYDAY=MO,TH;COUNT=4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first occurrence is the due date itself, every completion advances the rule
+	occurrence := at(2024, time.January, 1, 9)
+	occurrences := []time.Time{occurrence}
+	for {
+		var ok bool
+		recurrence, ok = recurrence.Advance()
+		if !ok {
+			break
+		}
+
+		occurrence, ok = recurrence.Next(occurrence)
+		if !ok {
+			t.Fatalf("Next(%v) found no occurrence before the count ran out", occurrence)
+		}
+
+		occurrences = append(occurrences, occurrence)
+	}
+
+	want := []time.Time{at(2024, time.January, 1, 9), at(2024, time.January, 4, 9), at(2024, time.January, 8, 9), at(2024, time.January, 11, 9)}
+	if !slices.EqualFunc(occurrences, want, time.Time.Equal) {
+		t.Errorf("occurrences = %v, want %v", occurrences, want)
+	}
+
+	if recurrence.Count != 1 || recurrence.String() != "FREQ=WEEKLY;BYDAY=MO,TH;COUNT=1" {
+		t.Errorf("rule of the last occurrence = %q, want COUNT=1", recurrence.String())
+	}
+}
+
+func TestRecurrenceAdvanceWithoutCount(t *testing.T) {
+	recurrence, err := ParseRecurrence("FREQ=DAILY")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		var ok bool
+		if recurrence, ok = recurrence.Advance(); !ok || recurrence.Count != 0 {
+			t.Fatalf("Advance() = %+v, %v, want an endless rule", recurrence, ok)
+		}
+	}
+}
+
+func TestRecurrenceSummary(t *testing.T) {
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{"FREQ=DAILY", "every day"},
+		{"FREQ=DAILY;INTERVAL=2", "every 2nd day"},
+		{"FREQ=DAILY;INTERVAL=11", "every 11th day"},
+		{"FREQ=DAILY;INTERVAL=23", "every 23rd day"},
+		{"FREQ=WEEKLY", "every week"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO", "every 2nd Monday"},
+		{"FREQ=WEEKLY;BYDAY=FR,MO,WE", "every Monday, Wednesday and Friday"},
+		{"FREQ=MONTHLY", "every month"},
+		{"FREQ=MONTHLY;INTERVAL=3", "every 3rd month"},
+		{"FREQ=MONTHLY;BYMONTHDAY=1,15", "every month on the 1st and 15th"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", "every month on the last day"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-2", "every month on the 2nd to last day"},
+		{"FREQ=DAILY;COUNT=1", "every day, once"},
+		{"FREQ=WEEKLY;BYDAY=TU;COUNT=5", "every Tuesday, 5 times"},
+		{"FREQ=DAILY;UNTIL=20240131", "every day, until 31 Jan 2024"},
+		{"FREQ=DAILY;UNTIL=20240131T170000Z", "every day, until 31 Jan 2024 17:00"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rule, func(t *testing.T) {
+			recurrence, err := ParseRecurrence(test.rule)
+			if err != nil {
+				t.Fatalf("ParseRecurrence(%q) error = %v", test.rule, err)
+			}
+
+			if summary := recurrence.Summary(); summary != test.want {
+				t.Errorf("Summary() = %q, want %q", summary, test.want)
+			}
+		})
+	}
+}
@@ -7,15 +7,25 @@ import (
 )
 
 type Session struct {
-	Id      string
-	UserId  int
-	Expires time.Time
+	Id       string
+	UserId   int
+	Expires  time.Time
+	Pending  bool
+	Attempts int
 }
 
 func NewSession(userId int, duration time.Duration) Session {
 	sessionId := uuid.New().String()
 	expires := time.Now().Add(duration)
-	return Session{sessionId, userId, expires}
+	return Session{Id: sessionId, UserId: userId, Expires: expires}
+}
+
+// NewPendingSession creates a half-authenticated session for a user who has passed the password
+// check but still needs to provide a second factor.
+func NewPendingSession(userId int, duration time.Duration) Session {
+	session := NewSession(userId, duration)
+	session.Pending = true
+	return session
 }
 
 func (this Session) Extend(duration time.Duration) Session {
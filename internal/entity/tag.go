@@ -0,0 +1,76 @@
+package entity
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	PriorityNone = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+)
+
+var Priorities = []int{PriorityNone, PriorityLow, PriorityMedium, PriorityHigh}
+
+func PriorityLabel(priority int) string {
+	switch priority {
+	case PriorityLow:
+		return "Low"
+	case PriorityMedium:
+		return "Medium"
+	case PriorityHigh:
+		return "High"
+	default:
+		return "None"
+	}
+}
+
+const maxTagsPerTodo = 10
+
+// Tag is a label the user attaches to any number of their todos. Names are unique per user
+// ignoring case.
+type Tag struct {
+	Id     int
+	UserId int
+	Name   string
+}
+
+// ParseTags reads a comma separated list of tags. Surrounding space is removed and repeated tags
+// are dropped, keeping the spelling of the first one.
+func ParseTags(input string) []string {
+	tags := []string{}
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(input, ",") {
+		tag = strings.TrimSpace(tag)
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+func ValidateTags(tags []string) error {
+	if len(tags) > maxTagsPerTodo {
+		return errors.New("A todo can have at most 10 tags.")
+	}
+
+	for _, tag := range tags {
+		length := len([]rune(tag))
+		if length == 0 || strings.Contains(tag, ",") {
+			return errors.New("Tag is invalid.")
+		}
+
+		if length > 50 {
+			return errors.New("Tag is too long.")
+		}
+	}
+
+	return nil
+}
@@ -1,12 +1,38 @@
 package entity
 
-import "errors"
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// TodoPositionGap is the distance between neighbouring todos when they are numbered. The gaps let
+// a todo move between two others without renumbering the list.
+const TodoPositionGap int64 = 1024
+
+const maxNotesLength = 10000
 
 type Todo struct {
 	Id         int
 	Task       string
 	Done       bool
 	TodoListId int
+	Position   int64
+	// Due is a wall clock time in the time zone of the user, the zero time when the todo has no
+	// due date. Only the date is used unless DueHasTime is set.
+	Due        time.Time
+	DueHasTime bool
+	Priority   int
+	Tags       []string
+	// ParentId is the todo this is a subtask of, zero for todos at the top of the list. Depth
+	// counts the parents above the todo.
+	ParentId int
+	Depth    int
+	Subtasks []Todo
+	// Recurrence is the rule the todo repeats with in RRULE form, empty for todos that don't.
+	Recurrence string
+	// Notes are written in Markdown.
+	Notes string
 }
 
 func NewTodo(task string, todoListId int) Todo {
@@ -18,6 +44,117 @@ func (this Todo) Toggle() Todo {
 	return this
 }
 
+// SubtasksDone counts the direct subtasks that are done.
+func (this Todo) SubtasksDone() int {
+	done := 0
+	for _, subtask := range this.Subtasks {
+		if subtask.Done {
+			done++
+		}
+	}
+
+	return done
+}
+
+// HasOpenSubtasks reports whether any subtask at any depth is still open.
+func (this Todo) HasOpenSubtasks() bool {
+	for _, subtask := range this.Subtasks {
+		if !subtask.Done || subtask.HasOpenSubtasks() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (this Todo) HasDue() bool {
+	return !this.Due.IsZero()
+}
+
+// IsOverdue reports whether an unfinished todo was due before now. The due time is read in the
+// location of now.
+func (this Todo) IsOverdue(now time.Time) bool {
+	if this.Done || !this.HasDue() {
+		return false
+	}
+
+	if this.DueHasTime {
+		return WallClock(now).After(this.Due)
+	}
+
+	return this.Due.Before(StartOfDay(now))
+}
+
+func (this Todo) DueLabel() string {
+	if !this.HasDue() {
+		return ""
+	}
+
+	if this.DueHasTime {
+		return this.Due.Format("Mon 2 Jan 2006 15:04")
+	}
+
+	return this.Due.Format("Mon 2 Jan 2006")
+}
+
+// WallClock drops the location of the time, keeping the date and clock as they read there. Due
+// dates are stored this way so they don't move when the user changes time zone.
+func WallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+// StartOfDay returns midnight of the day of the time as a wall clock time.
+func StartOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// DaysBetween counts the calendar days from the day of the start to the day of the end.
+func DaysBetween(start time.Time, end time.Time) int {
+	return int(StartOfDay(end).Sub(StartOfDay(start)).Hours() / 24)
+}
+
+// ParseDue reads a due date from a date and an optional clock time as sent by the date and time
+// inputs of a form. Empty values mean no due date.
+func ParseDue(date string, clock string) (time.Time, bool, error) {
+	if date == "" {
+		if clock != "" {
+			return time.Time{}, false, errors.New("Due time needs a due date.")
+		}
+
+		return time.Time{}, false, nil
+	}
+
+	if clock == "" {
+		due, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return time.Time{}, false, errors.New("Due date is invalid.")
+		}
+
+		return due, false, nil
+	}
+
+	due, err := time.Parse("2006-01-02 15:04", date+" "+clock)
+	if err != nil {
+		return time.Time{}, false, errors.New("Due time is invalid.")
+	}
+
+	return due, true, nil
+}
+
+// RecurrenceSummary describes the recurrence rule of the todo, empty when it doesn't repeat.
+func (this Todo) RecurrenceSummary() string {
+	recurrence, err := ParseRecurrence(this.Recurrence)
+	if this.Recurrence == "" || err != nil {
+		return ""
+	}
+
+	return recurrence.Summary()
+}
+
+func (this Todo) PriorityLabel() string {
+	return PriorityLabel(this.Priority)
+}
+
 func (this Todo) Validate() error {
 	length := len([]rune(this.Task))
 	if length == 0 {
@@ -28,17 +165,146 @@ func (this Todo) Validate() error {
 		return errors.New("Task is too long.")
 	}
 
+	if this.Priority < PriorityNone || this.Priority > PriorityHigh {
+		return errors.New("Unknown priority.")
+	}
+
+	if err := ValidateTags(this.Tags); err != nil {
+		return err
+	}
+
+	if this.Recurrence != "" {
+		if _, err := ParseRecurrence(this.Recurrence); err != nil {
+			return err
+		}
+	}
+
+	if len([]rune(this.Notes)) > maxNotesLength {
+		return errors.New("Notes are too long.")
+	}
+
 	return nil
 }
 
+// ScheduledTodo is a todo shown outside of its list, along with the name of the list.
+type ScheduledTodo struct {
+	Todo
+	ListName string
+}
+
+// SyncedTodo is a todo as sync clients such as calendar apps see it. Uid and ResourceName are
+// chosen by the client that added the todo, or made up from its id. Revision grows with every
+// change to the todo. ParentUid is the Uid of the parent of a subtask.
+type SyncedTodo struct {
+	Todo
+	Uid          string
+	ResourceName string
+	ParentUid    string
+	Revision     int64
+	// Deleted is set for todos in the trash when changes are listed.
+	Deleted bool
+}
+
+// Matches in the snippet of a search result are put between these marks. They are control
+// characters so text typed by users can't be mistaken for them.
+const (
+	SnippetMarkStart = "\x02"
+	SnippetMarkEnd   = "\x03"
+)
+
+// TodoSearchResult is a todo matching a search, with the part of its task and notes that matched.
+type TodoSearchResult struct {
+	Todo
+	ListName string
+	Snippet  string
+}
+
+type SnippetPart struct {
+	Text  string
+	Match bool
+}
+
+// SnippetParts splits the snippet into the matching parts and the text around them. Marks without
+// a pair are dropped.
+func (this TodoSearchResult) SnippetParts() []SnippetPart {
+	var parts []SnippetPart
+	rest := this.Snippet
+	for rest != "" {
+		before, afterStart, found := strings.Cut(rest, SnippetMarkStart)
+		if !found {
+			break
+		}
+
+		match, afterEnd, found := strings.Cut(afterStart, SnippetMarkEnd)
+		if !found {
+			break
+		}
+
+		parts = append(parts, SnippetPart{stripMarks(before), false}, SnippetPart{stripMarks(match), true})
+		rest = afterEnd
+	}
+
+	return append(parts, SnippetPart{stripMarks(rest), false})
+}
+
+func stripMarks(text string) string {
+	return strings.NewReplacer(SnippetMarkStart, "", SnippetMarkEnd, "").Replace(text)
+}
+
+// Lists are shared by adding members to them. The owner can rename, remove and share the list,
+// editors can change its todos and viewers can only read them.
+const (
+	ListRoleOwner  = "owner"
+	ListRoleEditor = "editor"
+	ListRoleViewer = "viewer"
+)
+
+// SharedListRoles are the roles a list can be shared with.
+var SharedListRoles = []string{ListRoleEditor, ListRoleViewer}
+
+// TodoList is read on behalf of a user. UserId is the owner of the list, Role is the role of the
+// user reading it.
 type TodoList struct {
-	Id     int
-	Name   string
-	UserId int
+	Id        int
+	Name      string
+	UserId    int
+	OwnerName string
+	Role      string
 }
 
 func NewTodoList(name string, userId int) TodoList {
-	return TodoList{Name: name, UserId: userId}
+	return TodoList{Name: name, UserId: userId, Role: ListRoleOwner}
+}
+
+func (this TodoList) IsOwner() bool {
+	return this.Role == ListRoleOwner
+}
+
+func (this TodoList) CanEdit() bool {
+	return this.Role == ListRoleOwner || this.Role == ListRoleEditor
+}
+
+type TodoListMember struct {
+	TodoListId int
+	UserId     int
+	UserName   string
+	Role       string
+}
+
+// TrashedList is a removed list waiting in the trash. TodoCount is how many todos come back with
+// it.
+type TrashedList struct {
+	TodoList
+	DeletedAt time.Time
+	TodoCount int
+}
+
+// TrashedTodo is a removed todo waiting in the trash, along with the name of its list. Its
+// subtasks were removed with it and come back with it.
+type TrashedTodo struct {
+	Todo
+	ListName  string
+	DeletedAt time.Time
 }
 
 func (this TodoList) Validate() error {
@@ -0,0 +1,104 @@
+package entity
+
+import (
+	"fmt"
+	"time"
+)
+
+// Kinds of changes in the activity of a list.
+const (
+	ActivityCreated  = "created"
+	ActivityRenamed  = "renamed"
+	ActivityToggled  = "toggled"
+	ActivityMoved    = "moved"
+	ActivityDeleted  = "deleted"
+	ActivityRestored = "restored"
+)
+
+// Values of a toggled todo before and after the change.
+const (
+	ActivityOpen = "open"
+	ActivityDone = "done"
+)
+
+// TodoActivity is an entry in the activity log of a list. TodoId is zero for changes to the list
+// itself. Subject is the task of the todo as it was when the change was made, Before and After
+// hold the value that changed: the name or task when renamed, open or done when toggled and the
+// names of the lists when moved.
+type TodoActivity struct {
+	Id         int64
+	TodoListId int
+	TodoId     int
+	ActorId    int
+	ActorName  string
+	Kind       string
+	Subject    string
+	Before     string
+	After      string
+	Created    time.Time
+}
+
+// NewListActivity is a change the user made to the list itself.
+func NewListActivity(kind string, actor User, listId int) TodoActivity {
+	return TodoActivity{
+		TodoListId: listId,
+		ActorId:    actor.Id,
+		ActorName:  actor.Name,
+		Kind:       kind,
+		Created:    time.Now(),
+	}
+}
+
+// NewTodoActivity is a change the user made to a todo of its list.
+func NewTodoActivity(kind string, actor User, todo Todo) TodoActivity {
+	activity := NewListActivity(kind, actor, todo.TodoListId)
+	activity.TodoId = todo.Id
+	activity.Subject = todo.Task
+	return activity
+}
+
+// Changed sets the value before and after the change.
+func (this TodoActivity) Changed(before string, after string) TodoActivity {
+	this.Before = before
+	this.After = after
+	return this
+}
+
+// Description tells what the actor did, to be shown after their name.
+func (this TodoActivity) Description() string {
+	if this.TodoId == 0 {
+		switch this.Kind {
+		case ActivityCreated:
+			return "created the list"
+		case ActivityRenamed:
+			return fmt.Sprintf("renamed the list from %q to %q", this.Before, this.After)
+		case ActivityDeleted:
+			return "moved the list to the trash"
+		case ActivityRestored:
+			return "restored the list from the trash"
+		}
+
+		return this.Kind + " the list"
+	}
+
+	switch this.Kind {
+	case ActivityCreated:
+		return fmt.Sprintf("added %q", this.Subject)
+	case ActivityRenamed:
+		return fmt.Sprintf("renamed %q to %q", this.Before, this.After)
+	case ActivityToggled:
+		if this.After == ActivityDone {
+			return fmt.Sprintf("finished %q", this.Subject)
+		}
+
+		return fmt.Sprintf("opened %q again", this.Subject)
+	case ActivityMoved:
+		return fmt.Sprintf("moved %q from %s to %s", this.Subject, this.Before, this.After)
+	case ActivityDeleted:
+		return fmt.Sprintf("moved %q to the trash", this.Subject)
+	case ActivityRestored:
+		return fmt.Sprintf("restored %q from the trash", this.Subject)
+	}
+
+	return fmt.Sprintf("%s %q", this.Kind, this.Subject)
+}
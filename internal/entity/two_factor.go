@@ -0,0 +1,12 @@
+package entity
+
+type TwoFactor struct {
+	UserId      int
+	Secret      []byte
+	Enabled     bool
+	LastCounter int64
+}
+
+func NewTwoFactor(userId int, secret []byte) TwoFactor {
+	return TwoFactor{UserId: userId, Secret: secret}
+}
@@ -1,15 +1,30 @@
 package entity
 
-import "errors"
+import (
+	"errors"
+	"net/mail"
+	"slices"
+	"time"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+var Roles = []string{RoleUser, RoleAdmin}
 
 type User struct {
-	Id   int
-	Name string
-	Key  []byte
+	Id       int
+	Name     string
+	Key      []byte
+	Email    string
+	Role     string
+	TimeZone string
 }
 
 func NewUser(name string, key []byte) User {
-	return User{Name: name, Key: key}
+	return User{Name: name, Key: key, Role: RoleUser, TimeZone: "UTC"}
 }
 
 func (this User) Validate() error {
@@ -21,5 +36,44 @@ func (this User) Validate() error {
 	if nameLength > 100 {
 		return errors.New("User name is too long.")
 	}
+
+	if this.Email != "" {
+		if _, err := mail.ParseAddress(this.Email); err != nil {
+			return errors.New("Email address is invalid.")
+		}
+	}
+
+	if !slices.Contains(Roles, this.Role) {
+		return errors.New("Unknown role.")
+	}
+
+	if _, err := time.LoadLocation(this.TimeZone); err != nil || this.TimeZone == "" {
+		return errors.New("Unknown time zone.")
+	}
+
 	return nil
 }
+
+// Location returns the time zone of the user for deciding what today is. Unknown zones fall back
+// to UTC.
+func (this User) Location() *time.Location {
+	location, err := time.LoadLocation(this.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return location
+}
+
+func (this User) HasRole(role string) bool {
+	return this.Role == role
+}
+
+func (this User) IsAdmin() bool {
+	return this.HasRole(RoleAdmin)
+}
+
+// Can reports whether the role of the user grants the permission.
+func (this User) Can(permission Permission) bool {
+	return slices.Contains(rolePermissions[this.Role], permission)
+}
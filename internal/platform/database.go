@@ -5,6 +5,8 @@ import (
 	"log"
 	"os"
 	"sort"
+	"strconv"
+	"strings"
 )
 
 type DatabaseOptions struct {
@@ -34,7 +36,7 @@ func applyMigrations(database *sql.DB, directory string) {
 	}
 
 	sort.Slice(files, func(i, j int) bool {
-		return files[i].Name() < files[j].Name()
+		return migrationVersion(files[i].Name()) < migrationVersion(files[j].Name())
 	})
 
 	for _, file := range files {
@@ -51,3 +53,15 @@ func applyMigrations(database *sql.DB, directory string) {
 		log.Printf("Executed migration: %s", file.Name())
 	}
 }
+
+// migrationVersion reads the number in front of a migration file name, so that version 10 is
+// applied after version 9 instead of after version 1.
+func migrationVersion(fileName string) int {
+	prefix, _, _ := strings.Cut(fileName, "_")
+	version, err := strconv.Atoi(prefix)
+	if err != nil {
+		log.Fatalf("Migration file name doesn't start with a version: %s", fileName)
+	}
+
+	return version
+}
@@ -0,0 +1,116 @@
+package platform
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+type MailOptions struct {
+	Mode     string
+	From     string
+	Host     string
+	Port     int
+	Username string
+	Password string
+	File     string
+}
+
+// NewMailer returns the sender selected by the mail mode. SMTP is used when the mode is "smtp",
+// otherwise messages are written to the configured file or to stdout for development.
+func NewMailer(options MailOptions) Mailer {
+	switch strings.ToLower(options.Mode) {
+	case "smtp":
+		return NewSmtpMailer(options)
+	case "file":
+		return NewFileMailer(options.From, options.File)
+	default:
+		return NewFileMailer(options.From, "")
+	}
+}
+
+func newMessage(from string, to string, subject string, body string) []byte {
+	var builder strings.Builder
+	builder.WriteString("From: " + from + "\r\n")
+	builder.WriteString("To: " + to + "\r\n")
+	builder.WriteString("Subject: " + subject + "\r\n")
+	builder.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	builder.WriteString("\r\n")
+	builder.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	builder.WriteString("\r\n")
+	return []byte(builder.String())
+}
+
+type SmtpMailer struct {
+	options MailOptions
+}
+
+func NewSmtpMailer(options MailOptions) *SmtpMailer {
+	return &SmtpMailer{options}
+}
+
+func (this *SmtpMailer) Send(to string, subject string, body string) error {
+	address := net.JoinHostPort(this.options.Host, strconv.Itoa(this.options.Port))
+	var auth smtp.Auth
+	if this.options.Username != "" {
+		auth = smtp.PlainAuth("", this.options.Username, this.options.Password, this.options.Host)
+	}
+
+	message := newMessage(this.options.From, to, subject, body)
+	if err := smtp.SendMail(address, auth, this.options.From, []string{to}, message); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+type FileMailer struct {
+	from   string
+	file   string
+	locker sync.Mutex
+}
+
+// NewFileMailer writes messages to the end of the file instead of sending them. An empty file
+// name writes to stdout.
+func NewFileMailer(from string, file string) *FileMailer {
+	return &FileMailer{from: from, file: file}
+}
+
+func (this *FileMailer) Send(to string, subject string, body string) error {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+
+	var output io.Writer = os.Stdout
+	if this.file != "" {
+		file, err := os.OpenFile(this.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Println(err.Error())
+			return err
+		}
+
+		defer file.Close()
+		output = file
+	}
+
+	message := newMessage(this.from, to, subject, body)
+	if _, err := fmt.Fprintf(output, "%s\n", message); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package platform
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/platform/smtptest"
+)
+
+func TestSmtpMailerSend(t *testing.T) {
+	server := smtptest.NewServer()
+	defer server.Close()
+
+	mailer := NewMailer(MailOptions{Mode: "smtp", From: "app@example.com", Host: server.Host, Port: server.Port})
+	if err := mailer.Send("user@example.com", "Hello", "First line\nSecond line"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("server got %d messages, want 1", len(messages))
+	}
+
+	message := messages[0]
+	if message.From != "app@example.com" {
+		t.Errorf("From = %q, want app@example.com", message.From)
+	}
+
+	if len(message.To) != 1 || message.To[0] != "user@example.com" {
+		t.Errorf("To = %v, want [user@example.com]", message.To)
+	}
+
+	if message.Auth != "" {
+		t.Errorf("Auth = %q, want no authentication without a username", message.Auth)
+	}
+
+	for _, want := range []string{"From: app@example.com\n", "To: user@example.com\n", "Subject: Hello\n", "\n\nFirst line\nSecond line\n"} {
+		if !strings.Contains(message.Data, want) {
+			t.Errorf("Data = %q, want it to contain %q", message.Data, want)
+		}
+	}
+}
+
+func TestSmtpMailerAuthenticates(t *testing.T) {
+	server := smtptest.NewServer()
+	defer server.Close()
+
+	mailer := NewSmtpMailer(MailOptions{From: "app@example.com", Host: server.Host, Port: server.Port, Username: "app", Password: "secret"})
+	if err := mailer.Send("user@example.com", "Hello", "Body"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("server got %d messages, want 1", len(messages))
+	}
+
+	want := "PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00app\x00secret"))
+	if messages[0].Auth != want {
+		t.Errorf("Auth = %q, want %q", messages[0].Auth, want)
+	}
+}
+
+func TestSmtpMailerUnreachable(t *testing.T) {
+	server := smtptest.NewServer()
+	server.Close()
+
+	mailer := NewSmtpMailer(MailOptions{From: "app@example.com", Host: server.Host, Port: server.Port})
+	if err := mailer.Send("user@example.com", "Hello", "Body"); err == nil {
+		t.Fatal("Send() error = nil, want an error when the server is down")
+	}
+}
+
+func TestFileMailerAppends(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "mail.txt")
+	mailer := NewMailer(MailOptions{Mode: "file", From: "app@example.com", File: file})
+	for _, subject := range []string{"First", "Second"} {
+		if err := mailer.Send("user@example.com", subject, "Body"); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"Subject: First\r\n", "Subject: Second\r\n"} {
+		if !strings.Contains(string(contents), want) {
+			t.Errorf("file = %q, want it to contain %q", contents, want)
+		}
+	}
+}
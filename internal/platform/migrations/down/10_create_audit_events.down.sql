@@ -0,0 +1,14 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 10) THEN 
+        RAISE NOTICE 'Migration create_audit_events not applied, skipping';
+        RETURN;
+    END IF;
+
+    DROP TABLE IF EXISTS "AuditEvents";
+    DROP FUNCTION IF EXISTS "PreventAuditEventChanges"();
+    
+    DELETE FROM "Migrations" WHERE "Version" = 10;
+END $$;
+COMMIT;
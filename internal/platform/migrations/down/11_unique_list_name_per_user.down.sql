@@ -0,0 +1,14 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 11) THEN 
+        RAISE NOTICE 'Migration unique_list_name_per_user not applied, skipping';
+        RETURN;
+    END IF;
+
+    DROP INDEX IF EXISTS "Index_TodoLists_UserId_Name";
+    ALTER TABLE IF EXISTS "TodoLists" ADD CONSTRAINT "TodoLists_Name_key" UNIQUE ("Name");
+    
+    DELETE FROM "Migrations" WHERE "Version" = 11;
+END $$;
+COMMIT;
@@ -0,0 +1,14 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 12) THEN 
+        RAISE NOTICE 'Migration add_todo_positions not applied, skipping';
+        RETURN;
+    END IF;
+
+    DROP INDEX IF EXISTS "Index_Todos_TodoListId_Position";
+    ALTER TABLE IF EXISTS "Todos" DROP COLUMN "Position";
+    
+    DELETE FROM "Migrations" WHERE "Version" = 12;
+END $$;
+COMMIT;
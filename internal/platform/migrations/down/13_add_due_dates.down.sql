@@ -0,0 +1,16 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 13) THEN 
+        RAISE NOTICE 'Migration add_due_dates not applied, skipping';
+        RETURN;
+    END IF;
+
+    DROP INDEX IF EXISTS "Index_Todos_Due";
+    ALTER TABLE IF EXISTS "Todos" DROP COLUMN "DueHasTime";
+    ALTER TABLE IF EXISTS "Todos" DROP COLUMN "Due";
+    ALTER TABLE IF EXISTS "Users" DROP COLUMN "TimeZone";
+    
+    DELETE FROM "Migrations" WHERE "Version" = 13;
+END $$;
+COMMIT;
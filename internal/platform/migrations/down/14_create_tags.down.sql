@@ -0,0 +1,16 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 14) THEN 
+        RAISE NOTICE 'Migration create_tags not applied, skipping';
+        RETURN;
+    END IF;
+
+    DROP TABLE IF EXISTS "TodoTags";
+    DROP TABLE IF EXISTS "Tags";
+    ALTER TABLE IF EXISTS "Todos" DROP CONSTRAINT "Priority";
+    ALTER TABLE IF EXISTS "Todos" DROP COLUMN "Priority";
+    
+    DELETE FROM "Migrations" WHERE "Version" = 14;
+END $$;
+COMMIT;
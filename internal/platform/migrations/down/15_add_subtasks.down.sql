@@ -0,0 +1,15 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 15) THEN 
+        RAISE NOTICE 'Migration add_subtasks not applied, skipping';
+        RETURN;
+    END IF;
+
+    DROP INDEX IF EXISTS "Index_Todos_ParentId";
+    ALTER TABLE IF EXISTS "Todos" DROP CONSTRAINT "ParentId";
+    ALTER TABLE IF EXISTS "Todos" DROP COLUMN "ParentId";
+    
+    DELETE FROM "Migrations" WHERE "Version" = 15;
+END $$;
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 16) THEN 
+        RAISE NOTICE 'Migration add_recurrence not applied, skipping';
+        RETURN;
+    END IF;
+
+    ALTER TABLE IF EXISTS "Todos" DROP COLUMN "Recurrence";
+    
+    DELETE FROM "Migrations" WHERE "Version" = 16;
+END $$;
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 17) THEN 
+        RAISE NOTICE 'Migration add_todo_notes not applied, skipping';
+        RETURN;
+    END IF;
+
+    ALTER TABLE IF EXISTS "Todos" DROP COLUMN "Notes";
+    
+    DELETE FROM "Migrations" WHERE "Version" = 17;
+END $$;
+COMMIT;
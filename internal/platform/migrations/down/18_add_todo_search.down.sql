@@ -0,0 +1,14 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 18) THEN 
+        RAISE NOTICE 'Migration add_todo_search not applied, skipping';
+        RETURN;
+    END IF;
+
+    DROP INDEX IF EXISTS "Index_Todos_Search";
+    ALTER TABLE IF EXISTS "Todos" DROP COLUMN "Search";
+    
+    DELETE FROM "Migrations" WHERE "Version" = 18;
+END $$;
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 19) THEN 
+        RAISE NOTICE 'Migration create_todo_list_members not applied, skipping';
+        RETURN;
+    END IF;
+
+    DROP TABLE IF EXISTS "TodoListMembers";
+    
+    DELETE FROM "Migrations" WHERE "Version" = 19;
+END $$;
+COMMIT;
@@ -0,0 +1,22 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 20) THEN 
+        RAISE NOTICE 'Migration add_trash not applied, skipping';
+        RETURN;
+    END IF;
+
+    -- without the trash its contents are gone for good
+    DELETE FROM "TodoLists" WHERE "DeletedAt" IS NOT NULL;
+    DELETE FROM "Todos" WHERE "DeletedAt" IS NOT NULL;
+
+    DROP INDEX IF EXISTS "Index_TodoLists_UserId_Name";
+    CREATE UNIQUE INDEX IF NOT EXISTS "Index_TodoLists_UserId_Name" ON "TodoLists"("UserId", lower("Name"));
+    DROP INDEX IF EXISTS "Index_Todos_DeletedAt";
+    DROP INDEX IF EXISTS "Index_TodoLists_DeletedAt";
+    ALTER TABLE IF EXISTS "Todos" DROP COLUMN "DeletedAt";
+    ALTER TABLE IF EXISTS "TodoLists" DROP COLUMN "DeletedAt";
+    
+    DELETE FROM "Migrations" WHERE "Version" = 20;
+END $$;
+COMMIT;
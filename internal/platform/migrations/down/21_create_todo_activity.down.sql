@@ -0,0 +1,14 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 21) THEN 
+        RAISE NOTICE 'Migration create_todo_activity not applied, skipping';
+        RETURN;
+    END IF;
+
+    DROP TABLE IF EXISTS "TodoActivity";
+    DROP FUNCTION IF EXISTS "PreventTodoActivityChanges"();
+    
+    DELETE FROM "Migrations" WHERE "Version" = 21;
+END $$;
+COMMIT;
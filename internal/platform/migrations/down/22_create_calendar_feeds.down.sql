@@ -0,0 +1,13 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 22) THEN 
+        RAISE NOTICE 'Migration create_calendar_feeds not applied, skipping';
+        RETURN;
+    END IF;
+
+    DROP TABLE IF EXISTS "CalendarFeeds";
+    
+    DELETE FROM "Migrations" WHERE "Version" = 22;
+END $$;
+COMMIT;
@@ -0,0 +1,23 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 23) THEN 
+        RAISE NOTICE 'Migration add_todo_sync not applied, skipping';
+        RETURN;
+    END IF;
+
+    DROP TRIGGER IF EXISTS "Trigger_Todos_Bury" ON "Todos";
+    DROP FUNCTION IF EXISTS "BuryTodo"();
+    DROP TABLE IF EXISTS "TodoTombstones";
+    DROP TRIGGER IF EXISTS "Trigger_Todos_StampRevision" ON "Todos";
+    DROP FUNCTION IF EXISTS "StampTodoRevision"();
+    DROP INDEX IF EXISTS "Index_Todos_TodoListId_Revision";
+    DROP INDEX IF EXISTS "Index_Todos_TodoListId_ResourceName";
+    ALTER TABLE IF EXISTS "Todos" DROP COLUMN IF EXISTS "Revision";
+    ALTER TABLE IF EXISTS "Todos" DROP COLUMN IF EXISTS "ResourceName";
+    ALTER TABLE IF EXISTS "Todos" DROP COLUMN IF EXISTS "Uid";
+    DROP SEQUENCE IF EXISTS "TodoRevisions";
+    
+    DELETE FROM "Migrations" WHERE "Version" = 23;
+END $$;
+COMMIT;
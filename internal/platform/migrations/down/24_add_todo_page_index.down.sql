@@ -0,0 +1,13 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 24) THEN 
+        RAISE NOTICE 'Migration add_todo_page_index not applied, skipping';
+        RETURN;
+    END IF;
+
+    DROP INDEX IF EXISTS "Index_Todos_TodoListId_Position_Id_Top";
+    
+    DELETE FROM "Migrations" WHERE "Version" = 24;
+END $$;
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 4) THEN 
+        RAISE NOTICE 'Migration add_user_email not applied, skipping';
+        RETURN;
+    END IF;
+
+    ALTER TABLE IF EXISTS "Users" DROP COLUMN "Email";
+    
+    DELETE FROM "Migrations" WHERE "Version" = 4;
+END $$;
+COMMIT;
@@ -0,0 +1,14 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 5) THEN 
+        RAISE NOTICE 'Migration create_password_reset_tokens not applied, skipping';
+        RETURN;
+    END IF;
+
+    DROP INDEX IF EXISTS "Index_PasswordResetTokens_UserId";
+    DROP TABLE IF EXISTS "PasswordResetTokens";
+    
+    DELETE FROM "Migrations" WHERE "Version" = 5;
+END $$;
+COMMIT;
@@ -0,0 +1,15 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 6) THEN 
+        RAISE NOTICE 'Migration create_two_factor not applied, skipping';
+        RETURN;
+    END IF;
+
+    DROP INDEX IF EXISTS "Index_RecoveryCodes_UserId";
+    DROP TABLE IF EXISTS "RecoveryCodes";
+    DROP TABLE IF EXISTS "TwoFactor";
+    
+    DELETE FROM "Migrations" WHERE "Version" = 6;
+END $$;
+COMMIT;
@@ -0,0 +1,14 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 7) THEN 
+        RAISE NOTICE 'Migration create_api_tokens not applied, skipping';
+        RETURN;
+    END IF;
+
+    DROP INDEX IF EXISTS "Index_ApiTokens_UserId";
+    DROP TABLE IF EXISTS "ApiTokens";
+    
+    DELETE FROM "Migrations" WHERE "Version" = 7;
+END $$;
+COMMIT;
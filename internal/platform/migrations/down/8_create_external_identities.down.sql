@@ -0,0 +1,13 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 8) THEN 
+        RAISE NOTICE 'Migration create_external_identities not applied, skipping';
+        RETURN;
+    END IF;
+
+    DROP TABLE IF EXISTS "ExternalIdentities";
+    
+    DELETE FROM "Migrations" WHERE "Version" = 8;
+END $$;
+COMMIT;
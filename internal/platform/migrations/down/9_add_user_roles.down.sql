@@ -0,0 +1,14 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF NOT EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 9) THEN 
+        RAISE NOTICE 'Migration add_user_roles not applied, skipping';
+        RETURN;
+    END IF;
+
+    ALTER TABLE IF EXISTS "Users" DROP CONSTRAINT "Role";
+    ALTER TABLE IF EXISTS "Users" DROP COLUMN "Role";
+    
+    DELETE FROM "Migrations" WHERE "Version" = 9;
+END $$;
+COMMIT;
@@ -0,0 +1,41 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 10) THEN
+        RAISE NOTICE 'Migration create_audit_events already applied, skipping';
+        RETURN;
+    END IF;
+
+    CREATE TABLE IF NOT EXISTS "AuditEvents"
+    (
+        "Id" BIGINT NOT NULL PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+        "UserId" INTEGER NULL,
+        "UserName" TEXT NOT NULL DEFAULT '',
+        "Kind" TEXT NOT NULL,
+        "Ip" TEXT NOT NULL DEFAULT '',
+        "UserAgent" TEXT NOT NULL DEFAULT '',
+        "Detail" TEXT NOT NULL DEFAULT '',
+        "Created" TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+
+    CREATE INDEX IF NOT EXISTS "Index_AuditEvents_UserId_Created" ON "AuditEvents"("UserId", "Created" DESC);
+    CREATE INDEX IF NOT EXISTS "Index_AuditEvents_Created" ON "AuditEvents"("Created" DESC);
+
+    -- the log is append-only, events can't be changed or removed once written
+    CREATE OR REPLACE FUNCTION "PreventAuditEventChanges"() RETURNS TRIGGER AS $function$
+    BEGIN
+        RAISE EXCEPTION 'AuditEvents is append-only';
+    END;
+    $function$ LANGUAGE plpgsql;
+
+    CREATE TRIGGER "Trigger_AuditEvents_AppendOnly"
+        BEFORE UPDATE OR DELETE ON "AuditEvents"
+        FOR EACH ROW EXECUTE FUNCTION "PreventAuditEventChanges"();
+
+    CREATE TRIGGER "Trigger_AuditEvents_NoTruncate"
+        BEFORE TRUNCATE ON "AuditEvents"
+        FOR EACH STATEMENT EXECUTE FUNCTION "PreventAuditEventChanges"();
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (10, 'create_audit_events');
+END $$;
+COMMIT;
@@ -0,0 +1,39 @@
+BEGIN;
+DO $$ 
+DECLARE
+    duplicate RECORD;
+    candidate TEXT;
+    suffix INTEGER;
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 11) THEN
+        RAISE NOTICE 'Migration unique_list_name_per_user already applied, skipping';
+        RETURN;
+    END IF;
+
+    -- list names only have to be unique among the lists of one user, ignoring case
+    ALTER TABLE IF EXISTS "TodoLists" DROP CONSTRAINT IF EXISTS "TodoLists_Name_key";
+
+    -- names that only differ in case get a number, the oldest list keeps its name
+    FOR duplicate IN
+        SELECT "Id", "UserId", "Name" FROM (
+            SELECT "Id", "UserId", "Name", row_number() OVER (PARTITION BY "UserId", lower("Name") ORDER BY "Id") AS "Number"
+            FROM "TodoLists"
+        ) AS "Numbered" 
+        WHERE "Number" > 1 
+        ORDER BY "Id"
+    LOOP
+        suffix := 2;
+        LOOP
+            candidate := duplicate."Name" || ' (' || suffix || ')';
+            EXIT WHEN NOT EXISTS(SELECT 1 FROM "TodoLists" WHERE "UserId" = duplicate."UserId" AND lower("Name") = lower(candidate));
+            suffix := suffix + 1;
+        END LOOP;
+
+        UPDATE "TodoLists" SET "Name" = candidate WHERE "Id" = duplicate."Id";
+    END LOOP;
+
+    CREATE UNIQUE INDEX IF NOT EXISTS "Index_TodoLists_UserId_Name" ON "TodoLists"("UserId", lower("Name"));
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (11, 'unique_list_name_per_user');
+END $$;
+COMMIT;
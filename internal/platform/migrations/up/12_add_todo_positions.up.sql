@@ -0,0 +1,23 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 12) THEN
+        RAISE NOTICE 'Migration add_todo_positions already applied, skipping';
+        RETURN;
+    END IF;
+
+    ALTER TABLE IF EXISTS "Todos" ADD COLUMN "Position" BIGINT NOT NULL DEFAULT 0;
+
+    -- existing todos keep their alphabetical order, spaced out so they can be moved between each other
+    UPDATE "Todos" t SET "Position" = ranked."Rank" * 1024
+    FROM (
+        SELECT "Id", row_number() OVER (PARTITION BY "TodoListId" ORDER BY "Task" ASC, "Id" ASC) AS "Rank" 
+        FROM "Todos"
+    ) ranked
+    WHERE t."Id" = ranked."Id";
+
+    CREATE INDEX IF NOT EXISTS "Index_Todos_TodoListId_Position" ON "Todos"("TodoListId", "Position");
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (12, 'add_todo_positions');
+END $$;
+COMMIT;
@@ -0,0 +1,19 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 13) THEN
+        RAISE NOTICE 'Migration add_due_dates already applied, skipping';
+        RETURN;
+    END IF;
+
+    ALTER TABLE IF EXISTS "Users" ADD COLUMN "TimeZone" TEXT NOT NULL DEFAULT 'UTC';
+
+    -- due dates are wall clock times in the time zone of the user, "DueHasTime" is false for whole days
+    ALTER TABLE IF EXISTS "Todos" ADD COLUMN "Due" TIMESTAMP NULL;
+    ALTER TABLE IF EXISTS "Todos" ADD COLUMN "DueHasTime" BOOLEAN NOT NULL DEFAULT false;
+
+    CREATE INDEX IF NOT EXISTS "Index_Todos_Due" ON "Todos"("Due") WHERE "Due" IS NOT NULL;
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (13, 'add_due_dates');
+END $$;
+COMMIT;
@@ -0,0 +1,35 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 14) THEN
+        RAISE NOTICE 'Migration create_tags already applied, skipping';
+        RETURN;
+    END IF;
+
+    ALTER TABLE IF EXISTS "Todos" ADD COLUMN "Priority" SMALLINT NOT NULL DEFAULT 0;
+    ALTER TABLE IF EXISTS "Todos" ADD CONSTRAINT "Priority" CHECK ("Priority" BETWEEN 0 AND 3);
+
+    CREATE TABLE IF NOT EXISTS "Tags"
+    (
+        "Id" INTEGER NOT NULL PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+        "UserId" INTEGER NOT NULL,
+        "Name" TEXT NOT NULL,
+        CONSTRAINT "UserId" FOREIGN KEY ("UserId") REFERENCES "Users"("Id") ON DELETE CASCADE
+    );
+
+    CREATE UNIQUE INDEX IF NOT EXISTS "Index_Tags_UserId_Name" ON "Tags"("UserId", lower("Name"));
+
+    CREATE TABLE IF NOT EXISTS "TodoTags"
+    (
+        "TodoId" INTEGER NOT NULL,
+        "TagId" INTEGER NOT NULL,
+        PRIMARY KEY ("TodoId", "TagId"),
+        CONSTRAINT "TodoId" FOREIGN KEY ("TodoId") REFERENCES "Todos"("Id") ON DELETE CASCADE,
+        CONSTRAINT "TagId" FOREIGN KEY ("TagId") REFERENCES "Tags"("Id") ON DELETE CASCADE
+    );
+
+    CREATE INDEX IF NOT EXISTS "Index_TodoTags_TagId" ON "TodoTags"("TagId");
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (14, 'create_tags');
+END $$;
+COMMIT;
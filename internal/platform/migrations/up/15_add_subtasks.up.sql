@@ -0,0 +1,15 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 15) THEN
+        RAISE NOTICE 'Migration add_subtasks already applied, skipping';
+        RETURN;
+    END IF;
+
+    ALTER TABLE IF EXISTS "Todos" ADD COLUMN "ParentId" INTEGER NULL;
+    ALTER TABLE IF EXISTS "Todos" ADD CONSTRAINT "ParentId" FOREIGN KEY ("ParentId") REFERENCES "Todos"("Id") ON DELETE CASCADE;
+    CREATE INDEX IF NOT EXISTS "Index_Todos_ParentId" ON "Todos"("ParentId");
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (15, 'add_subtasks');
+END $$;
+COMMIT;
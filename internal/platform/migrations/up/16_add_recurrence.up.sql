@@ -0,0 +1,13 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 16) THEN
+        RAISE NOTICE 'Migration add_recurrence already applied, skipping';
+        RETURN;
+    END IF;
+
+    ALTER TABLE IF EXISTS "Todos" ADD COLUMN "Recurrence" TEXT NOT NULL DEFAULT '';
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (16, 'add_recurrence');
+END $$;
+COMMIT;
@@ -0,0 +1,13 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 17) THEN
+        RAISE NOTICE 'Migration add_todo_notes already applied, skipping';
+        RETURN;
+    END IF;
+
+    ALTER TABLE IF EXISTS "Todos" ADD COLUMN "Notes" TEXT NOT NULL DEFAULT '';
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (17, 'add_todo_notes');
+END $$;
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 18) THEN
+        RAISE NOTICE 'Migration add_todo_search already applied, skipping';
+        RETURN;
+    END IF;
+
+    ALTER TABLE IF EXISTS "Todos" ADD COLUMN "Search" TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', "Task"), 'A') || setweight(to_tsvector('english', "Notes"), 'B')
+    ) STORED;
+    CREATE INDEX IF NOT EXISTS "Index_Todos_Search" ON "Todos" USING GIN ("Search");
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (18, 'add_todo_search');
+END $$;
+COMMIT;
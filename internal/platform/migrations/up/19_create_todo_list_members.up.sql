@@ -0,0 +1,29 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 19) THEN
+        RAISE NOTICE 'Migration create_todo_list_members already applied, skipping';
+        RETURN;
+    END IF;
+
+    CREATE TABLE IF NOT EXISTS "TodoListMembers"
+    (
+        "TodoListId" INTEGER NOT NULL,
+        "UserId" INTEGER NOT NULL,
+        "Role" TEXT NOT NULL,
+        PRIMARY KEY ("TodoListId", "UserId"),
+        CONSTRAINT "TodoListId" FOREIGN KEY ("TodoListId") REFERENCES "TodoLists"("Id") ON DELETE CASCADE,
+        CONSTRAINT "UserId" FOREIGN KEY ("UserId") REFERENCES "Users"("Id") ON DELETE CASCADE,
+        CONSTRAINT "Role" CHECK ("Role" IN ('owner', 'editor', 'viewer'))
+    );
+
+    CREATE INDEX IF NOT EXISTS "Index_TodoListMembers_UserId" ON "TodoListMembers"("UserId");
+
+    -- the owner stays in "TodoLists" and is also the first member of the list
+    INSERT INTO "TodoListMembers" ("TodoListId", "UserId", "Role") 
+    SELECT "Id", "UserId", 'owner' FROM "TodoLists" 
+    ON CONFLICT DO NOTHING;
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (19, 'create_todo_list_members');
+END $$;
+COMMIT;
@@ -0,0 +1,21 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 20) THEN
+        RAISE NOTICE 'Migration add_trash already applied, skipping';
+        RETURN;
+    END IF;
+
+    -- removed lists and todos stay in the trash until they are restored or purged
+    ALTER TABLE IF EXISTS "TodoLists" ADD COLUMN "DeletedAt" TIMESTAMPTZ NULL;
+    ALTER TABLE IF EXISTS "Todos" ADD COLUMN "DeletedAt" TIMESTAMPTZ NULL;
+    CREATE INDEX IF NOT EXISTS "Index_TodoLists_DeletedAt" ON "TodoLists"("DeletedAt") WHERE "DeletedAt" IS NOT NULL;
+    CREATE INDEX IF NOT EXISTS "Index_Todos_DeletedAt" ON "Todos"("DeletedAt") WHERE "DeletedAt" IS NOT NULL;
+
+    -- a list in the trash doesn't keep its name from being used again
+    DROP INDEX IF EXISTS "Index_TodoLists_UserId_Name";
+    CREATE UNIQUE INDEX IF NOT EXISTS "Index_TodoLists_UserId_Name" ON "TodoLists"("UserId", lower("Name")) WHERE "DeletedAt" IS NULL;
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (20, 'add_trash');
+END $$;
+COMMIT;
@@ -0,0 +1,43 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 21) THEN
+        RAISE NOTICE 'Migration create_todo_activity already applied, skipping';
+        RETURN;
+    END IF;
+
+    -- entries outlive the lists, todos and users they mention, so there are no foreign keys
+    CREATE TABLE IF NOT EXISTS "TodoActivity"
+    (
+        "Id" BIGINT NOT NULL PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+        "TodoListId" INTEGER NOT NULL,
+        "TodoId" INTEGER NULL,
+        "ActorId" INTEGER NOT NULL,
+        "ActorName" TEXT NOT NULL DEFAULT '',
+        "Kind" TEXT NOT NULL,
+        "Subject" TEXT NOT NULL DEFAULT '',
+        "Before" TEXT NOT NULL DEFAULT '',
+        "After" TEXT NOT NULL DEFAULT '',
+        "Created" TIMESTAMPTZ NOT NULL DEFAULT now()
+    );
+
+    CREATE INDEX IF NOT EXISTS "Index_TodoActivity_TodoListId_Id" ON "TodoActivity"("TodoListId", "Id" DESC);
+
+    -- the log is append-only like "AuditEvents"
+    CREATE OR REPLACE FUNCTION "PreventTodoActivityChanges"() RETURNS TRIGGER AS $function$
+    BEGIN
+        RAISE EXCEPTION 'TodoActivity is append-only';
+    END;
+    $function$ LANGUAGE plpgsql;
+
+    CREATE TRIGGER "Trigger_TodoActivity_AppendOnly"
+        BEFORE UPDATE OR DELETE ON "TodoActivity"
+        FOR EACH ROW EXECUTE FUNCTION "PreventTodoActivityChanges"();
+
+    CREATE TRIGGER "Trigger_TodoActivity_NoTruncate"
+        BEFORE TRUNCATE ON "TodoActivity"
+        FOR EACH STATEMENT EXECUTE FUNCTION "PreventTodoActivityChanges"();
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (21, 'create_todo_activity');
+END $$;
+COMMIT;
@@ -0,0 +1,21 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 22) THEN
+        RAISE NOTICE 'Migration create_calendar_feeds already applied, skipping';
+        RETURN;
+    END IF;
+
+    -- a user has at most one feed, creating a new one replaces the old token
+    CREATE TABLE IF NOT EXISTS "CalendarFeeds"
+    (
+        "UserId" INTEGER NOT NULL PRIMARY KEY,
+        "Hash" BYTEA NOT NULL UNIQUE,
+        "LastUsed" TIMESTAMPTZ NULL,
+        "Created" TIMESTAMPTZ NOT NULL DEFAULT now(),
+        CONSTRAINT "UserId" FOREIGN KEY ("UserId") REFERENCES "Users"("Id") ON DELETE CASCADE
+    );
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (22, 'create_calendar_feeds');
+END $$;
+COMMIT;
@@ -0,0 +1,68 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 23) THEN
+        RAISE NOTICE 'Migration add_todo_sync already applied, skipping';
+        RETURN;
+    END IF;
+
+    -- every change to a todo takes the next revision, sync clients ask for the changes after the
+    -- revision they saw last
+    CREATE SEQUENCE IF NOT EXISTS "TodoRevisions" AS BIGINT;
+
+    ALTER TABLE IF EXISTS "Todos" ADD COLUMN "Uid" TEXT NULL;
+    ALTER TABLE IF EXISTS "Todos" ADD COLUMN "ResourceName" TEXT NULL;
+    ALTER TABLE IF EXISTS "Todos" ADD COLUMN "Revision" BIGINT NOT NULL DEFAULT nextval('"TodoRevisions"');
+    UPDATE "Todos" SET "Uid" = 'todo-' || "Id" || '@try-go-htmx', "ResourceName" = 'todo-' || "Id" || '.ics';
+    ALTER TABLE IF EXISTS "Todos" ALTER COLUMN "Uid" SET NOT NULL;
+    ALTER TABLE IF EXISTS "Todos" ALTER COLUMN "ResourceName" SET NOT NULL;
+    CREATE UNIQUE INDEX IF NOT EXISTS "Index_Todos_TodoListId_ResourceName" ON "Todos"("TodoListId", "ResourceName");
+    CREATE INDEX IF NOT EXISTS "Index_Todos_TodoListId_Revision" ON "Todos"("TodoListId", "Revision");
+
+    -- todos added by the app get names made up from their id, clients name the todos they add
+    CREATE OR REPLACE FUNCTION "StampTodoRevision"() RETURNS TRIGGER AS $function$
+    BEGIN
+        NEW."Uid" := COALESCE(NEW."Uid", 'todo-' || NEW."Id" || '@try-go-htmx');
+        NEW."ResourceName" := COALESCE(NEW."ResourceName", 'todo-' || NEW."Id" || '.ics');
+        IF TG_OP = 'UPDATE' THEN
+            NEW."Revision" := nextval('"TodoRevisions"');
+        END IF;
+        RETURN NEW;
+    END;
+    $function$ LANGUAGE plpgsql;
+
+    CREATE TRIGGER "Trigger_Todos_StampRevision"
+        BEFORE INSERT OR UPDATE ON "Todos"
+        FOR EACH ROW EXECUTE FUNCTION "StampTodoRevision"();
+
+    -- todos deleted for good or moved to another list are gone from their list, the tombstones
+    -- tell sync clients about them. lists deleted for good don't need tombstones
+    CREATE TABLE IF NOT EXISTS "TodoTombstones"
+    (
+        "TodoListId" INTEGER NOT NULL,
+        "ResourceName" TEXT NOT NULL,
+        "Revision" BIGINT NOT NULL DEFAULT nextval('"TodoRevisions"')
+    );
+
+    CREATE INDEX IF NOT EXISTS "Index_TodoTombstones_TodoListId_Revision" ON "TodoTombstones"("TodoListId", "Revision");
+
+    CREATE OR REPLACE FUNCTION "BuryTodo"() RETURNS TRIGGER AS $function$
+    BEGIN
+        IF TG_OP = 'UPDATE' AND OLD."TodoListId" = NEW."TodoListId" THEN
+            RETURN NULL;
+        END IF;
+
+        INSERT INTO "TodoTombstones" ("TodoListId", "ResourceName") 
+        SELECT OLD."TodoListId", OLD."ResourceName" 
+        WHERE EXISTS (SELECT 1 FROM "TodoLists" WHERE "Id" = OLD."TodoListId");
+        RETURN NULL;
+    END;
+    $function$ LANGUAGE plpgsql;
+
+    CREATE TRIGGER "Trigger_Todos_Bury"
+        AFTER UPDATE OF "TodoListId" OR DELETE ON "Todos"
+        FOR EACH ROW EXECUTE FUNCTION "BuryTodo"();
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (23, 'add_todo_sync');
+END $$;
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 24) THEN
+        RAISE NOTICE 'Migration add_todo_page_index already applied, skipping';
+        RETURN;
+    END IF;
+
+    -- pages of a list are read by the position of their top level todos, so a page is found
+    -- without reading the todos before it
+    CREATE INDEX IF NOT EXISTS "Index_Todos_TodoListId_Position_Id_Top" ON "Todos"("TodoListId", "Position", "Id") 
+        WHERE "ParentId" IS NULL AND "DeletedAt" IS NULL;
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (24, 'add_todo_page_index');
+END $$;
+COMMIT;
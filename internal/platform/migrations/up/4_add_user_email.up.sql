@@ -0,0 +1,13 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 4) THEN
+        RAISE NOTICE 'Migration add_user_email already applied, skipping';
+        RETURN;
+    END IF;
+
+    ALTER TABLE IF EXISTS "Users" ADD COLUMN "Email" TEXT NOT NULL DEFAULT '';
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (4, 'add_user_email');
+END $$;
+COMMIT;
@@ -0,0 +1,23 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 5) THEN
+        RAISE NOTICE 'Migration create_password_reset_tokens already applied, skipping';
+        RETURN;
+    END IF;
+
+    CREATE TABLE IF NOT EXISTS "PasswordResetTokens"
+    (
+        "Id" INTEGER NOT NULL PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+        "UserId" INTEGER NOT NULL,
+        "Hash" BYTEA NOT NULL UNIQUE,
+        "Expires" TIMESTAMPTZ NOT NULL,
+        "Used" BOOLEAN NOT NULL DEFAULT false,
+        CONSTRAINT "UserId" FOREIGN KEY ("UserId") REFERENCES "Users"("Id") ON DELETE CASCADE
+    );
+
+    CREATE INDEX IF NOT EXISTS "Index_PasswordResetTokens_UserId" ON "PasswordResetTokens"("UserId");
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (5, 'create_password_reset_tokens');
+END $$;
+COMMIT;
@@ -0,0 +1,31 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 6) THEN
+        RAISE NOTICE 'Migration create_two_factor already applied, skipping';
+        RETURN;
+    END IF;
+
+    CREATE TABLE IF NOT EXISTS "TwoFactor"
+    (
+        "UserId" INTEGER NOT NULL PRIMARY KEY,
+        "Secret" BYTEA NOT NULL,
+        "Enabled" BOOLEAN NOT NULL DEFAULT false,
+        "LastCounter" BIGINT NOT NULL DEFAULT 0,
+        CONSTRAINT "UserId" FOREIGN KEY ("UserId") REFERENCES "Users"("Id") ON DELETE CASCADE
+    );
+
+    CREATE TABLE IF NOT EXISTS "RecoveryCodes"
+    (
+        "Id" INTEGER NOT NULL PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+        "UserId" INTEGER NOT NULL,
+        "Hash" BYTEA NOT NULL,
+        "Used" BOOLEAN NOT NULL DEFAULT false,
+        CONSTRAINT "UserId" FOREIGN KEY ("UserId") REFERENCES "Users"("Id") ON DELETE CASCADE
+    );
+
+    CREATE INDEX IF NOT EXISTS "Index_RecoveryCodes_UserId" ON "RecoveryCodes"("UserId");
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (6, 'create_two_factor');
+END $$;
+COMMIT;
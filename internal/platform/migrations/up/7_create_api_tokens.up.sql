@@ -0,0 +1,26 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 7) THEN
+        RAISE NOTICE 'Migration create_api_tokens already applied, skipping';
+        RETURN;
+    END IF;
+
+    CREATE TABLE IF NOT EXISTS "ApiTokens"
+    (
+        "Id" INTEGER NOT NULL PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+        "UserId" INTEGER NOT NULL,
+        "Name" TEXT NOT NULL,
+        "Hash" BYTEA NOT NULL UNIQUE,
+        "Scopes" TEXT NOT NULL,
+        "Expires" TIMESTAMPTZ NULL,
+        "LastUsed" TIMESTAMPTZ NULL,
+        "Created" TIMESTAMPTZ NOT NULL DEFAULT now(),
+        CONSTRAINT "UserId" FOREIGN KEY ("UserId") REFERENCES "Users"("Id") ON DELETE CASCADE
+    );
+
+    CREATE INDEX IF NOT EXISTS "Index_ApiTokens_UserId" ON "ApiTokens"("UserId");
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (7, 'create_api_tokens');
+END $$;
+COMMIT;
@@ -0,0 +1,24 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 8) THEN
+        RAISE NOTICE 'Migration create_external_identities already applied, skipping';
+        RETURN;
+    END IF;
+
+    CREATE TABLE IF NOT EXISTS "ExternalIdentities"
+    (
+        "Id" INTEGER NOT NULL PRIMARY KEY GENERATED ALWAYS AS IDENTITY,
+        "UserId" INTEGER NOT NULL,
+        "Provider" TEXT NOT NULL,
+        "Subject" TEXT NOT NULL,
+        "Email" TEXT NOT NULL DEFAULT '',
+        "Created" TIMESTAMPTZ NOT NULL DEFAULT now(),
+        CONSTRAINT "UserId" FOREIGN KEY ("UserId") REFERENCES "Users"("Id") ON DELETE CASCADE,
+        CONSTRAINT "Unique_ExternalIdentities_Provider_Subject" UNIQUE ("Provider", "Subject"),
+        CONSTRAINT "Unique_ExternalIdentities_UserId_Provider" UNIQUE ("UserId", "Provider")
+    );
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (8, 'create_external_identities');
+END $$;
+COMMIT;
@@ -0,0 +1,14 @@
+BEGIN;
+DO $$ 
+BEGIN 
+    IF EXISTS(SELECT 1 FROM "Migrations" WHERE "Version" = 9) THEN
+        RAISE NOTICE 'Migration add_user_roles already applied, skipping';
+        RETURN;
+    END IF;
+
+    ALTER TABLE IF EXISTS "Users" ADD COLUMN "Role" TEXT NOT NULL DEFAULT 'user';
+    ALTER TABLE IF EXISTS "Users" ADD CONSTRAINT "Role" CHECK ("Role" IN ('user', 'admin'));
+
+    INSERT INTO "Migrations" ("Version", "Name") VALUES (9, 'add_user_roles');
+END $$;
+COMMIT;
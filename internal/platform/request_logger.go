@@ -0,0 +1,54 @@
+package platform
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (recorder *responseRecorder) WriteHeader(code int) {
+	recorder.statusCode = code
+	recorder.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the flushing and deadlines of the wrapped writer.
+func (recorder *responseRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
+// NewRequestLogger logs the method, path, status and duration of every request. Paths under one
+// of the secret prefixes carry a secret, such as the calendar feed link, so the rest of the path is
+// left out of the log.
+func NewRequestLogger(secretPrefixes ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(response http.ResponseWriter, request *http.Request) {
+			start := time.Now()
+			recorder := &responseRecorder{ResponseWriter: response, statusCode: http.StatusOK}
+			next(recorder, request)
+			duration := time.Since(start).Milliseconds()
+			log.Printf(
+				"%s %s | status %d | duration %d ms",
+				request.Method,
+				redactPath(request.URL.Path, secretPrefixes),
+				recorder.statusCode,
+				duration,
+			)
+		}
+	}
+}
+
+func redactPath(path string, secretPrefixes []string) string {
+	for _, prefix := range secretPrefixes {
+		if strings.HasPrefix(path, prefix) && len(path) > len(prefix) {
+			return prefix + "[redacted]"
+		}
+	}
+
+	return path
+}
@@ -0,0 +1,45 @@
+package platform
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestLoggerRedactsSecrets(t *testing.T) {
+	var output bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&output)
+
+	logger := NewRequestLogger("/htmx/calendar/")
+	handler := logger(func(response http.ResponseWriter, request *http.Request) {
+		if strings.HasSuffix(request.URL.Path, "missing") {
+			response.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	tests := []struct {
+		path string
+		want string
+		not  string
+	}{
+		{"/htmx/calendar/tghcal_secret.ics", "GET /htmx/calendar/[redacted] | status 200", "tghcal_secret"},
+		{"/htmx/calendar/missing", "GET /htmx/calendar/[redacted] | status 404", "missing"},
+		{"/htmx/calendar/", "GET /htmx/calendar/ | status 200", "[redacted]"},
+		{"/htmx/todos", "GET /htmx/todos | status 200", "[redacted]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			output.Reset()
+			handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, test.path, nil))
+			line := output.String()
+			if !strings.Contains(line, test.want) || strings.Contains(line, test.not) {
+				t.Errorf("logged %q, want %q without %q", line, test.want, test.not)
+			}
+		})
+	}
+}
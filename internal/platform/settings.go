@@ -8,11 +8,17 @@ import (
 )
 
 type Settings struct {
-	Mode     string           `json:"mode"`
-	Address  string           `json:"address"`
-	Database DatabaseSettings `json:"database"`
-	Password PasswordSettings `json:"password"`
-	Session  SessionSettings  `json:"session"`
+	Mode      string            `json:"mode"`
+	Address   string            `json:"address"`
+	Database  DatabaseSettings  `json:"database"`
+	Password  PasswordSettings  `json:"password"`
+	Session   SessionSettings   `json:"session"`
+	Mail      MailSettings      `json:"mail"`
+	Reset     ResetSettings     `json:"passwordReset"`
+	TwoFactor TwoFactorSettings `json:"twoFactor"`
+	Oidc      OidcSettings      `json:"oidc"`
+	Admin     AdminSettings     `json:"admin"`
+	Todo      TodoSettings      `json:"todo"`
 }
 
 type DatabaseSettings struct {
@@ -38,6 +44,56 @@ type SessionSettings struct {
 	SessionDurationMin float64 `json:"sessionDurationMin"`
 }
 
+type MailSettings struct {
+	Mode     string `json:"mode"`
+	From     string `json:"from"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	File     string `json:"file"`
+}
+
+type ResetSettings struct {
+	LinkUrl          string  `json:"linkUrl"`
+	TokenDurationMin float64 `json:"tokenDurationMin"`
+}
+
+type TwoFactorSettings struct {
+	Issuer             string  `json:"issuer"`
+	EncryptionKey      string  `json:"-"`
+	PendingDurationMin float64 `json:"pendingDurationMin"`
+}
+
+type OidcSettings struct {
+	Providers []OidcProviderSettings `json:"providers"`
+}
+
+type OidcProviderSettings struct {
+	Name         string   `json:"name"`
+	DisplayName  string   `json:"displayName"`
+	Issuer       string   `json:"issuer"`
+	ClientId     string   `json:"clientId"`
+	ClientSecret string   `json:"clientSecret"`
+	RedirectUrl  string   `json:"redirectUrl"`
+	Scopes       []string `json:"scopes"`
+}
+
+type AdminSettings struct {
+	BootstrapUsername string `json:"bootstrapUsername"`
+}
+
+type TodoSettings struct {
+	MaxSubtaskDepth    int  `json:"maxSubtaskDepth"`
+	CompleteParents    bool `json:"completeParents"`
+	TrashRetentionDays int  `json:"trashRetentionDays"`
+}
+
+// EncryptionKeyVariable names the environment variable holding the base64 encoded key that
+// encrypts two-factor secrets. The key is kept out of the settings file so it isn't committed.
+// Without it two-factor authentication can't be enrolled or used, everything else works.
+const EncryptionKeyVariable = "TWO_FACTOR_ENCRYPTION_KEY"
+
 func ReadSettings(fileName string) Settings {
 	bytes, err := os.ReadFile(fileName)
 	if err != nil {
@@ -49,6 +105,11 @@ func ReadSettings(fileName string) Settings {
 		log.Panic(err.Error())
 	}
 
+	settings.TwoFactor.EncryptionKey = os.Getenv(EncryptionKeyVariable)
+	if settings.TwoFactor.EncryptionKey == "" {
+		log.Printf("Environment variable %s is not set, two-factor authentication is unavailable.", EncryptionKeyVariable)
+	}
+
 	return settings
 }
 
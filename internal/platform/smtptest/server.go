@@ -0,0 +1,156 @@
+// Package smtptest provides an in-process SMTP server for tests of code that sends mail.
+package smtptest
+
+import (
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Message is a message accepted by the server.
+type Message struct {
+	From string
+	To   []string
+	Auth string
+	Data string
+}
+
+// Server accepts every message on a local port and keeps it in memory. It speaks just enough of
+// SMTP for net/smtp: no TLS, PLAIN authentication accepting any credentials.
+type Server struct {
+	Host     string
+	Port     int
+	listener net.Listener
+	messages []Message
+	received chan Message
+	locker   sync.Mutex
+	group    sync.WaitGroup
+}
+
+// NewServer starts a server on a free port of the loopback interface. Close stops it.
+func NewServer() *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("smtptest: failed to listen on a port: " + err.Error())
+	}
+
+	address := listener.Addr().(*net.TCPAddr)
+	server := &Server{
+		Host:     address.IP.String(),
+		Port:     address.Port,
+		listener: listener,
+		received: make(chan Message, 100),
+	}
+
+	server.group.Add(1)
+	go server.serve()
+	return server
+}
+
+// Close stops accepting connections and waits for open ones to finish.
+func (this *Server) Close() {
+	this.listener.Close()
+	this.group.Wait()
+}
+
+// Messages returns the messages accepted so far.
+func (this *Server) Messages() []Message {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	return append([]Message(nil), this.messages...)
+}
+
+// Received delivers every accepted message once, for waiting on mail sent in the background.
+func (this *Server) Received() <-chan Message {
+	return this.received
+}
+
+func (this *Server) serve() {
+	defer this.group.Done()
+	for {
+		connection, err := this.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		this.group.Add(1)
+		go func() {
+			defer this.group.Done()
+			defer connection.Close()
+			this.converse(textproto.NewConn(connection))
+		}()
+	}
+}
+
+func (this *Server) converse(connection *textproto.Conn) {
+	var message Message
+	connection.PrintfLine("220 %s smtptest", this.Host)
+	for {
+		line, err := connection.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, argument, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			connection.PrintfLine("250-%s", this.Host)
+			connection.PrintfLine("250 AUTH PLAIN")
+		case "HELO", "NOOP":
+			connection.PrintfLine("250 OK")
+		case "AUTH":
+			message.Auth = argument
+			connection.PrintfLine("235 Authenticated")
+		case "MAIL":
+			message.From = trimAddress(argument)
+			connection.PrintfLine("250 OK")
+		case "RCPT":
+			message.To = append(message.To, trimAddress(argument))
+			connection.PrintfLine("250 OK")
+		case "DATA":
+			connection.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(connection.DotReader())
+			if err != nil {
+				return
+			}
+
+			message.Data = string(data)
+			this.accept(message)
+			message = Message{Auth: message.Auth}
+			connection.PrintfLine("250 OK")
+		case "RSET":
+			message = Message{Auth: message.Auth}
+			connection.PrintfLine("250 OK")
+		case "QUIT":
+			connection.PrintfLine("221 Bye")
+			return
+		default:
+			connection.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+func (this *Server) accept(message Message) {
+	this.locker.Lock()
+	this.messages = append(this.messages, message)
+	this.locker.Unlock()
+	select {
+	case this.received <- message:
+	default:
+	}
+}
+
+// trimAddress reads the address out of "FROM:<address>" and "TO:<address>".
+func trimAddress(argument string) string {
+	_, address, _ := strings.Cut(argument, ":")
+	address, _, _ = strings.Cut(strings.TrimSpace(address), " ")
+	return strings.Trim(address, "<>")
+}
+
+// Address returns the host and port of the server joined for dialing.
+func (this *Server) Address() string {
+	return net.JoinHostPort(this.Host, strconv.Itoa(this.Port))
+}
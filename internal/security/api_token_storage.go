@@ -0,0 +1,103 @@
+package security
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+)
+
+type ApiTokenStorage struct {
+	database *sql.DB
+}
+
+func NewApiTokenStorage(database *sql.DB) *ApiTokenStorage {
+	return &ApiTokenStorage{database}
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanApiToken(row rowScanner) (entity.ApiToken, error) {
+	var token entity.ApiToken
+	var scopes string
+	var expires, lastUsed sql.NullTime
+	err := row.Scan(&token.Id, &token.UserId, &token.Name, &token.Hash, &scopes, &expires, &lastUsed, &token.Created)
+	if err != nil {
+		return token, err
+	}
+
+	token.Scopes = strings.Fields(scopes)
+	token.Expires = expires.Time
+	token.LastUsed = lastUsed.Time
+	return token, nil
+}
+
+func (this *ApiTokenStorage) InsertToken(token entity.ApiToken) (int, error) {
+	var expires sql.NullTime
+	if !token.Expires.IsZero() {
+		expires = sql.NullTime{Time: token.Expires, Valid: true}
+	}
+
+	id := 0
+	query := `INSERT INTO "ApiTokens" ("UserId", "Name", "Hash", "Scopes", "Expires", "Created") VALUES ($1, $2, $3, $4, $5, $6) RETURNING "Id"`
+	row := this.database.QueryRow(query, token.UserId, token.Name, token.Hash, strings.Join(token.Scopes, " "), expires, token.Created)
+	if err := row.Scan(&id); err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (this *ApiTokenStorage) FindTokensByUserId(userId int) []entity.ApiToken {
+	var tokens []entity.ApiToken
+	query := `
+		SELECT "Id", "UserId", "Name", "Hash", "Scopes", "Expires", "LastUsed", "Created" FROM "ApiTokens" 
+		WHERE "UserId" = $1 ORDER BY "Created" DESC`
+	rows, err := this.database.Query(query, userId)
+	if err != nil {
+		log.Println(err.Error())
+		return tokens
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		token, err := scanApiToken(rows)
+		if err != nil {
+			log.Println(err.Error())
+			return tokens
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	return tokens
+}
+
+// UseToken finds an unexpired token by its hash and records the time it was used in the same
+// statement.
+func (this *ApiTokenStorage) UseToken(hash []byte) (entity.ApiToken, error) {
+	query := `
+		UPDATE "ApiTokens" SET "LastUsed" = now() 
+		WHERE "Hash" = $1 AND ("Expires" IS NULL OR "Expires" > now())
+		RETURNING "Id", "UserId", "Name", "Hash", "Scopes", "Expires", "LastUsed", "Created"`
+	token, err := scanApiToken(this.database.QueryRow(query, hash))
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err.Error())
+	}
+
+	return token, err
+}
+
+func (this *ApiTokenStorage) DeleteToken(userId int, tokenId int) error {
+	query := `DELETE FROM "ApiTokens" WHERE "Id" = $1 AND "UserId" = $2`
+	if _, err := this.database.Exec(query, tokenId, userId); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	return nil
+}
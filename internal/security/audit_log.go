@@ -0,0 +1,127 @@
+package security
+
+import (
+	"database/sql"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+)
+
+const maxAuditEvents = 1000
+
+// AuditLog writes security events to an append-only table. Failing to write an event is logged
+// but doesn't fail the operation being audited.
+type AuditLog struct {
+	database *sql.DB
+}
+
+func NewAuditLog(database *sql.DB) *AuditLog {
+	return &AuditLog{database}
+}
+
+// withRequest adds the client address and user agent of the request to the event.
+func withRequest(event entity.AuditEvent, request *http.Request) entity.AuditEvent {
+	if request == nil {
+		return event
+	}
+
+	ip, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		ip = request.RemoteAddr
+	}
+
+	event.Ip = ip
+	event.UserAgent = request.UserAgent()
+	return event
+}
+
+func (this *AuditLog) Record(event entity.AuditEvent) {
+	var userId sql.NullInt32
+	if event.UserId != 0 {
+		userId = sql.NullInt32{Int32: int32(event.UserId), Valid: true}
+	}
+
+	query := `
+		INSERT INTO "AuditEvents" ("UserId", "UserName", "Kind", "Ip", "UserAgent", "Detail", "Created") 
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := this.database.Exec(query, userId, event.UserName, event.Kind, event.Ip, event.UserAgent, event.Detail, event.Created)
+	if err != nil {
+		log.Printf("User: %s | Audit event %s could not be written: %s", event.UserName, event.Kind, err.Error())
+	}
+}
+
+func (this *AuditLog) scanEvents(rows *sql.Rows) []entity.AuditEvent {
+	var events []entity.AuditEvent
+	defer rows.Close()
+	for rows.Next() {
+		var event entity.AuditEvent
+		var userId sql.NullInt32
+		err := rows.Scan(&event.Id, &userId, &event.UserName, &event.Kind, &event.Ip, &event.UserAgent, &event.Detail, &event.Created)
+		if err != nil {
+			log.Println(err.Error())
+			return events
+		}
+
+		event.UserId = int(userId.Int32)
+		events = append(events, event)
+	}
+
+	return events
+}
+
+func (this *AuditLog) FindEventsByUserId(userId int, limit int) []entity.AuditEvent {
+	query := `
+		SELECT "Id", "UserId", "UserName", "Kind", "Ip", "UserAgent", "Detail", "Created" FROM "AuditEvents" 
+		WHERE "UserId" = $1 ORDER BY "Created" DESC LIMIT $2`
+	rows, err := this.database.Query(query, userId, limit)
+	if err != nil {
+		log.Println(err.Error())
+		return nil
+	}
+
+	return this.scanEvents(rows)
+}
+
+// FindEvents returns events matching every non-empty field of the filter, newest first.
+func (this *AuditLog) FindEvents(filter entity.AuditFilter) []entity.AuditEvent {
+	query := `SELECT "Id", "UserId", "UserName", "Kind", "Ip", "UserAgent", "Detail", "Created" FROM "AuditEvents" WHERE true`
+	var args []any
+	addCondition := func(condition string, value any) {
+		args = append(args, value)
+		query += " AND " + condition + " $" + strconv.Itoa(len(args))
+	}
+
+	if filter.UserName != "" {
+		addCondition(`"UserName" =`, filter.UserName)
+	}
+
+	if filter.Kind != "" {
+		addCondition(`"Kind" =`, filter.Kind)
+	}
+
+	if !filter.From.IsZero() {
+		addCondition(`"Created" >=`, filter.From)
+	}
+
+	if !filter.To.IsZero() {
+		addCondition(`"Created" <`, filter.To)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > maxAuditEvents {
+		limit = maxAuditEvents
+	}
+
+	args = append(args, limit)
+	query += ` ORDER BY "Created" DESC LIMIT $` + strconv.Itoa(len(args))
+	rows, err := this.database.Query(query, args...)
+	if err != nil {
+		log.Println(err.Error())
+		return nil
+	}
+
+	return this.scanEvents(rows)
+}
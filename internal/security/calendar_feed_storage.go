@@ -0,0 +1,71 @@
+package security
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+)
+
+type CalendarFeedStorage struct {
+	database *sql.DB
+}
+
+func NewCalendarFeedStorage(database *sql.DB) *CalendarFeedStorage {
+	return &CalendarFeedStorage{database}
+}
+
+func scanCalendarFeed(row rowScanner) (entity.CalendarFeed, error) {
+	var feed entity.CalendarFeed
+	var lastUsed sql.NullTime
+	err := row.Scan(&feed.UserId, &feed.Hash, &lastUsed, &feed.Created)
+	feed.LastUsed = lastUsed.Time
+	return feed, err
+}
+
+// SaveFeed stores the feed of the user, replacing the one they had so the old link stops working.
+func (this *CalendarFeedStorage) SaveFeed(feed entity.CalendarFeed) error {
+	query := `
+		INSERT INTO "CalendarFeeds" ("UserId", "Hash", "Created") VALUES ($1, $2, $3) 
+		ON CONFLICT ("UserId") DO UPDATE SET "Hash" = EXCLUDED."Hash", "LastUsed" = NULL, "Created" = EXCLUDED."Created"`
+	if _, err := this.database.Exec(query, feed.UserId, feed.Hash, feed.Created); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (this *CalendarFeedStorage) FindFeedByUserId(userId int) (entity.CalendarFeed, error) {
+	query := `SELECT "UserId", "Hash", "LastUsed", "Created" FROM "CalendarFeeds" WHERE "UserId" = $1`
+	feed, err := scanCalendarFeed(this.database.QueryRow(query, userId))
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err.Error())
+	}
+
+	return feed, err
+}
+
+// UseFeed finds a feed by the hash of its secret and records the time it was used in the same
+// statement.
+func (this *CalendarFeedStorage) UseFeed(hash []byte) (entity.CalendarFeed, error) {
+	query := `
+		UPDATE "CalendarFeeds" SET "LastUsed" = now() WHERE "Hash" = $1 
+		RETURNING "UserId", "Hash", "LastUsed", "Created"`
+	feed, err := scanCalendarFeed(this.database.QueryRow(query, hash))
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err.Error())
+	}
+
+	return feed, err
+}
+
+func (this *CalendarFeedStorage) DeleteFeed(userId int) error {
+	query := `DELETE FROM "CalendarFeeds" WHERE "UserId" = $1`
+	if _, err := this.database.Exec(query, userId); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	return nil
+}
@@ -33,3 +33,31 @@ func (this *CookieFactory) ClearSessionCookie() *http.Cookie {
 		Secure:   this.options.Secure,
 	}
 }
+
+const oidcStateCookieName = "oidc_state"
+
+// NewOidcStateCookie binds a sign in flow to the browser that started it. It has to be sent on the
+// cross-site redirect back from the provider, so it's lax instead of strict.
+func (this *CookieFactory) NewOidcStateCookie(state string) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookieName,
+		Path:     "/",
+		Value:    state,
+		MaxAge:   int(oidcFlowDuration.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   this.options.Secure,
+	}
+}
+
+func (this *CookieFactory) ClearOidcStateCookie() *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookieName,
+		Path:     "/",
+		Value:    "",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Secure:   this.options.Secure,
+	}
+}
@@ -0,0 +1,81 @@
+package security
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+)
+
+type ExternalIdentityStorage struct {
+	database *sql.DB
+}
+
+func NewExternalIdentityStorage(database *sql.DB) *ExternalIdentityStorage {
+	return &ExternalIdentityStorage{database}
+}
+
+func (this *ExternalIdentityStorage) FindIdentity(provider string, subject string) (entity.ExternalIdentity, error) {
+	var identity entity.ExternalIdentity
+	query := `
+		SELECT "Id", "UserId", "Provider", "Subject", "Email", "Created" FROM "ExternalIdentities" 
+		WHERE "Provider" = $1 AND "Subject" = $2`
+	row := this.database.QueryRow(query, provider, subject)
+	err := row.Scan(&identity.Id, &identity.UserId, &identity.Provider, &identity.Subject, &identity.Email, &identity.Created)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Println(err.Error())
+		}
+
+		return identity, err
+	}
+
+	return identity, nil
+}
+
+func (this *ExternalIdentityStorage) FindIdentitiesByUserId(userId int) []entity.ExternalIdentity {
+	var identities []entity.ExternalIdentity
+	query := `
+		SELECT "Id", "UserId", "Provider", "Subject", "Email", "Created" FROM "ExternalIdentities" 
+		WHERE "UserId" = $1 ORDER BY "Provider" ASC`
+	rows, err := this.database.Query(query, userId)
+	if err != nil {
+		log.Println(err.Error())
+		return identities
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var identity entity.ExternalIdentity
+		err := rows.Scan(&identity.Id, &identity.UserId, &identity.Provider, &identity.Subject, &identity.Email, &identity.Created)
+		if err != nil {
+			log.Println(err.Error())
+			return identities
+		}
+
+		identities = append(identities, identity)
+	}
+
+	return identities
+}
+
+func (this *ExternalIdentityStorage) InsertIdentity(identity entity.ExternalIdentity) error {
+	query := `INSERT INTO "ExternalIdentities" ("UserId", "Provider", "Subject", "Email", "Created") VALUES ($1, $2, $3, $4, $5)`
+	_, err := this.database.Exec(query, identity.UserId, identity.Provider, identity.Subject, identity.Email, identity.Created)
+	if err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (this *ExternalIdentityStorage) DeleteIdentity(userId int, identityId int) error {
+	query := `DELETE FROM "ExternalIdentities" WHERE "Id" = $1 AND "UserId" = $2`
+	if _, err := this.database.Exec(query, identityId, userId); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package security
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrInvalidOidcState = errors.New("Sign in request is invalid or has expired.")
+
+const oidcFlowDuration = 10 * time.Minute
+
+// OidcFlow holds what is needed to finish an authorization code flow. LinkUserId is set when a
+// logged in user is linking a provider to their account instead of logging in.
+type OidcFlow struct {
+	Provider   string
+	Nonce      string
+	Verifier   string
+	LinkUserId int
+	Expires    time.Time
+}
+
+type OidcFlowStorage struct {
+	flows  map[string]OidcFlow
+	locker sync.Mutex
+}
+
+func NewOidcFlowStorage() *OidcFlowStorage {
+	return &OidcFlowStorage{flows: make(map[string]OidcFlow)}
+}
+
+func (this *OidcFlowStorage) InsertFlow(state string, flow OidcFlow) {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	now := time.Now()
+	for key, existing := range this.flows {
+		if existing.Expires.Before(now) {
+			delete(this.flows, key)
+		}
+	}
+
+	flow.Expires = now.Add(oidcFlowDuration)
+	this.flows[state] = flow
+}
+
+// TakeFlow removes and returns the flow so each state value can only be used once.
+func (this *OidcFlowStorage) TakeFlow(state string) (OidcFlow, error) {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	flow, ok := this.flows[state]
+	if !ok {
+		return flow, ErrInvalidOidcState
+	}
+
+	delete(this.flows, state)
+	if flow.Expires.Before(time.Now()) {
+		return flow, ErrInvalidOidcState
+	}
+
+	return flow, nil
+}
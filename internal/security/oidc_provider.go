@@ -0,0 +1,334 @@
+package security
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrOidcDiscovery   = errors.New("OpenID provider configuration could not be loaded.")
+	ErrOidcExchange    = errors.New("Authorization code could not be exchanged.")
+	ErrInvalidIdToken  = errors.New("Invalid ID token.")
+	ErrUnknownProvider = errors.New("Unknown sign in provider.")
+)
+
+const (
+	oidcClockSkew       = time.Minute
+	oidcKeyRefreshDelay = 5 * time.Minute
+)
+
+type OidcProviderOptions struct {
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectUrl  string
+	Scopes       []string
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+type oidcJwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+type oidcTokenResponse struct {
+	IdToken string `json:"id_token"`
+	Error   string `json:"error"`
+}
+
+type oidcAudience []string
+
+func (this *oidcAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*this = oidcAudience{single}
+		return nil
+	}
+
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+
+	*this = many
+	return nil
+}
+
+type OidcClaims struct {
+	Issuer            string       `json:"iss"`
+	Subject           string       `json:"sub"`
+	Audience          oidcAudience `json:"aud"`
+	AuthorizedParty   string       `json:"azp"`
+	Expires           int64        `json:"exp"`
+	IssuedAt          int64        `json:"iat"`
+	Nonce             string       `json:"nonce"`
+	Email             string       `json:"email"`
+	EmailVerified     bool         `json:"email_verified"`
+	PreferredUsername string       `json:"preferred_username"`
+	Name              string       `json:"name"`
+}
+
+// OidcProvider is an OpenID Connect relying party for a single provider. The discovery document
+// and signing keys are fetched on first use and cached, keys are refetched when a token is signed
+// with an unknown key id.
+type OidcProvider struct {
+	options       OidcProviderOptions
+	client        *http.Client
+	locker        sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]*rsa.PublicKey
+	keysRefreshed time.Time
+}
+
+func NewOidcProvider(options OidcProviderOptions) *OidcProvider {
+	if len(options.Scopes) == 0 {
+		options.Scopes = []string{"openid", "profile", "email"}
+	}
+
+	return &OidcProvider{
+		options: options,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		keys:    make(map[string]*rsa.PublicKey),
+	}
+}
+
+func (this *OidcProvider) getJson(endpoint string, target any) error {
+	response, err := this.client.Get(endpoint)
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", endpoint, response.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(target)
+}
+
+func (this *OidcProvider) discover() (oidcDiscovery, error) {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	if this.discovery != nil {
+		return *this.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	endpoint := strings.TrimSuffix(this.options.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := this.getJson(endpoint, &discovery); err != nil {
+		return discovery, errors.Join(ErrOidcDiscovery, err)
+	}
+
+	if discovery.Issuer != this.options.Issuer {
+		return discovery, errors.Join(ErrOidcDiscovery, errors.New("Issuer doesn't match the configured issuer."))
+	}
+
+	this.discovery = &discovery
+	return discovery, nil
+}
+
+// AuthCodeUrl builds the authorization request for the code flow with a S256 PKCE challenge.
+func (this *OidcProvider) AuthCodeUrl(state string, nonce string, verifier string) (string, error) {
+	discovery, err := this.discover()
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", this.options.ClientId)
+	query.Set("redirect_uri", this.options.RedirectUrl)
+	query.Set("scope", strings.Join(this.options.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange trades the authorization code for tokens and returns the verified ID token claims.
+func (this *OidcProvider) Exchange(code string, verifier string, nonce string) (OidcClaims, error) {
+	var claims OidcClaims
+	discovery, err := this.discover()
+	if err != nil {
+		return claims, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", this.options.RedirectUrl)
+	form.Set("code_verifier", verifier)
+	request, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return claims, err
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(url.QueryEscape(this.options.ClientId), url.QueryEscape(this.options.ClientSecret))
+	response, err := this.client.Do(request)
+	if err != nil {
+		return claims, errors.Join(ErrOidcExchange, err)
+	}
+
+	defer response.Body.Close()
+	var tokens oidcTokenResponse
+	if err := json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&tokens); err != nil {
+		return claims, errors.Join(ErrOidcExchange, err)
+	}
+
+	if response.StatusCode != http.StatusOK || tokens.IdToken == "" {
+		return claims, errors.Join(ErrOidcExchange, fmt.Errorf("status %d: %s", response.StatusCode, tokens.Error))
+	}
+
+	return this.verifyIdToken(tokens.IdToken, nonce, discovery)
+}
+
+func (this *OidcProvider) findKey(keyId string, discovery oidcDiscovery) (*rsa.PublicKey, error) {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	if key, ok := this.keys[keyId]; ok {
+		return key, nil
+	}
+
+	// the provider may have rotated its keys, but don't let unknown key ids trigger a fetch on
+	// every request
+	if time.Since(this.keysRefreshed) < oidcKeyRefreshDelay && len(this.keys) > 0 {
+		return nil, ErrInvalidIdToken
+	}
+
+	var jwks oidcJwks
+	if err := this.getJson(discovery.JwksUri, &jwks); err != nil {
+		return nil, errors.Join(ErrInvalidIdToken, err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+
+		modulus, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			continue
+		}
+
+		exponent, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			continue
+		}
+
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(modulus),
+			E: int(new(big.Int).SetBytes(exponent).Int64()),
+		}
+	}
+
+	this.keys = keys
+	this.keysRefreshed = time.Now()
+	if key, ok := this.keys[keyId]; ok {
+		return key, nil
+	}
+
+	return nil, ErrInvalidIdToken
+}
+
+func (this *OidcProvider) verifyIdToken(rawToken string, nonce string, discovery oidcDiscovery) (OidcClaims, error) {
+	var claims OidcClaims
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return claims, ErrInvalidIdToken
+	}
+
+	headerJson, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return claims, ErrInvalidIdToken
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyId     string `json:"kid"`
+	}
+
+	if err := json.Unmarshal(headerJson, &header); err != nil || header.Algorithm != "RS256" {
+		return claims, ErrInvalidIdToken
+	}
+
+	key, err := this.findKey(header.KeyId, discovery)
+	if err != nil {
+		return claims, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, ErrInvalidIdToken
+	}
+
+	signed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, signed[:], signature); err != nil {
+		return claims, ErrInvalidIdToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, ErrInvalidIdToken
+	}
+
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, ErrInvalidIdToken
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Issuer != discovery.Issuer:
+		return claims, ErrInvalidIdToken
+	case !slices.Contains(claims.Audience, this.options.ClientId):
+		return claims, ErrInvalidIdToken
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != this.options.ClientId:
+		return claims, ErrInvalidIdToken
+	case time.Unix(claims.Expires, 0).Add(oidcClockSkew).Before(now):
+		return claims, ErrInvalidIdToken
+	case time.Unix(claims.IssuedAt, 0).Add(-oidcClockSkew).After(now):
+		return claims, ErrInvalidIdToken
+	case claims.Nonce == "" || claims.Nonce != nonce:
+		return claims, ErrInvalidIdToken
+	case claims.Subject == "":
+		return claims, ErrInvalidIdToken
+	}
+
+	return claims, nil
+}
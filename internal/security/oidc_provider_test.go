@@ -0,0 +1,424 @@
+package security
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/platform"
+)
+
+const (
+	mockClientId     = "client"
+	mockClientSecret = "client secret"
+	mockRedirectUrl  = "http://localhost/htmx/oidc/callback"
+	mockKeyId        = "mock-key"
+	mockSubject      = "subject-1"
+)
+
+type mockGrant struct {
+	challenge string
+	nonce     string
+}
+
+// mockIdp is an OpenID provider serving discovery, signing keys and a token endpoint. Codes are
+// handed out by authorize instead of a login page, claims and signer can be changed per test.
+type mockIdp struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	signer   *rsa.PrivateKey
+	claims   func(claims map[string]any)
+	grants   map[string]mockGrant
+	verified []string
+	locker   sync.Mutex
+}
+
+func newMockIdp(t *testing.T) *mockIdp {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &mockIdp{key: key, signer: key, grants: make(map[string]mockGrant)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("GET /jwks", idp.jwks)
+	mux.HandleFunc("POST /token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (this *mockIdp) options() OidcProviderOptions {
+	return OidcProviderOptions{
+		Name:         "mock",
+		DisplayName:  "Mock",
+		Issuer:       this.server.URL,
+		ClientId:     mockClientId,
+		ClientSecret: mockClientSecret,
+		RedirectUrl:  mockRedirectUrl,
+	}
+}
+
+func (this *mockIdp) discovery(response http.ResponseWriter, request *http.Request) {
+	json.NewEncoder(response).Encode(oidcDiscovery{
+		Issuer:                this.server.URL,
+		AuthorizationEndpoint: this.server.URL + "/authorize",
+		TokenEndpoint:         this.server.URL + "/token",
+		JwksUri:               this.server.URL + "/jwks",
+	})
+}
+
+func (this *mockIdp) jwks(response http.ResponseWriter, request *http.Request) {
+	json.NewEncoder(response).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": mockKeyId,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(this.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(this.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize plays the user approving the authorization request and returns the code the
+// provider would redirect back with.
+func (this *mockIdp) authorize(t *testing.T, authCodeUrl string) string {
+	t.Helper()
+	parsed, err := url.Parse(authCodeUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := parsed.Query()
+	if parsed.Path != "/authorize" || query.Get("client_id") != mockClientId || query.Get("redirect_uri") != mockRedirectUrl {
+		t.Fatalf("unexpected authorization request %s", authCodeUrl)
+	}
+
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization request isn't using a S256 PKCE challenge: %s", authCodeUrl)
+	}
+
+	if query.Get("state") == "" || query.Get("nonce") == "" {
+		t.Fatalf("authorization request is missing state or nonce: %s", authCodeUrl)
+	}
+
+	return this.grant(query.Get("code_challenge"), query.Get("nonce"))
+}
+
+func (this *mockIdp) grant(challenge string, nonce string) string {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	code, _ := newSecretToken("code_")
+	this.grants[code] = mockGrant{challenge, nonce}
+	return code
+}
+
+func (this *mockIdp) token(response http.ResponseWriter, request *http.Request) {
+	fail := func(code string) {
+		response.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(response).Encode(map[string]string{"error": code})
+	}
+
+	clientId, clientSecret, ok := request.BasicAuth()
+	if !ok || clientId != mockClientId || clientSecret != url.QueryEscape(mockClientSecret) {
+		fail("invalid_client")
+		return
+	}
+
+	if request.FormValue("grant_type") != "authorization_code" || request.FormValue("redirect_uri") != mockRedirectUrl {
+		fail("invalid_request")
+		return
+	}
+
+	this.locker.Lock()
+	grant, ok := this.grants[request.FormValue("code")]
+	delete(this.grants, request.FormValue("code"))
+	this.locker.Unlock()
+	if !ok {
+		fail("invalid_grant")
+		return
+	}
+
+	verifier := request.FormValue("code_verifier")
+	challenge := sha256.Sum256([]byte(verifier))
+	if base64.RawURLEncoding.EncodeToString(challenge[:]) != grant.challenge {
+		fail("invalid_grant")
+		return
+	}
+
+	this.locker.Lock()
+	this.verified = append(this.verified, verifier)
+	this.locker.Unlock()
+
+	now := time.Now()
+	claims := map[string]any{
+		"iss":                this.server.URL,
+		"sub":                mockSubject,
+		"aud":                mockClientId,
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"iat":                now.Unix(),
+		"nonce":              grant.nonce,
+		"email":              "alice@example.com",
+		"email_verified":     true,
+		"preferred_username": "alice",
+	}
+
+	if this.claims != nil {
+		this.claims(claims)
+	}
+
+	json.NewEncoder(response).Encode(map[string]string{"id_token": this.sign(claims)})
+}
+
+func (this *mockIdp) sign(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": mockKeyId, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, this.signer, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func newPkceVerifier() (string, string) {
+	verifier, _ := newSecretToken("")
+	challenge := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(challenge[:])
+}
+
+func TestOidcExchangeVerifiesIdToken(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		nonce  string
+		claims func(idp *mockIdp, claims map[string]any)
+		want   error
+	}{
+		{"valid token", "", nil, nil},
+		{"nonce mismatch", "other nonce", nil, ErrInvalidIdToken},
+		{"missing nonce", "", func(idp *mockIdp, claims map[string]any) { delete(claims, "nonce") }, ErrInvalidIdToken},
+		{"other issuer", "", func(idp *mockIdp, claims map[string]any) { claims["iss"] = "https://attacker.example.com" }, ErrInvalidIdToken},
+		{"other audience", "", func(idp *mockIdp, claims map[string]any) { claims["aud"] = "other client" }, ErrInvalidIdToken},
+		{"audiences without azp", "", func(idp *mockIdp, claims map[string]any) { claims["aud"] = []string{mockClientId, "other client"} }, ErrInvalidIdToken},
+		{"audiences with other azp", "", func(idp *mockIdp, claims map[string]any) {
+			claims["aud"] = []string{mockClientId, "other client"}
+			claims["azp"] = "other client"
+		}, ErrInvalidIdToken},
+		{"audiences with azp", "", func(idp *mockIdp, claims map[string]any) {
+			claims["aud"] = []string{mockClientId, "other client"}
+			claims["azp"] = mockClientId
+		}, nil},
+		{"expired", "", func(idp *mockIdp, claims map[string]any) {
+			claims["exp"] = time.Now().Add(-oidcClockSkew - time.Minute).Unix()
+		}, ErrInvalidIdToken},
+		{"expired within clock skew", "", func(idp *mockIdp, claims map[string]any) { claims["exp"] = time.Now().Add(-oidcClockSkew / 2).Unix() }, nil},
+		{"issued in the future", "", func(idp *mockIdp, claims map[string]any) {
+			claims["iat"] = time.Now().Add(oidcClockSkew + time.Minute).Unix()
+		}, ErrInvalidIdToken},
+		{"missing subject", "", func(idp *mockIdp, claims map[string]any) { delete(claims, "sub") }, ErrInvalidIdToken},
+		{"signed with another key", "", func(idp *mockIdp, claims map[string]any) { idp.signer = otherKey }, ErrInvalidIdToken},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			idp := newMockIdp(t)
+			if test.claims != nil {
+				idp.claims = func(claims map[string]any) { test.claims(idp, claims) }
+			}
+
+			provider := NewOidcProvider(idp.options())
+			verifier, challenge := newPkceVerifier()
+			code := idp.grant(challenge, "nonce")
+			nonce := test.nonce
+			if nonce == "" {
+				nonce = "nonce"
+			}
+
+			claims, err := provider.Exchange(code, verifier, nonce)
+			if !errors.Is(err, test.want) {
+				t.Fatalf("Exchange() error = %v, want %v", err, test.want)
+			}
+
+			if test.want == nil && claims.Subject != mockSubject {
+				t.Errorf("Subject = %q, want %q", claims.Subject, mockSubject)
+			}
+		})
+	}
+}
+
+func TestOidcExchangeRequiresPkceVerifier(t *testing.T) {
+	idp := newMockIdp(t)
+	provider := NewOidcProvider(idp.options())
+	_, challenge := newPkceVerifier()
+	code := idp.grant(challenge, "nonce")
+	if _, err := provider.Exchange(code, "wrong verifier", "nonce"); !errors.Is(err, ErrOidcExchange) {
+		t.Fatalf("Exchange() with a wrong verifier error = %v, want %v", err, ErrOidcExchange)
+	}
+}
+
+func TestOidcDiscoveryRejectsOtherIssuer(t *testing.T) {
+	idp := newMockIdp(t)
+	options := idp.options()
+	options.Issuer = idp.server.URL + "/"
+	provider := NewOidcProvider(options)
+	if _, err := provider.AuthCodeUrl("state", "nonce", "verifier"); !errors.Is(err, ErrOidcDiscovery) {
+		t.Fatalf("AuthCodeUrl() error = %v, want %v", err, ErrOidcDiscovery)
+	}
+}
+
+// newOidcTestService returns a service whose database knows one user with the mock subject
+// linked to it.
+func newOidcTestService(t *testing.T, idp *mockIdp) *SecurityService {
+	key, err := NewPasswordHasher(testPasswordOptions).Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := entity.NewUser("alice", key)
+	alice.Id = 1
+	handler := func(query string, args []driver.Value) (fakeRows, error) {
+		switch {
+		case strings.Contains(query, "FROM \"ExternalIdentities\"") && strings.Contains(query, "\"Subject\" = $2"):
+			rows := fakeRows{columns: []string{"Id", "UserId", "Provider", "Subject", "Email", "Created"}}
+			if args[0] == "mock" && args[1] == mockSubject {
+				rows.values = append(rows.values, []driver.Value{int64(1), int64(alice.Id), "mock", mockSubject, "", time.Now()})
+			}
+
+			return rows, nil
+		case strings.Contains(query, "FROM \"Users\" WHERE \"Id\" = $1"):
+			return fakeRows{userColumns, [][]driver.Value{{int64(alice.Id), alice.Name, alice.Key, alice.Email, alice.Role, alice.TimeZone}}}, nil
+		case strings.Contains(query, "FROM \"TwoFactor\""):
+			return fakeRows{[]string{"exists"}, [][]driver.Value{{false}}}, nil
+		case strings.Contains(query, "INSERT INTO \"AuditEvents\""):
+			return fakeRows{}, nil
+		}
+
+		return fakeRows{}, errors.New("unexpected query: " + query)
+	}
+
+	return NewSecurityService(
+		newFakeDatabase(t, handler),
+		testPasswordOptions,
+		SessionOptions{CookieName: "session", Secret: "secret", Duration: time.Hour},
+		ResetOptions{},
+		TwoFactorOptions{Issuer: "test", EncryptionKey: make([]byte, 32), PendingDuration: time.Minute},
+		[]OidcProviderOptions{idp.options()},
+		"",
+		platform.NewFileMailer("app@example.com", ""),
+	)
+}
+
+func newOidcCallback(state string, code string, stateCookie *http.Cookie) *http.Request {
+	query := url.Values{}
+	query.Set("state", state)
+	query.Set("code", code)
+	request := httptest.NewRequest(http.MethodGet, "/htmx/oidc/callback?"+query.Encode(), nil)
+	if stateCookie != nil {
+		request.AddCookie(stateCookie)
+	}
+
+	return request
+}
+
+func findCookie(response *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range response.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+
+	return nil
+}
+
+func TestOidcLoginUsesStateOnce(t *testing.T) {
+	idp := newMockIdp(t)
+	service := newOidcTestService(t, idp)
+	begin := httptest.NewRecorder()
+	authCodeUrl, err := service.BeginOidcLogin("mock", 0, begin)
+	if err != nil {
+		t.Fatalf("BeginOidcLogin() error = %v", err)
+	}
+
+	stateCookie := findCookie(begin, oidcStateCookieName)
+	if stateCookie == nil {
+		t.Fatal("BeginOidcLogin() didn't set the state cookie")
+	}
+
+	parsed, _ := url.Parse(authCodeUrl)
+	state := parsed.Query().Get("state")
+	if stateCookie.Value != state {
+		t.Fatalf("state cookie = %q, want the state of the request %q", stateCookie.Value, state)
+	}
+
+	code := idp.authorize(t, authCodeUrl)
+	if _, err := service.CompleteOidcLogin(httptest.NewRecorder(), newOidcCallback("other state", code, stateCookie)); err != ErrInvalidOidcState {
+		t.Fatalf("CompleteOidcLogin() with another state error = %v, want %v", err, ErrInvalidOidcState)
+	}
+
+	if _, err := service.CompleteOidcLogin(httptest.NewRecorder(), newOidcCallback(state, code, nil)); err != ErrInvalidOidcState {
+		t.Fatalf("CompleteOidcLogin() without the state cookie error = %v, want %v", err, ErrInvalidOidcState)
+	}
+
+	complete := httptest.NewRecorder()
+	linked, err := service.CompleteOidcLogin(complete, newOidcCallback(state, code, stateCookie))
+	if err != nil || linked {
+		t.Fatalf("CompleteOidcLogin() = %v, %v, want a login", linked, err)
+	}
+
+	if findCookie(complete, "session") == nil {
+		t.Error("CompleteOidcLogin() didn't start a session")
+	}
+
+	if len(idp.verified) != 1 {
+		t.Errorf("token endpoint checked %d PKCE verifiers, want 1", len(idp.verified))
+	}
+
+	replayCode := idp.authorize(t, authCodeUrl)
+	if _, err := service.CompleteOidcLogin(httptest.NewRecorder(), newOidcCallback(state, replayCode, stateCookie)); err != ErrInvalidOidcState {
+		t.Fatalf("CompleteOidcLogin() with a used state error = %v, want %v", err, ErrInvalidOidcState)
+	}
+}
+
+func TestOidcLoginRejectsNonceMismatch(t *testing.T) {
+	idp := newMockIdp(t)
+	idp.claims = func(claims map[string]any) { claims["nonce"] = "replayed nonce" }
+	service := newOidcTestService(t, idp)
+	begin := httptest.NewRecorder()
+	authCodeUrl, err := service.BeginOidcLogin("mock", 0, begin)
+	if err != nil {
+		t.Fatalf("BeginOidcLogin() error = %v", err)
+	}
+
+	parsed, _ := url.Parse(authCodeUrl)
+	code := idp.authorize(t, authCodeUrl)
+	complete := httptest.NewRecorder()
+	if _, err := service.CompleteOidcLogin(complete, newOidcCallback(parsed.Query().Get("state"), code, findCookie(begin, oidcStateCookieName))); !errors.Is(err, ErrInvalidIdToken) {
+		t.Fatalf("CompleteOidcLogin() error = %v, want %v", err, ErrInvalidIdToken)
+	}
+
+	if findCookie(complete, "session") != nil {
+		t.Error("CompleteOidcLogin() started a session for a token with another nonce")
+	}
+}
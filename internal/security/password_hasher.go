@@ -12,6 +12,13 @@ import (
 	"golang.org/x/crypto/argon2"
 )
 
+var (
+	ErrPasswordRequired = errors.New("Password is required.")
+	ErrPasswordTooLong  = errors.New("Password is too long.")
+)
+
+const maxPasswordLength = 128
+
 type PasswordOptions struct {
 	Time                uint32
 	Memory              uint32
@@ -41,6 +48,20 @@ func newSalt(length uint32) []byte {
 	return bytes
 }
 
+// validatePassword checks a password chosen by the user before it is hashed. Registration,
+// password changes and resets all go through it.
+func validatePassword(password string) error {
+	if password == "" {
+		return ErrPasswordRequired
+	}
+
+	if len([]rune(password)) > maxPasswordLength {
+		return ErrPasswordTooLong
+	}
+
+	return nil
+}
+
 func (this *PasswordHasher) Hash(password string) ([]byte, error) {
 	salt := newSalt(this.options.SaltLength)
 	key := argon2.IDKey([]byte(password), salt, this.options.Time, this.options.Memory, this.options.Threads, this.options.KeyLength)
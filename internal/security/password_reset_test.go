@@ -0,0 +1,291 @@
+package security
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/platform"
+	"github.com/skaisanlahti/try-go-htmx/internal/platform/smtptest"
+)
+
+var testPasswordOptions = PasswordOptions{Time: 1, Memory: 64, Threads: 1, SaltLength: 16, KeyLength: 32}
+
+type fakeResetToken struct {
+	userId  int
+	hash    []byte
+	expires time.Time
+	used    bool
+}
+
+// resetDatabase keeps the users, reset tokens and audit events the password reset flow touches.
+type resetDatabase struct {
+	users  []entity.User
+	tokens []fakeResetToken
+	events []string
+	locker sync.Mutex
+}
+
+var userColumns = []string{"Id", "Name", "Password", "Email", "Role", "TimeZone"}
+
+func (this *resetDatabase) userRow(match func(user entity.User) bool) fakeRows {
+	rows := fakeRows{columns: userColumns}
+	for _, user := range this.users {
+		if match(user) {
+			rows.values = append(rows.values, []driver.Value{int64(user.Id), user.Name, user.Key, user.Email, user.Role, user.TimeZone})
+		}
+	}
+
+	return rows
+}
+
+func (this *resetDatabase) handle(query string, args []driver.Value) (fakeRows, error) {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	switch {
+	case strings.Contains(query, "FROM \"Users\" WHERE \"Name\" = $1"):
+		return this.userRow(func(user entity.User) bool { return user.Name == args[0] }), nil
+	case strings.Contains(query, "FROM \"Users\" WHERE \"Id\" = $1"):
+		return this.userRow(func(user entity.User) bool { return int64(user.Id) == args[0] }), nil
+	case strings.Contains(query, "UPDATE \"Users\" SET \"Password\""):
+		for i := range this.users {
+			if int64(this.users[i].Id) == args[0] {
+				this.users[i].Key = args[1].([]byte)
+			}
+		}
+
+		return fakeRows{}, nil
+	case strings.Contains(query, "INSERT INTO \"PasswordResetTokens\""):
+		this.tokens = append(this.tokens, fakeResetToken{userId: int(args[0].(int64)), hash: args[1].([]byte), expires: args[2].(time.Time)})
+		return fakeRows{}, nil
+	case strings.Contains(query, "SELECT EXISTS(SELECT 1 FROM \"PasswordResetTokens\""):
+		_, exists := this.findToken(args[0].([]byte))
+		return fakeRows{[]string{"exists"}, [][]driver.Value{{exists}}}, nil
+	case strings.Contains(query, "UPDATE \"PasswordResetTokens\" SET \"Used\" = true"):
+		rows := fakeRows{columns: []string{"UserId"}}
+		if index, ok := this.findToken(args[0].([]byte)); ok {
+			this.tokens[index].used = true
+			rows.values = append(rows.values, []driver.Value{int64(this.tokens[index].userId)})
+		}
+
+		return rows, nil
+	case strings.Contains(query, "DELETE FROM \"PasswordResetTokens\" WHERE \"UserId\" = $1"):
+		var kept []fakeResetToken
+		for _, token := range this.tokens {
+			if int64(token.userId) != args[0] {
+				kept = append(kept, token)
+			}
+		}
+
+		this.tokens = kept
+		return fakeRows{}, nil
+	case strings.Contains(query, "INSERT INTO \"AuditEvents\""):
+		this.events = append(this.events, args[2].(string))
+		return fakeRows{}, nil
+	}
+
+	return fakeRows{}, errors.New("unexpected query: " + query)
+}
+
+func (this *resetDatabase) findToken(hash []byte) (int, bool) {
+	for i, token := range this.tokens {
+		if bytes.Equal(token.hash, hash) && !token.used && token.expires.After(time.Now()) {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+func (this *resetDatabase) key(userId int) []byte {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	for _, user := range this.users {
+		if user.Id == userId {
+			return user.Key
+		}
+	}
+
+	return nil
+}
+
+func newResetTestService(t *testing.T, mailer platform.Mailer) (*SecurityService, *resetDatabase) {
+	hasher := NewPasswordHasher(testPasswordOptions)
+	key, err := hasher.Hash("old password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := entity.NewUser("alice", key)
+	alice.Id = 1
+	alice.Email = "alice@example.com"
+	bob := entity.NewUser("bob", key)
+	bob.Id = 2
+	data := &resetDatabase{users: []entity.User{alice, bob}}
+	service := NewSecurityService(
+		newFakeDatabase(t, data.handle),
+		testPasswordOptions,
+		SessionOptions{CookieName: "session", Secret: "secret", Duration: time.Hour},
+		ResetOptions{LinkUrl: "http://localhost/htmx/reset-password", Duration: 30 * time.Minute},
+		TwoFactorOptions{Issuer: "test", EncryptionKey: make([]byte, 32), PendingDuration: time.Minute},
+		nil,
+		"",
+		mailer,
+	)
+
+	return service, data
+}
+
+var resetLinkPattern = regexp.MustCompile(`http://localhost/htmx/reset-password\?token=(\S+)`)
+
+func readResetToken(t *testing.T, message smtptest.Message) string {
+	match := resetLinkPattern.FindStringSubmatch(message.Data)
+	if match == nil {
+		t.Fatalf("message has no reset link: %q", message.Data)
+	}
+
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func TestPasswordResetFlow(t *testing.T) {
+	server := smtptest.NewServer()
+	defer server.Close()
+
+	mailer := platform.NewSmtpMailer(platform.MailOptions{From: "app@example.com", Host: server.Host, Port: server.Port})
+	service, data := newResetTestService(t, mailer)
+	session := entity.NewSession(1, time.Hour)
+	service.sessionStorage.InsertSession(session)
+
+	if err := service.RequestPasswordReset("alice"); err != nil {
+		t.Fatalf("RequestPasswordReset() error = %v", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("server got %d messages, want 1", len(messages))
+	}
+
+	if len(messages[0].To) != 1 || messages[0].To[0] != "alice@example.com" {
+		t.Errorf("To = %v, want [alice@example.com]", messages[0].To)
+	}
+
+	if !strings.Contains(messages[0].Data, "Subject: Reset your password\n") {
+		t.Errorf("Data = %q, want the reset subject", messages[0].Data)
+	}
+
+	token := readResetToken(t, messages[0])
+	if !service.IsResetTokenValid(token) {
+		t.Fatal("IsResetTokenValid() = false for a mailed token")
+	}
+
+	if err := service.ResetPassword(token, "", nil); err != ErrPasswordRequired {
+		t.Fatalf("ResetPassword() with an empty password error = %v, want %v", err, ErrPasswordRequired)
+	}
+
+	if err := service.ResetPassword(token, strings.Repeat("a", maxPasswordLength+1), nil); err != ErrPasswordTooLong {
+		t.Fatalf("ResetPassword() with a long password error = %v, want %v", err, ErrPasswordTooLong)
+	}
+
+	if !service.IsResetTokenValid(token) {
+		t.Fatal("IsResetTokenValid() = false after rejected passwords, want the token kept")
+	}
+
+	if err := service.ResetPassword(token, "new password", nil); err != nil {
+		t.Fatalf("ResetPassword() error = %v", err)
+	}
+
+	if ok, _ := service.passwordHasher.Verify(data.key(1), "new password"); !ok {
+		t.Error("new password doesn't verify after the reset")
+	}
+
+	if _, err := service.sessionStorage.FindSessionBySessionId(session.Id); err == nil {
+		t.Error("session of the user survived the reset")
+	}
+
+	if service.IsResetTokenValid(token) {
+		t.Error("IsResetTokenValid() = true for a used token")
+	}
+
+	if err := service.ResetPassword(token, "another password", nil); err != ErrInvalidResetToken {
+		t.Errorf("ResetPassword() with a used token error = %v, want %v", err, ErrInvalidResetToken)
+	}
+
+	if want := []string{entity.AuditPasswordReset}; strings.Join(data.events, ",") != strings.Join(want, ",") {
+		t.Errorf("audit events = %v, want %v", data.events, want)
+	}
+}
+
+func TestPasswordResetSendsNothingForUnknownAccounts(t *testing.T) {
+	server := smtptest.NewServer()
+	defer server.Close()
+
+	mailer := platform.NewSmtpMailer(platform.MailOptions{From: "app@example.com", Host: server.Host, Port: server.Port})
+	service, data := newResetTestService(t, mailer)
+	for _, name := range []string{"nobody", "bob"} {
+		if err := service.RequestPasswordReset(name); err != nil {
+			t.Errorf("RequestPasswordReset(%q) error = %v, want nil", name, err)
+		}
+	}
+
+	if messages := server.Messages(); len(messages) != 0 {
+		t.Errorf("server got %d messages, want none", len(messages))
+	}
+
+	if len(data.tokens) != 0 {
+		t.Errorf("%d reset tokens stored, want none", len(data.tokens))
+	}
+}
+
+func TestChangePasswordValidatesNewPassword(t *testing.T) {
+	service, data := newResetTestService(t, platform.NewFileMailer("app@example.com", ""))
+	user, err := service.userStorage.FindUserById(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		current     string
+		newPassword string
+		want        error
+	}{
+		{"wrong current password", "wrong", "new password", ErrInvalidCredentials},
+		{"empty password", "old password", "", ErrPasswordRequired},
+		{"long password", "old password", strings.Repeat("a", maxPasswordLength+1), ErrPasswordTooLong},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := service.ChangePassword(user, test.current, test.newPassword, nil); err != test.want {
+				t.Errorf("ChangePassword() error = %v, want %v", err, test.want)
+			}
+
+			if ok, _ := service.passwordHasher.Verify(data.key(1), "old password"); !ok {
+				t.Error("password changed although the new one was rejected")
+			}
+		})
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/htmx/password", nil)
+	if err := service.ChangePassword(user, "old password", "new password", request); err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+
+	if ok, _ := service.passwordHasher.Verify(data.key(1), "new password"); !ok {
+		t.Error("new password doesn't verify after the change")
+	}
+}
@@ -0,0 +1,39 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"log"
+	"strings"
+)
+
+const recoveryCodeCount = 10
+
+func newRecoveryCodes() ([]string, [][]byte) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([][]byte, recoveryCodeCount)
+	for i := range codes {
+		bytes := make([]byte, 8)
+		_, err := rand.Read(bytes)
+		if err != nil {
+			log.Panicln(err)
+		}
+
+		code := base32.StdEncoding.EncodeToString(bytes)[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashRecoveryCode(code)
+	}
+
+	return codes, hashes
+}
+
+// hashRecoveryCode ignores case, spaces and dashes so codes can be typed the way they were shown
+// or without formatting. A fast hash is enough since the codes are random and high entropy.
+func hashRecoveryCode(code string) []byte {
+	normalized := strings.ToUpper(code)
+	normalized = strings.ReplaceAll(normalized, "-", "")
+	normalized = strings.ReplaceAll(normalized, " ", "")
+	hash := sha256.Sum256([]byte(normalized))
+	return hash[:]
+}
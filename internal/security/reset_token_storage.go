@@ -0,0 +1,72 @@
+package security
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+)
+
+var ErrInvalidResetToken = errors.New("Reset link is invalid or has expired.")
+
+type ResetTokenStorage struct {
+	database *sql.DB
+}
+
+func NewResetTokenStorage(database *sql.DB) *ResetTokenStorage {
+	return &ResetTokenStorage{database}
+}
+
+func (this *ResetTokenStorage) InsertToken(token entity.PasswordResetToken) error {
+	query := `INSERT INTO "PasswordResetTokens" ("UserId", "Hash", "Expires") VALUES ($1, $2, $3)`
+	if _, err := this.database.Exec(query, token.UserId, token.Hash, token.Expires); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func (this *ResetTokenStorage) TokenExists(hash []byte) bool {
+	exists := false
+	query := `SELECT EXISTS(SELECT 1 FROM "PasswordResetTokens" WHERE "Hash" = $1 AND "Used" = false AND "Expires" > now())`
+	row := this.database.QueryRow(query, hash)
+	if err := row.Scan(&exists); err != nil {
+		log.Println(err.Error())
+		return false
+	}
+
+	return exists
+}
+
+// UseToken marks a token as used and returns its owner. The update only matches unused and
+// unexpired tokens, so concurrent requests with the same token can't both succeed.
+func (this *ResetTokenStorage) UseToken(hash []byte) (int, error) {
+	userId := 0
+	query := `
+		UPDATE "PasswordResetTokens" SET "Used" = true 
+		WHERE "Hash" = $1 AND "Used" = false AND "Expires" > now() 
+		RETURNING "UserId"`
+	row := this.database.QueryRow(query, hash)
+	if err := row.Scan(&userId); err != nil {
+		if err != sql.ErrNoRows {
+			log.Println(err.Error())
+			return 0, err
+		}
+
+		return 0, ErrInvalidResetToken
+	}
+
+	return userId, nil
+}
+
+func (this *ResetTokenStorage) DeleteTokensByUserId(userId int) error {
+	query := `DELETE FROM "PasswordResetTokens" WHERE "UserId" = $1`
+	if _, err := this.database.Exec(query, userId); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	return nil
+}
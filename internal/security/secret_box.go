@@ -0,0 +1,71 @@
+package security
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"log"
+)
+
+var ErrSecretBoxUnavailable = errors.New("Two-factor authentication isn't configured on this server.")
+
+// SecretBox encrypts values that have to be stored in a recoverable form, such as TOTP secrets,
+// with AES-256-GCM. The nonce is stored in front of the ciphertext. A box without a key can't
+// seal or open anything.
+type SecretBox struct {
+	aead cipher.AEAD
+}
+
+func NewSecretBox(key []byte) *SecretBox {
+	if len(key) == 0 {
+		return &SecretBox{}
+	}
+
+	if len(key) != 32 {
+		log.Fatalln("Secret box key must be 32 bytes long.")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	return &SecretBox{aead}
+}
+
+func (this *SecretBox) IsAvailable() bool {
+	return this.aead != nil
+}
+
+func (this *SecretBox) Seal(plaintext []byte) ([]byte, error) {
+	if !this.IsAvailable() {
+		return nil, ErrSecretBoxUnavailable
+	}
+
+	nonce := make([]byte, this.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return this.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (this *SecretBox) Open(sealed []byte) ([]byte, error) {
+	if !this.IsAvailable() {
+		return nil, ErrSecretBoxUnavailable
+	}
+
+	nonceSize := this.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, errors.New("Sealed value too short.")
+	}
+
+	nonce, ciphertext := sealed[:nonceSize], sealed[nonceSize:]
+	return this.aead.Open(nil, nonce, ciphertext, nil)
+}
@@ -0,0 +1,39 @@
+package security
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSecretBoxRoundTrip(t *testing.T) {
+	box := NewSecretBox(bytes.Repeat([]byte{7}, 32))
+	sealed, err := box.Seal([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Seal() error = %v", err)
+	}
+
+	opened, err := box.Open(sealed)
+	if err != nil || string(opened) != "secret" {
+		t.Fatalf("Open() = %q, %v, want the sealed value", opened, err)
+	}
+
+	sealed[len(sealed)-1] ^= 1
+	if _, err := box.Open(sealed); err == nil {
+		t.Error("Open() of a tampered value error = nil")
+	}
+}
+
+func TestSecretBoxWithoutKey(t *testing.T) {
+	box := NewSecretBox(nil)
+	if box.IsAvailable() {
+		t.Fatal("IsAvailable() = true without a key")
+	}
+
+	if _, err := box.Seal([]byte("secret")); err != ErrSecretBoxUnavailable {
+		t.Errorf("Seal() error = %v, want %v", err, ErrSecretBoxUnavailable)
+	}
+
+	if _, err := box.Open([]byte("sealed value")); err != ErrSecretBoxUnavailable {
+		t.Errorf("Open() error = %v, want %v", err, ErrSecretBoxUnavailable)
+	}
+}
@@ -0,0 +1,26 @@
+package security
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"log"
+)
+
+// newSecretToken returns a random bearer secret and the hash that is stored in its place. The
+// secrets have enough entropy that a plain SHA-256 is sufficient, unlike passwords.
+func newSecretToken(prefix string) (string, []byte) {
+	bytes := make([]byte, 32)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		log.Panicln(err)
+	}
+
+	token := prefix + base64.RawURLEncoding.EncodeToString(bytes)
+	return token, hashSecretToken(token)
+}
+
+func hashSecretToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
@@ -5,18 +5,52 @@ import (
 	"database/sql"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+	"github.com/skaisanlahti/try-go-htmx/internal/platform"
 )
 
 var (
-	ErrInvalidCredentials = errors.New("Invalid credentials.")
-	ErrUserAlreadyExists  = errors.New("User already exists.")
+	ErrInvalidCredentials   = errors.New("Invalid credentials.")
+	ErrUserAlreadyExists    = errors.New("User already exists.")
+	ErrSecondFactorRequired = errors.New("Second factor required.")
+	ErrInvalidCode          = errors.New("Invalid code.")
+	ErrLoginExpired         = errors.New("Login has expired, please log in again.")
+	ErrTwoFactorEnabled     = errors.New("Two-factor authentication is already enabled.")
+	ErrTwoFactorNotEnrolled = errors.New("Two-factor authentication is not enrolled.")
+	ErrTooManyAttempts      = errors.New("Too many attempts, please log in again.")
+	ErrInvalidToken         = errors.New("Invalid token.")
+	ErrInsufficientScope    = errors.New("Token doesn't have the required scope.")
+	ErrAccountExists        = errors.New("An account with this name already exists. Log in with your password and link the provider from your account page.")
+	ErrIdentityLinked       = errors.New("This sign in is already linked to another account.")
+	ErrForbidden            = errors.New("Forbidden.")
+	ErrLastAdmin            = errors.New("The last admin can't be demoted.")
 )
 
+const apiTokenPrefix = "tgh_"
+
+const calendarFeedPrefix = "tghcal_"
+
+const maxSecondFactorAttempts = 5
+
+type ResetOptions struct {
+	LinkUrl  string
+	Duration time.Duration
+}
+
+type TwoFactorOptions struct {
+	Issuer          string
+	EncryptionKey   []byte
+	PendingDuration time.Duration
+}
+
 func NewSessionSecret(length uint32) string {
 	bytes := make([]byte, length)
 	_, err := rand.Read(bytes)
@@ -28,21 +62,40 @@ func NewSessionSecret(length uint32) string {
 }
 
 type SecurityService struct {
-	database        *sql.DB
-	sessionOptions  SessionOptions
-	passwordOptions PasswordOptions
-	sessionStorage  *SessionStorage
-	cookieFactory   *CookieFactory
-	userStorage     *UserStorage
-	sessionSigner   *SessionSigner
-	passwordHasher  *PasswordHasher
-	fakeUser        entity.User
+	database          *sql.DB
+	sessionOptions    SessionOptions
+	passwordOptions   PasswordOptions
+	resetOptions      ResetOptions
+	twoFactorOptions  TwoFactorOptions
+	sessionStorage    *SessionStorage
+	cookieFactory     *CookieFactory
+	userStorage       *UserStorage
+	resetTokenStorage *ResetTokenStorage
+	twoFactorStorage  *TwoFactorStorage
+	apiTokenStorage   *ApiTokenStorage
+	calendarStorage   *CalendarFeedStorage
+	identityStorage   *ExternalIdentityStorage
+	oidcFlowStorage   *OidcFlowStorage
+	auditLog          *AuditLog
+	oidcProviders     map[string]*OidcProvider
+	oidcOptions       []OidcProviderOptions
+	adminName         string
+	sessionSigner     *SessionSigner
+	passwordHasher    *PasswordHasher
+	secretBox         *SecretBox
+	mailer            platform.Mailer
+	fakeUser          entity.User
 }
 
 func NewSecurityService(
 	database *sql.DB,
 	passwordOptions PasswordOptions,
 	sessionOptions SessionOptions,
+	resetOptions ResetOptions,
+	twoFactorOptions TwoFactorOptions,
+	oidcOptions []OidcProviderOptions,
+	adminName string,
+	mailer platform.Mailer,
 ) *SecurityService {
 	passwordHasher := NewPasswordHasher(passwordOptions)
 	fakeKey, err := passwordHasher.Hash("password")
@@ -51,26 +104,55 @@ func NewSecurityService(
 	}
 
 	fakeUser := entity.NewUser("username", fakeKey)
+	oidcProviders := make(map[string]*OidcProvider)
+	for _, options := range oidcOptions {
+		oidcProviders[options.Name] = NewOidcProvider(options)
+	}
+
+	auditLog := NewAuditLog(database)
+	onSessionExpired := func(session entity.Session) {
+		auditLog.Record(entity.NewAuditEvent(entity.AuditSessionExpired, session.UserId, ""))
+	}
+
 	return &SecurityService{
-		database:        database,
-		sessionOptions:  sessionOptions,
-		passwordOptions: passwordOptions,
-		cookieFactory:   NewCookieFactory(sessionOptions),
-		sessionStorage:  NewSessionStorage(),
-		userStorage:     NewUserStorage(database),
-		sessionSigner:   NewSessionSigner(sessionOptions),
-		passwordHasher:  passwordHasher,
-		fakeUser:        fakeUser,
+		database:          database,
+		sessionOptions:    sessionOptions,
+		passwordOptions:   passwordOptions,
+		resetOptions:      resetOptions,
+		twoFactorOptions:  twoFactorOptions,
+		cookieFactory:     NewCookieFactory(sessionOptions),
+		sessionStorage:    NewSessionStorage(onSessionExpired),
+		userStorage:       NewUserStorage(database),
+		resetTokenStorage: NewResetTokenStorage(database),
+		twoFactorStorage:  NewTwoFactorStorage(database),
+		apiTokenStorage:   NewApiTokenStorage(database),
+		calendarStorage:   NewCalendarFeedStorage(database),
+		identityStorage:   NewExternalIdentityStorage(database),
+		oidcFlowStorage:   NewOidcFlowStorage(),
+		auditLog:          auditLog,
+		oidcProviders:     oidcProviders,
+		oidcOptions:       oidcOptions,
+		adminName:         adminName,
+		sessionSigner:     NewSessionSigner(sessionOptions),
+		passwordHasher:    passwordHasher,
+		secretBox:         NewSecretBox(twoFactorOptions.EncryptionKey),
+		mailer:            mailer,
+		fakeUser:          fakeUser,
 	}
 }
 
-func (this *SecurityService) RegisterUser(name string, password string, response http.ResponseWriter) error {
+func (this *SecurityService) RegisterUser(name string, email string, password string, response http.ResponseWriter, request *http.Request) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+
 	key, err := this.passwordHasher.Hash(password)
 	if err != nil {
 		return err
 	}
 
 	user := entity.NewUser(name, key)
+	user.Email = email
 	err = user.Validate()
 	if err != nil {
 		return err
@@ -81,8 +163,12 @@ func (this *SecurityService) RegisterUser(name string, password string, response
 		return err
 	}
 
-	session := entity.NewSession(userId, this.sessionOptions.Duration)
-	err = this.sessionStorage.InsertSession(session)
+	this.auditLog.Record(withRequest(entity.NewAuditEvent(entity.AuditRegistered, userId, user.Name), request))
+	return this.startSession(entity.NewSession(userId, this.sessionOptions.Duration), response)
+}
+
+func (this *SecurityService) startSession(session entity.Session, response http.ResponseWriter) error {
+	err := this.sessionStorage.InsertSession(session)
 	if err != nil {
 		return err
 	}
@@ -97,15 +183,17 @@ func (this *SecurityService) RegisterUser(name string, password string, response
 	return nil
 }
 
-func (this *SecurityService) LoginUser(name string, password string, response http.ResponseWriter) error {
+func (this *SecurityService) LoginUser(name string, password string, response http.ResponseWriter, request *http.Request) error {
 	user, err := this.userStorage.FindUserByName(name)
 	if err != nil {
 		this.passwordHasher.Verify(this.fakeUser.Key, password)
+		this.auditLog.Record(withRequest(entity.NewAuditEvent(entity.AuditLoginFailed, 0, name), request))
 		return ErrInvalidCredentials
 	}
 
 	isPasswordCorrect, newKeyChannel := this.passwordHasher.Verify(user.Key, password)
 	if !isPasswordCorrect {
+		this.auditLog.Record(withRequest(entity.NewAuditEvent(entity.AuditLoginFailed, user.Id, user.Name), request))
 		return ErrInvalidCredentials
 	}
 
@@ -113,20 +201,26 @@ func (this *SecurityService) LoginUser(name string, password string, response ht
 		go this.updateUserKey(user, newKeyChannel)
 	}
 
-	session := entity.NewSession(user.Id, this.sessionOptions.Duration)
-	err = this.sessionStorage.InsertSession(session)
-	if err != nil {
-		return err
-	}
+	return this.beginLogin(user, "password", response, request)
+}
 
-	signedSession, err := this.sessionSigner.NewSignature(session.Id)
-	if err != nil {
-		return err
+// beginLogin starts a session for a user whose first factor has been checked. Users with
+// two-factor authentication get a half-authenticated session until their code is verified. The
+// method is recorded in the audit log.
+func (this *SecurityService) beginLogin(user entity.User, method string, response http.ResponseWriter, request *http.Request) error {
+	if this.twoFactorStorage.IsTwoFactorEnabled(user.Id) {
+		pendingSession := entity.NewPendingSession(user.Id, this.twoFactorOptions.PendingDuration)
+		if err := this.startSession(pendingSession, response); err != nil {
+			return err
+		}
+
+		return ErrSecondFactorRequired
 	}
 
-	cookie := this.cookieFactory.NewSessionCookie(signedSession)
-	http.SetCookie(response, cookie)
-	return nil
+	event := withRequest(entity.NewAuditEvent(entity.AuditLoginSucceeded, user.Id, user.Name), request)
+	event.Detail = method
+	this.auditLog.Record(event)
+	return this.startSession(entity.NewSession(user.Id, this.sessionOptions.Duration), response)
 }
 
 func (this *SecurityService) updateUserKey(user entity.User, newKeyChannel chan []byte) {
@@ -140,7 +234,10 @@ func (this *SecurityService) updateUserKey(user entity.User, newKeyChannel chan
 	err := this.userStorage.UpdateUserKey(user)
 	if err != nil {
 		log.Printf("User: %s | Key update failed: database update failed.", user.Name)
+		return
 	}
+
+	this.auditLog.Record(entity.NewAuditEvent(entity.AuditPasswordRehashed, user.Id, user.Name))
 }
 
 func (this *SecurityService) LogoutUser(response http.ResponseWriter, request *http.Request) error {
@@ -154,11 +251,17 @@ func (this *SecurityService) LogoutUser(response http.ResponseWriter, request *h
 		return err
 	}
 
+	session, err := this.sessionStorage.FindSessionBySessionId(sessionId)
+	if err != nil {
+		return err
+	}
+
 	err = this.sessionStorage.DeleteSession(sessionId)
 	if err != nil {
 		return err
 	}
 
+	this.auditLog.Record(withRequest(entity.NewAuditEvent(entity.AuditLogout, session.UserId, ""), request))
 	http.SetCookie(response, this.cookieFactory.ClearSessionCookie())
 	return nil
 }
@@ -174,12 +277,12 @@ func (this *SecurityService) IsLoggedIn(request *http.Request) bool {
 		return false
 	}
 
-	_, err = this.sessionStorage.FindSessionBySessionId(sessionId)
+	session, err := this.sessionStorage.FindSessionBySessionId(sessionId)
 	if err != nil {
 		return false
 	}
 
-	return true
+	return !session.Pending
 }
 
 func (this *SecurityService) VerifySession(response http.ResponseWriter, request *http.Request) (entity.User, error) {
@@ -201,9 +304,14 @@ func (this *SecurityService) VerifySession(response http.ResponseWriter, request
 
 	if session.Expires.Before(time.Now()) {
 		this.sessionStorage.DeleteSession(sessionId)
+		this.auditLog.Record(withRequest(entity.NewAuditEvent(entity.AuditSessionExpired, session.UserId, ""), request))
 		return user, errors.New("Session has expired.")
 	}
 
+	if session.Pending {
+		return user, ErrSecondFactorRequired
+	}
+
 	err = this.sessionStorage.UpdateSession(session.Extend(this.sessionOptions.Duration))
 	if err != nil {
 		return user, err
@@ -224,3 +332,649 @@ func (this *SecurityService) VerifySession(response http.ResponseWriter, request
 
 	return user, nil
 }
+
+func (this *SecurityService) currentSessionId(request *http.Request) string {
+	cookie, err := request.Cookie(this.sessionOptions.CookieName)
+	if err != nil {
+		return ""
+	}
+
+	sessionId, err := this.sessionSigner.VerifySignature(cookie.Value)
+	if err != nil {
+		return ""
+	}
+
+	return sessionId
+}
+
+// ChangePassword replaces the password of a logged in user after checking the current one.
+// Every other session of the user is revoked, the session making the request stays valid.
+func (this *SecurityService) ChangePassword(user entity.User, currentPassword string, newPassword string, request *http.Request) error {
+	isPasswordCorrect, _ := this.passwordHasher.Verify(user.Key, currentPassword)
+	if !isPasswordCorrect {
+		return ErrInvalidCredentials
+	}
+
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+
+	key, err := this.passwordHasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	user.Key = key
+	if err = this.userStorage.UpdateUserKey(user); err != nil {
+		return err
+	}
+
+	this.sessionStorage.DeleteSessionsByUserId(user.Id, this.currentSessionId(request))
+	this.auditLog.Record(withRequest(entity.NewAuditEvent(entity.AuditPasswordChanged, user.Id, user.Name), request))
+	return nil
+}
+
+// RequestPasswordReset mails a single use reset link to the user. Unknown users and users without
+// an email address are not reported back so the form can't be used to discover accounts.
+func (this *SecurityService) RequestPasswordReset(name string) error {
+	user, err := this.userStorage.FindUserByName(name)
+	if err != nil || user.Email == "" {
+		return nil
+	}
+
+	token, hash := newSecretToken("")
+	resetToken := entity.NewPasswordResetToken(user.Id, hash, this.resetOptions.Duration)
+	if err = this.resetTokenStorage.InsertToken(resetToken); err != nil {
+		return err
+	}
+
+	link := this.resetOptions.LinkUrl + "?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf(
+		"Hi %s,\n\nUse the link below to choose a new password. The link expires in %d minutes and can only be used once.\n\n%s\n\nIf you didn't ask for a new password you can ignore this message.",
+		user.Name,
+		int(this.resetOptions.Duration.Minutes()),
+		link,
+	)
+
+	return this.mailer.Send(user.Email, "Reset your password", body)
+}
+
+func (this *SecurityService) IsResetTokenValid(token string) bool {
+	return this.resetTokenStorage.TokenExists(hashSecretToken(token))
+}
+
+// ResetPassword consumes a reset token and sets a new password for its owner. All sessions of
+// the user are revoked along with any other outstanding reset tokens.
+func (this *SecurityService) ResetPassword(token string, newPassword string, request *http.Request) error {
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+
+	userId, err := this.resetTokenStorage.UseToken(hashSecretToken(token))
+	if err != nil {
+		return err
+	}
+
+	user, err := this.userStorage.FindUserById(userId)
+	if err != nil {
+		return err
+	}
+
+	key, err := this.passwordHasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	user.Key = key
+	if err = this.userStorage.UpdateUserKey(user); err != nil {
+		return err
+	}
+
+	this.sessionStorage.DeleteSessionsByUserId(user.Id, "")
+	this.auditLog.Record(withRequest(entity.NewAuditEvent(entity.AuditPasswordReset, user.Id, user.Name), request))
+	return this.resetTokenStorage.DeleteTokensByUserId(user.Id)
+}
+
+func (this *SecurityService) findPendingSession(request *http.Request) (entity.Session, error) {
+	session, err := this.sessionStorage.FindSessionBySessionId(this.currentSessionId(request))
+	if err != nil || !session.Pending {
+		return session, ErrLoginExpired
+	}
+
+	if session.Expires.Before(time.Now()) {
+		this.sessionStorage.DeleteSession(session.Id)
+		return session, ErrLoginExpired
+	}
+
+	return session, nil
+}
+
+func (this *SecurityService) HasPendingLogin(request *http.Request) bool {
+	_, err := this.findPendingSession(request)
+	return err == nil
+}
+
+// checkSecondFactor accepts either a TOTP code or one of the unused recovery codes.
+func (this *SecurityService) checkSecondFactor(twoFactor entity.TwoFactor, code string) bool {
+	secret, err := this.secretBox.Open(twoFactor.Secret)
+	if err != nil {
+		log.Printf("User: %d | Two-factor secret could not be decrypted.", twoFactor.UserId)
+		return false
+	}
+
+	counter, ok := verifyTotp(secret, code, time.Now(), twoFactor.LastCounter)
+	if ok {
+		return this.twoFactorStorage.UseCounter(twoFactor.UserId, counter)
+	}
+
+	return this.twoFactorStorage.UseRecoveryCode(twoFactor.UserId, hashRecoveryCode(code))
+}
+
+// VerifySecondFactor completes a login that is waiting for a second factor. The half-authenticated
+// session is replaced with a new full session so the pending session id can't be reused.
+func (this *SecurityService) VerifySecondFactor(code string, response http.ResponseWriter, request *http.Request) error {
+	session, err := this.findPendingSession(request)
+	if err != nil {
+		return err
+	}
+
+	twoFactor, err := this.twoFactorStorage.FindTwoFactorByUserId(session.UserId)
+	if err != nil || !twoFactor.Enabled {
+		this.sessionStorage.DeleteSession(session.Id)
+		return ErrLoginExpired
+	}
+
+	if !this.secretBox.IsAvailable() {
+		return ErrSecretBoxUnavailable
+	}
+
+	if !this.checkSecondFactor(twoFactor, code) {
+		this.auditLog.Record(withRequest(entity.NewAuditEvent(entity.AuditSecondFactorFailed, session.UserId, ""), request))
+		session.Attempts++
+		if session.Attempts >= maxSecondFactorAttempts {
+			this.sessionStorage.DeleteSession(session.Id)
+			http.SetCookie(response, this.cookieFactory.ClearSessionCookie())
+			return ErrTooManyAttempts
+		}
+
+		this.sessionStorage.UpdateSession(session)
+		return ErrInvalidCode
+	}
+
+	this.sessionStorage.DeleteSession(session.Id)
+	event := withRequest(entity.NewAuditEvent(entity.AuditLoginSucceeded, session.UserId, ""), request)
+	event.Detail = "second factor"
+	this.auditLog.Record(event)
+	return this.startSession(entity.NewSession(session.UserId, this.sessionOptions.Duration), response)
+}
+
+func (this *SecurityService) IsTwoFactorEnabled(user entity.User) bool {
+	return this.twoFactorStorage.IsTwoFactorEnabled(user.Id)
+}
+
+func (this *SecurityService) CountRecoveryCodes(user entity.User) int {
+	return this.twoFactorStorage.CountRecoveryCodes(user.Id)
+}
+
+// BeginTwoFactorEnrollment creates a new secret for the user and returns it as an otpauth URI and
+// as text for manual entry. The secret is not used for logins until the enrollment is confirmed.
+func (this *SecurityService) BeginTwoFactorEnrollment(user entity.User) (string, string, error) {
+	if this.twoFactorStorage.IsTwoFactorEnabled(user.Id) {
+		return "", "", ErrTwoFactorEnabled
+	}
+
+	secret := newTotpSecret()
+	sealedSecret, err := this.secretBox.Seal(secret)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err = this.twoFactorStorage.UpsertPendingTwoFactor(entity.NewTwoFactor(user.Id, sealedSecret)); err != nil {
+		return "", "", err
+	}
+
+	uri := newTotpUri(this.twoFactorOptions.Issuer, user.Name, secret)
+	return uri, encodeTotpSecret(secret), nil
+}
+
+// ConfirmTwoFactorEnrollment enables two-factor authentication once the user proves the
+// authenticator works, and returns the recovery codes. The codes are only stored hashed.
+func (this *SecurityService) ConfirmTwoFactorEnrollment(user entity.User, code string) ([]string, error) {
+	twoFactor, err := this.twoFactorStorage.FindTwoFactorByUserId(user.Id)
+	if err != nil {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	if twoFactor.Enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := this.secretBox.Open(twoFactor.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	counter, ok := verifyTotp(secret, code, time.Now(), twoFactor.LastCounter)
+	if !ok || !this.twoFactorStorage.UseCounter(user.Id, counter) {
+		return nil, ErrInvalidCode
+	}
+
+	codes, hashes := newRecoveryCodes()
+	if err = this.twoFactorStorage.EnableTwoFactor(user.Id, hashes); err != nil {
+		return nil, err
+	}
+
+	this.auditLog.Record(entity.NewAuditEvent(entity.AuditTwoFactorEnabled, user.Id, user.Name))
+
+	return codes, nil
+}
+
+func (this *SecurityService) DisableTwoFactor(user entity.User, code string) error {
+	twoFactor, err := this.twoFactorStorage.FindTwoFactorByUserId(user.Id)
+	if err != nil || !twoFactor.Enabled {
+		return ErrTwoFactorNotEnrolled
+	}
+
+	if !this.secretBox.IsAvailable() {
+		return ErrSecretBoxUnavailable
+	}
+
+	if !this.checkSecondFactor(twoFactor, code) {
+		return ErrInvalidCode
+	}
+
+	if err = this.twoFactorStorage.DeleteTwoFactor(user.Id); err != nil {
+		return err
+	}
+
+	this.auditLog.Record(entity.NewAuditEvent(entity.AuditTwoFactorDisabled, user.Id, user.Name))
+	return nil
+}
+
+// CreateApiToken issues a personal access token. The returned secret is only available here, the
+// database keeps just its hash.
+func (this *SecurityService) CreateApiToken(user entity.User, name string, scopes []string, expires time.Time, request *http.Request) (string, error) {
+	secret, hash := newSecretToken(apiTokenPrefix)
+	token := entity.NewApiToken(user.Id, name, hash, scopes, expires)
+	if err := token.Validate(); err != nil {
+		return "", err
+	}
+
+	if _, err := this.apiTokenStorage.InsertToken(token); err != nil {
+		return "", err
+	}
+
+	event := withRequest(entity.NewAuditEvent(entity.AuditTokenCreated, user.Id, user.Name), request)
+	event.Detail = name
+	this.auditLog.Record(event)
+	return secret, nil
+}
+
+func (this *SecurityService) FindApiTokens(user entity.User) []entity.ApiToken {
+	return this.apiTokenStorage.FindTokensByUserId(user.Id)
+}
+
+func (this *SecurityService) RevokeApiToken(user entity.User, tokenId int) error {
+	if err := this.apiTokenStorage.DeleteToken(user.Id, tokenId); err != nil {
+		return err
+	}
+
+	this.auditLog.Record(entity.NewAuditEvent(entity.AuditTokenRevoked, user.Id, user.Name))
+	return nil
+}
+
+// VerifyBearerToken authenticates a request with an Authorization: Bearer header and checks that
+// the token carries the scope. It returns the same user VerifySession would for a cookie.
+func (this *SecurityService) VerifyBearerToken(request *http.Request, scope string) (entity.User, error) {
+	var user entity.User
+	header := request.Header.Get("Authorization")
+	secret, found := strings.CutPrefix(header, "Bearer ")
+	if !found || !strings.HasPrefix(secret, apiTokenPrefix) {
+		return user, ErrInvalidToken
+	}
+
+	token, err := this.apiTokenStorage.UseToken(hashSecretToken(secret))
+	if err != nil {
+		return user, ErrInvalidToken
+	}
+
+	if !token.HasScope(scope) {
+		return user, ErrInsufficientScope
+	}
+
+	return this.userStorage.FindUserById(token.UserId)
+}
+
+// VerifyBasicAuth authenticates a request with an Authorization: Basic header, for clients such
+// as calendar apps that can't send bearer tokens. The password can be an API token of the user,
+// checked for the scope like VerifyBearerToken does, or the password of the account. Accounts with
+// two-factor authentication have to use a token since the second factor can't be asked for.
+func (this *SecurityService) VerifyBasicAuth(request *http.Request, scope string) (entity.User, error) {
+	var user entity.User
+	name, password, ok := request.BasicAuth()
+	if !ok {
+		return user, ErrInvalidCredentials
+	}
+
+	if strings.HasPrefix(password, apiTokenPrefix) {
+		token, err := this.apiTokenStorage.UseToken(hashSecretToken(password))
+		if err != nil {
+			return user, ErrInvalidToken
+		}
+
+		if user, err = this.userStorage.FindUserById(token.UserId); err != nil || user.Name != name {
+			return entity.User{}, ErrInvalidToken
+		}
+
+		if !token.HasScope(scope) {
+			return entity.User{}, ErrInsufficientScope
+		}
+
+		return user, nil
+	}
+
+	user, err := this.userStorage.FindUserByName(name)
+	if err != nil {
+		this.passwordHasher.Verify(this.fakeUser.Key, password)
+		this.auditLog.Record(withRequest(entity.NewAuditEvent(entity.AuditLoginFailed, 0, name), request))
+		return entity.User{}, ErrInvalidCredentials
+	}
+
+	isPasswordCorrect, newKeyChannel := this.passwordHasher.Verify(user.Key, password)
+	if !isPasswordCorrect {
+		this.auditLog.Record(withRequest(entity.NewAuditEvent(entity.AuditLoginFailed, user.Id, user.Name), request))
+		return entity.User{}, ErrInvalidCredentials
+	}
+
+	if newKeyChannel != nil {
+		go this.updateUserKey(user, newKeyChannel)
+	}
+
+	if this.twoFactorStorage.IsTwoFactorEnabled(user.Id) {
+		return entity.User{}, ErrSecondFactorRequired
+	}
+
+	return user, nil
+}
+
+// CreateCalendarFeed issues the secret of the calendar feed of the user, replacing the one they
+// had. Like API tokens, the secret is only available here.
+func (this *SecurityService) CreateCalendarFeed(user entity.User, request *http.Request) (string, error) {
+	secret, hash := newSecretToken(calendarFeedPrefix)
+	if err := this.calendarStorage.SaveFeed(entity.NewCalendarFeed(user.Id, hash)); err != nil {
+		return "", err
+	}
+
+	this.auditLog.Record(withRequest(entity.NewAuditEvent(entity.AuditCalendarCreated, user.Id, user.Name), request))
+	return secret, nil
+}
+
+// FindCalendarFeed returns the calendar feed of the user, false when they don't have one.
+func (this *SecurityService) FindCalendarFeed(user entity.User) (entity.CalendarFeed, bool) {
+	feed, err := this.calendarStorage.FindFeedByUserId(user.Id)
+	return feed, err == nil
+}
+
+func (this *SecurityService) RevokeCalendarFeed(user entity.User, request *http.Request) error {
+	if err := this.calendarStorage.DeleteFeed(user.Id); err != nil {
+		return err
+	}
+
+	this.auditLog.Record(withRequest(entity.NewAuditEvent(entity.AuditCalendarRevoked, user.Id, user.Name), request))
+	return nil
+}
+
+// VerifyCalendarSecret returns the user a calendar feed secret belongs to. The secret only opens
+// the feed, it's never accepted in place of a session or an API token.
+func (this *SecurityService) VerifyCalendarSecret(secret string) (entity.User, error) {
+	var user entity.User
+	if !strings.HasPrefix(secret, calendarFeedPrefix) {
+		return user, ErrInvalidToken
+	}
+
+	feed, err := this.calendarStorage.UseFeed(hashSecretToken(secret))
+	if err != nil {
+		return user, ErrInvalidToken
+	}
+
+	return this.userStorage.FindUserById(feed.UserId)
+}
+
+type OidcProviderInfo struct {
+	Name        string
+	DisplayName string
+}
+
+func (this *SecurityService) OidcProviders() []OidcProviderInfo {
+	var providers []OidcProviderInfo
+	for _, options := range this.oidcOptions {
+		providers = append(providers, OidcProviderInfo{options.Name, options.DisplayName})
+	}
+
+	return providers
+}
+
+// BeginOidcLogin starts an authorization code flow and returns the provider URL to redirect to.
+// A non-zero linkUserId links the external account to that user instead of logging in.
+func (this *SecurityService) BeginOidcLogin(providerName string, linkUserId int, response http.ResponseWriter) (string, error) {
+	provider, ok := this.oidcProviders[providerName]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+
+	state, _ := newSecretToken("")
+	nonce, _ := newSecretToken("")
+	verifier, _ := newSecretToken("")
+	redirectUrl, err := provider.AuthCodeUrl(state, nonce, verifier)
+	if err != nil {
+		log.Println(err.Error())
+		return "", err
+	}
+
+	this.oidcFlowStorage.InsertFlow(state, OidcFlow{
+		Provider:   providerName,
+		Nonce:      nonce,
+		Verifier:   verifier,
+		LinkUserId: linkUserId,
+	})
+
+	http.SetCookie(response, this.cookieFactory.NewOidcStateCookie(state))
+	return redirectUrl, nil
+}
+
+// CompleteOidcLogin handles the redirect back from the provider. Known identities log in as their
+// linked user, new identities are either linked to the user who started the flow or provisioned
+// as a new user. It reports whether the flow was a link instead of a login.
+func (this *SecurityService) CompleteOidcLogin(response http.ResponseWriter, request *http.Request) (bool, error) {
+	http.SetCookie(response, this.cookieFactory.ClearOidcStateCookie())
+	query := request.URL.Query()
+	state := query.Get("state")
+	cookie, err := request.Cookie(oidcStateCookieName)
+	if err != nil || state == "" || cookie.Value != state {
+		return false, ErrInvalidOidcState
+	}
+
+	flow, err := this.oidcFlowStorage.TakeFlow(state)
+	if err != nil {
+		return false, err
+	}
+
+	if query.Get("error") != "" {
+		return false, fmt.Errorf("Sign in was cancelled or failed: %s.", query.Get("error"))
+	}
+
+	provider := this.oidcProviders[flow.Provider]
+	claims, err := provider.Exchange(query.Get("code"), flow.Verifier, flow.Nonce)
+	if err != nil {
+		log.Println(err.Error())
+		return false, err
+	}
+
+	email := ""
+	if claims.EmailVerified {
+		email = claims.Email
+	}
+
+	identity, err := this.identityStorage.FindIdentity(flow.Provider, claims.Subject)
+	if err == nil {
+		if flow.LinkUserId != 0 && flow.LinkUserId != identity.UserId {
+			return true, ErrIdentityLinked
+		}
+
+		if flow.LinkUserId != 0 {
+			return true, nil
+		}
+
+		user, err := this.userStorage.FindUserById(identity.UserId)
+		if err != nil {
+			return false, err
+		}
+
+		return false, this.beginLogin(user, flow.Provider, response, request)
+	}
+
+	if err != sql.ErrNoRows {
+		return false, err
+	}
+
+	if flow.LinkUserId != 0 {
+		identity := entity.NewExternalIdentity(flow.LinkUserId, flow.Provider, claims.Subject, email)
+		if err = this.identityStorage.InsertIdentity(identity); err != nil {
+			return true, err
+		}
+
+		event := withRequest(entity.NewAuditEvent(entity.AuditIdentityLinked, flow.LinkUserId, ""), request)
+		event.Detail = flow.Provider
+		this.auditLog.Record(event)
+		return true, nil
+	}
+
+	user, err := this.provisionOidcUser(claims, email)
+	if err != nil {
+		return false, err
+	}
+
+	this.auditLog.Record(withRequest(entity.NewAuditEvent(entity.AuditRegistered, user.Id, user.Name), request))
+
+	identity = entity.NewExternalIdentity(user.Id, flow.Provider, claims.Subject, email)
+	if err = this.identityStorage.InsertIdentity(identity); err != nil {
+		return false, err
+	}
+
+	return false, this.beginLogin(user, flow.Provider, response, request)
+}
+
+// provisionOidcUser creates a local user for a first time external login. The password is random
+// and never shown, the user can set one later with a password reset.
+func (this *SecurityService) provisionOidcUser(claims OidcClaims, email string) (entity.User, error) {
+	name := claims.PreferredUsername
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+
+	if len([]rune(name)) < 3 {
+		name = claims.Subject
+	}
+
+	password, _ := newSecretToken("")
+	key, err := this.passwordHasher.Hash(password)
+	if err != nil {
+		return entity.User{}, err
+	}
+
+	user := entity.NewUser(name, key)
+	user.Email = email
+	if err = user.Validate(); err != nil {
+		return user, err
+	}
+
+	user.Id, err = this.userStorage.InsertUserIfNotExists(user)
+	if err == ErrUserAlreadyExists {
+		return user, ErrAccountExists
+	}
+
+	return user, err
+}
+
+func (this *SecurityService) FindExternalIdentities(user entity.User) []entity.ExternalIdentity {
+	return this.identityStorage.FindIdentitiesByUserId(user.Id)
+}
+
+func (this *SecurityService) UnlinkExternalIdentity(user entity.User, identityId int) error {
+	return this.identityStorage.DeleteIdentity(user.Id, identityId)
+}
+
+// BootstrapAdmin promotes the configured admin user at startup if the account already exists.
+// Registering with that name doesn't grant the role, the account has to exist before a restart.
+func (this *SecurityService) BootstrapAdmin() {
+	if this.adminName == "" {
+		return
+	}
+
+	user, err := this.userStorage.FindUserByName(this.adminName)
+	if err != nil || user.IsAdmin() {
+		return
+	}
+
+	if err = this.userStorage.UpdateUserRole(user.Id, entity.RoleAdmin); err == nil {
+		log.Printf("User: %s | Promoted to admin by configuration.", user.Name)
+	}
+}
+
+func (this *SecurityService) Authorize(user entity.User, permission entity.Permission) error {
+	if !user.Can(permission) {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+func (this *SecurityService) FindUsers(actor entity.User) ([]entity.User, error) {
+	if err := this.Authorize(actor, entity.PermissionManageUsers); err != nil {
+		return nil, err
+	}
+
+	return this.userStorage.FindUsers(), nil
+}
+
+func (this *SecurityService) ChangeUserRole(actor entity.User, userId int, role string) error {
+	if err := this.Authorize(actor, entity.PermissionManageUsers); err != nil {
+		return err
+	}
+
+	if !slices.Contains(entity.Roles, role) {
+		return errors.New("Unknown role.")
+	}
+
+	if err := this.userStorage.UpdateUserRole(userId, role); err != nil {
+		return err
+	}
+
+	event := entity.NewAuditEvent(entity.AuditRoleChanged, userId, "")
+	event.Detail = fmt.Sprintf("%s by %s", role, actor.Name)
+	this.auditLog.Record(event)
+	return nil
+}
+
+// FindSecurityActivity returns the most recent audit events of the user for the account page.
+func (this *SecurityService) FindSecurityActivity(user entity.User) []entity.AuditEvent {
+	return this.auditLog.FindEventsByUserId(user.Id, 50)
+}
+
+func (this *SecurityService) FindAuditEvents(actor entity.User, filter entity.AuditFilter) ([]entity.AuditEvent, error) {
+	if err := this.Authorize(actor, entity.PermissionViewAudit); err != nil {
+		return nil, err
+	}
+
+	return this.auditLog.FindEvents(filter), nil
+}
+
+// ChangeTimeZone sets the zone used to decide which todos are due today for the user.
+func (this *SecurityService) ChangeTimeZone(user entity.User, timeZone string) error {
+	user.TimeZone = timeZone
+	if err := user.Validate(); err != nil {
+		return err
+	}
+
+	return this.userStorage.UpdateUserTimeZone(user.Id, timeZone)
+}
@@ -18,13 +18,17 @@ type SessionOptions struct {
 }
 
 type SessionStorage struct {
-	sessions map[string]entity.Session
-	locker   sync.RWMutex
+	sessions  map[string]entity.Session
+	locker    sync.RWMutex
+	onExpired func(session entity.Session)
 }
 
-func NewSessionStorage() *SessionStorage {
+// NewSessionStorage starts the expired session clean up. onExpired is called for every session
+// the clean up removes and may be nil.
+func NewSessionStorage(onExpired func(session entity.Session)) *SessionStorage {
 	storage := &SessionStorage{
-		sessions: make(map[string]entity.Session),
+		sessions:  make(map[string]entity.Session),
+		onExpired: onExpired,
 	}
 
 	go storage.RemoveExpired()
@@ -89,6 +93,18 @@ func (this *SessionStorage) DeleteSession(sessionId string) error {
 	return nil
 }
 
+// DeleteSessionsByUserId removes every session of the user except the one with the given id.
+// Pass an empty id to remove all of them.
+func (this *SessionStorage) DeleteSessionsByUserId(userId int, exceptSessionId string) {
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	for key, session := range this.sessions {
+		if session.UserId == userId && session.Id != exceptSessionId {
+			delete(this.sessions, key)
+		}
+	}
+}
+
 const (
 	checkingInterval time.Duration = 60 * time.Second
 	timeFormat       string        = "2006/01/02 15:04:05 -0700"
@@ -100,15 +116,23 @@ func (this *SessionStorage) RemoveExpired() {
 		log.Printf("Next expired session clean up scheduled at %s.", time.Now().Add(checkingInterval).Format(timeFormat))
 		time.Sleep(checkingInterval)
 		startTask := time.Now()
+		expired := make(map[string]entity.Session)
 		this.locker.Lock()
 		for _, session := range this.sessions {
 			if session.Expires.Before(time.Now()) {
+				expired[session.Id] = session
 				delete(this.sessions, session.Id)
 				delete(this.sessions, strconv.Itoa(session.UserId))
 			}
 		}
 
 		this.locker.Unlock()
+		if this.onExpired != nil {
+			for _, session := range expired {
+				this.onExpired(session)
+			}
+		}
+
 		taskDuration := time.Now().Sub(startTask)
 		log.Printf("Expired sessions cleaned up in %d ms.", taskDuration.Milliseconds())
 	}
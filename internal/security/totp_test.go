@@ -0,0 +1,65 @@
+package security
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors.
+var rfc6238Secret = []byte("12345678901234567890")
+
+func TestTotpCodeRfc6238Vectors(t *testing.T) {
+	// the RFC lists 8 digit codes, 6 digit codes are their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, test := range tests {
+		counter := totpCounter(time.Unix(test.unix, 0))
+		if code := totpCode(rfc6238Secret, counter); code != test.want {
+			t.Errorf("totpCode() at %d = %s, want %s", test.unix, code, test.want)
+		}
+	}
+}
+
+func TestVerifyTotp(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := totpCounter(now)
+	tests := []struct {
+		name        string
+		code        string
+		lastCounter int64
+		wantCounter int64
+		wantOk      bool
+	}{
+		{"current step", totpCode(rfc6238Secret, current), 0, current, true},
+		{"current step with spaces", "050 471", 0, current, true},
+		{"previous step", totpCode(rfc6238Secret, current-1), 0, current - 1, true},
+		{"next step", totpCode(rfc6238Secret, current+1), 0, current + 1, true},
+		{"two steps back", totpCode(rfc6238Secret, current-2), 0, 0, false},
+		{"two steps ahead", totpCode(rfc6238Secret, current+2), 0, 0, false},
+		{"reused code", totpCode(rfc6238Secret, current), current, 0, false},
+		{"code older than the last one", totpCode(rfc6238Secret, current-1), current, 0, false},
+		{"code after the last one", totpCode(rfc6238Secret, current+1), current, current + 1, true},
+		{"wrong code", "000000", 0, 0, false},
+		{"too short", "05047", 0, 0, false},
+		{"too long", "0504711", 0, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			counter, ok := verifyTotp(rfc6238Secret, test.code, now, test.lastCounter)
+			if ok != test.wantOk || counter != test.wantCounter {
+				t.Errorf("verifyTotp(%q) = %d, %v, want %d, %v", test.code, counter, ok, test.wantCounter, test.wantOk)
+			}
+		})
+	}
+}
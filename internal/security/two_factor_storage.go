@@ -0,0 +1,151 @@
+package security
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+)
+
+type TwoFactorStorage struct {
+	database *sql.DB
+}
+
+func NewTwoFactorStorage(database *sql.DB) *TwoFactorStorage {
+	return &TwoFactorStorage{database}
+}
+
+func (this *TwoFactorStorage) FindTwoFactorByUserId(userId int) (entity.TwoFactor, error) {
+	var twoFactor entity.TwoFactor
+	query := `SELECT "UserId", "Secret", "Enabled", "LastCounter" FROM "TwoFactor" WHERE "UserId" = $1`
+	row := this.database.QueryRow(query, userId)
+	if err := row.Scan(&twoFactor.UserId, &twoFactor.Secret, &twoFactor.Enabled, &twoFactor.LastCounter); err != nil {
+		if err != sql.ErrNoRows {
+			log.Println(err.Error())
+		}
+
+		return twoFactor, err
+	}
+
+	return twoFactor, nil
+}
+
+func (this *TwoFactorStorage) IsTwoFactorEnabled(userId int) bool {
+	enabled := false
+	query := `SELECT EXISTS(SELECT 1 FROM "TwoFactor" WHERE "UserId" = $1 AND "Enabled" = true)`
+	row := this.database.QueryRow(query, userId)
+	if err := row.Scan(&enabled); err != nil {
+		log.Println(err.Error())
+		return false
+	}
+
+	return enabled
+}
+
+// UpsertPendingTwoFactor stores a new secret that is not yet enabled. Enabled secrets are never
+// replaced, enrollment has to be disabled first.
+func (this *TwoFactorStorage) UpsertPendingTwoFactor(twoFactor entity.TwoFactor) error {
+	query := `
+		INSERT INTO "TwoFactor" ("UserId", "Secret", "Enabled", "LastCounter") VALUES ($1, $2, false, 0)
+		ON CONFLICT ("UserId") DO UPDATE SET "Secret" = $2, "LastCounter" = 0 WHERE "TwoFactor"."Enabled" = false`
+	if _, err := this.database.Exec(query, twoFactor.UserId, twoFactor.Secret); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// UseCounter records the time step of an accepted code. The update only succeeds when the step is
+// newer than the last accepted one, which keeps concurrent requests from replaying the same code.
+func (this *TwoFactorStorage) UseCounter(userId int, counter int64) bool {
+	query := `UPDATE "TwoFactor" SET "LastCounter" = $2 WHERE "UserId" = $1 AND "LastCounter" < $2`
+	result, err := this.database.Exec(query, userId, counter)
+	if err != nil {
+		log.Println(err.Error())
+		return false
+	}
+
+	affected, err := result.RowsAffected()
+	return err == nil && affected == 1
+}
+
+// EnableTwoFactor turns on the pending secret and replaces the recovery codes of the user.
+func (this *TwoFactorStorage) EnableTwoFactor(userId int, recoveryCodeHashes [][]byte) error {
+	transaction, err := this.database.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer transaction.Rollback()
+
+	query := `UPDATE "TwoFactor" SET "Enabled" = true WHERE "UserId" = $1`
+	if _, err := transaction.Exec(query, userId); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	query = `DELETE FROM "RecoveryCodes" WHERE "UserId" = $1`
+	if _, err := transaction.Exec(query, userId); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	query = `INSERT INTO "RecoveryCodes" ("UserId", "Hash") VALUES ($1, $2)`
+	for _, hash := range recoveryCodeHashes {
+		if _, err := transaction.Exec(query, userId, hash); err != nil {
+			log.Println(err.Error())
+			return err
+		}
+	}
+
+	return transaction.Commit()
+}
+
+func (this *TwoFactorStorage) DeleteTwoFactor(userId int) error {
+	transaction, err := this.database.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer transaction.Rollback()
+
+	query := `DELETE FROM "RecoveryCodes" WHERE "UserId" = $1`
+	if _, err := transaction.Exec(query, userId); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	query = `DELETE FROM "TwoFactor" WHERE "UserId" = $1`
+	if _, err := transaction.Exec(query, userId); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	return transaction.Commit()
+}
+
+// UseRecoveryCode marks a matching unused code as used. It reports false when no code matched.
+func (this *TwoFactorStorage) UseRecoveryCode(userId int, hash []byte) bool {
+	query := `UPDATE "RecoveryCodes" SET "Used" = true WHERE "UserId" = $1 AND "Hash" = $2 AND "Used" = false`
+	result, err := this.database.Exec(query, userId, hash)
+	if err != nil {
+		log.Println(err.Error())
+		return false
+	}
+
+	affected, err := result.RowsAffected()
+	return err == nil && affected > 0
+}
+
+func (this *TwoFactorStorage) CountRecoveryCodes(userId int) int {
+	count := 0
+	query := `SELECT COUNT(*) FROM "RecoveryCodes" WHERE "UserId" = $1 AND "Used" = false`
+	row := this.database.QueryRow(query, userId)
+	if err := row.Scan(&count); err != nil {
+		log.Println(err.Error())
+		return 0
+	}
+
+	return count
+}
@@ -17,9 +17,9 @@ func NewUserStorage(database *sql.DB) *UserStorage {
 
 func (this *UserStorage) FindUserByName(name string) (entity.User, error) {
 	var user entity.User
-	query := `SELECT * FROM "Users" WHERE "Name" = $1`
+	query := `SELECT "Id", "Name", "Password", "Email", "Role", "TimeZone" FROM "Users" WHERE "Name" = $1`
 	row := this.database.QueryRow(query, name)
-	if err := row.Scan(&user.Id, &user.Name, &user.Key); err != nil {
+	if err := row.Scan(&user.Id, &user.Name, &user.Key, &user.Email, &user.Role, &user.TimeZone); err != nil {
 		if err != sql.ErrNoRows {
 			log.Println(err.Error())
 		}
@@ -32,9 +32,9 @@ func (this *UserStorage) FindUserByName(name string) (entity.User, error) {
 
 func (this *UserStorage) FindUserById(id int) (entity.User, error) {
 	var user entity.User
-	query := `SELECT * FROM "Users" WHERE "Id" = $1`
+	query := `SELECT "Id", "Name", "Password", "Email", "Role", "TimeZone" FROM "Users" WHERE "Id" = $1`
 	row := this.database.QueryRow(query, id)
-	if err := row.Scan(&user.Id, &user.Name, &user.Key); err != nil {
+	if err := row.Scan(&user.Id, &user.Name, &user.Key, &user.Email, &user.Role, &user.TimeZone); err != nil {
 		if err != sql.ErrNoRows {
 			log.Println(err.Error())
 		}
@@ -45,6 +45,9 @@ func (this *UserStorage) FindUserById(id int) (entity.User, error) {
 	return user, nil
 }
 
+// InsertUserIfNotExists adds the user and returns its id. The first user of the application is
+// made an admin so a fresh installation always has one. The table is locked for the duration of
+// the transaction so two concurrent registrations can't both become the first user.
 func (this *UserStorage) InsertUserIfNotExists(user entity.User) (int, error) {
 	transaction, err := this.database.Begin()
 	if err != nil {
@@ -53,9 +56,14 @@ func (this *UserStorage) InsertUserIfNotExists(user entity.User) (int, error) {
 
 	defer transaction.Rollback()
 
+	if _, err = transaction.Exec(`LOCK TABLE "Users" IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+
 	exists := false
 	findQuery := `SELECT EXISTS(SELECT 1 FROM "Users" WHERE "Name" = $1 )`
-	row := this.database.QueryRow(findQuery, user.Name)
+	row := transaction.QueryRow(findQuery, user.Name)
 	err = row.Scan(&exists)
 	if err != nil {
 		if err != sql.ErrNoRows {
@@ -69,9 +77,20 @@ func (this *UserStorage) InsertUserIfNotExists(user entity.User) (int, error) {
 		return 0, ErrUserAlreadyExists
 	}
 
-	userQuery := `INSERT INTO "Users" ("Name", "Password") VALUES ($1, $2) RETURNING "Id"`
+	isFirst := false
+	row = transaction.QueryRow(`SELECT NOT EXISTS(SELECT 1 FROM "Users")`)
+	if err = row.Scan(&isFirst); err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+
+	if isFirst {
+		user.Role = entity.RoleAdmin
+	}
+
+	userQuery := `INSERT INTO "Users" ("Name", "Password", "Email", "Role", "TimeZone") VALUES ($1, $2, $3, $4, $5) RETURNING "Id"`
 	id := 0
-	row = transaction.QueryRow(userQuery, &user.Name, &user.Key)
+	row = transaction.QueryRow(userQuery, &user.Name, &user.Key, &user.Email, &user.Role, &user.TimeZone)
 	if err := row.Scan(&id); err != nil {
 		log.Println(err.Error())
 		return 0, err
@@ -94,3 +113,71 @@ func (this *UserStorage) UpdateUserKey(user entity.User) error {
 
 	return nil
 }
+
+func (this *UserStorage) FindUsers() []entity.User {
+	var users []entity.User
+	query := `SELECT "Id", "Name", "Password", "Email", "Role", "TimeZone" FROM "Users" ORDER BY "Name" ASC`
+	rows, err := this.database.Query(query)
+	if err != nil {
+		log.Println(err.Error())
+		return users
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var user entity.User
+		if err := rows.Scan(&user.Id, &user.Name, &user.Key, &user.Email, &user.Role, &user.TimeZone); err != nil {
+			log.Println(err.Error())
+			return users
+		}
+
+		users = append(users, user)
+	}
+
+	return users
+}
+
+// UpdateUserRole changes the role of a user. Demoting the last admin is refused so the
+// application can't be left without one.
+func (this *UserStorage) UpdateUserRole(userId int, role string) error {
+	transaction, err := this.database.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer transaction.Rollback()
+
+	if _, err = transaction.Exec(`LOCK TABLE "Users" IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	query := `UPDATE "Users" SET "Role" = $2 WHERE "Id" = $1`
+	if _, err := transaction.Exec(query, userId, role); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	admins := 0
+	row := transaction.QueryRow(`SELECT COUNT(*) FROM "Users" WHERE "Role" = $1`, entity.RoleAdmin)
+	if err := row.Scan(&admins); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	if admins == 0 {
+		return ErrLastAdmin
+	}
+
+	return transaction.Commit()
+}
+
+func (this *UserStorage) UpdateUserTimeZone(userId int, timeZone string) error {
+	query := `UPDATE "Users" SET "TimeZone" = $2 WHERE "Id" = $1`
+	if _, err := this.database.Exec(query, userId, timeZone); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	return nil
+}
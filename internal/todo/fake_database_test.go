@@ -0,0 +1,150 @@
+package todo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeRows is the answer to a query, the column names and one slice of values per row.
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+// fakeHandler answers the statements the code under test runs, rows are ignored for Exec.
+type fakeHandler func(query string, args []driver.Value) (fakeRows, error)
+
+var (
+	fakeHandlers       = make(map[string]fakeHandler)
+	fakeHandlersLocker sync.Mutex
+	registerFakeDriver sync.Once
+)
+
+// newFakeDatabase opens a database whose statements are answered by the handler, so storage
+// can be exercised without a PostgreSQL server. Transactions reach the handler as BEGIN, COMMIT
+// and ROLLBACK statements.
+func newFakeDatabase(t *testing.T, handler fakeHandler) *sql.DB {
+	registerFakeDriver.Do(func() {
+		sql.Register("fake", fakeDriver{})
+	})
+
+	fakeHandlersLocker.Lock()
+	name := t.Name() + "#" + strconv.Itoa(len(fakeHandlers))
+	fakeHandlers[name] = handler
+	fakeHandlersLocker.Unlock()
+
+	database, err := sql.Open("fake", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeHandlersLocker.Lock()
+	defer fakeHandlersLocker.Unlock()
+	handler, ok := fakeHandlers[name]
+	if !ok {
+		return nil, errors.New("fake database " + name + " doesn't exist")
+	}
+
+	return &fakeConn{handler}, nil
+}
+
+type fakeConn struct {
+	handler fakeHandler
+}
+
+func (this *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fake database doesn't prepare statements")
+}
+
+func (this *fakeConn) Close() error {
+	return nil
+}
+
+func (this *fakeConn) Begin() (driver.Tx, error) {
+	if _, err := this.handler("BEGIN", nil); err != nil {
+		return nil, err
+	}
+
+	return fakeTx{this.handler}, nil
+}
+
+// CheckNamedValue takes arguments of any type, like the tag slices PostgreSQL reads as arrays.
+func (this *fakeConn) CheckNamedValue(value *driver.NamedValue) error {
+	return nil
+}
+
+func (this *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := this.handler(query, values(args))
+	if err != nil {
+		return nil, err
+	}
+
+	return &fakeRowsCursor{rows: rows}, nil
+}
+
+func (this *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if _, err := this.handler(query, values(args)); err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(1), nil
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, 0, len(args))
+	for _, arg := range args {
+		values = append(values, arg.Value)
+	}
+
+	return values
+}
+
+type fakeTx struct {
+	handler fakeHandler
+}
+
+func (this fakeTx) Commit() error {
+	_, err := this.handler("COMMIT", nil)
+	return err
+}
+
+func (this fakeTx) Rollback() error {
+	_, err := this.handler("ROLLBACK", nil)
+	return err
+}
+
+type fakeRowsCursor struct {
+	rows fakeRows
+	next int
+}
+
+func (this *fakeRowsCursor) Columns() []string {
+	return this.rows.columns
+}
+
+func (this *fakeRowsCursor) Close() error {
+	return nil
+}
+
+func (this *fakeRowsCursor) Next(destination []driver.Value) error {
+	if this.next >= len(this.rows.values) {
+		return io.EOF
+	}
+
+	copy(destination, this.rows.values[this.next])
+	this.next++
+	return nil
+}
@@ -0,0 +1,296 @@
+package todo
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+)
+
+// calendarHistoryDays is how long finished todos stay in the calendar feed after they were due.
+const calendarHistoryDays = 30
+
+// calendarEventDuration is how long the event of a todo due at a clock time lasts.
+const calendarEventDuration = 30 * time.Minute
+
+// maxCalendarLine is the longest line of an iCalendar file in octets, not counting the line break.
+const maxCalendarLine = 75
+
+const calendarProductId = "-//try-go-htmx//Todos//EN"
+
+const calendarUidDomain = "try-go-htmx"
+
+// Calendar is the feed of the dated todos of a user in the lists shared with them. With Events
+// set, the open todos are also written as events so calendars without task support show them.
+type Calendar struct {
+	Name   string
+	Zone   string
+	Events bool
+	Todos  []entity.ScheduledTodo
+}
+
+// FindCalendar returns the feed of the user: the open todos with a due date and the finished ones
+// due in the last days.
+func (this *TodoService) FindCalendar(user entity.User, events bool) (Calendar, error) {
+	since := entity.StartOfDay(time.Now().In(user.Location())).AddDate(0, 0, -calendarHistoryDays)
+	todos, err := this.attachScheduledTags(this.storage.findCalendarTodos(user.Id, since))
+	if err != nil {
+		return Calendar{}, err
+	}
+
+	return Calendar{
+		Name:   "Todos of " + user.Name,
+		Zone:   user.Location().String(),
+		Events: events,
+		Todos:  todos,
+	}, nil
+}
+
+// ETag identifies what the feed shows. It's weak since the stamps of the file change every time
+// it's written while the todos stay the same.
+func (this Calendar) ETag() (string, error) {
+	content, err := json.Marshal(this)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(content)
+	return `W/"` + hex.EncodeToString(hash[:16]) + `"`, nil
+}
+
+// Encode writes the feed as an RFC 5545 iCalendar file stamped with the time. Todos that repeat
+// are written without their rule, since the next occurrence is already a todo of its own once the
+// previous one is done.
+func (this Calendar) Encode(writer io.Writer, stamp time.Time) error {
+	calendar := newCalendarWriter(writer, stamp)
+	calendar.begin()
+	calendar.text("X-WR-CALNAME", this.Name)
+	calendar.line("X-WR-TIMEZONE", this.Zone)
+	calendar.line("REFRESH-INTERVAL;VALUE=DURATION", "PT15M")
+	calendar.line("X-PUBLISHED-TTL", "PT15M")
+	location, err := time.LoadLocation(this.Zone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	for _, todo := range this.Todos {
+		synced := entity.SyncedTodo{Todo: todo.Todo, Uid: calendarUid("todo", todo.Id)}
+		if todo.ParentId != 0 {
+			synced.ParentUid = calendarUid("todo", todo.ParentId)
+		}
+
+		synced.Recurrence = ""
+		calendar.todo(synced, append([]string{todo.ListName}, todo.Tags...), location)
+	}
+
+	if this.Events {
+		for _, todo := range this.Todos {
+			if !todo.Done {
+				calendar.event(todo, location)
+			}
+		}
+	}
+
+	calendar.line("END", "VCALENDAR")
+	return calendar.flush()
+}
+
+// calendarWriter writes the content lines of an iCalendar file, folding the long ones. The first
+// error is kept and returned by flush.
+type calendarWriter struct {
+	writer *bufio.Writer
+	stamp  string
+	err    error
+}
+
+func newCalendarWriter(writer io.Writer, stamp time.Time) *calendarWriter {
+	return &calendarWriter{writer: bufio.NewWriter(writer), stamp: formatCalendarTime(stamp)}
+}
+
+// EncodeSyncedTodo writes the todo as an iCalendar file of its own, the way sync clients read
+// it. Unlike the feed, the file keeps the recurrence rule so a client saving the todo back
+// doesn't drop it.
+func EncodeSyncedTodo(writer io.Writer, todo entity.SyncedTodo, location *time.Location, stamp time.Time) error {
+	calendar := newCalendarWriter(writer, stamp)
+	calendar.begin()
+	calendar.todo(todo, todo.Tags, location)
+	calendar.line("END", "VCALENDAR")
+	return calendar.flush()
+}
+
+// begin starts the calendar.
+func (this *calendarWriter) begin() {
+	this.line("BEGIN", "VCALENDAR")
+	this.line("VERSION", "2.0")
+	this.line("PRODID", calendarProductId)
+	this.line("CALSCALE", "GREGORIAN")
+}
+
+// todo writes the todo with the categories. A todo that repeats starts when it's due, since the
+// recurrence of a todo is counted from its start.
+func (this *calendarWriter) todo(todo entity.SyncedTodo, categories []string, location *time.Location) {
+	this.line("BEGIN", "VTODO")
+	this.line("UID", todo.Uid)
+	this.line("DTSTAMP", this.stamp)
+	this.text("SUMMARY", todo.Task)
+	if todo.Notes != "" {
+		this.text("DESCRIPTION", todo.Notes)
+	}
+
+	if todo.HasDue() {
+		if todo.Recurrence != "" {
+			this.due("DTSTART", todo.Todo, location)
+		}
+
+		this.due("DUE", todo.Todo, location)
+	}
+
+	if todo.Recurrence != "" {
+		this.line("RRULE", todo.Recurrence)
+	}
+
+	if todo.Done {
+		this.line("STATUS", "COMPLETED")
+		this.line("PERCENT-COMPLETE", "100")
+	} else {
+		this.line("STATUS", "NEEDS-ACTION")
+	}
+
+	if priority := calendarPriority(todo.Priority); priority != 0 {
+		this.line("PRIORITY", fmt.Sprint(priority))
+	}
+
+	if len(categories) > 0 {
+		this.categories(categories)
+	}
+
+	if todo.ParentUid != "" {
+		this.line("RELATED-TO", todo.ParentUid)
+	}
+
+	this.line("END", "VTODO")
+}
+
+func (this *calendarWriter) event(todo entity.ScheduledTodo, location *time.Location) {
+	this.line("BEGIN", "VEVENT")
+	this.line("UID", calendarUid("event", todo.Id))
+	this.line("DTSTAMP", this.stamp)
+	this.text("SUMMARY", todo.Task)
+	if todo.Notes != "" {
+		this.text("DESCRIPTION", todo.Notes)
+	}
+
+	this.due("DTSTART", todo.Todo, location)
+	end := todo.Todo
+	if end.DueHasTime {
+		end.Due = end.Due.Add(calendarEventDuration)
+	} else {
+		end.Due = end.Due.AddDate(0, 0, 1)
+	}
+
+	this.due("DTEND", end, location)
+	this.categories(append([]string{todo.ListName}, todo.Tags...))
+	this.line("RELATED-TO", calendarUid("todo", todo.Id))
+	this.line("END", "VEVENT")
+}
+
+// due writes the due date of the todo as a date, or as a time in UTC when it has a clock time. Due
+// times are wall clock times in the time zone of the user.
+func (this *calendarWriter) due(name string, todo entity.Todo, location *time.Location) {
+	if !todo.DueHasTime {
+		this.line(name+";VALUE=DATE", todo.Due.Format("20060102"))
+		return
+	}
+
+	due := time.Date(todo.Due.Year(), todo.Due.Month(), todo.Due.Day(), todo.Due.Hour(), todo.Due.Minute(), 0, 0, location)
+	this.line(name, formatCalendarTime(due))
+}
+
+// categories writes the names as one list, escaping each of them.
+func (this *calendarWriter) categories(names []string) {
+	escaped := make([]string, len(names))
+	for i, name := range names {
+		escaped[i] = escapeCalendarText(name)
+	}
+
+	this.line("CATEGORIES", strings.Join(escaped, ","))
+}
+
+// text writes a property whose value is text, escaping it.
+func (this *calendarWriter) text(name string, value string) {
+	this.line(name, escapeCalendarText(value))
+}
+
+// line writes a content line, folding it so no line is longer than maxCalendarLine octets. The
+// continuation lines start with a space and multi-byte characters are never split.
+func (this *calendarWriter) line(name string, value string) {
+	if this.err != nil {
+		return
+	}
+
+	content := name + ":" + value
+	limit := maxCalendarLine
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+
+		if _, this.err = this.writer.WriteString(content[:cut] + "\r\n "); this.err != nil {
+			return
+		}
+
+		content = content[cut:]
+		limit = maxCalendarLine - 1
+	}
+
+	_, this.err = this.writer.WriteString(content + "\r\n")
+}
+
+func (this *calendarWriter) flush() error {
+	if this.err != nil {
+		return this.err
+	}
+
+	return this.writer.Flush()
+}
+
+// calendarEscaper escapes the characters that have a meaning in iCalendar text values. Carriage
+// returns are dropped, line breaks are written as \n.
+var calendarEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", "")
+
+func escapeCalendarText(value string) string {
+	return calendarEscaper.Replace(value)
+}
+
+func formatCalendarTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// calendarUid names a todo the same way in every version of the feed, so calendar apps update
+// the item instead of adding a new one.
+func calendarUid(kind string, todoId int) string {
+	return fmt.Sprintf("%s-%d@%s", kind, todoId, calendarUidDomain)
+}
+
+// calendarPriority maps the priority of a todo to the iCalendar scale, where 1 is the highest and
+// 0 means undefined.
+func calendarPriority(priority int) int {
+	switch priority {
+	case entity.PriorityHigh:
+		return 1
+	case entity.PriorityMedium:
+		return 5
+	case entity.PriorityLow:
+		return 9
+	}
+
+	return 0
+}
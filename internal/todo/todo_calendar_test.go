@@ -0,0 +1,133 @@
+package todo
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+)
+
+func TestCalendarWriterFoldsLines(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"short", "short"},
+		{"exactly the limit", strings.Repeat("a", maxCalendarLine-len("X:"))},
+		{"one over the limit", strings.Repeat("a", maxCalendarLine-len("X:")+1)},
+		{"several lines", strings.Repeat("abcdefghij", 30)},
+		{"two byte runes", strings.Repeat("ä", 100)},
+		{"three byte runes", strings.Repeat("€", 100)},
+		{"four byte runes across the fold", strings.Repeat("a", 72) + strings.Repeat("😀", 40)},
+		{"mixed", strings.Repeat("aä€😀", 30)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			writer := newCalendarWriter(&buffer, time.Now())
+			writer.line("X", test.value)
+			if err := writer.flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			output := buffer.String()
+			if !strings.HasSuffix(output, "\r\n") {
+				t.Fatalf("line %q doesn't end in CRLF", output)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(output, "\r\n"), "\r\n")
+			for i, line := range lines {
+				if len(line) > maxCalendarLine {
+					t.Errorf("line %d is %d octets, want at most %d", i, len(line), maxCalendarLine)
+				}
+
+				if !utf8.ValidString(line) {
+					t.Errorf("line %d %q splits a rune", i, line)
+				}
+
+				if i > 0 && !strings.HasPrefix(line, " ") {
+					t.Errorf("continuation line %d %q doesn't start with a space", i, line)
+				}
+			}
+
+			unfolded := strings.ReplaceAll(strings.TrimSuffix(output, "\r\n"), "\r\n ", "")
+			if unfolded != "X:"+test.value {
+				t.Errorf("unfolded to %q, want %q", unfolded, "X:"+test.value)
+			}
+		})
+	}
+}
+
+func TestEscapeCalendarText(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"plain", "plain"},
+		{`back\slash`, `back\\slash`},
+		{"semi;colon", `semi\;colon`},
+		{"com,ma", `com\,ma`},
+		{"line\nbreak", `line\nbreak`},
+		{"windows\r\nbreak", `windows\nbreak`},
+		{"stray\rreturn", "strayreturn"},
+		{`all\;,` + "\n", `all\\\;\,\n`},
+		{`\n`, `\\n`},
+	}
+
+	for _, test := range tests {
+		if got := escapeCalendarText(test.value); got != test.want {
+			t.Errorf("escapeCalendarText(%q) = %q, want %q", test.value, got, test.want)
+		}
+
+		want := strings.ReplaceAll(strings.ReplaceAll(test.value, "\r\n", "\n"), "\r", "")
+		if got := unescapeCalendarText(escapeCalendarText(test.value)); got != want {
+			t.Errorf("unescapeCalendarText(%q) = %q, want %q", escapeCalendarText(test.value), got, want)
+		}
+	}
+}
+
+func TestCalendarETag(t *testing.T) {
+	due := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	calendar := Calendar{
+		Name: "Todos of someone",
+		Zone: "Europe/Helsinki",
+		Todos: []entity.ScheduledTodo{
+			{Todo: entity.Todo{Id: 1, Task: "water plants", Due: due, Tags: []string{}}, ListName: "Home"},
+		},
+	}
+
+	etag, err := calendar.ETag()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(etag, `W/"`) || !strings.HasSuffix(etag, `"`) {
+		t.Errorf("ETag %q isn't a weak entity tag", etag)
+	}
+
+	again, _ := calendar.ETag()
+	if again != etag {
+		t.Errorf("ETag changed from %q to %q for the same feed", etag, again)
+	}
+
+	changes := map[string]func(calendar *Calendar){
+		"done":   func(calendar *Calendar) { calendar.Todos[0].Done = true },
+		"task":   func(calendar *Calendar) { calendar.Todos[0].Task = "water the plants" },
+		"due":    func(calendar *Calendar) { calendar.Todos[0].Due = due.AddDate(0, 0, 1) },
+		"events": func(calendar *Calendar) { calendar.Events = true },
+		"zone":   func(calendar *Calendar) { calendar.Zone = "UTC" },
+	}
+
+	for name, change := range changes {
+		changed := calendar
+		changed.Todos = append([]entity.ScheduledTodo{}, calendar.Todos...)
+		change(&changed)
+		if changedTag, _ := changed.ETag(); changedTag == etag {
+			t.Errorf("ETag stayed %q when the %s changed", etag, name)
+		}
+	}
+}
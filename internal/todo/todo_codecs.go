@@ -0,0 +1,706 @@
+package todo
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+)
+
+var (
+	ErrUnknownFormat         = errors.New("Unknown file format.")
+	ErrSubtaskWithoutParent  = errors.New("Subtask has no todo above it to belong to.")
+	ErrMissingTaskColumn     = errors.New("The file has no task column.")
+	ErrInvalidTransferFormat = errors.New("The file could not be read in that format.")
+)
+
+// TransferList is a list with its todos as the codecs read and write it. Subtasks are nested in
+// their parent, ids and positions are left out. The name is empty when the file doesn't tell which
+// list the todos belong to.
+type TransferList struct {
+	Name  string
+	Todos []entity.Todo
+}
+
+// CountTodos counts the todos of the list, subtasks included.
+func (this TransferList) CountTodos() int {
+	count := 0
+	walkTodos(this.Todos, 0, func(todo entity.Todo, depth int) error {
+		count++
+		return nil
+	})
+
+	return count
+}
+
+// Codec reads and writes lists in a file format. Formats that can't hold every field of a todo
+// leave out what they can't hold.
+type Codec interface {
+	// Name identifies the format in urls and forms.
+	Name() string
+	Label() string
+	ContentType() string
+	Extension() string
+	Encode(writer io.Writer, lists []TransferList) error
+	Decode(reader io.Reader) ([]TransferList, error)
+}
+
+// JsonFormat is the format that keeps every field of the todos.
+const JsonFormat = "json"
+
+var codecs = []Codec{
+	jsonCodec{format{JsonFormat, "JSON", "application/json", "json"}},
+	csvCodec{format{"csv", "CSV", "text/csv; charset=utf-8", "csv"}},
+	markdownCodec{format{"markdown", "Markdown checklist", "text/markdown; charset=utf-8", "md"}},
+	todoTxtCodec{format{"todotxt", "todo.txt", "text/plain; charset=utf-8", "txt"}},
+}
+
+// format describes the file format of a codec.
+type format struct {
+	name        string
+	label       string
+	contentType string
+	extension   string
+}
+
+func (this format) Name() string {
+	return this.name
+}
+
+func (this format) Label() string {
+	return this.label
+}
+
+func (this format) ContentType() string {
+	return this.contentType
+}
+
+func (this format) Extension() string {
+	return this.extension
+}
+
+// Codecs returns the formats lists can be imported from and exported to.
+func Codecs() []Codec {
+	return codecs
+}
+
+func FindCodec(name string) (Codec, error) {
+	for _, codec := range codecs {
+		if codec.Name() == name {
+			return codec, nil
+		}
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+// Due dates are written as "2006-01-02" or "2006-01-02T15:04" in every format, like in the API.
+const (
+	transferDateFormat = "2006-01-02"
+	transferTimeFormat = "2006-01-02T15:04"
+)
+
+func formatDue(todo entity.Todo) string {
+	if todo.DueHasTime {
+		return todo.Due.Format(transferTimeFormat)
+	}
+
+	if todo.HasDue() {
+		return todo.Due.Format(transferDateFormat)
+	}
+
+	return ""
+}
+
+func parseDue(value string) (time.Time, bool, error) {
+	date, clock, _ := strings.Cut(strings.TrimSpace(value), "T")
+	return entity.ParseDue(date, clock)
+}
+
+// nest adds the todo at the depth, under the last todo of each level above it.
+func nest(todos []entity.Todo, todo entity.Todo, depth int) ([]entity.Todo, error) {
+	if depth == 0 {
+		return append(todos, todo), nil
+	}
+
+	if len(todos) == 0 {
+		return todos, ErrSubtaskWithoutParent
+	}
+
+	last := &todos[len(todos)-1]
+	subtasks, err := nest(last.Subtasks, todo, depth-1)
+	if err != nil {
+		return todos, err
+	}
+
+	last.Subtasks = subtasks
+	return todos, nil
+}
+
+// walkTodos calls visit with every todo of the tree and its depth, parents before their subtasks.
+func walkTodos(todos []entity.Todo, depth int, visit func(todo entity.Todo, depth int) error) error {
+	for _, todo := range todos {
+		if err := visit(todo, depth); err != nil {
+			return err
+		}
+
+		if err := walkTodos(todo.Subtasks, depth+1, visit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listIndex returns the index of the list with the name, adding the list when there's none yet.
+// Formats with a list name per todo use it to keep the lists in the order they first appear.
+func listIndex(lists *[]TransferList, name string) int {
+	index := slices.IndexFunc(*lists, func(list TransferList) bool { return list.Name == name })
+	if index < 0 {
+		*lists = append(*lists, TransferList{Name: name})
+		index = len(*lists) - 1
+	}
+
+	return index
+}
+
+func lineError(line int, err error) error {
+	return fmt.Errorf("Line %d: %w", line, err)
+}
+
+// jsonCodec keeps every field of the todos.
+type jsonCodec struct{ format }
+
+type jsonTodo struct {
+	Task       string     `json:"task"`
+	Done       bool       `json:"done"`
+	Due        string     `json:"due,omitempty"`
+	Priority   int        `json:"priority"`
+	Tags       []string   `json:"tags"`
+	Recurrence string     `json:"recurrence,omitempty"`
+	Notes      string     `json:"notes,omitempty"`
+	Subtasks   []jsonTodo `json:"subtasks,omitempty"`
+}
+
+type jsonList struct {
+	Name  string     `json:"name"`
+	Todos []jsonTodo `json:"todos"`
+}
+
+type jsonFile struct {
+	Lists []jsonList `json:"lists"`
+}
+
+func newJsonTodos(todos []entity.Todo) []jsonTodo {
+	jsonTodos := []jsonTodo{}
+	for _, todo := range todos {
+		tags := todo.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+
+		jsonTodos = append(jsonTodos, jsonTodo{
+			Task:       todo.Task,
+			Done:       todo.Done,
+			Due:        formatDue(todo),
+			Priority:   todo.Priority,
+			Tags:       tags,
+			Recurrence: todo.Recurrence,
+			Notes:      todo.Notes,
+			Subtasks:   newJsonTodos(todo.Subtasks),
+		})
+	}
+
+	return jsonTodos
+}
+
+func (this jsonTodo) todo() (entity.Todo, error) {
+	due, hasTime, err := parseDue(this.Due)
+	if err != nil {
+		return entity.Todo{}, fmt.Errorf("Todo %q: %w", this.Task, err)
+	}
+
+	todo := entity.Todo{
+		Task:       this.Task,
+		Done:       this.Done,
+		Due:        due,
+		DueHasTime: hasTime,
+		Priority:   this.Priority,
+		Tags:       this.Tags,
+		Recurrence: this.Recurrence,
+		Notes:      this.Notes,
+	}
+
+	for _, subtask := range this.Subtasks {
+		subtodo, err := subtask.todo()
+		if err != nil {
+			return todo, err
+		}
+
+		todo.Subtasks = append(todo.Subtasks, subtodo)
+	}
+
+	return todo, nil
+}
+
+func (this jsonCodec) Encode(writer io.Writer, lists []TransferList) error {
+	file := jsonFile{Lists: []jsonList{}}
+	for _, list := range lists {
+		file.Lists = append(file.Lists, jsonList{list.Name, newJsonTodos(list.Todos)})
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(file)
+}
+
+func (this jsonCodec) Decode(reader io.Reader) ([]TransferList, error) {
+	var file jsonFile
+	if err := json.NewDecoder(reader).Decode(&file); err != nil {
+		return nil, ErrInvalidTransferFormat
+	}
+
+	var lists []TransferList
+	for _, jsonList := range file.Lists {
+		list := TransferList{Name: jsonList.Name}
+		for _, jsonTodo := range jsonList.Todos {
+			todo, err := jsonTodo.todo()
+			if err != nil {
+				return nil, err
+			}
+
+			list.Todos = append(list.Todos, todo)
+		}
+
+		lists = append(lists, list)
+	}
+
+	return lists, nil
+}
+
+// csvCodec writes a row per todo, subtasks right after their parent with a greater depth. Tags are
+// separated by commas inside their column.
+type csvCodec struct{ format }
+
+var csvColumns = []string{"list", "depth", "task", "done", "due", "priority", "tags", "recurrence", "notes"}
+
+// csvFormulaStart holds the characters that make spreadsheets read a cell as a formula. Cells that
+// start with one are written after a quote, which spreadsheets show as text. Cells that start with
+// a quote get one too, so reading the file back only takes off the quotes that were added.
+const csvFormulaStart = "=+-@\t\r'"
+
+func escapeCsvCell(cell string) string {
+	if cell != "" && strings.ContainsRune(csvFormulaStart, rune(cell[0])) {
+		return "'" + cell
+	}
+
+	return cell
+}
+
+func unescapeCsvCell(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(csvFormulaStart, rune(cell[1])) {
+		return cell[1:]
+	}
+
+	return cell
+}
+
+func (this csvCodec) Encode(writer io.Writer, lists []TransferList) error {
+	csvWriter := csv.NewWriter(writer)
+	if err := csvWriter.Write(csvColumns); err != nil {
+		return err
+	}
+
+	for _, list := range lists {
+		err := walkTodos(list.Todos, 0, func(todo entity.Todo, depth int) error {
+			record := []string{
+				list.Name,
+				strconv.Itoa(depth),
+				todo.Task,
+				strconv.FormatBool(todo.Done),
+				formatDue(todo),
+				strings.ToLower(todo.PriorityLabel()),
+				strings.Join(todo.Tags, ", "),
+				todo.Recurrence,
+				todo.Notes,
+			}
+
+			for i := range record {
+				record[i] = escapeCsvCell(record[i])
+			}
+
+			return csvWriter.Write(record)
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// parsePriority reads a priority by its label or number, empty meaning none.
+func parsePriority(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return entity.PriorityNone, nil
+	}
+
+	for _, priority := range entity.Priorities {
+		if strings.EqualFold(value, entity.PriorityLabel(priority)) || value == strconv.Itoa(priority) {
+			return priority, nil
+		}
+	}
+
+	return 0, errors.New("Unknown priority.")
+}
+
+// Decode finds the columns by the header row, so they can come in any order. Only the task column
+// is required.
+func (this csvCodec) Decode(reader io.Reader) ([]TransferList, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, ErrInvalidTransferFormat
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	if _, ok := columns["task"]; !ok {
+		return nil, ErrMissingTaskColumn
+	}
+
+	var lists []TransferList
+	for line := 2; ; line++ {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, lineError(line, ErrInvalidTransferFormat)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return unescapeCsvCell(record[i])
+			}
+
+			return ""
+		}
+
+		todo := entity.Todo{Task: strings.TrimSpace(field("task")), Notes: field("notes"), Recurrence: field("recurrence")}
+		todo.Tags = entity.ParseTags(field("tags"))
+		if done := field("done"); done != "" {
+			if todo.Done, err = strconv.ParseBool(done); err != nil {
+				return nil, lineError(line, errors.New("Done is not true or false."))
+			}
+		}
+
+		if todo.Due, todo.DueHasTime, err = parseDue(field("due")); err != nil {
+			return nil, lineError(line, err)
+		}
+
+		if todo.Priority, err = parsePriority(field("priority")); err != nil {
+			return nil, lineError(line, err)
+		}
+
+		depth := 0
+		if value := field("depth"); value != "" {
+			if depth, err = strconv.Atoi(value); err != nil || depth < 0 {
+				return nil, lineError(line, errors.New("Depth is not a number."))
+			}
+		}
+
+		index := listIndex(&lists, field("list"))
+		if lists[index].Todos, err = nest(lists[index].Todos, todo, depth); err != nil {
+			return nil, lineError(line, err)
+		}
+	}
+
+	return lists, nil
+}
+
+// markdownCodec writes GitHub style checklists, a heading per list and subtasks indented under
+// their parent. Only the task and whether it's done are kept.
+type markdownCodec struct{ format }
+
+var (
+	markdownHeading = regexp.MustCompile(`^#+\s+(.*)$`)
+	markdownItem    = regexp.MustCompile(`^(\s*)[-*+]\s+\[([ xX])\]\s+(.*)$`)
+)
+
+func (this markdownCodec) Encode(writer io.Writer, lists []TransferList) error {
+	buffered := bufio.NewWriter(writer)
+	for i, list := range lists {
+		if i > 0 {
+			buffered.WriteString("\n")
+		}
+
+		fmt.Fprintf(buffered, "# %s\n\n", list.Name)
+		err := walkTodos(list.Todos, 0, func(todo entity.Todo, depth int) error {
+			mark := " "
+			if todo.Done {
+				mark = "x"
+			}
+
+			_, err := fmt.Fprintf(buffered, "%s- [%s] %s\n", strings.Repeat("  ", depth), mark, todo.Task)
+			return err
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return buffered.Flush()
+}
+
+// Decode nests an item under the closest item above it with less indentation, so both two and
+// four space indents work. Lines that are neither headings nor checklist items are skipped.
+func (this markdownCodec) Decode(reader io.Reader) ([]TransferList, error) {
+	var lists []TransferList
+	var indents []int
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if match := markdownHeading.FindStringSubmatch(text); match != nil {
+			lists = append(lists, TransferList{Name: strings.TrimSpace(match[1])})
+			indents = nil
+			continue
+		}
+
+		match := markdownItem.FindStringSubmatch(text)
+		if match == nil {
+			continue
+		}
+
+		if len(lists) == 0 {
+			lists = append(lists, TransferList{})
+		}
+
+		indent := len(strings.ReplaceAll(match[1], "\t", "    "))
+		for len(indents) > 0 && indents[len(indents)-1] >= indent {
+			indents = indents[:len(indents)-1]
+		}
+
+		todo := entity.Todo{Task: strings.TrimSpace(match[3]), Done: match[2] != " "}
+		last := &lists[len(lists)-1]
+		var err error
+		if last.Todos, err = nest(last.Todos, todo, len(indents)); err != nil {
+			return nil, lineError(line, err)
+		}
+
+		indents = append(indents, indent)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, ErrInvalidTransferFormat
+	}
+
+	return lists, nil
+}
+
+// todoTxtCodec writes the todo.txt format, a line per todo. Priorities High, Medium and Low are
+// written as (A), (B) and (C), or as pri:A on finished todos like the format suggests. Tags are
+// written as +projects, the list, due date and recurrence rule as list:, due: and rrule: values.
+// Spaces in tags and list names are escaped. Subtasks follow their parent with their depth as a
+// depth: value. Notes are left out, todo.txt has no place for them.
+type todoTxtCodec struct{ format }
+
+var (
+	todoTxtPriority = regexp.MustCompile(`^\(([A-Z])\)$`)
+	todoTxtDate     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+)
+
+// todoTxtKeys are the keys of the values the codec writes.
+var todoTxtKeys = []string{"list", "due", "rrule", "pri", "depth"}
+
+// escapeTodoTxtTask puts a backslash before the words of the task that would be read back as
+// something else: a tag, a value, or a mark, priority or date at the start of the line. Words
+// starting with a backslash get one too, so Decode only takes off the backslashes added here.
+func escapeTodoTxtTask(task string) string {
+	words := strings.Fields(task)
+	for i, word := range words {
+		key, value, _ := strings.Cut(word, ":")
+		escape := word[0] == '\\' ||
+			len(word) > 1 && (word[0] == '+' || word[0] == '@') ||
+			value != "" && slices.Contains(todoTxtKeys, key) ||
+			i == 0 && (word == "x" || todoTxtPriority.MatchString(word) || todoTxtDate.MatchString(word))
+		if escape {
+			words[i] = "\\" + word
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+func priorityLetter(priority int) string {
+	switch priority {
+	case entity.PriorityHigh:
+		return "A"
+	case entity.PriorityMedium:
+		return "B"
+	case entity.PriorityLow:
+		return "C"
+	default:
+		return ""
+	}
+}
+
+// letterPriority reads a todo.txt priority, letters after C are low as well.
+func letterPriority(letter string) int {
+	switch letter {
+	case "A":
+		return entity.PriorityHigh
+	case "B":
+		return entity.PriorityMedium
+	default:
+		return entity.PriorityLow
+	}
+}
+
+func (this todoTxtCodec) Encode(writer io.Writer, lists []TransferList) error {
+	buffered := bufio.NewWriter(writer)
+	for _, list := range lists {
+		err := walkTodos(list.Todos, 0, func(todo entity.Todo, depth int) error {
+			var fields []string
+			letter := priorityLetter(todo.Priority)
+			if todo.Done {
+				fields = append(fields, "x")
+			} else if letter != "" {
+				fields = append(fields, "("+letter+")")
+			}
+
+			fields = append(fields, escapeTodoTxtTask(todo.Task))
+			for _, tag := range todo.Tags {
+				fields = append(fields, "+"+url.PathEscape(tag))
+			}
+
+			if list.Name != "" {
+				fields = append(fields, "list:"+url.PathEscape(list.Name))
+			}
+
+			if due := formatDue(todo); due != "" {
+				fields = append(fields, "due:"+due)
+			}
+
+			if todo.Recurrence != "" {
+				fields = append(fields, "rrule:"+todo.Recurrence)
+			}
+
+			if todo.Done && letter != "" {
+				fields = append(fields, "pri:"+letter)
+			}
+
+			if depth > 0 {
+				fields = append(fields, "depth:"+strconv.Itoa(depth))
+			}
+
+			_, err := fmt.Fprintln(buffered, strings.Join(fields, " "))
+			return err
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return buffered.Flush()
+}
+
+// Decode reads the completion and creation dates of the format but doesn't keep them. Contexts
+// become tags like projects do, values with keys other than the ones written stay in the task. A
+// todo with a depth is nested under the last todo above it in its list with one less.
+func (this todoTxtCodec) Decode(reader io.Reader) ([]TransferList, error) {
+	var lists []TransferList
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+
+		var todo entity.Todo
+		dates := 1
+		if words[0] == "x" {
+			todo.Done = true
+			words = words[1:]
+			dates = 2
+		} else if match := todoTxtPriority.FindStringSubmatch(words[0]); match != nil {
+			todo.Priority = letterPriority(match[1])
+			words = words[1:]
+		}
+
+		for ; dates > 0 && len(words) > 0 && todoTxtDate.MatchString(words[0]); dates-- {
+			words = words[1:]
+		}
+
+		listName := ""
+		depth := 0
+		var task []string
+		for _, word := range words {
+			key, value, _ := strings.Cut(word, ":")
+			var err error
+			switch {
+			case word[0] == '\\':
+				task = append(task, word[1:])
+			case len(word) > 1 && (word[0] == '+' || word[0] == '@'):
+				tag, unescapeErr := url.PathUnescape(word[1:])
+				if unescapeErr != nil {
+					tag = word[1:]
+				}
+
+				todo.Tags = append(todo.Tags, tag)
+			case key == "list" && value != "":
+				if listName, err = url.PathUnescape(value); err != nil {
+					listName = value
+				}
+			case key == "due" && value != "":
+				if todo.Due, todo.DueHasTime, err = parseDue(value); err != nil {
+					return nil, lineError(line, err)
+				}
+			case key == "rrule" && value != "":
+				todo.Recurrence = value
+			case key == "pri" && len(value) == 1 && value >= "A" && value <= "Z":
+				todo.Priority = letterPriority(value)
+			case key == "depth" && value != "":
+				if depth, err = strconv.Atoi(value); err != nil || depth < 0 {
+					return nil, lineError(line, errors.New("Depth is not a number."))
+				}
+			default:
+				task = append(task, word)
+			}
+		}
+
+		todo.Task = strings.Join(task, " ")
+		todo.Tags = entity.ParseTags(strings.Join(todo.Tags, ","))
+		index := listIndex(&lists, listName)
+		var err error
+		if lists[index].Todos, err = nest(lists[index].Todos, todo, depth); err != nil {
+			return nil, lineError(line, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, ErrInvalidTransferFormat
+	}
+
+	return lists, nil
+}
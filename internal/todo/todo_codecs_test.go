@@ -0,0 +1,170 @@
+package todo
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+)
+
+// transferTestLists has the tasks, tags and names the formats have to escape to read them back.
+func transferTestLists() []TransferList {
+	return []TransferList{
+		{
+			Name: "Home & garden",
+			Todos: []entity.Todo{
+				{
+					Task:       "water +plants @home",
+					Due:        time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+					Priority:   entity.PriorityHigh,
+					Tags:       []string{"garden", "with space"},
+					Recurrence: "FREQ=WEEKLY",
+					Notes:      "=HYPERLINK(\"https://example.com\")\nsecond line",
+					Subtasks: []entity.Todo{
+						{
+							Task:     "child +notatag",
+							Done:     true,
+							Priority: entity.PriorityMedium,
+							Tags:     []string{},
+							Subtasks: []entity.Todo{
+								{Task: "grandchild due:tomorrow list:other", Tags: []string{"-minus"}},
+							},
+						},
+						{Task: "second child", Tags: []string{}},
+					},
+				},
+				{Task: "x marks the spot", Tags: []string{}},
+				{Task: "(A) isn't a priority", Tags: []string{}},
+				{Task: "2024-01-01 isn't a date", Tags: []string{}},
+			},
+		},
+		{
+			Name: "=cmd|' /C calc'!A0",
+			Todos: []entity.Todo{
+				{
+					Task:       "=SUM(A1:A2)",
+					Due:        time.Date(2024, time.March, 1, 14, 30, 0, 0, time.UTC),
+					DueHasTime: true,
+					Tags:       []string{"=eq", "@at"},
+				},
+				{Task: "-minus", Done: true, Priority: entity.PriorityLow, Tags: []string{}},
+				{Task: "+plus", Tags: []string{}},
+				{Task: "@at", Tags: []string{}},
+				{Task: "'quoted", Tags: []string{}},
+				{Task: `\backslash`, Tags: []string{}},
+			},
+		},
+	}
+}
+
+// keepTodos applies keep to every todo of the lists, subtasks included.
+func keepTodos(lists []TransferList, keep func(todo entity.Todo) entity.Todo) []TransferList {
+	var kept []TransferList
+	for _, list := range lists {
+		kept = append(kept, TransferList{Name: list.Name, Todos: keepSubtasks(list.Todos, keep)})
+	}
+
+	return kept
+}
+
+func keepSubtasks(todos []entity.Todo, keep func(todo entity.Todo) entity.Todo) []entity.Todo {
+	var kept []entity.Todo
+	for _, todo := range todos {
+		subtasks := keepSubtasks(todo.Subtasks, keep)
+		todo = keep(todo)
+		todo.Subtasks = subtasks
+		kept = append(kept, todo)
+	}
+
+	return kept
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		keep func(todo entity.Todo) entity.Todo
+	}{
+		{JsonFormat, func(todo entity.Todo) entity.Todo { return todo }},
+		{"csv", func(todo entity.Todo) entity.Todo { return todo }},
+		{"markdown", func(todo entity.Todo) entity.Todo {
+			return entity.Todo{Task: todo.Task, Done: todo.Done}
+		}},
+		{"todotxt", func(todo entity.Todo) entity.Todo {
+			todo.Notes = ""
+			return todo
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			codec, err := FindCodec(test.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buffer bytes.Buffer
+			if err = codec.Encode(&buffer, transferTestLists()); err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+
+			decoded, err := codec.Decode(strings.NewReader(buffer.String()))
+			if err != nil {
+				t.Fatalf("Decode: %v\n%s", err, buffer.String())
+			}
+
+			want := keepTodos(transferTestLists(), test.keep)
+			if got := keepTodos(decoded, test.keep); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v\nwant %+v\nfrom\n%s", got, want, buffer.String())
+			}
+		})
+	}
+}
+
+func TestCsvEncodeEscapesFormulas(t *testing.T) {
+	codec, _ := FindCodec("csv")
+	var buffer bytes.Buffer
+	if err := codec.Encode(&buffer, transferTestLists()); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&buffer).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, record := range records {
+		for _, cell := range record {
+			if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+				t.Errorf("cell %q starts a formula", cell)
+			}
+		}
+	}
+}
+
+func TestTodoTxtEncodeEscapesTask(t *testing.T) {
+	tests := []struct {
+		task string
+		want string
+	}{
+		{"child +notatag", `child \+notatag`},
+		{"call @home", `call \@home`},
+		{"a + b", "a + b"},
+		{"due:tomorrow", `\due:tomorrow`},
+		{"note: colon", "note: colon"},
+		{"x marks", `\x marks`},
+		{"(B) first", `\(B) first`},
+		{"2024-01-01 first", `\2024-01-01 first`},
+		{"mid x (B) 2024-01-01", "mid x (B) 2024-01-01"},
+		{`\backslash`, `\\backslash`},
+	}
+
+	for _, test := range tests {
+		if got := escapeTodoTxtTask(test.task); got != test.want {
+			t.Errorf("escapeTodoTxtTask(%q) = %q, want %q", test.task, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package todo
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrorStatus maps the errors of the todo service to HTTP status codes so every client answers
+// the same error with the same status. Other errors get the fallback.
+func ErrorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, ErrListNotFound), errors.Is(err, ErrTodoNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrForbidden), errors.Is(err, ErrReadOnly), errors.Is(err, ErrNotListOwner):
+		return http.StatusForbidden
+	case errors.Is(err, ErrInvalidMove), errors.Is(err, ErrCursorInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrCalendarInvalid), errors.Is(err, ErrCalendarNoTodo), errors.Is(err, ErrUidChanged):
+		return http.StatusBadRequest
+	default:
+		return fallback
+	}
+}
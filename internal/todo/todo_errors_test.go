@@ -0,0 +1,35 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"list not found", ErrListNotFound, http.StatusNotFound},
+		{"todo not found", ErrTodoNotFound, http.StatusNotFound},
+		{"forbidden", ErrForbidden, http.StatusForbidden},
+		{"read only", ErrReadOnly, http.StatusForbidden},
+		{"not list owner", ErrNotListOwner, http.StatusForbidden},
+		{"invalid move", ErrInvalidMove, http.StatusBadRequest},
+		{"invalid cursor", ErrCursorInvalid, http.StatusBadRequest},
+		{"invalid calendar", ErrCalendarInvalid, http.StatusBadRequest},
+		{"wrapped", fmt.Errorf("move: %w", ErrTodoNotFound), http.StatusNotFound},
+		{"other", errors.New("Database is down."), http.StatusTeapot},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ErrorStatus(test.err, http.StatusTeapot); got != test.want {
+				t.Errorf("ErrorStatus(%v) = %d, want %d", test.err, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package todo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// todoEventChannel is the Postgres channel todo events are sent on.
+const todoEventChannel = "todo_events"
+
+const (
+	// eventBufferSize is how many events a subscriber can fall behind before it's dropped.
+	eventBufferSize = 32
+	// eventRetryDelay is how long the hub waits before listening again after losing its connection.
+	eventRetryDelay = 5 * time.Second
+)
+
+// TodoEvent tells the subscribers of a list that it changed. TodoId is the todo that changed in
+// place, it's zero when todos were added, removed or moved and the whole list has to be shown
+// again.
+type TodoEvent struct {
+	ListId int `json:"listId"`
+	TodoId int `json:"todoId"`
+}
+
+// EventHub passes todo events from Postgres to the subscribers in this process. Events are sent
+// with NOTIFY by whichever instance changed the list, so every instance gets them.
+type EventHub struct {
+	database    *sql.DB
+	context     context.Context
+	cancel      context.CancelFunc
+	mutex       sync.Mutex
+	subscribers map[int]map[chan TodoEvent]bool
+}
+
+func NewEventHub(database *sql.DB) *EventHub {
+	running, cancel := context.WithCancel(context.Background())
+	return &EventHub{
+		database:    database,
+		context:     running,
+		cancel:      cancel,
+		subscribers: make(map[int]map[chan TodoEvent]bool),
+	}
+}
+
+// Run listens for events until the hub is closed. When the connection is lost it listens again
+// after a delay.
+func (this *EventHub) Run() {
+	for this.context.Err() == nil {
+		if err := this.listen(); err != nil && this.context.Err() == nil {
+			log.Println(err.Error())
+		}
+
+		select {
+		case <-this.context.Done():
+		case <-time.After(eventRetryDelay):
+		}
+	}
+}
+
+// Close stops listening and ends every subscription, so open streams finish before the server
+// shuts down.
+func (this *EventHub) Close() {
+	this.cancel()
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for _, subscribers := range this.subscribers {
+		for events := range subscribers {
+			close(events)
+		}
+	}
+
+	this.subscribers = make(map[int]map[chan TodoEvent]bool)
+}
+
+func (this *EventHub) listen() error {
+	connection, err := this.database.Conn(this.context)
+	if err != nil {
+		return err
+	}
+
+	defer connection.Close()
+	var listenErr error
+	connection.Raw(func(driverConnection any) error {
+		pgxConnection, ok := driverConnection.(*stdlib.Conn)
+		if !ok {
+			listenErr = errors.New("Todo events need a pgx connection.")
+			return nil
+		}
+
+		listenErr = this.receive(pgxConnection.Conn())
+		// the connection is still listening, so it's dropped instead of going back to the pool
+		return driver.ErrBadConn
+	})
+
+	return listenErr
+}
+
+func (this *EventHub) receive(connection *pgx.Conn) error {
+	if _, err := connection.Exec(this.context, "LISTEN "+todoEventChannel); err != nil {
+		return err
+	}
+
+	// events sent while the hub wasn't listening are lost, so every list is shown again
+	this.dispatchToAll()
+	for {
+		notification, err := connection.WaitForNotification(this.context)
+		if err != nil {
+			return err
+		}
+
+		var event TodoEvent
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			log.Println(err.Error())
+			continue
+		}
+
+		this.dispatch(event)
+	}
+}
+
+// subscribe returns the events of the list until unsubscribe is called. The channel is closed when
+// the subscriber falls too far behind or the hub closes.
+func (this *EventHub) subscribe(listId int) (<-chan TodoEvent, func()) {
+	events := make(chan TodoEvent, eventBufferSize)
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if this.context.Err() != nil {
+		close(events)
+		return events, func() {}
+	}
+
+	if this.subscribers[listId] == nil {
+		this.subscribers[listId] = make(map[chan TodoEvent]bool)
+	}
+
+	this.subscribers[listId][events] = true
+	return events, func() {
+		this.mutex.Lock()
+		defer this.mutex.Unlock()
+		this.remove(listId, events)
+	}
+}
+
+// remove ends a subscription unless it has already ended. The mutex must be held.
+func (this *EventHub) remove(listId int, events chan TodoEvent) {
+	if !this.subscribers[listId][events] {
+		return
+	}
+
+	delete(this.subscribers[listId], events)
+	if len(this.subscribers[listId]) == 0 {
+		delete(this.subscribers, listId)
+	}
+
+	close(events)
+}
+
+// dispatch hands the event to the subscribers of its list without waiting for them. A subscriber
+// with a full buffer is dropped, its stream ends and the client connects again.
+func (this *EventHub) dispatch(event TodoEvent) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	for events := range this.subscribers[event.ListId] {
+		select {
+		case events <- event:
+		default:
+			this.remove(event.ListId, events)
+		}
+	}
+}
+
+func (this *EventHub) dispatchToAll() {
+	this.mutex.Lock()
+	listIds := make([]int, 0, len(this.subscribers))
+	for listId := range this.subscribers {
+		listIds = append(listIds, listId)
+	}
+
+	this.mutex.Unlock()
+	for _, listId := range listIds {
+		this.dispatch(TodoEvent{ListId: listId})
+	}
+}
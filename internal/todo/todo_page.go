@@ -0,0 +1,241 @@
+package todo
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+)
+
+// Pages of a list hold todoPageSize top level todos with their subtasks, pages of lists hold
+// listPageSize lists.
+const (
+	todoPageSize = 50
+	listPageSize = 50
+)
+
+// maxReloadedPages is how many pages a list rendered again shows at most.
+const maxReloadedPages = 20
+
+var ErrCursorInvalid = errors.New("Page cursor is invalid.")
+
+// TodoCursor is the key of a top level todo in the order of its list. Pages start after a cursor,
+// so todos added or moved elsewhere in the list don't shift the pages that follow. The zero value
+// is the start of the list.
+type TodoCursor struct {
+	Position int64
+	Id       int
+}
+
+func (this TodoCursor) IsZero() bool {
+	return this.Id == 0
+}
+
+// String encodes the cursor for urls, the zero cursor as an empty string.
+func (this TodoCursor) String() string {
+	if this.IsZero() {
+		return ""
+	}
+
+	return strconv.FormatInt(this.Position, 10) + ":" + strconv.Itoa(this.Id)
+}
+
+// ParseTodoCursor reads a cursor encoded with String. An empty string is the zero cursor.
+func ParseTodoCursor(text string) (TodoCursor, error) {
+	if text == "" {
+		return TodoCursor{}, nil
+	}
+
+	maybePosition, maybeId, found := strings.Cut(text, ":")
+	position, positionErr := strconv.ParseInt(maybePosition, 10, 64)
+	id, idErr := strconv.Atoi(maybeId)
+	if !found || positionErr != nil || idErr != nil || id <= 0 {
+		return TodoCursor{}, ErrCursorInvalid
+	}
+
+	return TodoCursor{position, id}, nil
+}
+
+// TodoPage is a page of the top level todos of a list with their subtasks nested under them. Next
+// is the last top level todo of the page when more are left and Last the last one either way.
+// Total counts every todo matching the filter, subtasks included, and is only read for the first
+// page.
+type TodoPage struct {
+	Todos []entity.Todo
+	Next  TodoCursor
+	Last  TodoCursor
+	Total int
+}
+
+// FindTodoPage returns the page of the todos of the list matching the filter that starts after
+// the after cursor. When through is set the page runs on up to and including that todo, so a list
+// can be rendered again with the pages loaded so far, at most maxReloadedPages of them.
+func (this *TodoService) FindTodoPage(user entity.User, listId int, filter TodoFilter, after TodoCursor, through TodoCursor) (TodoPage, error) {
+	if err := this.explainMissingList(user, listId, accessRead); err != nil {
+		return TodoPage{}, err
+	}
+
+	// the page is read as usual first, so it isn't empty when the through todo is gone
+	keys, more, err := this.readTodoKeys(user, listId, filter, after, TodoCursor{}, todoPageSize)
+	if err == nil && more && !through.IsZero() {
+		var rest []TodoCursor
+		rest, _, err = this.readTodoKeys(user, listId, filter, keys[len(keys)-1], through, (maxReloadedPages-1)*todoPageSize)
+		if err == nil && len(rest) > 0 {
+			keys = append(keys, rest...)
+			_, more, err = this.readTodoKeys(user, listId, filter, keys[len(keys)-1], TodoCursor{}, 0)
+		}
+	}
+
+	if err != nil {
+		return TodoPage{}, err
+	}
+
+	var page TodoPage
+	todoIds := make([]int, 0, len(keys))
+	for _, key := range keys {
+		todoIds = append(todoIds, key.Id)
+	}
+
+	if len(keys) > 0 {
+		page.Last = keys[len(keys)-1]
+	}
+
+	if more {
+		page.Next = page.Last
+	}
+
+	todos, err := this.storage.findTodosUnder(listId, user.Id, filter, todoIds)
+	if err != nil {
+		return TodoPage{}, err
+	}
+
+	if err = this.attachTags(todos); err != nil {
+		return TodoPage{}, err
+	}
+
+	page.Todos = buildTodoTree(todos)
+	if after.IsZero() {
+		page.Total, err = this.storage.countTodos(listId, user.Id, filter)
+	}
+
+	return page, err
+}
+
+// readTodoKeys returns at most limit keys of top level todos and whether more are left. One more
+// key than the limit is read to tell.
+func (this *TodoService) readTodoKeys(user entity.User, listId int, filter TodoFilter, after TodoCursor, through TodoCursor, limit int) ([]TodoCursor, bool, error) {
+	keys, err := this.storage.findTopTodoKeys(listId, user.Id, filter, after, through, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(keys) > limit {
+		return keys[:limit], true, nil
+	}
+
+	return keys, false, nil
+}
+
+// ListCursor is the key of a list in the order of FindLists, the lists of the user by name followed
+// by the lists shared with them by name. The zero value is the start.
+type ListCursor struct {
+	Shared bool
+	Name   string
+	Id     int
+}
+
+func newListCursor(list entity.TodoList) ListCursor {
+	return ListCursor{!list.IsOwner(), list.Name, list.Id}
+}
+
+func (this ListCursor) IsZero() bool {
+	return this.Id == 0
+}
+
+// String encodes the cursor for urls, the zero cursor as an empty string. The name goes last since
+// it may hold the separator.
+func (this ListCursor) String() string {
+	if this.IsZero() {
+		return ""
+	}
+
+	return strconv.FormatBool(this.Shared) + ":" + strconv.Itoa(this.Id) + ":" + this.Name
+}
+
+// ParseListCursor reads a cursor encoded with String. An empty string is the zero cursor.
+func ParseListCursor(text string) (ListCursor, error) {
+	if text == "" {
+		return ListCursor{}, nil
+	}
+
+	parts := strings.SplitN(text, ":", 3)
+	if len(parts) != 3 {
+		return ListCursor{}, ErrCursorInvalid
+	}
+
+	shared, sharedErr := strconv.ParseBool(parts[0])
+	id, idErr := strconv.Atoi(parts[1])
+	if sharedErr != nil || idErr != nil || id <= 0 {
+		return ListCursor{}, ErrCursorInvalid
+	}
+
+	return ListCursor{shared, parts[2], id}, nil
+}
+
+// ListPage is a page of the lists of the user. Next is the last list of the page when more are
+// left and Last the last one either way. Total counts every list and is only read for the first
+// page.
+type ListPage struct {
+	Lists []entity.TodoList
+	Next  ListCursor
+	Last  ListCursor
+	Total int
+}
+
+// FindListPage returns the page of the lists of the user that starts after the after cursor. When
+// through is set the page runs on up to and including that list, like with FindTodoPage.
+func (this *TodoService) FindListPage(user entity.User, after ListCursor, through ListCursor) (ListPage, error) {
+	lists, more, err := this.readLists(user, after, ListCursor{}, listPageSize)
+	if err == nil && more && !through.IsZero() {
+		var rest []entity.TodoList
+		rest, _, err = this.readLists(user, newListCursor(lists[len(lists)-1]), through, (maxReloadedPages-1)*listPageSize)
+		if err == nil && len(rest) > 0 {
+			lists = append(lists, rest...)
+			_, more, err = this.readLists(user, newListCursor(lists[len(lists)-1]), ListCursor{}, 0)
+		}
+	}
+
+	if err != nil {
+		return ListPage{}, err
+	}
+
+	page := ListPage{Lists: lists}
+	if len(lists) > 0 {
+		page.Last = newListCursor(lists[len(lists)-1])
+	}
+
+	if more {
+		page.Next = page.Last
+	}
+
+	if after.IsZero() {
+		page.Total, err = this.storage.countTodoLists(user.Id)
+	}
+
+	return page, err
+}
+
+// readLists returns at most limit lists and whether more are left, like readTodoKeys.
+func (this *TodoService) readLists(user entity.User, after ListCursor, through ListCursor, limit int) ([]entity.TodoList, bool, error) {
+	lists, err := this.storage.findTodoListPage(user.Id, after, through, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(lists) > limit {
+		return lists[:limit], true, nil
+	}
+
+	return lists, false, nil
+}
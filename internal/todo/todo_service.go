@@ -1,165 +1,1530 @@
 package todo
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"errors"
+	"math"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/skaisanlahti/try-go-htmx/internal/entity"
 )
 
+var (
+	ErrListNotFound      = errors.New("Todo list not found.")
+	ErrTodoNotFound      = errors.New("Todo not found.")
+	ErrForbidden         = errors.New("Todo list belongs to another user.")
+	ErrListAlreadyExists = errors.New("You already have a list with that name.")
+	ErrInvalidMove       = errors.New("Todos can only be moved next to todos of the same list and parent.")
+	ErrSubtaskTooDeep    = errors.New("Subtasks can't be nested any deeper.")
+	ErrReadOnly          = errors.New("You can only view this todo list.")
+	ErrNotListOwner      = errors.New("Only the owner of the todo list can do that.")
+	ErrMemberNotFound    = errors.New("User not found.")
+	ErrInvalidListRole   = errors.New("Todo lists can only be shared with editors and viewers.")
+	ErrShareWithOwner    = errors.New("You already own this todo list.")
+	ErrOwnerCantLeave    = errors.New("The owner can't leave their own todo list.")
+	ErrNothingSelected   = errors.New("Select some todos first.")
+	ErrNoMoveTarget      = errors.New("Choose the list to move the todos to.")
+	ErrMoveToSameList    = errors.New("The todos are already in that list.")
+)
+
+// upcomingDays is how many days after today the upcoming view covers.
+const upcomingDays = 7
+
+// activityPageSize is how many entries of the activity log of a list are read at a time.
+const activityPageSize = 50
+
+// trashPurgeInterval is how often the trash is checked for lists and todos past their retention.
+const trashPurgeInterval = time.Hour
+
+// Searches return at most maxSearchResults todos, longer queries are cut to maxSearchLength.
+const (
+	maxSearchResults = 50
+	maxSearchLength  = 200
+)
+
+// TodoDetails holds the optional fields of a todo set through the add and edit forms.
+type TodoDetails struct {
+	Due        time.Time
+	DueHasTime bool
+	Priority   int
+	Tags       []string
+	Recurrence string
+}
+
+// apply sets the details on the todo. A valid recurrence rule is stored in its normal form, an
+// invalid one is left for Validate to report.
+func (this TodoDetails) apply(todo entity.Todo) entity.Todo {
+	todo.Due = this.Due
+	todo.DueHasTime = this.DueHasTime && !this.Due.IsZero()
+	todo.Priority = this.Priority
+	todo.Tags = this.Tags
+	if todo.Tags == nil {
+		todo.Tags = []string{}
+	}
+
+	todo.Recurrence = strings.TrimSpace(this.Recurrence)
+	if recurrence, err := entity.ParseRecurrence(todo.Recurrence); todo.Recurrence != "" && err == nil {
+		todo.Recurrence = recurrence.String()
+	}
+
+	return todo
+}
+
+const (
+	DoneAny  = ""
+	DoneOpen = "open"
+	DoneDone = "done"
+)
+
+// TodoFilter narrows down the todos of a list. The zero value matches every todo.
+type TodoFilter struct {
+	Tag string
+	// Priority matches todos with the priority or a higher one.
+	Priority int
+	Done     string
+}
+
+type TodoOptions struct {
+	// MaxSubtaskDepth is how many levels of subtasks a todo can have, zero turns subtasks off.
+	MaxSubtaskDepth int
+	// CompleteParents marks a todo done when all of its subtasks are done and open again when one
+	// of them is opened.
+	CompleteParents bool
+	// TrashRetention is how long removed lists and todos stay in the trash before they are deleted
+	// for good, zero keeps them until the user deletes them.
+	TrashRetention time.Duration
+}
+
+// TodoService runs every operation on behalf of a user. Lists and todos not shared with the user
+// are filtered out by the queries themselves and reported as ErrForbidden. Members without the
+// role an operation needs get ErrReadOnly or ErrNotListOwner. Every change to the todos of a list
+// is published to the subscribers of the list through the event hub.
 type TodoService struct {
-	database *sql.DB
+	storage *todoStorage
+	events  *EventHub
+	options TodoOptions
+}
+
+func NewTodoService(database *sql.DB, events *EventHub, options TodoOptions) *TodoService {
+	return &TodoService{newTodoStorage(database), events, options}
+}
+
+// SubscribeToList returns the changes to a list shared with the user as they happen, until
+// unsubscribe is called. The channel is closed early when the subscriber falls behind or the
+// server shuts down.
+func (this *TodoService) SubscribeToList(user entity.User, listId int) (<-chan TodoEvent, func(), error) {
+	if err := this.explainMissingList(user, listId, accessRead); err != nil {
+		return nil, nil, err
+	}
+
+	events, unsubscribe := this.events.subscribe(listId)
+	return events, unsubscribe, nil
+}
+
+// access is what an operation needs to be allowed to do with a list.
+type access int
+
+const (
+	accessRead access = iota
+	accessEdit
+	accessOwn
+)
+
+func (this access) allows(role string) bool {
+	switch this {
+	case accessRead:
+		return role != ""
+	case accessEdit:
+		return role == entity.ListRoleOwner || role == entity.ListRoleEditor
+	default:
+		return role == entity.ListRoleOwner
+	}
 }
 
-func NewTodoService(database *sql.DB) *TodoService {
-	return &TodoService{database}
+// deny returns the error for a user whose role in the list doesn't allow the access.
+func (this access) deny(role string) error {
+	switch {
+	case role == "":
+		return ErrForbidden
+	case this == accessOwn:
+		return ErrNotListOwner
+	default:
+		return ErrReadOnly
+	}
 }
 
-func (this *TodoService) FindListById(listId int) (entity.TodoList, error) {
-	var todoList entity.TodoList
-	query := `SELECT * FROM "TodoLists" WHERE "Id" = $1`
-	row := this.database.QueryRow(query, listId)
-	if err := row.Scan(&todoList.Id, &todoList.Name, &todoList.UserId); err != nil {
-		log.Println(err.Error())
-		return todoList, err
+// explainMissingList tells why a member scoped query found no list. It returns nil only when the
+// list exists and the role of the user allows the access, so it also guards queries that aren't
+// scoped to the user.
+func (this *TodoService) explainMissingList(user entity.User, listId int, need access) error {
+	role, err := this.storage.findListRole(listId, user.Id)
+	if err != nil {
+		return err
+	}
+
+	if !need.allows(role) {
+		return need.deny(role)
 	}
 
-	return todoList, nil
+	return nil
 }
 
-func (this *TodoService) FindListsByUserId(userId int) []entity.TodoList {
-	var todoLists []entity.TodoList
-	query := `SELECT * FROM "TodoLists" WHERE "UserId" = $1 ORDER BY "Name" ASC`
-	rows, err := this.database.Query(query, userId)
+// explainMissingTodo tells why a member scoped query found no todo. A todo that was removed
+// between the queries is reported as not found.
+func (this *TodoService) explainMissingTodo(user entity.User, todoId int, need access) error {
+	role, err := this.storage.findTodoRole(todoId, user.Id)
 	if err != nil {
-		log.Println(err.Error())
-		return todoLists
+		return err
 	}
 
-	defer rows.Close()
-	for rows.Next() {
-		var list entity.TodoList
-		if err := rows.Scan(&list.Id, &list.Name, &list.UserId); err != nil {
-			log.Println(err.Error())
-			return todoLists
+	if !need.allows(role) {
+		return need.deny(role)
+	}
+
+	return ErrTodoNotFound
+}
+
+func (this *TodoService) FindListById(user entity.User, listId int) (entity.TodoList, error) {
+	list, err := this.storage.findTodoListById(listId, user.Id)
+	if err == sql.ErrNoRows {
+		if err = this.explainMissingList(user, listId, accessRead); err == nil {
+			err = ErrListNotFound
 		}
+	}
+
+	return list, err
+}
+
+// FindLists returns the lists of the user followed by the lists shared with them.
+func (this *TodoService) FindLists(user entity.User) []entity.TodoList {
+	return this.storage.findTodoListsByUserId(user.Id)
+}
+
+// attachTags fills in the tags of the todos.
+func (this *TodoService) attachTags(todos []entity.Todo) error {
+	todoIds := make([]int, 0, len(todos))
+	for _, todo := range todos {
+		todoIds = append(todoIds, todo.Id)
+	}
+
+	tags, err := this.storage.findTagsByTodoIds(todoIds)
+	if err != nil {
+		return err
+	}
 
-		todoLists = append(todoLists, list)
+	for i := range todos {
+		todos[i].Tags = tags[todos[i].Id]
 	}
 
-	return todoLists
+	return nil
 }
 
-func (this *TodoService) FindTodosByListId(listId int) []entity.Todo {
-	var todos []entity.Todo
-	query := `SELECT * FROM "Todos" WHERE "TodoListId" = $1 ORDER BY "Task" ASC`
-	rows, err := this.database.Query(query, listId)
+func (this *TodoService) attachScheduledTags(todos []entity.ScheduledTodo, err error) ([]entity.ScheduledTodo, error) {
 	if err != nil {
-		log.Println(err.Error())
-		return todos
+		return nil, err
+	}
+
+	plainTodos := make([]entity.Todo, len(todos))
+	for i, todo := range todos {
+		plainTodos[i] = todo.Todo
+	}
+
+	if err = this.attachTags(plainTodos); err != nil {
+		return nil, err
+	}
+
+	for i := range todos {
+		todos[i].Todo = plainTodos[i]
+	}
+
+	return todos, nil
+}
+
+// buildTodoTree nests the todos under their parents, keeping their order. Todos whose parent is
+// not among them, such as subtasks left over by a filter, are kept at the top.
+func buildTodoTree(todos []entity.Todo) []entity.Todo {
+	ids := make(map[int]bool, len(todos))
+	for _, todo := range todos {
+		ids[todo.Id] = true
 	}
 
-	defer rows.Close()
-	for rows.Next() {
-		var todo entity.Todo
-		if err := rows.Scan(&todo.Id, &todo.Task, &todo.Done, &todo.TodoListId); err != nil {
-			log.Println(err.Error())
-			return todos
+	var roots []entity.Todo
+	children := make(map[int][]entity.Todo)
+	for _, todo := range todos {
+		if todo.ParentId != 0 && ids[todo.ParentId] {
+			children[todo.ParentId] = append(children[todo.ParentId], todo)
+		} else {
+			roots = append(roots, todo)
 		}
+	}
+
+	return attachSubtasks(roots, children)
+}
 
-		todos = append(todos, todo)
+func attachSubtasks(todos []entity.Todo, children map[int][]entity.Todo) []entity.Todo {
+	for i := range todos {
+		todos[i].Subtasks = attachSubtasks(children[todos[i].Id], children)
 	}
 
 	return todos
 }
 
-func (this *TodoService) FindTodoById(id int) (entity.Todo, error) {
-	var todo entity.Todo
-	query := `SELECT * FROM "Todos" WHERE "Id" = $1`
-	row := this.database.QueryRow(query, id)
-	if err := row.Scan(&todo.Id, &todo.Task, &todo.Done, &todo.TodoListId); err != nil {
-		log.Println(err.Error())
-		return todo, err
+// FindTodosByListId returns the todos of the list matching the filter with their subtasks nested
+// under them.
+func (this *TodoService) FindTodosByListId(user entity.User, listId int, filter TodoFilter) ([]entity.Todo, error) {
+	todos, err := this.storage.findTodosByListId(listId, user.Id, filter)
+	if err != nil {
+		return nil, err
 	}
 
-	return todo, nil
+	if err = this.attachTags(todos); err != nil {
+		return nil, err
+	}
+
+	if len(todos) == 0 {
+		if err = this.explainMissingList(user, listId, accessRead); err != nil {
+			return nil, err
+		}
+	}
+
+	return buildTodoTree(todos), nil
+}
+
+// FindTodoById returns the todo with its subtasks nested under it.
+func (this *TodoService) FindTodoById(user entity.User, todoId int) (entity.Todo, error) {
+	subtree, err := this.storage.findSubtree(todoId, user.Id)
+	if err != nil {
+		return entity.Todo{}, err
+	}
+
+	if len(subtree) == 0 {
+		return entity.Todo{}, this.explainMissingTodo(user, todoId, accessRead)
+	}
+
+	if err = this.attachTags(subtree); err != nil {
+		return entity.Todo{}, err
+	}
+
+	return buildTodoTree(subtree)[0], nil
+}
+
+// CanAddSubtask reports whether the todo is shallow enough to get subtasks.
+func (this *TodoService) CanAddSubtask(todo entity.Todo) bool {
+	return todo.Depth < this.options.MaxSubtaskDepth
 }
 
-func (this *TodoService) AddList(name string, userId int) (entity.TodoList, error) {
-	newList := entity.NewTodoList(name, userId)
+// FindListTags returns the tags that can be filtered by in the list, the ones on its todos. Other
+// tags of the owner stay private when the list is shared.
+func (this *TodoService) FindListTags(list entity.TodoList) []entity.Tag {
+	return this.storage.findTagsByListId(list.Id)
+}
+
+func (this *TodoService) AddList(user entity.User, name string) (entity.TodoList, error) {
+	newList := entity.NewTodoList(name, user.Id)
 	if err := newList.Validate(); err != nil {
 		return newList, err
 	}
 
-	query := `INSERT INTO "TodoLists" ("Name", "UserId") VALUES ($1, $2)`
-	if _, err := this.database.Exec(query, newList.Name, newList.UserId); err != nil {
-		log.Println(err.Error())
+	exists, err := this.storage.listExists(newList.Name, user.Id)
+	if err != nil {
 		return newList, err
 	}
 
-	return newList, nil
+	if exists {
+		return newList, ErrListAlreadyExists
+	}
+
+	err = this.storage.transaction(func(storage *todoStorage) error {
+		listId, err := storage.insertTodoList(newList)
+		if err != nil {
+			return err
+		}
+
+		newList.Id = listId
+		return storage.insertActivity(entity.NewListActivity(entity.ActivityCreated, user, listId))
+	})
+
+	return newList, err
+}
+
+func (this *TodoService) RenameList(user entity.User, listId int, name string) (entity.TodoList, error) {
+	renamedList := entity.TodoList{Id: listId, Name: name, UserId: user.Id}
+	if err := renamedList.Validate(); err != nil {
+		return renamedList, err
+	}
+
+	var list entity.TodoList
+	err := this.storage.transaction(func(storage *todoStorage) error {
+		renamed, previousName, err := storage.renameTodoList(listId, user.Id, name)
+		if err != nil {
+			return err
+		}
+
+		list = renamed
+		if previousName == renamed.Name {
+			return nil
+		}
+
+		activity := entity.NewListActivity(entity.ActivityRenamed, user, listId).Changed(previousName, renamed.Name)
+		return storage.insertActivity(activity)
+	})
+
+	if err == sql.ErrNoRows {
+		if err = this.explainMissingList(user, listId, accessOwn); err == nil {
+			err = ErrListNotFound
+		}
+	}
+
+	if err != nil {
+		return renamedList, err
+	}
+
+	list.OwnerName = user.Name
+	list.Role = entity.ListRoleOwner
+	return list, nil
+}
+
+// RemoveList moves the list to the trash with its todos.
+func (this *TodoService) RemoveList(user entity.User, listId int) error {
+	err := this.storage.transaction(func(storage *todoStorage) error {
+		trashed, err := storage.trashTodoList(listId, user.Id)
+		if err == nil && !trashed {
+			err = sql.ErrNoRows
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return storage.insertActivity(entity.NewListActivity(entity.ActivityDeleted, user, listId))
+	})
+
+	if err == sql.ErrNoRows {
+		if err = this.explainMissingList(user, listId, accessOwn); err == nil {
+			err = ErrListNotFound
+		}
+	}
+
+	return err
+}
+
+// FindListMembers returns who the list is shared with, the owner first. Only the owner can see
+// them.
+func (this *TodoService) FindListMembers(user entity.User, listId int) ([]entity.TodoListMember, error) {
+	if err := this.explainMissingList(user, listId, accessOwn); err != nil {
+		return nil, err
+	}
+
+	return this.storage.findListMembers(listId)
 }
 
-func (this *TodoService) RemoveList(listId int) error {
-	query := `DELETE FROM "TodoLists" WHERE "Id" = $1`
-	if _, err := this.database.Exec(query, listId); err != nil {
-		log.Println(err.Error())
+// ShareList shares the list with the user by name, or changes their role when the list is already
+// shared with them.
+func (this *TodoService) ShareList(user entity.User, listId int, userName string, role string) error {
+	if !slices.Contains(entity.SharedListRoles, role) {
+		return ErrInvalidListRole
+	}
+
+	if err := this.explainMissingList(user, listId, accessOwn); err != nil {
 		return err
 	}
 
-	return nil
+	userName = strings.TrimSpace(userName)
+	if userName == user.Name {
+		return ErrShareWithOwner
+	}
+
+	shared, err := this.storage.upsertListMember(listId, userName, role)
+	if err == nil && !shared {
+		err = ErrMemberNotFound
+	}
+
+	return err
+}
+
+// UnshareList takes the list away from a member.
+func (this *TodoService) UnshareList(user entity.User, listId int, memberId int) error {
+	if err := this.explainMissingList(user, listId, accessOwn); err != nil {
+		return err
+	}
+
+	if memberId == user.Id {
+		return ErrOwnerCantLeave
+	}
+
+	deleted, err := this.storage.deleteListMember(listId, memberId)
+	if err == nil && !deleted {
+		err = ErrMemberNotFound
+	}
+
+	return err
+}
+
+// LeaveList removes a list shared with the user from their lists.
+func (this *TodoService) LeaveList(user entity.User, listId int) error {
+	if err := this.explainMissingList(user, listId, accessRead); err != nil {
+		return err
+	}
+
+	deleted, err := this.storage.deleteListMember(listId, user.Id)
+	if err == nil && !deleted {
+		err = ErrOwnerCantLeave
+	}
+
+	return err
 }
 
-func (this *TodoService) AddTodo(task string, todoListId int) (entity.Todo, error) {
-	newTodo := entity.NewTodo(task, todoListId)
+func (this *TodoService) AddTodo(user entity.User, task string, listId int, details TodoDetails) (entity.Todo, error) {
+	newTodo := details.apply(entity.NewTodo(task, listId))
 	if err := newTodo.Validate(); err != nil {
 		return newTodo, err
 	}
 
-	query := `INSERT INTO "Todos" ("Task", "Done", "TodoListId") VALUES ($1, $2, $3)`
-	if _, err := this.database.Exec(query, newTodo.Task, newTodo.Done, newTodo.TodoListId); err != nil {
-		log.Println(err.Error())
+	err := this.storage.transaction(func(storage *todoStorage) error {
+		if err := storage.lockTodoList(listId, user.Id); err != nil {
+			return err
+		}
+
+		var err error
+		if newTodo, err = this.insertNewTodo(storage, user, newTodo); err != nil {
+			return err
+		}
+
+		return storage.notify(TodoEvent{ListId: listId})
+	})
+
+	if err == sql.ErrNoRows {
+		if err = this.explainMissingList(user, listId, accessEdit); err == nil {
+			err = ErrListNotFound
+		}
+	}
+
+	return newTodo, err
+}
+
+// insertNewTodo stores a validated todo with its tags in a list the caller has locked and records
+// it in the activity log.
+func (this *TodoService) insertNewTodo(storage *todoStorage, user entity.User, newTodo entity.Todo) (entity.Todo, error) {
+	todoId, err := storage.insertTodo(newTodo, user.Id)
+	if err != nil {
+		return newTodo, err
+	}
+
+	newTodo.Id = todoId
+	if err = storage.setTodoTags(todoId, newTodo.Tags); err != nil {
 		return newTodo, err
 	}
 
-	return newTodo, nil
+	return newTodo, storage.insertActivity(entity.NewTodoActivity(entity.ActivityCreated, user, newTodo))
 }
 
-func (this *TodoService) ToggleTodo(todoId int) (entity.Todo, error) {
-	var todo entity.Todo
-	tx, err := this.database.Begin()
+// AddSubtask adds a todo under the parent todo in the same list. The list is locked first like in
+// AddTodo, then the parent and its ancestors so a done parent can be opened again.
+func (this *TodoService) AddSubtask(user entity.User, parentId int, task string, details TodoDetails) (entity.Todo, error) {
+	parent, err := this.storage.findTodoById(parentId, user.Id)
+	if err == sql.ErrNoRows {
+		return entity.Todo{}, this.explainMissingTodo(user, parentId, accessEdit)
+	}
+
 	if err != nil {
-		return todo, err
+		return entity.Todo{}, err
 	}
-	defer tx.Rollback()
 
-	query := `SELECT * FROM "Todos" WHERE "Id" = $1 FOR UPDATE`
-	row := tx.QueryRow(query, todoId)
-	if err := row.Scan(&todo.Id, &todo.Task, &todo.Done, &todo.TodoListId); err != nil {
-		log.Println(err.Error())
-		return todo, err
+	newTodo := details.apply(entity.NewTodo(task, parent.TodoListId))
+	newTodo.ParentId = parentId
+	if err := newTodo.Validate(); err != nil {
+		return newTodo, err
+	}
+
+	err = this.storage.transaction(func(storage *todoStorage) error {
+		if err := storage.lockTodoList(parent.TodoListId, user.Id); err != nil {
+			return err
+		}
+
+		var err error
+		if newTodo, err = this.insertSubtask(storage, user, newTodo); err != nil {
+			return err
+		}
+
+		return storage.notify(TodoEvent{ListId: parent.TodoListId})
+	})
+
+	if err == sql.ErrNoRows {
+		err = this.explainMissingTodo(user, parentId, accessEdit)
+	}
+
+	return newTodo, err
+}
+
+// insertSubtask stores a validated subtask under its parent in a list the caller has locked. The
+// parent and its ancestors are locked while the subtask opens them again. sql.ErrNoRows is
+// returned when the user can't edit the parent.
+func (this *TodoService) insertSubtask(storage *todoStorage, user entity.User, newTodo entity.Todo) (entity.Todo, error) {
+	path, err := storage.lockTodoPath(newTodo.ParentId, user.Id)
+	if err != nil {
+		return newTodo, err
+	}
+
+	if len(path) == 0 {
+		return newTodo, sql.ErrNoRows
+	}
+
+	newTodo.Depth = len(path)
+	if !this.CanAddSubtask(path[len(path)-1]) {
+		return newTodo, ErrSubtaskTooDeep
+	}
+
+	if newTodo, err = this.insertNewTodo(storage, user, newTodo); err != nil {
+		return newTodo, err
+	}
+
+	return newTodo, this.rollUp(storage, user, path, false)
+}
+
+// UpdateTodo sets the task and details of a todo from the edit form.
+func (this *TodoService) UpdateTodo(user entity.User, todoId int, task string, details TodoDetails) (entity.Todo, error) {
+	updatedTodo := details.apply(entity.Todo{Id: todoId, Task: task})
+	if err := updatedTodo.Validate(); err != nil {
+		return updatedTodo, err
 	}
 
-	updatedTodo := todo.Toggle()
-	query = `UPDATE "Todos" SET "Task" = $2, "Done" = $3 WHERE "Id" = $1`
-	if _, err := tx.Exec(query, updatedTodo.Id, updatedTodo.Task, updatedTodo.Done); err != nil {
-		log.Println(err.Error())
+	err := this.storage.transaction(func(storage *todoStorage) error {
+		todo, err := this.saveDetails(storage, user, updatedTodo)
+		if err != nil {
+			return err
+		}
+
+		return storage.notify(TodoEvent{ListId: todo.TodoListId, TodoId: todoId})
+	})
+
+	if err == sql.ErrNoRows {
+		return updatedTodo, this.explainMissingTodo(user, todoId, accessEdit)
+	}
+
+	if err != nil {
+		return updatedTodo, err
+	}
+
+	return this.FindTodoById(user, todoId)
+}
+
+// saveDetails stores the task, details and tags of a validated todo and records a renaming in the
+// activity log. sql.ErrNoRows is returned when the user can't edit the todo.
+func (this *TodoService) saveDetails(storage *todoStorage, user entity.User, updatedTodo entity.Todo) (entity.Todo, error) {
+	todo, previousTask, err := storage.updateTodoDetails(updatedTodo, user.Id)
+	if err != nil {
 		return todo, err
 	}
 
-	if err = tx.Commit(); err != nil {
+	if err = storage.setTodoTags(todo.Id, updatedTodo.Tags); err != nil {
 		return todo, err
 	}
 
-	return updatedTodo, nil
+	if previousTask != todo.Task {
+		activity := entity.NewTodoActivity(entity.ActivityRenamed, user, todo).Changed(previousTask, todo.Task)
+		if err = storage.insertActivity(activity); err != nil {
+			return todo, err
+		}
+	}
+
+	return todo, nil
+}
+
+// lockTodoPath locks the todo together with its ancestors so concurrent changes in the same tree
+// roll up one at a time. Finishing a recurring todo adds its next occurrence to the list, so the
+// list of a recurring todo is locked first like in AddTodo.
+func (this *TodoService) lockTodoPath(storage *todoStorage, user entity.User, todoId int) ([]entity.Todo, error) {
+	todo, err := storage.findTodoById(todoId, user.Id)
+	if err == sql.ErrNoRows {
+		return nil, this.explainMissingTodo(user, todoId, accessEdit)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if todo.Recurrence != "" {
+		err = storage.lockTodoList(todo.TodoListId, user.Id)
+		if err == sql.ErrNoRows {
+			return nil, this.explainMissingTodo(user, todoId, accessEdit)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	path, err := storage.lockTodoPath(todoId, user.Id)
+	if err == nil && len(path) == 0 {
+		err = this.explainMissingTodo(user, todoId, accessEdit)
+	}
+
+	return path, err
 }
 
-func (this *TodoService) RemoveTodo(todoId int) error {
-	query := `DELETE FROM "Todos" WHERE "Id" = $1`
-	if _, err := this.database.Exec(query, todoId); err != nil {
-		log.Println(err.Error())
+// saveDone stores the done state of a locked todo and rolls it up to its ancestors in the path.
+func (this *TodoService) saveDone(storage *todoStorage, user entity.User, path []entity.Todo, todo entity.Todo) error {
+	if err := storage.insertActivity(toggledActivity(user, todo)); err != nil {
 		return err
 	}
 
-	return nil
+	if todo.Done && todo.Recurrence != "" {
+		if err := this.addNextOccurrence(storage, user, todo); err != nil {
+			return err
+		}
+
+		todo.Recurrence = ""
+	}
+
+	if err := storage.updateTodo(todo); err != nil {
+		return err
+	}
+
+	return this.rollUp(storage, user, path[:len(path)-1], todo.Done)
+}
+
+// addNextOccurrence adds the todo following a finished recurring todo. The rule moves on to the
+// new todo, so opening the finished one again and closing it doesn't repeat it twice. Todos
+// without a due date repeat from today. The subtasks are copied under the new todo as open, see
+// nextSubtasks, and the finished ones stay with the finished todo.
+func (this *TodoService) addNextOccurrence(storage *todoStorage, user entity.User, todo entity.Todo) error {
+	recurrence, err := entity.ParseRecurrence(todo.Recurrence)
+	if err != nil {
+		return err
+	}
+
+	after := todo.Due
+	if !todo.HasDue() {
+		after = entity.StartOfDay(time.Now().In(user.Location()))
+	}
+
+	rule, hasMore := recurrence.Advance()
+	due, found := recurrence.Next(after)
+	if !hasMore || !found {
+		return nil
+	}
+
+	tags, err := storage.findTagsByTodoIds([]int{todo.Id})
+	if err != nil {
+		return err
+	}
+
+	next := entity.NewTodo(todo.Task, todo.TodoListId)
+	next.ParentId = todo.ParentId
+	next.Priority = todo.Priority
+	next.Due = due
+	next.DueHasTime = todo.DueHasTime
+	next.Recurrence = rule.String()
+	next.Notes = todo.Notes
+	nextId, err := storage.insertTodo(next, user.Id)
+	if err != nil {
+		return err
+	}
+
+	next.Id = nextId
+	if err = storage.insertActivity(entity.NewTodoActivity(entity.ActivityCreated, user, next)); err != nil {
+		return err
+	}
+
+	if err = storage.setTodoTags(nextId, tags[todo.Id]); err != nil {
+		return err
+	}
+
+	return this.copySubtasks(storage, user, todo.Id, nextId, entity.DaysBetween(after, due))
+}
+
+// copySubtasks adds the subtasks of a finished recurring todo under its next occurrence with their
+// tags.
+func (this *TodoService) copySubtasks(storage *todoStorage, user entity.User, todoId int, nextId int, days int) error {
+	subtree, err := storage.findSubtree(todoId, user.Id)
+	if err != nil || len(subtree) < 2 {
+		return err
+	}
+
+	ids := make([]int, 0, len(subtree))
+	for _, subtask := range subtree[1:] {
+		ids = append(ids, subtask.Id)
+	}
+
+	tags, err := storage.findTagsByTodoIds(ids)
+	if err != nil {
+		return err
+	}
+
+	copiedIds := map[int]int{todoId: nextId}
+	for _, subtask := range nextSubtasks(subtree, days) {
+		copied := subtask
+		copied.ParentId = copiedIds[subtask.ParentId]
+		copiedId, err := storage.insertTodo(copied, user.Id)
+		if err != nil {
+			return err
+		}
+
+		copiedIds[subtask.Id] = copiedId
+		if err = storage.setTodoTags(copiedId, tags[subtask.Id]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nextSubtasks returns the subtasks in a subtree from findSubtree as they start out under the next
+// occurrence of the todo at its root: open, without a recurrence of their own and with their due
+// dates moved the same number of days as the todo. Parents come before their subtasks, and the ids
+// are those of the originals so the caller can tell which new parent each one belongs under.
+func nextSubtasks(subtree []entity.Todo, days int) []entity.Todo {
+	if len(subtree) < 2 {
+		return nil
+	}
+
+	subtasks := make([]entity.Todo, 0, len(subtree)-1)
+	for _, subtask := range subtree[1:] {
+		subtask.Done = false
+		subtask.Recurrence = ""
+		subtask.Subtasks = nil
+		if subtask.HasDue() {
+			subtask.Due = subtask.Due.AddDate(0, 0, days)
+		}
+
+		subtasks = append(subtasks, subtask)
+	}
+
+	return subtasks
+}
+
+// toggledActivity records that the user finished the todo or opened it again.
+func toggledActivity(user entity.User, todo entity.Todo) entity.TodoActivity {
+	activity := entity.NewTodoActivity(entity.ActivityToggled, user, todo)
+	if todo.Done {
+		return activity.Changed(entity.ActivityOpen, entity.ActivityDone)
+	}
+
+	return activity.Changed(entity.ActivityDone, entity.ActivityOpen)
+}
+
+// UpdateTodoNotes replaces the notes of the todo.
+func (this *TodoService) UpdateTodoNotes(user entity.User, todoId int, notes string) (entity.Todo, error) {
+	todo, err := this.FindTodoById(user, todoId)
+	if err != nil {
+		return todo, err
+	}
+
+	todo.Notes = notes
+	if err = todo.Validate(); err != nil {
+		return todo, err
+	}
+
+	updated, err := this.storage.updateTodoNotes(todoId, user.Id, notes)
+	if err == nil && !updated {
+		err = this.explainMissingTodo(user, todoId, accessEdit)
+	}
+
+	if err != nil {
+		return todo, err
+	}
+
+	return todo, this.storage.notify(TodoEvent{ListId: todo.TodoListId, TodoId: todoId})
+}
+
+// ToggleTodo flips the done state of the todo. Finishing a recurring todo adds its next
+// occurrence in the same transaction.
+func (this *TodoService) ToggleTodo(user entity.User, todoId int) (entity.Todo, error) {
+	err := this.storage.transaction(func(storage *todoStorage) error {
+		path, err := this.lockTodoPath(storage, user, todoId)
+		if err != nil {
+			return err
+		}
+
+		todo := path[len(path)-1]
+		if err = this.saveDone(storage, user, path, todo.Toggle()); err != nil {
+			return err
+		}
+
+		// parents count their finished subtasks and a next occurrence is a new todo, so those
+		// changes show the whole list again
+		event := TodoEvent{ListId: todo.TodoListId, TodoId: todoId}
+		if len(path) > 1 || todo.Recurrence != "" {
+			event.TodoId = 0
+		}
+
+		return storage.notify(event)
+	})
+
+	if err != nil {
+		return entity.Todo{}, err
+	}
+
+	return this.FindTodoById(user, todoId)
+}
+
+// CompleteSubtasks marks the todo and all of its subtasks done. Only the todo itself moves on to
+// its next occurrence when it repeats.
+func (this *TodoService) CompleteSubtasks(user entity.User, todoId int) (entity.Todo, error) {
+	err := this.storage.transaction(func(storage *todoStorage) error {
+		path, err := this.lockTodoPath(storage, user, todoId)
+		if err != nil {
+			return err
+		}
+
+		completed, err := storage.completeSubtasks(todoId)
+		if err != nil {
+			return err
+		}
+
+		for _, subtask := range completed {
+			if err = storage.insertActivity(toggledActivity(user, subtask)); err != nil {
+				return err
+			}
+		}
+
+		todo := path[len(path)-1]
+		if !todo.Done {
+			todo.Done = true
+			if err = this.saveDone(storage, user, path, todo); err != nil {
+				return err
+			}
+		}
+
+		return storage.notify(TodoEvent{ListId: todo.TodoListId})
+	})
+
+	if err != nil {
+		return entity.Todo{}, err
+	}
+
+	return this.FindTodoById(user, todoId)
+}
+
+// rollUp carries a change in the done state of a subtask to its locked ancestors, nearest first,
+// when CompleteParents is set. A finished or removed subtask completes the parent once all of its
+// remaining subtasks are done, an opened subtask opens a done parent again. It stops at the first
+// ancestor that stays as it was. The activity log credits the user with the ancestors it changed.
+func (this *TodoService) rollUp(storage *todoStorage, user entity.User, ancestors []entity.Todo, done bool) error {
+	if !this.options.CompleteParents {
+		return nil
+	}
+
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		parent := ancestors[i]
+		if parent.Done == done {
+			return nil
+		}
+
+		if done {
+			total, open, err := storage.countSubtasks(parent.Id)
+			if err != nil {
+				return err
+			}
+
+			if total == 0 || open > 0 {
+				return nil
+			}
+		}
+
+		parent.Done = done
+		if err := storage.updateTodo(parent); err != nil {
+			return err
+		}
+
+		if err := storage.insertActivity(toggledActivity(user, parent)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MoveTodo places the todo directly after the todo beforeId, or directly before the todo afterId
+// when beforeId is zero. Neighbouring positions are read under a lock on the list, so concurrent
+// moves can't interleave and a move made from an outdated page still lands next to its anchor.
+// Reordering stays out of the activity log, only moves to another list are recorded.
+func (this *TodoService) MoveTodo(user entity.User, todoId int, beforeId int, afterId int) (entity.Todo, error) {
+	todo, err := this.FindTodoById(user, todoId)
+	if err != nil {
+		return todo, err
+	}
+
+	err = this.storage.transaction(func(storage *todoStorage) error {
+		if err := storage.lockTodoList(todo.TodoListId, user.Id); err != nil {
+			return err
+		}
+
+		movedTodo, err := storage.findTodoById(todoId, user.Id)
+		if err != nil {
+			return err
+		}
+
+		position, err := this.findNewPosition(storage, user, movedTodo, beforeId, afterId)
+		if err != nil {
+			return err
+		}
+
+		movedTodo.Position = position
+		todo = movedTodo
+		if err = storage.updateTodoPosition(todoId, position); err != nil {
+			return err
+		}
+
+		return storage.notify(TodoEvent{ListId: todo.TodoListId})
+	})
+
+	if err == sql.ErrNoRows {
+		err = this.explainMissingTodo(user, todoId, accessEdit)
+	}
+
+	return todo, err
+}
+
+// findNewPosition returns a free position next to the anchor todo. When there's no room left
+// between the anchor and its neighbour the list is renumbered once and the search repeated.
+func (this *TodoService) findNewPosition(storage *todoStorage, user entity.User, todo entity.Todo, beforeId int, afterId int) (int64, error) {
+	anchorId := beforeId
+	if anchorId == 0 {
+		anchorId = afterId
+	}
+
+	if anchorId == 0 || anchorId == todo.Id {
+		return todo.Position, nil
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		anchor, err := storage.findTodoById(anchorId, user.Id)
+		if err != nil {
+			return 0, err
+		}
+
+		if anchor.TodoListId != todo.TodoListId || anchor.ParentId != todo.ParentId {
+			return 0, ErrInvalidMove
+		}
+
+		var low, high int64
+		var hasLow, hasHigh bool
+		if beforeId != 0 {
+			low, hasLow = anchor.Position, true
+			high, hasHigh, err = storage.findNextPosition(todo.TodoListId, low, todo.Id)
+		} else {
+			high, hasHigh = anchor.Position, true
+			low, hasLow, err = storage.findPreviousPosition(todo.TodoListId, high, todo.Id)
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		switch {
+		case !hasHigh:
+			return low + entity.TodoPositionGap, nil
+		case !hasLow:
+			return high - entity.TodoPositionGap, nil
+		case high-low > 1:
+			return low + (high-low)/2, nil
+		}
+
+		if err = storage.rebalanceTodoList(todo.TodoListId); err != nil {
+			return 0, err
+		}
+	}
+
+	return 0, errors.New("Todo could not be moved.")
+}
+
+// RemoveTodo moves the todo with its subtasks to the trash.
+func (this *TodoService) RemoveTodo(user entity.User, todoId int) error {
+	return this.storage.transaction(func(storage *todoStorage) error {
+		path, err := storage.lockTodoPath(todoId, user.Id)
+		if err != nil {
+			return err
+		}
+
+		if len(path) == 0 {
+			return this.explainMissingTodo(user, todoId, accessEdit)
+		}
+
+		if err = this.trashLockedTodo(storage, user, path); err != nil {
+			return err
+		}
+
+		return storage.notify(TodoEvent{ListId: path[0].TodoListId})
+	})
+}
+
+// trashLockedTodo moves the last todo of a locked path to the trash. Removing the last open
+// subtask of a todo rolls up like finishing it would.
+func (this *TodoService) trashLockedTodo(storage *todoStorage, user entity.User, path []entity.Todo) error {
+	todo := path[len(path)-1]
+	trashed, err := storage.trashTodo(todo.Id, user.Id)
+	if err != nil {
+		return err
+	}
+
+	if !trashed {
+		return ErrTodoNotFound
+	}
+
+	if err = storage.insertActivity(entity.NewTodoActivity(entity.ActivityDeleted, user, todo)); err != nil {
+		return err
+	}
+
+	if todo.Done {
+		return nil
+	}
+
+	return this.rollUp(storage, user, path[:len(path)-1], true)
+}
+
+// selection returns the selected todo ids in order without duplicates, so the todos of a bulk
+// action are locked in the same order by every request.
+func selection(todoIds []int) ([]int, error) {
+	if len(todoIds) == 0 {
+		return nil, ErrNothingSelected
+	}
+
+	todoIds = slices.Clone(todoIds)
+	slices.Sort(todoIds)
+	return slices.Compact(todoIds), nil
+}
+
+// lockList locks a list the user can edit like AddTodo does.
+func (this *TodoService) lockList(storage *todoStorage, user entity.User, listId int) error {
+	err := storage.lockTodoList(listId, user.Id)
+	if err == sql.ErrNoRows {
+		if err = this.explainMissingList(user, listId, accessEdit); err == nil {
+			err = ErrListNotFound
+		}
+	}
+
+	return err
+}
+
+// checkSelection makes sure every selected todo is in the locked list and outside of the trash,
+// so a bulk action changes all of the todos or none of them.
+func (this *TodoService) checkSelection(storage *todoStorage, user entity.User, listId int, todoIds []int) error {
+	missingId, err := storage.findMissingTodoId(listId, todoIds)
+	if err != nil {
+		return err
+	}
+
+	if missingId != 0 {
+		return this.explainMissingTodo(user, missingId, accessEdit)
+	}
+
+	return nil
+}
+
+// SetTodosDone marks the selected todos of the list done or open in one transaction. Todos
+// already in that state are left alone, the others roll up and repeat like toggling them one by
+// one would.
+func (this *TodoService) SetTodosDone(user entity.User, listId int, todoIds []int, done bool) error {
+	todoIds, err := selection(todoIds)
+	if err != nil {
+		return err
+	}
+
+	return this.storage.transaction(func(storage *todoStorage) error {
+		if err := this.lockList(storage, user, listId); err != nil {
+			return err
+		}
+
+		if err := this.checkSelection(storage, user, listId, todoIds); err != nil {
+			return err
+		}
+
+		for _, todoId := range todoIds {
+			path, err := storage.lockTodoPath(todoId, user.Id)
+			if err != nil {
+				return err
+			}
+
+			if len(path) == 0 {
+				return ErrTodoNotFound
+			}
+
+			// an earlier todo of the selection may have rolled up to this one
+			todo := path[len(path)-1]
+			if todo.Done == done {
+				continue
+			}
+
+			todo.Done = done
+			if err = this.saveDone(storage, user, path, todo); err != nil {
+				return err
+			}
+		}
+
+		return storage.notify(TodoEvent{ListId: listId})
+	})
+}
+
+// RemoveTodos moves the selected todos of the list to the trash in one transaction.
+func (this *TodoService) RemoveTodos(user entity.User, listId int, todoIds []int) error {
+	todoIds, err := selection(todoIds)
+	if err != nil {
+		return err
+	}
+
+	return this.storage.transaction(func(storage *todoStorage) error {
+		if err := this.lockList(storage, user, listId); err != nil {
+			return err
+		}
+
+		if err := this.checkSelection(storage, user, listId, todoIds); err != nil {
+			return err
+		}
+
+		for _, todoId := range todoIds {
+			path, err := storage.lockTodoPath(todoId, user.Id)
+			if err != nil {
+				return err
+			}
+
+			// already removed along with a selected parent
+			if len(path) == 0 {
+				continue
+			}
+
+			if err = this.trashLockedTodo(storage, user, path); err != nil {
+				return err
+			}
+		}
+
+		return storage.notify(TodoEvent{ListId: listId})
+	})
+}
+
+// MoveTodos moves the selected todos of the list with their subtasks to the end of another list
+// the user can edit, in one transaction. Moved subtasks become top level todos of the other list.
+// Tags belong to the owner of a list, so todos moved to a list of another owner are tagged again
+// with the tags of that owner.
+func (this *TodoService) MoveTodos(user entity.User, listId int, todoIds []int, targetListId int) error {
+	todoIds, err := selection(todoIds)
+	if err != nil {
+		return err
+	}
+
+	if targetListId == 0 {
+		return ErrNoMoveTarget
+	}
+
+	if targetListId == listId {
+		return ErrMoveToSameList
+	}
+
+	source, err := this.FindListById(user, listId)
+	if err != nil {
+		return err
+	}
+
+	target, err := this.FindListById(user, targetListId)
+	if err != nil {
+		return err
+	}
+
+	return this.storage.transaction(func(storage *todoStorage) error {
+		// both lists are locked in the order of their ids, so moves between the same lists in
+		// opposite directions can't deadlock
+		for _, id := range []int{min(listId, targetListId), max(listId, targetListId)} {
+			if err := this.lockList(storage, user, id); err != nil {
+				return err
+			}
+		}
+
+		if err := this.checkSelection(storage, user, listId, todoIds); err != nil {
+			return err
+		}
+
+		for _, todoId := range todoIds {
+			path, err := storage.lockTodoPath(todoId, user.Id)
+			if err != nil {
+				return err
+			}
+
+			if len(path) == 0 {
+				return ErrTodoNotFound
+			}
+
+			// already moved along with a selected parent
+			todo := path[len(path)-1]
+			if todo.TodoListId != listId {
+				continue
+			}
+
+			movedIds, err := storage.moveSubtree(todoId, targetListId)
+			if err != nil {
+				return err
+			}
+
+			// the move shows in the activity of both lists
+			moved := entity.NewTodoActivity(entity.ActivityMoved, user, todo).Changed(source.Name, target.Name)
+			if err = storage.insertActivity(moved); err != nil {
+				return err
+			}
+
+			moved.TodoListId = targetListId
+			if err = storage.insertActivity(moved); err != nil {
+				return err
+			}
+
+			if source.UserId != target.UserId {
+				if err = this.retag(storage, movedIds); err != nil {
+					return err
+				}
+			}
+
+			if !todo.Done {
+				if err = this.rollUp(storage, user, path[:len(path)-1], true); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := storage.notify(TodoEvent{ListId: listId}); err != nil {
+			return err
+		}
+
+		return storage.notify(TodoEvent{ListId: targetListId})
+	})
+}
+
+// retag files the todos under the tags of the owner of their current list, by name.
+func (this *TodoService) retag(storage *todoStorage, todoIds []int) error {
+	tags, err := storage.findTagsByTodoIds(todoIds)
+	if err != nil {
+		return err
+	}
+
+	for _, todoId := range todoIds {
+		if err = storage.setTodoTags(todoId, tags[todoId]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ClearCompleted moves every finished todo of the list to the trash with its subtasks. It returns
+// how many todos were removed.
+func (this *TodoService) ClearCompleted(user entity.User, listId int) (int, error) {
+	cleared := 0
+	err := this.storage.transaction(func(storage *todoStorage) error {
+		if err := this.lockList(storage, user, listId); err != nil {
+			return err
+		}
+
+		trashed, err := storage.trashDoneTodos(listId)
+		if err != nil {
+			return err
+		}
+
+		// subtasks went along with their parent and aren't logged on their own
+		trashedIds := make(map[int]bool, len(trashed))
+		for _, todo := range trashed {
+			trashedIds[todo.Id] = true
+		}
+
+		for _, todo := range trashed {
+			if trashedIds[todo.ParentId] {
+				continue
+			}
+
+			if err = storage.insertActivity(entity.NewTodoActivity(entity.ActivityDeleted, user, todo)); err != nil {
+				return err
+			}
+		}
+
+		cleared = len(trashed)
+		return storage.notify(TodoEvent{ListId: listId})
+	})
+
+	return cleared, err
+}
+
+// RetentionDays is how many days lists and todos stay in the trash, zero when they stay until the
+// user deletes them.
+func (this *TodoService) RetentionDays() int {
+	return int(this.options.TrashRetention / (24 * time.Hour))
+}
+
+// FindTrashedLists returns the lists of the user in the trash.
+func (this *TodoService) FindTrashedLists(user entity.User) ([]entity.TrashedList, error) {
+	return this.storage.findTrashedLists(user.Id)
+}
+
+// FindTrashedTodos returns the todos in the trash of every list the user can edit, with their
+// tags.
+func (this *TodoService) FindTrashedTodos(user entity.User) ([]entity.TrashedTodo, error) {
+	todos, err := this.storage.findTrashedTodos(user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	plainTodos := make([]entity.Todo, len(todos))
+	for i, todo := range todos {
+		plainTodos[i] = todo.Todo
+	}
+
+	if err = this.attachTags(plainTodos); err != nil {
+		return nil, err
+	}
+
+	for i := range todos {
+		todos[i].Todo = plainTodos[i]
+	}
+
+	return todos, nil
+}
+
+// RestoreList takes a list of the user out of the trash. It fails with ErrListAlreadyExists when
+// the user has added another list with the same name since.
+func (this *TodoService) RestoreList(user entity.User, listId int) error {
+	return this.storage.transaction(func(storage *todoStorage) error {
+		restored, err := storage.restoreTodoList(listId, user.Id)
+		if err == nil && !restored {
+			err = ErrListNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		return storage.insertActivity(entity.NewListActivity(entity.ActivityRestored, user, listId))
+	})
+}
+
+// PurgeList deletes a list of the user in the trash for good, along with its todos.
+func (this *TodoService) PurgeList(user entity.User, listId int) error {
+	purged, err := this.storage.purgeTodoList(listId, user.Id)
+	if err == nil && !purged {
+		err = ErrListNotFound
+	}
+
+	return err
+}
+
+// RestoreTodo takes the todo out of the trash with the subtasks removed along with it. An open
+// todo coming back under a done parent opens the parent again like adding a subtask does.
+func (this *TodoService) RestoreTodo(user entity.User, todoId int) error {
+	err := this.storage.transaction(func(storage *todoStorage) error {
+		listId, err := storage.restoreTodo(todoId, user.Id)
+		if err != nil {
+			return err
+		}
+
+		path, err := storage.lockTodoPath(todoId, user.Id)
+		if err != nil {
+			return err
+		}
+
+		if len(path) == 0 {
+			return sql.ErrNoRows
+		}
+
+		todo := path[len(path)-1]
+		if err = storage.insertActivity(entity.NewTodoActivity(entity.ActivityRestored, user, todo)); err != nil {
+			return err
+		}
+
+		if !todo.Done {
+			if err = this.rollUp(storage, user, path[:len(path)-1], false); err != nil {
+				return err
+			}
+		}
+
+		return storage.notify(TodoEvent{ListId: listId})
+	})
+
+	if err == sql.ErrNoRows {
+		err = this.explainMissingTodo(user, todoId, accessEdit)
+	}
+
+	return err
+}
+
+// PurgeTodo deletes the todo in the trash for good, along with its subtasks.
+func (this *TodoService) PurgeTodo(user entity.User, todoId int) error {
+	purged, err := this.storage.purgeTodo(todoId, user.Id)
+	if err == nil && !purged {
+		err = this.explainMissingTodo(user, todoId, accessEdit)
+	}
+
+	return err
+}
+
+// FindActivity returns a page of the activity log of a list shared with the user, the latest entry
+// first. The page starts after the entry beforeId when it's set, more reports whether older
+// entries are left.
+func (this *TodoService) FindActivity(user entity.User, listId int, beforeId int64) ([]entity.TodoActivity, bool, error) {
+	if err := this.explainMissingList(user, listId, accessRead); err != nil {
+		return nil, false, err
+	}
+
+	if beforeId <= 0 {
+		beforeId = math.MaxInt64
+	}
+
+	entries, err := this.storage.findActivity(listId, beforeId, activityPageSize+1)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(entries) > activityPageSize {
+		return entries[:activityPageSize], true, nil
+	}
+
+	return entries, false, nil
+}
+
+// RunTrashPurge deletes the lists and todos that have been in the trash longer than the retention,
+// right away and then every trashPurgeInterval until the context is done. Nothing is purged when
+// there's no retention.
+func (this *TodoService) RunTrashPurge(running context.Context) {
+	if this.options.TrashRetention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+	for {
+		this.storage.purgeTrash(time.Now().Add(-this.options.TrashRetention))
+		select {
+		case <-running.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// FindTodosDueToday returns the todos of every list of the user due today in their time zone.
+func (this *TodoService) FindTodosDueToday(user entity.User) ([]entity.ScheduledTodo, error) {
+	today := entity.StartOfDay(time.Now().In(user.Location()))
+	return this.attachScheduledTags(this.storage.findTodosDueBetween(user.Id, today, today.AddDate(0, 0, 1)))
+}
+
+// FindUpcomingTodos returns the todos of every list of the user due in the days after today.
+func (this *TodoService) FindUpcomingTodos(user entity.User) ([]entity.ScheduledTodo, error) {
+	today := entity.StartOfDay(time.Now().In(user.Location()))
+	return this.attachScheduledTags(this.storage.findTodosDueBetween(user.Id, today.AddDate(0, 0, 1), today.AddDate(0, 0, 1+upcomingDays)))
+}
+
+func (this *TodoService) FindOverdueTodos(user entity.User) ([]entity.ScheduledTodo, error) {
+	now := time.Now().In(user.Location())
+	return this.attachScheduledTags(this.storage.findOverdueTodos(user.Id, entity.StartOfDay(now), entity.WallClock(now)))
+}
+
+// SearchTodos finds the todos of every list of the user whose task or notes match the query. An
+// empty query finds nothing.
+func (this *TodoService) SearchTodos(user entity.User, query string) ([]entity.TodoSearchResult, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, nil
+	}
+
+	if runes := []rune(query); len(runes) > maxSearchLength {
+		query = string(runes[:maxSearchLength])
+	}
+
+	return this.storage.searchTodos(user.Id, query, maxSearchResults)
 }
@@ -0,0 +1,60 @@
+package todo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+)
+
+func TestNextSubtasks(t *testing.T) {
+	due := time.Date(2024, time.January, 31, 9, 0, 0, 0, time.UTC)
+	subtree := []entity.Todo{
+		{Id: 1, Task: "weekly review", Done: true, Recurrence: "FREQ=WEEKLY", Due: due},
+		{Id: 2, Task: "inbox", Done: true, ParentId: 1, Depth: 1, Priority: 2, Notes: "empty it", Due: due},
+		{Id: 3, Task: "calendar", ParentId: 1, Depth: 1},
+		{Id: 4, Task: "water plants", Done: true, ParentId: 2, Depth: 2, Recurrence: "FREQ=DAILY"},
+	}
+
+	subtasks := nextSubtasks(subtree, entity.DaysBetween(due, due.AddDate(0, 0, 7)))
+	if len(subtasks) != 3 {
+		t.Fatalf("got %d subtasks, want 3", len(subtasks))
+	}
+
+	for i, subtask := range subtasks {
+		original := subtree[i+1]
+		if subtask.Id != original.Id || subtask.ParentId != original.ParentId || subtask.Task != original.Task {
+			t.Errorf("subtask %d = %d %q under %d, want %d %q under %d", i, subtask.Id, subtask.Task, subtask.ParentId, original.Id, original.Task, original.ParentId)
+		}
+
+		if subtask.Done {
+			t.Errorf("subtask %q is done, want it open", subtask.Task)
+		}
+
+		if subtask.Recurrence != "" {
+			t.Errorf("subtask %q repeats %q, want no recurrence", subtask.Task, subtask.Recurrence)
+		}
+	}
+
+	if subtasks[0].Priority != 2 || subtasks[0].Notes != "empty it" {
+		t.Errorf("got priority %d and notes %q, want them copied", subtasks[0].Priority, subtasks[0].Notes)
+	}
+
+	if want := time.Date(2024, time.February, 7, 9, 0, 0, 0, time.UTC); !subtasks[0].Due.Equal(want) {
+		t.Errorf("got due %v, want %v", subtasks[0].Due, want)
+	}
+
+	if subtasks[1].HasDue() {
+		t.Errorf("got due %v for a subtask without one", subtasks[1].Due)
+	}
+
+	if !subtree[1].Done || subtree[3].Recurrence == "" {
+		t.Error("the finished subtasks were changed")
+	}
+}
+
+func TestNextSubtasksWithoutSubtasks(t *testing.T) {
+	if subtasks := nextSubtasks([]entity.Todo{{Id: 1, Recurrence: "FREQ=DAILY"}}, 1); len(subtasks) != 0 {
+		t.Errorf("got %d subtasks, want none", len(subtasks))
+	}
+}
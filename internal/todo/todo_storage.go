@@ -2,47 +2,248 @@ package todo
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/skaisanlahti/try-go-htmx/internal/entity"
 )
 
+// uniqueViolation is the Postgres error code for a unique constraint or index violation.
+const uniqueViolation = "23505"
+
+func isUniqueViolation(err error) bool {
+	var pgError *pgconn.PgError
+	return errors.As(err, &pgError) && pgError.Code == uniqueViolation
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx so the storage works inside and outside of
+// transactions.
+type queryer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
 type todoStorage struct {
 	database *sql.DB
+	queryer  queryer
 }
 
 func newTodoStorage(database *sql.DB) *todoStorage {
-	return &todoStorage{database}
+	return &todoStorage{database, database}
 }
 
-func (this *todoStorage) listExists(name string) (entity.TodoList, error) {
-	var todoList entity.TodoList
-	query := `SELECT EXISTS(SELECT 1 FROM "TodoLists" WHERE "Name" = $1 )`
-	row := this.database.QueryRow(query, name)
-	if err := row.Scan(&todoList.Id, &todoList.Name, &todoList.UserId); err != nil {
+// transaction runs work with a storage bound to a single transaction. The transaction is
+// committed when work returns nil and rolled back otherwise.
+func (this *todoStorage) transaction(work func(storage *todoStorage) error) error {
+	tx, err := this.database.Begin()
+	if err != nil {
 		log.Println(err.Error())
-		return todoList, err
+		return err
 	}
+	defer tx.Rollback()
 
-	return todoList, nil
+	if err = work(&todoStorage{this.database, tx}); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (this *todoStorage) findTodoListById(listId int) (entity.TodoList, error) {
-	var todoList entity.TodoList
-	query := `SELECT * FROM "TodoLists" WHERE "Id" = $1`
-	row := this.database.QueryRow(query, listId)
-	if err := row.Scan(&todoList.Id, &todoList.Name, &todoList.UserId); err != nil {
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTodo(row rowScanner, extra ...any) (entity.Todo, error) {
+	var todo entity.Todo
+	var due sql.NullTime
+	var parentId sql.NullInt64
+	fields := []any{&todo.Id, &todo.Task, &todo.Done, &todo.TodoListId, &todo.Position, &due, &todo.DueHasTime, &todo.Priority, &parentId, &todo.Recurrence, &todo.Notes}
+	err := row.Scan(append(fields, extra...)...)
+	todo.Due = due.Time
+	todo.ParentId = int(parentId.Int64)
+	return todo, err
+}
+
+// scanTodos reads todos followed by their depth when withDepth is set.
+func scanTodos(rows *sql.Rows, withDepth bool) ([]entity.Todo, error) {
+	var todos []entity.Todo
+	defer rows.Close()
+	for rows.Next() {
+		var todo entity.Todo
+		var err error
+		if withDepth {
+			var depth int
+			todo, err = scanTodo(rows, &depth)
+			todo.Depth = depth
+		} else {
+			todo, err = scanTodo(rows)
+		}
+
+		if err != nil {
+			log.Println(err.Error())
+			return todos, err
+		}
+
+		todos = append(todos, todo)
+	}
+
+	return todos, rows.Err()
+}
+
+// scanScheduledTodos reads todos followed by the name of their list.
+func scanScheduledTodos(rows *sql.Rows) ([]entity.ScheduledTodo, error) {
+	var todos []entity.ScheduledTodo
+	defer rows.Close()
+	for rows.Next() {
+		var todo entity.ScheduledTodo
+		var err error
+		todo.Todo, err = scanTodo(rows, &todo.ListName)
+		if err != nil {
+			log.Println(err.Error())
+			return todos, err
+		}
+
+		todos = append(todos, todo)
+	}
+
+	return todos, rows.Err()
+}
+
+// notify sends the event to every instance listening for todo events. Inside a transaction the
+// event is only sent once the transaction commits.
+func (this *todoStorage) notify(event TodoEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if _, err = this.queryer.Exec(`SELECT pg_notify($1, $2)`, todoEventChannel, string(payload)); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// nullTime stores the zero time as NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// nullId stores the zero id as NULL.
+func nullId(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// listExists checks whether the user already has a list with the name, ignoring case.
+func (this *todoStorage) listExists(name string, userId int) (bool, error) {
+	exists := false
+	query := `SELECT EXISTS(SELECT 1 FROM "TodoLists" WHERE "UserId" = $1 AND lower("Name") = lower($2) AND "DeletedAt" IS NULL)`
+	if err := this.queryer.QueryRow(query, userId, name).Scan(&exists); err != nil {
+		log.Println(err.Error())
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// findListRole returns the role of the user in the list, empty if the list isn't shared with them.
+// It's used to tell a missing list from someone else's list after a member scoped query matched
+// nothing. A list in the trash is missing.
+func (this *todoStorage) findListRole(listId int, userId int) (string, error) {
+	var role string
+	query := `
+		SELECT COALESCE(m."Role", '') FROM "TodoLists" l 
+		LEFT JOIN "TodoListMembers" m ON m."TodoListId" = l."Id" AND m."UserId" = $2 
+		WHERE l."Id" = $1 AND l."DeletedAt" IS NULL`
+	err := this.queryer.QueryRow(query, listId, userId).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrListNotFound
+	}
+
+	if err != nil {
+		log.Println(err.Error())
+		return "", err
+	}
+
+	return role, nil
+}
+
+// findTodoRole returns the role of the user in the list the todo belongs to, also when the todo is
+// in the trash.
+func (this *todoStorage) findTodoRole(todoId int, userId int) (string, error) {
+	var role string
+	query := `
+		SELECT COALESCE(m."Role", '') FROM "Todos" t 
+		LEFT JOIN "TodoListMembers" m ON m."TodoListId" = t."TodoListId" AND m."UserId" = $2 
+		WHERE t."Id" = $1`
+	err := this.queryer.QueryRow(query, todoId, userId).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrTodoNotFound
+	}
+
+	if err != nil {
 		log.Println(err.Error())
+		return "", err
+	}
+
+	return role, nil
+}
+
+// findTodoOwner returns the id of the user owning the list the todo belongs to.
+func (this *todoStorage) findTodoOwner(todoId int) (int, error) {
+	var userId int
+	query := `
+		SELECT l."UserId" FROM "Todos" t 
+		JOIN "TodoLists" l ON l."Id" = t."TodoListId" 
+		WHERE t."Id" = $1`
+	err := this.queryer.QueryRow(query, todoId).Scan(&userId)
+	if err == sql.ErrNoRows {
+		return 0, ErrTodoNotFound
+	}
+
+	if err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+
+	return userId, nil
+}
+
+func (this *todoStorage) findTodoListById(listId int, userId int) (entity.TodoList, error) {
+	var todoList entity.TodoList
+	query := `
+		SELECT l."Id", l."Name", l."UserId", u."Name", m."Role" FROM "TodoLists" l 
+		JOIN "TodoListMembers" m ON m."TodoListId" = l."Id" 
+		JOIN "Users" u ON u."Id" = l."UserId" 
+		WHERE l."Id" = $1 AND m."UserId" = $2 AND l."DeletedAt" IS NULL`
+	row := this.queryer.QueryRow(query, listId, userId)
+	if err := row.Scan(&todoList.Id, &todoList.Name, &todoList.UserId, &todoList.OwnerName, &todoList.Role); err != nil {
+		if err != sql.ErrNoRows {
+			log.Println(err.Error())
+		}
+
 		return todoList, err
 	}
 
 	return todoList, nil
 }
 
+// findTodoListsByUserId returns the lists the user owns followed by the lists shared with them.
 func (this *todoStorage) findTodoListsByUserId(userId int) []entity.TodoList {
 	var todoLists []entity.TodoList
-	query := `SELECT * FROM "TodoLists" WHERE "UserId" = $1 ORDER BY "Name" ASC`
-	rows, err := this.database.Query(query, userId)
+	query := `
+		SELECT l."Id", l."Name", l."UserId", u."Name", m."Role" FROM "TodoLists" l 
+		JOIN "TodoListMembers" m ON m."TodoListId" = l."Id" 
+		JOIN "Users" u ON u."Id" = l."UserId" 
+		WHERE m."UserId" = $1 AND l."DeletedAt" IS NULL 
+		ORDER BY m."Role" = 'owner' DESC, l."Name" ASC`
+	rows, err := this.queryer.Query(query, userId)
 	if err != nil {
 		log.Println(err.Error())
 		return todoLists
@@ -51,7 +252,7 @@ func (this *todoStorage) findTodoListsByUserId(userId int) []entity.TodoList {
 	defer rows.Close()
 	for rows.Next() {
 		var list entity.TodoList
-		if err := rows.Scan(&list.Id, &list.Name, &list.UserId); err != nil {
+		if err := rows.Scan(&list.Id, &list.Name, &list.UserId, &list.OwnerName, &list.Role); err != nil {
 			log.Println(err.Error())
 			return todoLists
 		}
@@ -62,9 +263,593 @@ func (this *todoStorage) findTodoListsByUserId(userId int) []entity.TodoList {
 	return todoLists
 }
 
-func (this *todoStorage) insertTodoList(list entity.TodoList) error {
-	query := `INSERT INTO "TodoLists" ("Name", "UserId") VALUES ($1, $2)`
-	if _, err := this.database.Exec(query, list.Name, list.UserId); err != nil {
+// findTodoListPage returns the lists shared with the user that come after the after key and up to
+// the through key in the order of findTodoListsByUserId, at most limit of them. Keys with a zero id
+// don't bound the page.
+func (this *todoStorage) findTodoListPage(userId int, after ListCursor, through ListCursor, limit int) ([]entity.TodoList, error) {
+	var todoLists []entity.TodoList
+	query := `
+		SELECT l."Id", l."Name", l."UserId", u."Name", m."Role" FROM "TodoLists" l 
+		JOIN "TodoListMembers" m ON m."TodoListId" = l."Id" 
+		JOIN "Users" u ON u."Id" = l."UserId" 
+		WHERE m."UserId" = $1 AND l."DeletedAt" IS NULL 
+		AND ($2 = 0 OR (m."Role" <> 'owner', l."Name", l."Id") > ($3, $4, $2)) 
+		AND ($5 = 0 OR (m."Role" <> 'owner', l."Name", l."Id") <= ($6, $7, $5)) 
+		ORDER BY m."Role" <> 'owner' ASC, l."Name" ASC, l."Id" ASC LIMIT $8`
+	rows, err := this.queryer.Query(query, userId, after.Id, after.Shared, after.Name, through.Id, through.Shared, through.Name, limit)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var list entity.TodoList
+		if err := rows.Scan(&list.Id, &list.Name, &list.UserId, &list.OwnerName, &list.Role); err != nil {
+			log.Println(err.Error())
+			return todoLists, err
+		}
+
+		todoLists = append(todoLists, list)
+	}
+
+	return todoLists, rows.Err()
+}
+
+func (this *todoStorage) countTodoLists(userId int) (int, error) {
+	var count int
+	query := `
+		SELECT count(*) FROM "TodoLists" l 
+		JOIN "TodoListMembers" m ON m."TodoListId" = l."Id" 
+		WHERE m."UserId" = $1 AND l."DeletedAt" IS NULL`
+	if err := this.queryer.QueryRow(query, userId).Scan(&count); err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// insertTodoList adds the list with its owner as the first member. ErrListAlreadyExists is
+// returned if a list with the same name was added after the existence check.
+func (this *todoStorage) insertTodoList(list entity.TodoList) (int, error) {
+	var listId int
+	query := `
+		WITH list AS (INSERT INTO "TodoLists" ("Name", "UserId") VALUES ($1, $2) RETURNING "Id", "UserId") 
+		INSERT INTO "TodoListMembers" ("TodoListId", "UserId", "Role") 
+		SELECT "Id", "UserId", 'owner' FROM list 
+		RETURNING "TodoListId"`
+	if err := this.queryer.QueryRow(query, list.Name, list.UserId).Scan(&listId); err != nil {
+		if isUniqueViolation(err) {
+			return 0, ErrListAlreadyExists
+		}
+
+		log.Println(err.Error())
+		return 0, err
+	}
+
+	return listId, nil
+}
+
+// renameTodoList returns the renamed list and its previous name. sql.ErrNoRows is returned if the
+// user owns no such list and ErrListAlreadyExists if another list of the user has the name.
+func (this *todoStorage) renameTodoList(listId int, userId int, name string) (entity.TodoList, string, error) {
+	var list entity.TodoList
+	var previousName string
+	query := `
+		UPDATE "TodoLists" l SET "Name" = $3 FROM "TodoLists" previous 
+		WHERE l."Id" = $1 AND l."UserId" = $2 AND l."DeletedAt" IS NULL AND previous."Id" = l."Id" 
+		RETURNING l."Id", l."Name", l."UserId", previous."Name"`
+	err := this.queryer.QueryRow(query, listId, userId, name).Scan(&list.Id, &list.Name, &list.UserId, &previousName)
+	if isUniqueViolation(err) {
+		return list, "", ErrListAlreadyExists
+	}
+
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err.Error())
+	}
+
+	return list, previousName, err
+}
+
+// trashTodoList reports whether a list owned by the user was moved to the trash. Its todos stay as
+// they are and come back with it.
+func (this *todoStorage) trashTodoList(listId int, userId int) (bool, error) {
+	query := `UPDATE "TodoLists" SET "DeletedAt" = now() WHERE "Id" = $1 AND "UserId" = $2 AND "DeletedAt" IS NULL`
+	return this.execAffects(query, listId, userId)
+}
+
+// restoreTodoList reports whether a list of the user was taken out of the trash.
+// ErrListAlreadyExists is returned if the user has since added another list with the same name.
+func (this *todoStorage) restoreTodoList(listId int, userId int) (bool, error) {
+	query := `UPDATE "TodoLists" SET "DeletedAt" = NULL WHERE "Id" = $1 AND "UserId" = $2 AND "DeletedAt" IS NOT NULL`
+	restored, err := this.execAffects(query, listId, userId)
+	if isUniqueViolation(err) {
+		return false, ErrListAlreadyExists
+	}
+
+	return restored, err
+}
+
+// purgeTodoList reports whether a list of the user was deleted from the trash for good, along with
+// its todos.
+func (this *todoStorage) purgeTodoList(listId int, userId int) (bool, error) {
+	query := `DELETE FROM "TodoLists" WHERE "Id" = $1 AND "UserId" = $2 AND "DeletedAt" IS NOT NULL`
+	return this.execAffects(query, listId, userId)
+}
+
+// findTrashedLists returns the lists of the user in the trash, the latest removed first.
+func (this *todoStorage) findTrashedLists(userId int) ([]entity.TrashedList, error) {
+	var lists []entity.TrashedList
+	query := `
+		SELECT l."Id", l."Name", l."UserId", l."DeletedAt", 
+		(SELECT COUNT(*) FROM "Todos" t WHERE t."TodoListId" = l."Id" AND t."DeletedAt" IS NULL) FROM "TodoLists" l 
+		WHERE l."UserId" = $1 AND l."DeletedAt" IS NOT NULL 
+		ORDER BY l."DeletedAt" DESC, l."Id" DESC`
+	rows, err := this.queryer.Query(query, userId)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		list := entity.TrashedList{TodoList: entity.TodoList{Role: entity.ListRoleOwner}}
+		if err := rows.Scan(&list.Id, &list.Name, &list.UserId, &list.DeletedAt, &list.TodoCount); err != nil {
+			log.Println(err.Error())
+			return lists, err
+		}
+
+		lists = append(lists, list)
+	}
+
+	return lists, rows.Err()
+}
+
+// execAffects runs the query and reports whether it changed any rows.
+func (this *todoStorage) execAffects(query string, args ...any) (bool, error) {
+	result, err := this.queryer.Exec(query, args...)
+	if err != nil {
+		log.Println(err.Error())
+		return false, err
+	}
+
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// findListMembers returns the members of the list, the owner first.
+func (this *todoStorage) findListMembers(listId int) ([]entity.TodoListMember, error) {
+	var members []entity.TodoListMember
+	query := `
+		SELECT m."TodoListId", m."UserId", u."Name", m."Role" FROM "TodoListMembers" m 
+		JOIN "Users" u ON u."Id" = m."UserId" 
+		WHERE m."TodoListId" = $1 
+		ORDER BY m."Role" = 'owner' DESC, lower(u."Name") ASC`
+	rows, err := this.queryer.Query(query, listId)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var member entity.TodoListMember
+		if err := rows.Scan(&member.TodoListId, &member.UserId, &member.UserName, &member.Role); err != nil {
+			log.Println(err.Error())
+			return members, err
+		}
+
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// upsertListMember shares the list with the user by name or changes their role if it's already
+// shared with them. It reports false when there's no such user or the user owns the list.
+func (this *todoStorage) upsertListMember(listId int, userName string, role string) (bool, error) {
+	query := `
+		INSERT INTO "TodoListMembers" ("TodoListId", "UserId", "Role") 
+		SELECT $1, u."Id", $3 FROM "Users" u WHERE u."Name" = $2 
+		ON CONFLICT ("TodoListId", "UserId") DO UPDATE SET "Role" = EXCLUDED."Role" 
+		WHERE "TodoListMembers"."Role" <> 'owner'`
+	result, err := this.queryer.Exec(query, listId, userName, role)
+	if err != nil {
+		log.Println(err.Error())
+		return false, err
+	}
+
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// deleteListMember reports whether the list was unshared from the user. The owner can't be
+// removed.
+func (this *todoStorage) deleteListMember(listId int, userId int) (bool, error) {
+	query := `DELETE FROM "TodoListMembers" WHERE "TodoListId" = $1 AND "UserId" = $2 AND "Role" <> 'owner'`
+	result, err := this.queryer.Exec(query, listId, userId)
+	if err != nil {
+		log.Println(err.Error())
+		return false, err
+	}
+
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// findTodosByListId returns the todos of a list of the user matching the filter. An empty tag and
+// done state match every todo, priority matches the given level and above.
+func (this *todoStorage) findTodosByListId(listId int, userId int, filter TodoFilter) ([]entity.Todo, error) {
+	query := `
+		WITH RECURSIVE tree AS (
+			SELECT "Id", 0 AS "Depth" FROM "Todos" WHERE "TodoListId" = $1 AND "ParentId" IS NULL AND "DeletedAt" IS NULL 
+			UNION ALL 
+			SELECT c."Id", tree."Depth" + 1 FROM "Todos" c JOIN tree ON c."ParentId" = tree."Id" WHERE c."DeletedAt" IS NULL
+		)
+		SELECT t."Id", t."Task", t."Done", t."TodoListId", t."Position", t."Due", t."DueHasTime", t."Priority", t."ParentId", t."Recurrence", t."Notes", tree."Depth" FROM "Todos" t 
+		JOIN tree ON tree."Id" = t."Id" 
+		JOIN "TodoLists" l ON l."Id" = t."TodoListId" 
+		JOIN "TodoListMembers" m ON m."TodoListId" = t."TodoListId" 
+		WHERE t."TodoListId" = $1 AND m."UserId" = $2 AND l."DeletedAt" IS NULL 
+		AND ($3 = '' OR EXISTS(
+			SELECT 1 FROM "TodoTags" tt JOIN "Tags" tg ON tg."Id" = tt."TagId" 
+			WHERE tt."TodoId" = t."Id" AND lower(tg."Name") = lower($3)
+		)) 
+		AND t."Priority" >= $4 
+		AND ($5 = '' OR t."Done" = ($5 = 'done')) 
+		ORDER BY t."Position" ASC, t."Id" ASC`
+	rows, err := this.queryer.Query(query, listId, userId, filter.Tag, filter.Priority, filter.Done)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return scanTodos(rows, true)
+}
+
+// findTopTodoKeys returns the keys of the top level todos of a list shared with the user that come
+// after the after key and up to the through key, at most limit of them. Keys with a zero id don't
+// bound the page. With a filter only the todos with a match among them or their subtasks count.
+func (this *todoStorage) findTopTodoKeys(listId int, userId int, filter TodoFilter, after TodoCursor, through TodoCursor, limit int) ([]TodoCursor, error) {
+	query := `
+		WITH RECURSIVE matched AS (
+			SELECT t."Id", t."ParentId" FROM "Todos" t 
+			WHERE t."TodoListId" = $1 AND t."DeletedAt" IS NULL 
+			AND ($3 = '' OR EXISTS(
+				SELECT 1 FROM "TodoTags" tt JOIN "Tags" tg ON tg."Id" = tt."TagId" 
+				WHERE tt."TodoId" = t."Id" AND lower(tg."Name") = lower($3)
+			)) 
+			AND t."Priority" >= $4 
+			AND ($5 = '' OR t."Done" = ($5 = 'done')) 
+			UNION 
+			SELECT p."Id", p."ParentId" FROM "Todos" p JOIN matched ON p."Id" = matched."ParentId" WHERE p."DeletedAt" IS NULL
+		)
+		SELECT t."Position", t."Id" FROM "Todos" t 
+		JOIN matched ON matched."Id" = t."Id" 
+		JOIN "TodoLists" l ON l."Id" = t."TodoListId" 
+		JOIN "TodoListMembers" m ON m."TodoListId" = t."TodoListId" 
+		WHERE t."TodoListId" = $1 AND m."UserId" = $2 AND l."DeletedAt" IS NULL AND t."ParentId" IS NULL 
+		AND ($7 = 0 OR (t."Position", t."Id") > ($6, $7)) 
+		AND ($9 = 0 OR (t."Position", t."Id") <= ($8, $9)) 
+		ORDER BY t."Position" ASC, t."Id" ASC LIMIT $10`
+	args := []any{listId, userId, filter.Tag, filter.Priority, filter.Done, after.Position, after.Id, through.Position, through.Id, limit}
+
+	// without a filter every top level todo counts, which the index reads a page of at a time
+	if filter == (TodoFilter{}) {
+		query = `
+			SELECT t."Position", t."Id" FROM "Todos" t 
+			JOIN "TodoLists" l ON l."Id" = t."TodoListId" 
+			JOIN "TodoListMembers" m ON m."TodoListId" = t."TodoListId" 
+			WHERE t."TodoListId" = $1 AND m."UserId" = $2 AND l."DeletedAt" IS NULL 
+			AND t."ParentId" IS NULL AND t."DeletedAt" IS NULL 
+			AND ($4 = 0 OR (t."Position", t."Id") > ($3, $4)) 
+			AND ($6 = 0 OR (t."Position", t."Id") <= ($5, $6)) 
+			ORDER BY t."Position" ASC, t."Id" ASC LIMIT $7`
+		args = []any{listId, userId, after.Position, after.Id, through.Position, through.Id, limit}
+	}
+
+	rows, err := this.queryer.Query(query, args...)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	defer rows.Close()
+	var keys []TodoCursor
+	for rows.Next() {
+		var key TodoCursor
+		if err := rows.Scan(&key.Position, &key.Id); err != nil {
+			log.Println(err.Error())
+			return keys, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// findTodosUnder returns the top level todos with their subtasks that match the filter, in the
+// order of the list.
+func (this *todoStorage) findTodosUnder(listId int, userId int, filter TodoFilter, todoIds []int) ([]entity.Todo, error) {
+	if len(todoIds) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		WITH RECURSIVE tree AS (
+			SELECT "Id", 0 AS "Depth" FROM "Todos" WHERE "TodoListId" = $1 AND "Id" = ANY($6) AND "ParentId" IS NULL AND "DeletedAt" IS NULL 
+			UNION ALL 
+			SELECT c."Id", tree."Depth" + 1 FROM "Todos" c JOIN tree ON c."ParentId" = tree."Id" WHERE c."DeletedAt" IS NULL
+		)
+		SELECT t."Id", t."Task", t."Done", t."TodoListId", t."Position", t."Due", t."DueHasTime", t."Priority", t."ParentId", t."Recurrence", t."Notes", tree."Depth" FROM "Todos" t 
+		JOIN tree ON tree."Id" = t."Id" 
+		JOIN "TodoLists" l ON l."Id" = t."TodoListId" 
+		JOIN "TodoListMembers" m ON m."TodoListId" = t."TodoListId" 
+		WHERE t."TodoListId" = $1 AND m."UserId" = $2 AND l."DeletedAt" IS NULL 
+		AND ($3 = '' OR EXISTS(
+			SELECT 1 FROM "TodoTags" tt JOIN "Tags" tg ON tg."Id" = tt."TagId" 
+			WHERE tt."TodoId" = t."Id" AND lower(tg."Name") = lower($3)
+		)) 
+		AND t."Priority" >= $4 
+		AND ($5 = '' OR t."Done" = ($5 = 'done')) 
+		ORDER BY t."Position" ASC, t."Id" ASC`
+	rows, err := this.queryer.Query(query, listId, userId, filter.Tag, filter.Priority, filter.Done, todoIds)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return scanTodos(rows, true)
+}
+
+// countTodos returns how many todos of a list shared with the user match the filter, subtasks
+// included. Subtasks go to the trash with their parents, so the todos outside of it are the ones
+// shown.
+func (this *todoStorage) countTodos(listId int, userId int, filter TodoFilter) (int, error) {
+	var count int
+	query := `
+		SELECT count(*) FROM "Todos" t 
+		JOIN "TodoLists" l ON l."Id" = t."TodoListId" 
+		JOIN "TodoListMembers" m ON m."TodoListId" = t."TodoListId" 
+		WHERE t."TodoListId" = $1 AND m."UserId" = $2 AND l."DeletedAt" IS NULL AND t."DeletedAt" IS NULL 
+		AND ($3 = '' OR EXISTS(
+			SELECT 1 FROM "TodoTags" tt JOIN "Tags" tg ON tg."Id" = tt."TagId" 
+			WHERE tt."TodoId" = t."Id" AND lower(tg."Name") = lower($3)
+		)) 
+		AND t."Priority" >= $4 
+		AND ($5 = '' OR t."Done" = ($5 = 'done'))`
+	if err := this.queryer.QueryRow(query, listId, userId, filter.Tag, filter.Priority, filter.Done).Scan(&count); err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// findTodoById returns a todo of any list shared with the user. Todos in the trash or in a list in
+// the trash aren't found.
+func (this *todoStorage) findTodoById(todoId int, userId int) (entity.Todo, error) {
+	query := `
+		SELECT t."Id", t."Task", t."Done", t."TodoListId", t."Position", t."Due", t."DueHasTime", t."Priority", t."ParentId", t."Recurrence", t."Notes" FROM "Todos" t 
+		JOIN "TodoLists" l ON l."Id" = t."TodoListId" 
+		JOIN "TodoListMembers" m ON m."TodoListId" = t."TodoListId" 
+		WHERE t."Id" = $1 AND m."UserId" = $2 AND t."DeletedAt" IS NULL AND l."DeletedAt" IS NULL`
+	return scanTodo(this.queryer.QueryRow(query, todoId, userId))
+}
+
+// insertTodo adds the todo to the end of its list only if the user can edit the list.
+// sql.ErrNoRows is returned when they can't.
+func (this *todoStorage) insertTodo(todo entity.Todo, userId int) (int, error) {
+	var todoId int
+	query := `
+		INSERT INTO "Todos" ("Task", "Done", "TodoListId", "Position", "Due", "DueHasTime", "Priority", "ParentId", "Recurrence", "Notes") 
+		SELECT $1, $2, m."TodoListId", COALESCE((SELECT MAX("Position") FROM "Todos" WHERE "TodoListId" = m."TodoListId"), 0) + $5, $6, $7, $8, $9, $10, $11 
+		FROM "TodoListMembers" m JOIN "TodoLists" l ON l."Id" = m."TodoListId" 
+		WHERE m."TodoListId" = $3 AND m."UserId" = $4 AND m."Role" IN ('owner', 'editor') AND l."DeletedAt" IS NULL 
+		RETURNING "Id"`
+	row := this.queryer.QueryRow(query, todo.Task, todo.Done, todo.TodoListId, userId, entity.TodoPositionGap, nullTime(todo.Due), todo.DueHasTime, todo.Priority, nullId(todo.ParentId), todo.Recurrence, todo.Notes)
+	err := row.Scan(&todoId)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err.Error())
+	}
+
+	return todoId, err
+}
+
+func (this *todoStorage) updateTodo(todo entity.Todo) error {
+	query := `UPDATE "Todos" SET "Task" = $2, "Done" = $3, "Recurrence" = $4 WHERE "Id" = $1`
+	if _, err := this.queryer.Exec(query, todo.Id, todo.Task, todo.Done, todo.Recurrence); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// updateTodoDetails sets the fields of the edit form and returns the updated todo with its previous
+// task. sql.ErrNoRows is returned if the user can't edit such a todo.
+func (this *todoStorage) updateTodoDetails(todo entity.Todo, userId int) (entity.Todo, string, error) {
+	var previousTask string
+	query := `
+		UPDATE "Todos" t SET "Task" = $3, "Due" = $4, "DueHasTime" = $5, "Priority" = $6, "Recurrence" = $7 FROM "TodoListMembers" m, "TodoLists" l, "Todos" previous 
+		WHERE t."Id" = $1 AND m."TodoListId" = t."TodoListId" AND m."UserId" = $2 AND m."Role" IN ('owner', 'editor') 
+		AND l."Id" = t."TodoListId" AND t."DeletedAt" IS NULL AND l."DeletedAt" IS NULL AND previous."Id" = t."Id" 
+		RETURNING t."Id", t."Task", t."Done", t."TodoListId", t."Position", t."Due", t."DueHasTime", t."Priority", t."ParentId", t."Recurrence", t."Notes", previous."Task"`
+	row := this.queryer.QueryRow(query, todo.Id, userId, todo.Task, nullTime(todo.Due), todo.DueHasTime, todo.Priority, todo.Recurrence)
+	updatedTodo, err := scanTodo(row, &previousTask)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err.Error())
+	}
+
+	return updatedTodo, previousTask, err
+}
+
+// updateTodoNotes returns false if the user can't edit such a todo.
+func (this *todoStorage) updateTodoNotes(todoId int, userId int, notes string) (bool, error) {
+	query := `
+		UPDATE "Todos" t SET "Notes" = $3 FROM "TodoListMembers" m, "TodoLists" l 
+		WHERE t."Id" = $1 AND m."TodoListId" = t."TodoListId" AND m."UserId" = $2 AND m."Role" IN ('owner', 'editor') 
+		AND l."Id" = t."TodoListId" AND t."DeletedAt" IS NULL AND l."DeletedAt" IS NULL`
+	result, err := this.queryer.Exec(query, todoId, userId, notes)
+	if err != nil {
+		log.Println(err.Error())
+		return false, err
+	}
+
+	count, err := result.RowsAffected()
+	return count > 0, err
+}
+
+// findTodosDueBetween returns the todos of every list of the user due from the start up to but
+// not including the end. Both are wall clock times.
+func (this *todoStorage) findTodosDueBetween(userId int, start time.Time, end time.Time) ([]entity.ScheduledTodo, error) {
+	query := `
+		SELECT t."Id", t."Task", t."Done", t."TodoListId", t."Position", t."Due", t."DueHasTime", t."Priority", t."ParentId", t."Recurrence", t."Notes", l."Name" FROM "Todos" t 
+		JOIN "TodoLists" l ON l."Id" = t."TodoListId" 
+		JOIN "TodoListMembers" m ON m."TodoListId" = l."Id" 
+		WHERE m."UserId" = $1 AND t."Due" >= $2 AND t."Due" < $3 AND t."DeletedAt" IS NULL AND l."DeletedAt" IS NULL 
+		ORDER BY t."Due" ASC, t."DueHasTime" ASC, t."Position" ASC`
+	rows, err := this.queryer.Query(query, userId, start, end)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return scanScheduledTodos(rows)
+}
+
+// findCalendarTodos returns the todos with a due date of every list shared with the user, leaving
+// out the finished ones due before the wall clock time since.
+func (this *todoStorage) findCalendarTodos(userId int, since time.Time) ([]entity.ScheduledTodo, error) {
+	query := `
+		SELECT t."Id", t."Task", t."Done", t."TodoListId", t."Position", t."Due", t."DueHasTime", t."Priority", t."ParentId", t."Recurrence", t."Notes", l."Name" FROM "Todos" t 
+		JOIN "TodoLists" l ON l."Id" = t."TodoListId" 
+		JOIN "TodoListMembers" m ON m."TodoListId" = l."Id" 
+		WHERE m."UserId" = $1 AND t."Due" IS NOT NULL AND (NOT t."Done" OR t."Due" >= $2) 
+		AND t."DeletedAt" IS NULL AND l."DeletedAt" IS NULL 
+		ORDER BY t."Due" ASC, t."Id" ASC`
+	rows, err := this.queryer.Query(query, userId, since)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return scanScheduledTodos(rows)
+}
+
+// findOverdueTodos returns the unfinished todos of every list of the user that were due before
+// today, or before now when they have a due time.
+func (this *todoStorage) findOverdueTodos(userId int, today time.Time, now time.Time) ([]entity.ScheduledTodo, error) {
+	query := `
+		SELECT t."Id", t."Task", t."Done", t."TodoListId", t."Position", t."Due", t."DueHasTime", t."Priority", t."ParentId", t."Recurrence", t."Notes", l."Name" FROM "Todos" t 
+		JOIN "TodoLists" l ON l."Id" = t."TodoListId" 
+		JOIN "TodoListMembers" m ON m."TodoListId" = l."Id" 
+		WHERE m."UserId" = $1 AND NOT t."Done" AND t."DeletedAt" IS NULL AND l."DeletedAt" IS NULL 
+		AND ((t."DueHasTime" AND t."Due" < $3) OR (NOT t."DueHasTime" AND t."Due" < $2)) 
+		ORDER BY t."Due" ASC, t."Position" ASC`
+	rows, err := this.queryer.Query(query, userId, today, now)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return scanScheduledTodos(rows)
+}
+
+// searchHeadlineOptions marks the matches in snippets so they can be highlighted once escaped.
+var searchHeadlineOptions = fmt.Sprintf("StartSel=%s, StopSel=%s, MaxFragments=2, MaxWords=20, MinWords=5, FragmentDelimiter=\" … \"", entity.SnippetMarkStart, entity.SnippetMarkEnd)
+
+// searchTodos returns the todos of every list of the user matching the query, best matches first.
+// The query is read like a web search, so quoted phrases, "or" and "-word" work.
+func (this *todoStorage) searchTodos(userId int, search string, limit int) ([]entity.TodoSearchResult, error) {
+	query := `
+		SELECT t."Id", t."Task", t."Done", t."TodoListId", t."Position", t."Due", t."DueHasTime", t."Priority", t."ParentId", t."Recurrence", t."Notes", l."Name", 
+		ts_headline('english', t."Task" || E'\n' || t."Notes", q, $3) FROM "Todos" t 
+		JOIN "TodoLists" l ON l."Id" = t."TodoListId" 
+		JOIN "TodoListMembers" m ON m."TodoListId" = l."Id" 
+		CROSS JOIN websearch_to_tsquery('english', $2) q 
+		WHERE m."UserId" = $1 AND t."Search" @@ q AND t."DeletedAt" IS NULL AND l."DeletedAt" IS NULL 
+		ORDER BY ts_rank(t."Search", q) DESC, t."Id" DESC 
+		LIMIT $4`
+	rows, err := this.queryer.Query(query, userId, search, searchHeadlineOptions, limit)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	var results []entity.TodoSearchResult
+	defer rows.Close()
+	for rows.Next() {
+		var result entity.TodoSearchResult
+		result.Todo, err = scanTodo(rows, &result.ListName, &result.Snippet)
+		if err != nil {
+			log.Println(err.Error())
+			return results, err
+		}
+
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// lockTodoList locks a list the user can edit until the transaction ends, so todos of the list are
+// added and moved one at a time. sql.ErrNoRows is returned if the user can't edit such a list.
+func (this *todoStorage) lockTodoList(listId int, userId int) error {
+	var id int
+	query := `
+		SELECT l."Id" FROM "TodoLists" l 
+		JOIN "TodoListMembers" m ON m."TodoListId" = l."Id" 
+		WHERE l."Id" = $1 AND m."UserId" = $2 AND m."Role" IN ('owner', 'editor') AND l."DeletedAt" IS NULL 
+		FOR UPDATE OF l`
+	err := this.queryer.QueryRow(query, listId, userId).Scan(&id)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err.Error())
+	}
+
+	return err
+}
+
+// findPreviousPosition returns the position of the todo directly before the position, ignoring
+// the todo being moved. The bool is false when there is no such todo.
+func (this *todoStorage) findPreviousPosition(listId int, position int64, exceptTodoId int) (int64, bool, error) {
+	query := `
+		SELECT "Position" FROM "Todos" 
+		WHERE "TodoListId" = $1 AND "Position" < $2 AND "Id" <> $3 
+		ORDER BY "Position" DESC LIMIT 1`
+	return this.findPosition(query, listId, position, exceptTodoId)
+}
+
+// findNextPosition returns the position of the todo directly after the position, ignoring the
+// todo being moved. The bool is false when there is no such todo.
+func (this *todoStorage) findNextPosition(listId int, position int64, exceptTodoId int) (int64, bool, error) {
+	query := `
+		SELECT "Position" FROM "Todos" 
+		WHERE "TodoListId" = $1 AND "Position" > $2 AND "Id" <> $3 
+		ORDER BY "Position" ASC LIMIT 1`
+	return this.findPosition(query, listId, position, exceptTodoId)
+}
+
+func (this *todoStorage) findPosition(query string, args ...any) (int64, bool, error) {
+	var position int64
+	err := this.queryer.QueryRow(query, args...).Scan(&position)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+
+	if err != nil {
+		log.Println(err.Error())
+		return 0, false, err
+	}
+
+	return position, true, nil
+}
+
+func (this *todoStorage) updateTodoPosition(todoId int, position int64) error {
+	query := `UPDATE "Todos" SET "Position" = $2 WHERE "Id" = $1`
+	if _, err := this.queryer.Exec(query, todoId, position); err != nil {
 		log.Println(err.Error())
 		return err
 	}
@@ -72,9 +857,16 @@ func (this *todoStorage) insertTodoList(list entity.TodoList) error {
 	return nil
 }
 
-func (this *todoStorage) deleteTodoList(id int) error {
-	query := `DELETE FROM "TodoLists" WHERE "Id" = $1`
-	if _, err := this.database.Exec(query, id); err != nil {
+// rebalanceTodoList numbers the todos of the list again with full gaps, keeping their order.
+func (this *todoStorage) rebalanceTodoList(listId int) error {
+	query := `
+		UPDATE "Todos" t SET "Position" = ranked."Rank" * $2 
+		FROM (
+			SELECT "Id", row_number() OVER (ORDER BY "Position" ASC, "Id" ASC) AS "Rank" 
+			FROM "Todos" WHERE "TodoListId" = $1
+		) ranked 
+		WHERE t."Id" = ranked."Id"`
+	if _, err := this.queryer.Exec(query, listId, entity.TodoPositionGap); err != nil {
 		log.Println(err.Error())
 		return err
 	}
@@ -82,55 +874,298 @@ func (this *todoStorage) deleteTodoList(id int) error {
 	return nil
 }
 
-func (this *todoStorage) findTodosByListId(todoListId int) []entity.Todo {
-	var todos []entity.Todo
-	query := `SELECT * FROM "Todos" WHERE "TodoListId" = $1 ORDER BY "Task" ASC`
-	rows, err := this.database.Query(query, todoListId)
+// trashTodo reports whether a todo of a list the user can edit was moved to the trash. Its
+// subtasks are moved along with it and share its removal time, so they can be told apart from
+// subtasks removed before it.
+func (this *todoStorage) trashTodo(todoId int, userId int) (bool, error) {
+	query := `
+		WITH RECURSIVE subtree AS (
+			SELECT t."Id" FROM "Todos" t 
+			JOIN "TodoListMembers" m ON m."TodoListId" = t."TodoListId" 
+			WHERE t."Id" = $1 AND t."DeletedAt" IS NULL AND m."UserId" = $2 AND m."Role" IN ('owner', 'editor') 
+			UNION ALL 
+			SELECT c."Id" FROM "Todos" c JOIN subtree s ON c."ParentId" = s."Id" WHERE c."DeletedAt" IS NULL
+		)
+		UPDATE "Todos" SET "DeletedAt" = now() WHERE "Id" IN (SELECT "Id" FROM subtree)`
+	return this.execAffects(query, todoId, userId)
+}
+
+// trashDoneTodos moves the finished todos of the list to the trash with their subtasks, all with
+// the same removal time. It returns the todos that were moved, subtasks included.
+func (this *todoStorage) trashDoneTodos(listId int) ([]entity.Todo, error) {
+	query := `
+		WITH RECURSIVE subtree AS (
+			SELECT "Id" FROM "Todos" WHERE "TodoListId" = $1 AND "Done" AND "DeletedAt" IS NULL 
+			UNION 
+			SELECT c."Id" FROM "Todos" c JOIN subtree s ON c."ParentId" = s."Id" WHERE c."DeletedAt" IS NULL
+		)
+		UPDATE "Todos" t SET "DeletedAt" = now() WHERE t."Id" IN (SELECT "Id" FROM subtree) 
+		RETURNING t."Id", t."Task", t."Done", t."TodoListId", t."Position", t."Due", t."DueHasTime", t."Priority", t."ParentId", t."Recurrence", t."Notes"`
+	rows, err := this.queryer.Query(query, listId)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return scanTodos(rows, false)
+}
+
+// findMissingTodoId returns one of the todos that isn't in the list or is in the trash, zero when
+// they all are in the list.
+func (this *todoStorage) findMissingTodoId(listId int, todoIds []int) (int, error) {
+	var todoId int
+	query := `
+		SELECT id FROM unnest($2::INTEGER[]) AS id 
+		WHERE NOT EXISTS(SELECT 1 FROM "Todos" t WHERE t."Id" = id AND t."TodoListId" = $1 AND t."DeletedAt" IS NULL) 
+		LIMIT 1`
+	err := this.queryer.QueryRow(query, listId, todoIds).Scan(&todoId)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
 	if err != nil {
 		log.Println(err.Error())
-		return todos
+		return 0, err
 	}
 
+	return todoId, nil
+}
+
+// moveSubtree moves the todo with all of its subtasks, also those in the trash, to the end of
+// another list. The todo becomes a top level todo there. It returns the ids of the moved todos.
+func (this *todoStorage) moveSubtree(todoId int, listId int) ([]int, error) {
+	query := `
+		WITH RECURSIVE subtree AS (
+			SELECT "Id" FROM "Todos" WHERE "Id" = $1 
+			UNION ALL 
+			SELECT c."Id" FROM "Todos" c JOIN subtree s ON c."ParentId" = s."Id"
+		)
+		UPDATE "Todos" t SET "TodoListId" = $2, 
+		"ParentId" = CASE WHEN t."Id" = $1 THEN NULL ELSE t."ParentId" END, 
+		"Position" = CASE WHEN t."Id" = $1 THEN COALESCE((SELECT MAX("Position") FROM "Todos" WHERE "TodoListId" = $2), 0) + $3 ELSE t."Position" END 
+		WHERE t."Id" IN (SELECT "Id" FROM subtree) 
+		RETURNING t."Id"`
+	rows, err := this.queryer.Query(query, todoId, listId, entity.TodoPositionGap)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	var todoIds []int
 	defer rows.Close()
 	for rows.Next() {
-		var todo entity.Todo
-		if err := rows.Scan(&todo.Id, &todo.Task, &todo.Done, &todo.TodoListId); err != nil {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			log.Println(err.Error())
+			return todoIds, err
+		}
+
+		todoIds = append(todoIds, id)
+	}
+
+	return todoIds, rows.Err()
+}
+
+// restoreTodo takes a todo of a list the user can edit out of the trash together with the subtasks
+// removed with it. Removed ancestors come back too, without their other subtasks, so the todo
+// isn't left under a parent in the trash. It returns the id of the list or sql.ErrNoRows when the
+// user has no such todo in the trash.
+func (this *todoStorage) restoreTodo(todoId int, userId int) (int, error) {
+	var listId int
+	query := `
+		WITH RECURSIVE trashed AS (
+			SELECT t."Id", t."ParentId", t."DeletedAt" FROM "Todos" t 
+			JOIN "TodoLists" l ON l."Id" = t."TodoListId" 
+			JOIN "TodoListMembers" m ON m."TodoListId" = t."TodoListId" 
+			WHERE t."Id" = $1 AND t."DeletedAt" IS NOT NULL AND l."DeletedAt" IS NULL 
+			AND m."UserId" = $2 AND m."Role" IN ('owner', 'editor')
+		), subtree AS (
+			SELECT "Id" FROM trashed 
+			UNION ALL 
+			SELECT c."Id" FROM "Todos" c JOIN subtree s ON c."ParentId" = s."Id" 
+			WHERE c."DeletedAt" = (SELECT "DeletedAt" FROM trashed)
+		), ancestors AS (
+			SELECT p."Id", p."ParentId" FROM "Todos" p JOIN trashed ON p."Id" = trashed."ParentId" 
+			UNION ALL 
+			SELECT p."Id", p."ParentId" FROM "Todos" p JOIN ancestors a ON p."Id" = a."ParentId"
+		), restored AS (
+			UPDATE "Todos" SET "DeletedAt" = NULL 
+			WHERE "DeletedAt" IS NOT NULL AND ("Id" IN (SELECT "Id" FROM subtree) OR "Id" IN (SELECT "Id" FROM ancestors)) 
+			RETURNING "TodoListId"
+		)
+		SELECT "TodoListId" FROM restored LIMIT 1`
+	err := this.queryer.QueryRow(query, todoId, userId).Scan(&listId)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println(err.Error())
+	}
+
+	return listId, err
+}
+
+// purgeTodo reports whether a todo of a list the user can edit was deleted from the trash for
+// good. Its subtasks are all in the trash as well and are deleted with it.
+func (this *todoStorage) purgeTodo(todoId int, userId int) (bool, error) {
+	query := `
+		DELETE FROM "Todos" t USING "TodoListMembers" m 
+		WHERE t."Id" = $1 AND t."DeletedAt" IS NOT NULL 
+		AND m."TodoListId" = t."TodoListId" AND m."UserId" = $2 AND m."Role" IN ('owner', 'editor')`
+	return this.execAffects(query, todoId, userId)
+}
+
+// findTrashedTodos returns the todos in the trash of the lists the user can edit, the latest
+// removed first. Subtasks removed along with their parent are left out, they come back with it.
+// Todos of lists in the trash come back with their list and are left out too.
+func (this *todoStorage) findTrashedTodos(userId int) ([]entity.TrashedTodo, error) {
+	query := `
+		SELECT t."Id", t."Task", t."Done", t."TodoListId", t."Position", t."Due", t."DueHasTime", t."Priority", t."ParentId", t."Recurrence", t."Notes", l."Name", t."DeletedAt" FROM "Todos" t 
+		JOIN "TodoLists" l ON l."Id" = t."TodoListId" 
+		JOIN "TodoListMembers" m ON m."TodoListId" = l."Id" 
+		LEFT JOIN "Todos" p ON p."Id" = t."ParentId" 
+		WHERE m."UserId" = $1 AND m."Role" IN ('owner', 'editor') AND l."DeletedAt" IS NULL 
+		AND t."DeletedAt" IS NOT NULL AND (p."DeletedAt" IS NULL OR p."DeletedAt" <> t."DeletedAt") 
+		ORDER BY t."DeletedAt" DESC, t."Position" ASC`
+	rows, err := this.queryer.Query(query, userId)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	var todos []entity.TrashedTodo
+	defer rows.Close()
+	for rows.Next() {
+		var todo entity.TrashedTodo
+		todo.Todo, err = scanTodo(rows, &todo.ListName, &todo.DeletedAt)
+		if err != nil {
 			log.Println(err.Error())
-			return todos
+			return todos, err
 		}
 
 		todos = append(todos, todo)
 	}
 
-	return todos
+	return todos, rows.Err()
 }
 
-func (this *todoStorage) findTodoById(id int) (entity.Todo, error) {
+// purgeTrash deletes the lists and todos of every user removed before the time. Subtasks are
+// never removed before their parent, so none are left behind under a deleted todo.
+func (this *todoStorage) purgeTrash(before time.Time) error {
+	queries := []string{
+		`DELETE FROM "TodoLists" WHERE "DeletedAt" < $1`,
+		`DELETE FROM "Todos" WHERE "DeletedAt" < $1`,
+	}
 
-	var todo entity.Todo
-	query := `SELECT * FROM "Todos" WHERE "Id" = $1`
-	row := this.database.QueryRow(query, id)
-	if err := row.Scan(&todo.Id, &todo.Task, &todo.Done, &todo.TodoListId); err != nil {
+	for _, query := range queries {
+		if _, err := this.queryer.Exec(query, before); err != nil {
+			log.Println(err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findTagsByTodoIds returns the tag names of each todo, sorted by name.
+func (this *todoStorage) findTagsByTodoIds(todoIds []int) (map[int][]string, error) {
+	tags := make(map[int][]string)
+	if len(todoIds) == 0 {
+		return tags, nil
+	}
+
+	query := `
+		SELECT tt."TodoId", tg."Name" FROM "TodoTags" tt 
+		JOIN "Tags" tg ON tg."Id" = tt."TagId" 
+		WHERE tt."TodoId" = ANY($1) 
+		ORDER BY lower(tg."Name") ASC`
+	rows, err := this.queryer.Query(query, todoIds)
+	if err != nil {
 		log.Println(err.Error())
-		return todo, err
+		return tags, err
 	}
 
-	return todo, nil
+	defer rows.Close()
+	for rows.Next() {
+		var todoId int
+		var name string
+		if err := rows.Scan(&todoId, &name); err != nil {
+			log.Println(err.Error())
+			return tags, err
+		}
+
+		tags[todoId] = append(tags[todoId], name)
+	}
+
+	return tags, rows.Err()
 }
 
-func (this *todoStorage) insertTodo(todo entity.Todo) error {
-	query := `INSERT INTO "Todos" ("Task", "Done", "TodoListId") VALUES ($1, $2, $3)`
-	if _, err := this.database.Exec(query, todo.Task, todo.Done, todo.TodoListId); err != nil {
+// findTagsByListId returns the tags on at least one todo of the list outside of the trash. Todos
+// in the trash keep their tags for when they are restored.
+func (this *todoStorage) findTagsByListId(listId int) []entity.Tag {
+	var tags []entity.Tag
+	query := `
+		SELECT tg."Id", tg."UserId", tg."Name" FROM "Tags" tg 
+		WHERE EXISTS(
+			SELECT 1 FROM "TodoTags" tt 
+			JOIN "Todos" t ON t."Id" = tt."TodoId" 
+			JOIN "TodoLists" l ON l."Id" = t."TodoListId" 
+			WHERE tt."TagId" = tg."Id" AND t."TodoListId" = $1 AND t."DeletedAt" IS NULL AND l."DeletedAt" IS NULL
+		) 
+		ORDER BY lower(tg."Name") ASC`
+	rows, err := this.queryer.Query(query, listId)
+	if err != nil {
 		log.Println(err.Error())
-		return err
+		return tags
 	}
 
-	return nil
+	defer rows.Close()
+	for rows.Next() {
+		var tag entity.Tag
+		if err := rows.Scan(&tag.Id, &tag.UserId, &tag.Name); err != nil {
+			log.Println(err.Error())
+			return tags
+		}
+
+		tags = append(tags, tag)
+	}
+
+	return tags
 }
 
-func (this *todoStorage) updateTodo(todo entity.Todo) error {
-	query := `UPDATE "Todos" SET "Task" = $2, "Done" = $3 WHERE "Id" = $1`
-	if _, err := this.database.Exec(query, todo.Id, todo.Task, todo.Done); err != nil {
+// setTodoTags replaces the tags of a todo. Tags belong to the owner of the list, so everyone the
+// list is shared with files todos under the same tags. Tags new to the owner are created and tags
+// no longer used by any todo of the owner are removed.
+func (this *todoStorage) setTodoTags(todoId int, tags []string) error {
+	userId, err := this.findTodoOwner(todoId)
+	if err != nil {
+		return err
+	}
+
+	insertQuery := `
+		INSERT INTO "Tags" ("UserId", "Name") SELECT $1, name FROM unnest($2::TEXT[]) AS name 
+		ON CONFLICT ("UserId", lower("Name")) DO NOTHING`
+	if _, err := this.queryer.Exec(insertQuery, userId, tags); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	clearQuery := `DELETE FROM "TodoTags" WHERE "TodoId" = $1`
+	if _, err := this.queryer.Exec(clearQuery, todoId); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	linkQuery := `
+		INSERT INTO "TodoTags" ("TodoId", "TagId") 
+		SELECT $1, tg."Id" FROM "Tags" tg 
+		WHERE tg."UserId" = $2 AND lower(tg."Name") IN (SELECT lower(name) FROM unnest($3::TEXT[]) AS name)`
+	if _, err := this.queryer.Exec(linkQuery, todoId, userId, tags); err != nil {
+		log.Println(err.Error())
+		return err
+	}
+
+	cleanQuery := `
+		DELETE FROM "Tags" tg WHERE tg."UserId" = $1 
+		AND NOT EXISTS(SELECT 1 FROM "TodoTags" tt WHERE tt."TagId" = tg."Id")`
+	if _, err := this.queryer.Exec(cleanQuery, userId); err != nil {
 		log.Println(err.Error())
 		return err
 	}
@@ -138,9 +1173,291 @@ func (this *todoStorage) updateTodo(todo entity.Todo) error {
 	return nil
 }
 
-func (this *todoStorage) deleteTodo(id int) error {
-	query := `DELETE FROM "Todos" WHERE "Id" = $1`
-	if _, err := this.database.Exec(query, id); err != nil {
+// findSubtree returns the todo of the user followed by all of its subtasks, each with its depth in
+// the list.
+func (this *todoStorage) findSubtree(todoId int, userId int) ([]entity.Todo, error) {
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT "Id", "ParentId" FROM "Todos" WHERE "Id" = $1 
+			UNION ALL 
+			SELECT p."Id", p."ParentId" FROM "Todos" p JOIN ancestors a ON p."Id" = a."ParentId"
+		), subtree AS (
+			SELECT "Id", (SELECT COUNT(*) - 1 FROM ancestors) AS "Depth" FROM "Todos" WHERE "Id" = $1 AND "DeletedAt" IS NULL 
+			UNION ALL 
+			SELECT c."Id", s."Depth" + 1 FROM "Todos" c JOIN subtree s ON c."ParentId" = s."Id" WHERE c."DeletedAt" IS NULL
+		)
+		SELECT t."Id", t."Task", t."Done", t."TodoListId", t."Position", t."Due", t."DueHasTime", t."Priority", t."ParentId", t."Recurrence", t."Notes", s."Depth" FROM "Todos" t 
+		JOIN subtree s ON s."Id" = t."Id" 
+		JOIN "TodoLists" l ON l."Id" = t."TodoListId" 
+		JOIN "TodoListMembers" m ON m."TodoListId" = t."TodoListId" 
+		WHERE m."UserId" = $2 AND l."DeletedAt" IS NULL 
+		ORDER BY s."Depth" ASC, t."Position" ASC, t."Id" ASC`
+	rows, err := this.queryer.Query(query, todoId, userId)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return scanTodos(rows, true)
+}
+
+// lockTodoPath reads a todo of the user and its ancestors, starting from the top level todo, and
+// locks them until the transaction ends. Locking from the top down keeps concurrent changes to
+// the same tree from deadlocking. The result is empty if the user has no such todo.
+func (this *todoStorage) lockTodoPath(todoId int, userId int) ([]entity.Todo, error) {
+	query := `
+		WITH RECURSIVE ancestors AS (
+			SELECT "Id", "ParentId", 0 AS "Distance" FROM "Todos" WHERE "Id" = $1 AND "DeletedAt" IS NULL 
+			UNION ALL 
+			SELECT p."Id", p."ParentId", a."Distance" + 1 FROM "Todos" p JOIN ancestors a ON p."Id" = a."ParentId"
+		)
+		SELECT t."Id", t."Task", t."Done", t."TodoListId", t."Position", t."Due", t."DueHasTime", t."Priority", t."ParentId", t."Recurrence", t."Notes" FROM "Todos" t 
+		JOIN ancestors a ON a."Id" = t."Id" 
+		JOIN "TodoLists" l ON l."Id" = t."TodoListId" 
+		JOIN "TodoListMembers" m ON m."TodoListId" = t."TodoListId" 
+		WHERE m."UserId" = $2 AND m."Role" IN ('owner', 'editor') AND l."DeletedAt" IS NULL 
+		ORDER BY a."Distance" DESC 
+		FOR UPDATE OF t`
+	rows, err := this.queryer.Query(query, todoId, userId)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	path, err := scanTodos(rows, false)
+	for i := range path {
+		path[i].Depth = i
+	}
+
+	return path, err
+}
+
+// countSubtasks counts the direct subtasks of the todo outside of the trash and how many of them
+// are open.
+func (this *todoStorage) countSubtasks(todoId int) (int, int, error) {
+	total, open := 0, 0
+	query := `SELECT COUNT(*), COUNT(*) FILTER (WHERE NOT "Done") FROM "Todos" WHERE "ParentId" = $1 AND "DeletedAt" IS NULL`
+	if err := this.queryer.QueryRow(query, todoId).Scan(&total, &open); err != nil {
+		log.Println(err.Error())
+		return 0, 0, err
+	}
+
+	return total, open, nil
+}
+
+// completeSubtasks marks every subtask of the todo, at any depth, done. It returns the subtasks
+// that were still open.
+func (this *todoStorage) completeSubtasks(todoId int) ([]entity.Todo, error) {
+	query := `
+		WITH RECURSIVE descendants AS (
+			SELECT "Id" FROM "Todos" WHERE "ParentId" = $1 AND "DeletedAt" IS NULL 
+			UNION ALL 
+			SELECT c."Id" FROM "Todos" c JOIN descendants d ON c."ParentId" = d."Id" WHERE c."DeletedAt" IS NULL
+		)
+		UPDATE "Todos" t SET "Done" = TRUE WHERE t."Id" IN (SELECT "Id" FROM descendants) AND NOT t."Done" 
+		RETURNING t."Id", t."Task", t."Done", t."TodoListId", t."Position", t."Due", t."DueHasTime", t."Priority", t."ParentId", t."Recurrence", t."Notes"`
+	rows, err := this.queryer.Query(query, todoId)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return scanTodos(rows, false)
+}
+
+// insertActivity appends an entry to the activity log of its list.
+func (this *todoStorage) insertActivity(activity entity.TodoActivity) error {
+	query := `
+		INSERT INTO "TodoActivity" ("TodoListId", "TodoId", "ActorId", "ActorName", "Kind", "Subject", "Before", "After", "Created") 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err := this.queryer.Exec(query, activity.TodoListId, nullId(activity.TodoId), activity.ActorId, activity.ActorName,
+		activity.Kind, activity.Subject, activity.Before, activity.After, activity.Created)
+	if err != nil {
+		log.Println(err.Error())
+	}
+
+	return err
+}
+
+// findActivity returns at most limit entries of the activity log of the list written before the
+// entry beforeId, the latest first.
+func (this *todoStorage) findActivity(listId int, beforeId int64, limit int) ([]entity.TodoActivity, error) {
+	query := `
+		SELECT "Id", "TodoListId", "TodoId", "ActorId", "ActorName", "Kind", "Subject", "Before", "After", "Created" FROM "TodoActivity" 
+		WHERE "TodoListId" = $1 AND "Id" < $2 ORDER BY "Id" DESC LIMIT $3`
+	rows, err := this.queryer.Query(query, listId, beforeId, limit)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	var entries []entity.TodoActivity
+	defer rows.Close()
+	for rows.Next() {
+		var activity entity.TodoActivity
+		var todoId sql.NullInt64
+		err := rows.Scan(&activity.Id, &activity.TodoListId, &todoId, &activity.ActorId, &activity.ActorName,
+			&activity.Kind, &activity.Subject, &activity.Before, &activity.After, &activity.Created)
+		if err != nil {
+			log.Println(err.Error())
+			return entries, err
+		}
+
+		activity.TodoId = int(todoId.Int64)
+		entries = append(entries, activity)
+	}
+
+	return entries, rows.Err()
+}
+
+// syncedTodoColumns are read by scanSyncedTodos after the columns of scanTodo, from todos t with
+// their parent p joined.
+const syncedTodoColumns = `t."Id", t."Task", t."Done", t."TodoListId", t."Position", t."Due", t."DueHasTime", t."Priority", t."ParentId", t."Recurrence", t."Notes", 
+	t."Uid", t."ResourceName", COALESCE(p."Uid", ''), t."Revision", t."DeletedAt" IS NOT NULL`
+
+func scanSyncedTodos(rows *sql.Rows) ([]entity.SyncedTodo, error) {
+	var todos []entity.SyncedTodo
+	defer rows.Close()
+	for rows.Next() {
+		var todo entity.SyncedTodo
+		var err error
+		todo.Todo, err = scanTodo(rows, &todo.Uid, &todo.ResourceName, &todo.ParentUid, &todo.Revision, &todo.Deleted)
+		if err != nil {
+			log.Println(err.Error())
+			return todos, err
+		}
+
+		todos = append(todos, todo)
+	}
+
+	return todos, rows.Err()
+}
+
+// findSyncedTodos returns the todos of a list shared with the user outside of the trash, the todo
+// with the resource name only when the name is set.
+func (this *todoStorage) findSyncedTodos(listId int, userId int, resourceName string) ([]entity.SyncedTodo, error) {
+	query := `
+		SELECT ` + syncedTodoColumns + ` FROM "Todos" t 
+		LEFT JOIN "Todos" p ON p."Id" = t."ParentId" 
+		JOIN "TodoLists" l ON l."Id" = t."TodoListId" 
+		JOIN "TodoListMembers" m ON m."TodoListId" = l."Id" 
+		WHERE t."TodoListId" = $1 AND m."UserId" = $2 AND ($3 = '' OR t."ResourceName" = $3) 
+		AND t."DeletedAt" IS NULL AND l."DeletedAt" IS NULL 
+		ORDER BY t."Position" ASC`
+	rows, err := this.queryer.Query(query, listId, userId, resourceName)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return scanSyncedTodos(rows)
+}
+
+// findChangedTodos returns the todos of a list shared with the user changed after the revision,
+// including the ones moved to the trash since.
+func (this *todoStorage) findChangedTodos(listId int, userId int, revision int64) ([]entity.SyncedTodo, error) {
+	query := `
+		SELECT ` + syncedTodoColumns + ` FROM "Todos" t 
+		LEFT JOIN "Todos" p ON p."Id" = t."ParentId" 
+		JOIN "TodoListMembers" m ON m."TodoListId" = t."TodoListId" 
+		WHERE t."TodoListId" = $1 AND m."UserId" = $2 AND t."Revision" > $3 
+		ORDER BY t."Revision" ASC`
+	rows, err := this.queryer.Query(query, listId, userId, revision)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	return scanSyncedTodos(rows)
+}
+
+// findTombstones returns the resource names of the todos deleted for good or moved out of the list
+// after the revision.
+func (this *todoStorage) findTombstones(listId int, revision int64) ([]string, error) {
+	query := `
+		SELECT "ResourceName" FROM "TodoTombstones" 
+		WHERE "TodoListId" = $1 AND "Revision" > $2 ORDER BY "Revision" ASC`
+	rows, err := this.queryer.Query(query, listId, revision)
+	if err != nil {
+		log.Println(err.Error())
+		return nil, err
+	}
+
+	var names []string
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			log.Println(err.Error())
+			return names, err
+		}
+
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// findListRevision returns the latest revision of the todos of the list and of its tombstones.
+func (this *todoStorage) findListRevision(listId int) (int64, error) {
+	var revision int64
+	query := `
+		SELECT GREATEST(
+			(SELECT COALESCE(MAX("Revision"), 0) FROM "Todos" WHERE "TodoListId" = $1), 
+			(SELECT COALESCE(MAX("Revision"), 0) FROM "TodoTombstones" WHERE "TodoListId" = $1))`
+	if err := this.queryer.QueryRow(query, listId).Scan(&revision); err != nil {
+		log.Println(err.Error())
+		return 0, err
+	}
+
+	return revision, nil
+}
+
+// lockSyncedTodo reads the todo of the list with the resource name outside of the trash and locks
+// it until the transaction ends. The caller checks that the user can edit the list. Found is false
+// when the list has no such todo.
+func (this *todoStorage) lockSyncedTodo(listId int, resourceName string) (entity.SyncedTodo, bool, error) {
+	query := `
+		SELECT ` + syncedTodoColumns + ` FROM "Todos" t 
+		LEFT JOIN "Todos" p ON p."Id" = t."ParentId" 
+		WHERE t."TodoListId" = $1 AND t."ResourceName" = $2 AND t."DeletedAt" IS NULL 
+		FOR UPDATE OF t`
+	rows, err := this.queryer.Query(query, listId, resourceName)
+	if err != nil {
+		log.Println(err.Error())
+		return entity.SyncedTodo{}, false, err
+	}
+
+	todos, err := scanSyncedTodos(rows)
+	if err != nil || len(todos) == 0 {
+		return entity.SyncedTodo{}, false, err
+	}
+
+	return todos[0], true, nil
+}
+
+// findTodoIdByUid returns the id of the todo of the list with the uid, trashed ones included so
+// no two todos of a list share a uid.
+func (this *todoStorage) findTodoIdByUid(listId int, uid string) (int, bool, error) {
+	var todoId int
+	query := `SELECT "Id" FROM "Todos" WHERE "TodoListId" = $1 AND "Uid" = $2 LIMIT 1`
+	err := this.queryer.QueryRow(query, listId, uid).Scan(&todoId)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+
+	if err != nil {
+		log.Println(err.Error())
+		return 0, false, err
+	}
+
+	return todoId, true, nil
+}
+
+// updateSyncIdentity names a todo added by a sync client the way the client does.
+func (this *todoStorage) updateSyncIdentity(todoId int, uid string, resourceName string) error {
+	query := `UPDATE "Todos" SET "Uid" = $2, "ResourceName" = $3 WHERE "Id" = $1`
+	if _, err := this.queryer.Exec(query, todoId, uid, resourceName); err != nil {
 		log.Println(err.Error())
 		return err
 	}
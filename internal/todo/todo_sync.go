@@ -0,0 +1,514 @@
+package todo
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+)
+
+var (
+	ErrSyncTokenInvalid = errors.New("Sync token is not valid.")
+	ErrUidConflict      = errors.New("Another todo of the list already has this UID.")
+	ErrUidChanged       = errors.New("The UID of a todo can't be changed.")
+	ErrCalendarInvalid  = errors.New("The calendar data is not valid.")
+	ErrCalendarNoTodo   = errors.New("The calendar data has no todo with a UID.")
+)
+
+// SyncList is a list as sync clients see it. Revision changes whenever a todo of the list does.
+type SyncList struct {
+	entity.TodoList
+	Revision int64
+}
+
+// FindSyncLists returns the lists shared with the user with their revisions.
+func (this *TodoService) FindSyncLists(user entity.User) ([]SyncList, error) {
+	var lists []SyncList
+	for _, list := range this.FindLists(user) {
+		revision, err := this.storage.findListRevision(list.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		lists = append(lists, SyncList{list, revision})
+	}
+
+	return lists, nil
+}
+
+func (this *TodoService) FindSyncList(user entity.User, listId int) (SyncList, error) {
+	list, err := this.FindListById(user, listId)
+	if err != nil {
+		return SyncList{}, err
+	}
+
+	revision, err := this.storage.findListRevision(listId)
+	return SyncList{list, revision}, err
+}
+
+// FindSyncedTodos returns the todos of a list shared with the user outside of the trash.
+func (this *TodoService) FindSyncedTodos(user entity.User, listId int) ([]entity.SyncedTodo, error) {
+	if _, err := this.FindListById(user, listId); err != nil {
+		return nil, err
+	}
+
+	return this.attachSyncedTags(this.storage.findSyncedTodos(listId, user.Id, ""))
+}
+
+// FindSyncedTodo returns the todo of the list with the resource name, ErrTodoNotFound when the
+// list has no such todo.
+func (this *TodoService) FindSyncedTodo(user entity.User, listId int, resourceName string) (entity.SyncedTodo, error) {
+	if _, err := this.FindListById(user, listId); err != nil {
+		return entity.SyncedTodo{}, err
+	}
+
+	if resourceName == "" {
+		return entity.SyncedTodo{}, ErrTodoNotFound
+	}
+
+	todos, err := this.attachSyncedTags(this.storage.findSyncedTodos(listId, user.Id, resourceName))
+	if err == nil && len(todos) == 0 {
+		err = ErrTodoNotFound
+	}
+
+	if err != nil {
+		return entity.SyncedTodo{}, err
+	}
+
+	return todos[0], nil
+}
+
+// FindSyncChanges returns what changed in a list shared with the user after the revision: the
+// todos changed since and the resource names of the todos gone from the list, trashed ones among
+// them. The revision returned is the one to ask with next time.
+func (this *TodoService) FindSyncChanges(user entity.User, listId int, revision int64) ([]entity.SyncedTodo, []string, int64, error) {
+	list, err := this.FindSyncList(user, listId)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	if revision < 0 || revision > list.Revision {
+		return nil, nil, 0, ErrSyncTokenInvalid
+	}
+
+	todos, err := this.attachSyncedTags(this.storage.findChangedTodos(listId, user.Id, revision))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	removed, err := this.storage.findTombstones(listId, revision)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	var changed []entity.SyncedTodo
+	for _, todo := range todos {
+		if todo.Deleted {
+			removed = append(removed, todo.ResourceName)
+		} else {
+			changed = append(changed, todo)
+		}
+	}
+
+	// the revision was read before the changes, a change made in between is sent again next time
+	// rather than missed
+	return changed, removed, list.Revision, nil
+}
+
+func (this *TodoService) attachSyncedTags(todos []entity.SyncedTodo, err error) ([]entity.SyncedTodo, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	plainTodos := make([]entity.Todo, len(todos))
+	for i, todo := range todos {
+		plainTodos[i] = todo.Todo
+	}
+
+	if err = this.attachTags(plainTodos); err != nil {
+		return nil, err
+	}
+
+	for i := range todos {
+		todos[i].Todo = plainTodos[i]
+	}
+
+	return todos, nil
+}
+
+// SaveSyncedTodo adds or replaces the todo of the list with the resource name, and reports
+// whether it was added. The list and the todo are locked while check compares the todo as it is
+// to what the client last saw, found being false when there's no such todo yet, and every change
+// is made in the same transaction. So a failed save leaves nothing behind for a retry to
+// duplicate, and two clients saving over the same version can't both pass the check. The changes
+// are checked and recorded like changes made in the app. Subtasks find their parent by its uid
+// when they are added, they can't move to another parent afterwards.
+func (this *TodoService) SaveSyncedTodo(user entity.User, listId int, resourceName string, incoming entity.SyncedTodo, check func(existing entity.SyncedTodo, found bool) error) (entity.SyncedTodo, bool, error) {
+	details := TodoDetails{
+		Due:        incoming.Due,
+		DueHasTime: incoming.DueHasTime,
+		Priority:   incoming.Priority,
+		Tags:       entity.ParseTags(strings.Join(incoming.Tags, ",")),
+		Recurrence: incoming.Recurrence,
+	}
+
+	checked := details.apply(incoming.Todo)
+	if err := checked.Validate(); err != nil {
+		return incoming, false, err
+	}
+
+	if resourceName == "" {
+		return incoming, false, ErrTodoNotFound
+	}
+
+	created := false
+	err := this.storage.transaction(func(storage *todoStorage) error {
+		if err := storage.lockTodoList(listId, user.Id); err != nil {
+			return err
+		}
+
+		existing, found, err := storage.lockSyncedTodo(listId, resourceName)
+		if err != nil {
+			return err
+		}
+
+		if err = check(existing, found); err != nil {
+			return err
+		}
+
+		created = !found
+		if created {
+			existing, err = this.insertSyncedTodo(storage, user, listId, resourceName, incoming, details)
+		} else if existing.Uid != incoming.Uid {
+			err = ErrUidChanged
+		} else {
+			_, err = this.saveDetails(storage, user, details.apply(entity.Todo{Id: existing.Id, Task: incoming.Task}))
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if incoming.Notes != existing.Notes {
+			if _, err = storage.updateTodoNotes(existing.Id, user.Id, incoming.Notes); err != nil {
+				return err
+			}
+		}
+
+		if incoming.Done != existing.Done {
+			path, err := this.lockTodoPath(storage, user, existing.Id)
+			if err != nil {
+				return err
+			}
+
+			if err = this.saveDone(storage, user, path, path[len(path)-1].Toggle()); err != nil {
+				return err
+			}
+		}
+
+		return storage.notify(TodoEvent{ListId: listId})
+	})
+
+	if err == sql.ErrNoRows {
+		if err = this.explainMissingList(user, listId, accessEdit); err == nil {
+			err = ErrListNotFound
+		}
+	}
+
+	if err != nil {
+		return incoming, false, err
+	}
+
+	saved, err := this.FindSyncedTodo(user, listId, resourceName)
+	return saved, created, err
+}
+
+// insertSyncedTodo adds a todo sent by a sync client under the parent with the uid, or at the top
+// of the list when the list has no such parent, and names it like the client does. The caller
+// has validated the todo and locked the list.
+func (this *TodoService) insertSyncedTodo(storage *todoStorage, user entity.User, listId int, resourceName string, incoming entity.SyncedTodo, details TodoDetails) (entity.SyncedTodo, error) {
+	_, taken, err := storage.findTodoIdByUid(listId, incoming.Uid)
+	if err == nil && taken {
+		err = ErrUidConflict
+	}
+
+	if err != nil {
+		return entity.SyncedTodo{}, err
+	}
+
+	parentId, hasParent, err := storage.findTodoIdByUid(listId, incoming.ParentUid)
+	if err != nil {
+		return entity.SyncedTodo{}, err
+	}
+
+	added := details.apply(entity.NewTodo(incoming.Task, listId))
+	if incoming.ParentUid != "" && hasParent {
+		added.ParentId = parentId
+		added, err = this.insertSubtask(storage, user, added)
+	} else {
+		added, err = this.insertNewTodo(storage, user, added)
+	}
+
+	if err != nil {
+		return entity.SyncedTodo{}, err
+	}
+
+	if err = storage.updateSyncIdentity(added.Id, incoming.Uid, resourceName); err != nil {
+		return entity.SyncedTodo{}, err
+	}
+
+	return entity.SyncedTodo{Todo: added, Uid: incoming.Uid, ResourceName: resourceName}, nil
+}
+
+// RemoveSyncedTodo moves the todo of the list with the resource name to the trash with its
+// subtasks.
+func (this *TodoService) RemoveSyncedTodo(user entity.User, listId int, resourceName string) error {
+	todo, err := this.FindSyncedTodo(user, listId, resourceName)
+	if err != nil {
+		return err
+	}
+
+	return this.RemoveTodo(user, todo.Id)
+}
+
+// DecodeSyncedTodo reads the first todo of an iCalendar file sent by a sync client. Due times
+// are read in the location and kept as wall clock times like the todos of the app. Only the
+// properties the app has a place for are kept; a completed status marks the todo done.
+func DecodeSyncedTodo(reader io.Reader, location *time.Location) (entity.SyncedTodo, error) {
+	lines, err := readCalendarLines(reader)
+	if err != nil {
+		return entity.SyncedTodo{}, err
+	}
+
+	var todo entity.SyncedTodo
+	var components []string
+	found := false
+	for _, line := range lines {
+		switch line.name {
+		case "BEGIN":
+			components = append(components, strings.ToUpper(line.value))
+			if !found && len(components) == 2 && components[1] == "VTODO" {
+				todo = entity.SyncedTodo{}
+			}
+
+			continue
+		case "END":
+			if len(components) == 0 {
+				return todo, ErrCalendarInvalid
+			}
+
+			if components[len(components)-1] == "VTODO" && todo.Uid != "" {
+				found = true
+			}
+
+			components = components[:len(components)-1]
+			continue
+		}
+
+		// properties of alarms and other components inside of the todo are skipped
+		if found || len(components) != 2 || components[1] != "VTODO" {
+			continue
+		}
+
+		if err = readTodoProperty(&todo, line, location); err != nil {
+			return todo, err
+		}
+	}
+
+	if !found {
+		return todo, ErrCalendarNoTodo
+	}
+
+	return todo, nil
+}
+
+// readTodoProperty sets the field of the todo the property is for.
+func readTodoProperty(todo *entity.SyncedTodo, line calendarLine, location *time.Location) error {
+	switch line.name {
+	case "UID":
+		todo.Uid = line.value
+	case "SUMMARY":
+		todo.Task = unescapeCalendarText(line.value)
+	case "DESCRIPTION":
+		todo.Notes = unescapeCalendarText(line.value)
+	case "STATUS":
+		todo.Done = strings.EqualFold(line.value, "COMPLETED")
+	case "PRIORITY":
+		priority, err := strconv.Atoi(line.value)
+		if err != nil {
+			return ErrCalendarInvalid
+		}
+
+		todo.Priority = priorityFromCalendar(priority)
+	case "CATEGORIES":
+		for _, category := range splitCalendarList(line.value) {
+			todo.Tags = append(todo.Tags, unescapeCalendarText(category))
+		}
+	case "DUE":
+		due, hasTime, err := parseCalendarTime(line, location)
+		if err != nil {
+			return err
+		}
+
+		todo.Due = due
+		todo.DueHasTime = hasTime
+	case "RRULE":
+		todo.Recurrence = line.value
+	case "RELATED-TO":
+		relation := line.params["RELTYPE"]
+		if relation == "" || strings.EqualFold(relation, "PARENT") {
+			todo.ParentUid = line.value
+		}
+	}
+
+	return nil
+}
+
+// priorityFromCalendar maps the iCalendar scale, where 1 is the highest, to the priorities of
+// the app the way calendarPriority maps them back.
+func priorityFromCalendar(priority int) int {
+	switch {
+	case priority <= 0:
+		return entity.PriorityNone
+	case priority <= 4:
+		return entity.PriorityHigh
+	case priority == 5:
+		return entity.PriorityMedium
+	}
+
+	return entity.PriorityLow
+}
+
+// parseCalendarTime reads a date, a time in UTC, a time in the zone of a TZID parameter or a
+// floating time. Times are turned into wall clock times in the location.
+func parseCalendarTime(line calendarLine, location *time.Location) (time.Time, bool, error) {
+	if strings.EqualFold(line.params["VALUE"], "DATE") || len(line.value) == len("20060102") {
+		date, err := time.Parse("20060102", line.value)
+		if err != nil {
+			return time.Time{}, false, ErrCalendarInvalid
+		}
+
+		return date, false, nil
+	}
+
+	zone := location
+	if name := line.params["TZID"]; name != "" {
+		if named, err := time.LoadLocation(strings.Trim(name, `"`)); err == nil {
+			zone = named
+		}
+	}
+
+	value, isUtc := strings.CutSuffix(line.value, "Z")
+	if isUtc {
+		zone = time.UTC
+	}
+
+	parsed, err := time.ParseInLocation("20060102T150405", value, zone)
+	if err != nil {
+		return time.Time{}, false, ErrCalendarInvalid
+	}
+
+	return entity.WallClock(parsed.In(location)).Truncate(time.Minute), true, nil
+}
+
+// calendarLine is a content line of an iCalendar file. Names are upper case, parameters are
+// kept by their upper case names.
+type calendarLine struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// readCalendarLines unfolds the content lines of an iCalendar file and splits them into their
+// names, parameters and values.
+func readCalendarLines(reader io.Reader) ([]calendarLine, error) {
+	var unfolded []string
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+	for scanner.Scan() {
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if (strings.HasPrefix(text, " ") || strings.HasPrefix(text, "\t")) && len(unfolded) > 0 {
+			unfolded[len(unfolded)-1] += text[1:]
+			continue
+		}
+
+		if text != "" {
+			unfolded = append(unfolded, text)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, ErrCalendarInvalid
+	}
+
+	lines := make([]calendarLine, 0, len(unfolded))
+	for _, text := range unfolded {
+		line, err := parseCalendarLine(text)
+		if err != nil {
+			return nil, err
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+// parseCalendarLine splits a content line at the colon and semicolons outside of quoted
+// parameter values.
+func parseCalendarLine(text string) (calendarLine, error) {
+	line := calendarLine{params: make(map[string]string)}
+	var parts []string
+	quoted := false
+	start := 0
+	for i, char := range text {
+		switch {
+		case char == '"':
+			quoted = !quoted
+		case char == ';' && !quoted:
+			parts = append(parts, text[start:i])
+			start = i + 1
+		case char == ':' && !quoted:
+			parts = append(parts, text[start:i])
+			line.value = text[i+1:]
+			line.name = strings.ToUpper(parts[0])
+			for _, param := range parts[1:] {
+				name, value, _ := strings.Cut(param, "=")
+				line.params[strings.ToUpper(name)] = value
+			}
+
+			return line, nil
+		}
+	}
+
+	return line, ErrCalendarInvalid
+}
+
+// splitCalendarList splits a list value at the commas that aren't escaped.
+func splitCalendarList(value string) []string {
+	var items []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ',':
+			items = append(items, value[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(items, value[start:])
+}
+
+// calendarUnescaper reverses escapeCalendarText.
+var calendarUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+func unescapeCalendarText(value string) string {
+	return calendarUnescaper.Replace(value)
+}
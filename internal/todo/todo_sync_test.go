@@ -0,0 +1,100 @@
+package todo
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+)
+
+var errDiskFull = errors.New("Disk full.")
+
+// newSyncTestService answers the statements of saving a new synced todo to list 7: the list can
+// be edited, it has no todo with the resource name or uid yet, and the added todo gets id 42.
+// Naming the added todo fails when failIdentity is set. The statements run are recorded.
+func newSyncTestService(t *testing.T, failIdentity bool) (*TodoService, *[]string) {
+	var statements []string
+	database := newFakeDatabase(t, func(query string, args []driver.Value) (fakeRows, error) {
+		statements = append(statements, query)
+		switch {
+		case strings.Contains(query, "FOR UPDATE OF l"):
+			return fakeRows{[]string{"Id"}, [][]driver.Value{{int64(7)}}}, nil
+		case strings.Contains(query, "INSERT INTO \"Todos\""):
+			return fakeRows{[]string{"Id"}, [][]driver.Value{{int64(42)}}}, nil
+		case strings.Contains(query, "SELECT l.\"UserId\" FROM"):
+			return fakeRows{[]string{"UserId"}, [][]driver.Value{{int64(1)}}}, nil
+		case strings.Contains(query, "SET \"Uid\"") && failIdentity:
+			return fakeRows{}, errDiskFull
+		default:
+			return fakeRows{}, nil
+		}
+	})
+
+	return NewTodoService(database, NewEventHub(database), TodoOptions{MaxSubtaskDepth: 2}), &statements
+}
+
+func syncTestTodo() entity.SyncedTodo {
+	return entity.SyncedTodo{Todo: entity.Todo{Task: "water plants", Done: true, Notes: "twice"}, Uid: "uid-1"}
+}
+
+func TestSaveSyncedTodoChecksUnderLock(t *testing.T) {
+	service, statements := newSyncTestService(t, false)
+	errStale := errors.New("Stale.")
+	var checkedAfter []string
+	check := func(existing entity.SyncedTodo, found bool) error {
+		checkedAfter = append([]string{}, *statements...)
+		if found {
+			t.Errorf("check found %+v, want no todo", existing)
+		}
+
+		return errStale
+	}
+
+	user := entity.User{Id: 1, Name: "someone"}
+	if _, _, err := service.SaveSyncedTodo(user, 7, "todo-1.ics", syncTestTodo(), check); !errors.Is(err, errStale) {
+		t.Fatalf("got error %v, want the error of the check", err)
+	}
+
+	if len(checkedAfter) != 3 || checkedAfter[0] != "BEGIN" ||
+		!strings.Contains(checkedAfter[1], "FOR UPDATE OF l") || !strings.Contains(checkedAfter[2], "FOR UPDATE OF t") {
+		t.Fatalf("check ran after %q, want it after locking the list and the todo in a transaction", checkedAfter)
+	}
+
+	for _, statement := range *statements {
+		if strings.Contains(statement, "INSERT") || strings.Contains(statement, "UPDATE \"") || statement == "COMMIT" {
+			t.Errorf("statement %q ran after the check failed", statement)
+		}
+	}
+
+	if last := (*statements)[len(*statements)-1]; last != "ROLLBACK" {
+		t.Errorf("last statement %q, want ROLLBACK", last)
+	}
+}
+
+func TestSaveSyncedTodoRollsBackPartialSave(t *testing.T) {
+	service, statements := newSyncTestService(t, true)
+	check := func(existing entity.SyncedTodo, found bool) error { return nil }
+	user := entity.User{Id: 1, Name: "someone"}
+	if _, _, err := service.SaveSyncedTodo(user, 7, "todo-1.ics", syncTestTodo(), check); !errors.Is(err, errDiskFull) {
+		t.Fatalf("got error %v, want %v", err, errDiskFull)
+	}
+
+	inserted := false
+	for i, statement := range *statements {
+		if (i == 0) != (statement == "BEGIN") || statement == "COMMIT" {
+			t.Errorf("statement %d %q, want one transaction", i, statement)
+		}
+
+		inserted = inserted || strings.Contains(statement, "INSERT INTO \"Todos\"")
+	}
+
+	if !inserted {
+		t.Error("the todo wasn't added before naming it")
+	}
+
+	if last := (*statements)[len(*statements)-1]; last != "ROLLBACK" {
+		t.Errorf("last statement %q, want ROLLBACK so the todo without its uid is gone", last)
+	}
+}
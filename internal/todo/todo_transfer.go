@@ -0,0 +1,237 @@
+package todo
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/skaisanlahti/try-go-htmx/internal/entity"
+)
+
+var (
+	ErrNothingToImport = errors.New("The file has no todos to import.")
+	ErrTooManyTodos    = errors.New("The file has too many todos, import at most 5000 at a time.")
+)
+
+// maxImportTodos is how many todos a single import can add.
+const maxImportTodos = 5000
+
+// defaultImportName names the lists of a file that doesn't tell their names.
+const defaultImportName = "Imported todos"
+
+// ExportList returns a list shared with the user with all of its todos.
+func (this *TodoService) ExportList(user entity.User, listId int) ([]TransferList, error) {
+	list, err := this.FindListById(user, listId)
+	if err != nil {
+		return nil, err
+	}
+
+	todos, err := this.FindTodosByListId(user, listId, TodoFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	return []TransferList{{list.Name, todos}}, nil
+}
+
+// ExportLists returns the lists of the user and the lists shared with them, with all of their
+// todos.
+func (this *TodoService) ExportLists(user entity.User) ([]TransferList, error) {
+	var lists []TransferList
+	for _, list := range this.FindLists(user) {
+		todos, err := this.FindTodosByListId(user, list.Id, TodoFilter{})
+		if err != nil {
+			return nil, err
+		}
+
+		lists = append(lists, TransferList{list.Name, todos})
+	}
+
+	return lists, nil
+}
+
+// ParseImport reads a file in the format and checks it the way Import does, so what the import
+// adds can be previewed first. The todos go to the end of the list when listId is set, otherwise
+// every list of the file becomes a new list of the user.
+func (this *TodoService) ParseImport(user entity.User, listId int, format string, reader io.Reader) ([]TransferList, error) {
+	codec, err := FindCodec(format)
+	if err != nil {
+		return nil, err
+	}
+
+	lists, err := codec.Decode(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if listId != 0 {
+		if err = this.explainMissingList(user, listId, accessEdit); err != nil {
+			return nil, err
+		}
+	}
+
+	count := 0
+	names := make(map[string]bool)
+	for i := range lists {
+		if listId == 0 {
+			if lists[i].Name == "" {
+				lists[i].Name = defaultImportName
+			}
+
+			if err = this.checkImportedName(user, lists[i].Name, names); err != nil {
+				return nil, fmt.Errorf("List %q: %w", lists[i].Name, err)
+			}
+		}
+
+		if lists[i].Todos, err = this.prepareImported(lists[i].Todos, 0, &count); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(lists) == 0 || (listId != 0 && count == 0) {
+		return nil, ErrNothingToImport
+	}
+
+	if count > maxImportTodos {
+		return nil, ErrTooManyTodos
+	}
+
+	return lists, nil
+}
+
+// checkImportedName makes sure a list of the file can be added as a new list of the user. The
+// names seen so far in the file are collected in names, ignoring case like the lists of a user do.
+func (this *TodoService) checkImportedName(user entity.User, name string, names map[string]bool) error {
+	if err := entity.NewTodoList(name, user.Id).Validate(); err != nil {
+		return err
+	}
+
+	key := strings.ToLower(name)
+	if names[key] {
+		return ErrListAlreadyExists
+	}
+
+	names[key] = true
+	exists, err := this.storage.listExists(name, user.Id)
+	if err == nil && exists {
+		err = ErrListAlreadyExists
+	}
+
+	return err
+}
+
+// prepareImported stores the details of the todos in the form the add form does and validates
+// them, counting the todos in count. Subtasks nested deeper than the service allows are refused.
+func (this *TodoService) prepareImported(todos []entity.Todo, depth int, count *int) ([]entity.Todo, error) {
+	for i, todo := range todos {
+		if depth > this.options.MaxSubtaskDepth {
+			return todos, fmt.Errorf("Todo %q: %w", todo.Task, ErrSubtaskTooDeep)
+		}
+
+		details := TodoDetails{
+			Due:        todo.Due,
+			DueHasTime: todo.DueHasTime,
+			Priority:   todo.Priority,
+			Tags:       entity.ParseTags(strings.Join(todo.Tags, ",")),
+			Recurrence: todo.Recurrence,
+		}
+
+		prepared := details.apply(todo)
+		prepared.Depth = depth
+		if err := prepared.Validate(); err != nil {
+			return todos, fmt.Errorf("Todo %q: %w", todo.Task, err)
+		}
+
+		*count++
+		subtasks, err := this.prepareImported(todo.Subtasks, depth+1, count)
+		if err != nil {
+			return todos, err
+		}
+
+		prepared.Subtasks = subtasks
+		todos[i] = prepared
+	}
+
+	return todos, nil
+}
+
+// Import adds the todos of a file in the format, checked like ParseImport does, in one
+// transaction. It returns how many todos were added.
+func (this *TodoService) Import(user entity.User, listId int, format string, reader io.Reader) (int, error) {
+	lists, err := this.ParseImport(user, listId, format, reader)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = this.storage.transaction(func(storage *todoStorage) error {
+		if listId != 0 {
+			if err := this.lockList(storage, user, listId); err != nil {
+				return err
+			}
+		}
+
+		for _, list := range lists {
+			targetId := listId
+			if targetId == 0 {
+				newId, err := storage.insertTodoList(entity.NewTodoList(list.Name, user.Id))
+				if err != nil {
+					return fmt.Errorf("List %q: %w", list.Name, err)
+				}
+
+				targetId = newId
+				if err = storage.insertActivity(entity.NewListActivity(entity.ActivityCreated, user, targetId)); err != nil {
+					return err
+				}
+			}
+
+			added, err := this.insertImported(storage, user, targetId, 0, list.Todos)
+			if err != nil {
+				return err
+			}
+
+			count += added
+		}
+
+		if listId == 0 {
+			return nil
+		}
+
+		return storage.notify(TodoEvent{ListId: listId})
+	})
+
+	return count, err
+}
+
+// insertImported adds the todos under the parent with their tags and subtasks. It returns how many
+// todos were added.
+func (this *TodoService) insertImported(storage *todoStorage, user entity.User, listId int, parentId int, todos []entity.Todo) (int, error) {
+	count := 0
+	for _, todo := range todos {
+		todo.TodoListId = listId
+		todo.ParentId = parentId
+		todoId, err := storage.insertTodo(todo, user.Id)
+		if err != nil {
+			return count, err
+		}
+
+		todo.Id = todoId
+		if err = storage.setTodoTags(todoId, todo.Tags); err != nil {
+			return count, err
+		}
+
+		if err = storage.insertActivity(entity.NewTodoActivity(entity.ActivityCreated, user, todo)); err != nil {
+			return count, err
+		}
+
+		added, err := this.insertImported(storage, user, listId, todoId, todo.Subtasks)
+		if err != nil {
+			return count, err
+		}
+
+		count += 1 + added
+	}
+
+	return count, nil
+}